@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	gqlast "github.com/vektah/gqlparser/v2/ast"
+)
+
+// canonicalHash identifies an operation by the sha256 of its canonical document: parsed,
+// with aliases dropped and fields, arguments, directives, variable definitions and
+// fragments in sorted order, so operations that differ only in formatting, comments,
+// aliases or ordering hash the same. Text that does not parse is hashed normalized, and
+// operations without text by their type, name, variables and fields.
+func canonicalHash(op *GraphQLOperation) string {
+	var key string
+	if strings.TrimSpace(op.Raw) == "" {
+		key = createOperationKey(op)
+	} else if doc, err := parseGraphQLDocument(op.Raw); err == nil {
+		key = printCanonicalDocument(doc)
+	} else {
+		key = normalizeGraphQL(op.Raw)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// printCanonicalDocument puts a parsed document in canonical form in place and prints
+// it. Operations keep their order; fragments follow them sorted by name.
+func printCanonicalDocument(doc *gqlast.QueryDocument) string {
+	var parts []string
+	for _, def := range doc.Operations {
+		sortVariableDefinitions(def.VariableDefinitions)
+		canonicalizeDirectives(def.Directives)
+		def.SelectionSet = canonicalizeSelections(def.SelectionSet)
+		parts = append(parts, printOperation(def))
+	}
+	sort.SliceStable(doc.Fragments, func(i, j int) bool {
+		return doc.Fragments[i].Name < doc.Fragments[j].Name
+	})
+	for _, def := range doc.Fragments {
+		sortVariableDefinitions(def.VariableDefinition)
+		canonicalizeDirectives(def.Directives)
+		def.SelectionSet = canonicalizeSelections(def.SelectionSet)
+		parts = append(parts, printFragment(def))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// sortVariableDefinitions sorts variable definitions by name
+func sortVariableDefinitions(defs gqlast.VariableDefinitionList) {
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Variable < defs[j].Variable
+	})
+}
+
+// canonicalizeSelections drops aliases, sorts arguments and directives, and returns the
+// selections sorted by their printed form
+func canonicalizeSelections(selections gqlast.SelectionSet) gqlast.SelectionSet {
+	printed := make(map[gqlast.Selection]string, len(selections))
+	for _, selection := range selections {
+		switch s := selection.(type) {
+		case *gqlast.Field:
+			s.Alias = s.Name
+			sortArguments(s.Arguments)
+			canonicalizeDirectives(s.Directives)
+			s.SelectionSet = canonicalizeSelections(s.SelectionSet)
+		case *gqlast.InlineFragment:
+			canonicalizeDirectives(s.Directives)
+			s.SelectionSet = canonicalizeSelections(s.SelectionSet)
+		case *gqlast.FragmentSpread:
+			canonicalizeDirectives(s.Directives)
+		}
+		printed[selection] = printSelection(selection)
+	}
+	sort.SliceStable(selections, func(i, j int) bool {
+		return printed[selections[i]] < printed[selections[j]]
+	})
+	return selections
+}
+
+// canonicalizeDirectives sorts directives by name and their arguments
+func canonicalizeDirectives(directives gqlast.DirectiveList) {
+	for _, d := range directives {
+		sortArguments(d.Arguments)
+	}
+	sort.SliceStable(directives, func(i, j int) bool {
+		return directives[i].Name < directives[j].Name
+	})
+}
+
+// sortArguments sorts arguments by name
+func sortArguments(args gqlast.ArgumentList) {
+	sort.Slice(args, func(i, j int) bool {
+		return args[i].Name < args[j].Name
+	})
+}
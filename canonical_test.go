@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestCanonicalHashEquivalent(t *testing.T) {
+	base := canonicalHash(&GraphQLOperation{Raw: `query Q($b: Int, $a: ID) { user(id: $a, first: $b) { name id } posts { title } }`})
+	for _, raw := range []string{
+		// Reformatted, with comments
+		"query Q(\n  $b: Int\n  $a: ID\n) {\n  # the user\n  user(id: $a, first: $b) {\n    name\n    id\n  }\n  posts {\n    title\n  }\n}",
+		// Variables, arguments and fields reordered
+		`query Q($a: ID, $b: Int) { posts { title } user(first: $b, id: $a) { id name } }`,
+		// Aliased
+		`query Q($b: Int, $a: ID) { u: user(id: $a, first: $b) { name id } posts { title } }`,
+	} {
+		if got := canonicalHash(&GraphQLOperation{Raw: raw}); got != base {
+			t.Errorf("canonicalHash(%q) differs from the original", raw)
+		}
+	}
+}
+
+func TestCanonicalHashDistinct(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"different fields", `{ a }`, `{ b }`},
+		{"hash sign in strings", `{ a(s: "#one") }`, `{ a(s: "#two") }`},
+		{"braces in strings", `{ a(s: "{x}") }`, `{ a(s: "{y}") }`},
+		{"unparseable, hash sign in strings", `query Q { a(s: "# one") `, `query Q { a(s: "# two") `},
+		{"unparseable, braces in strings", `query Q { a(s: "} {") `, `query Q { a(s: "}{") `},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if canonicalHash(&GraphQLOperation{Raw: tt.a}) == canonicalHash(&GraphQLOperation{Raw: tt.b}) {
+				t.Errorf("%q and %q hash the same", tt.a, tt.b)
+			}
+		})
+	}
+}
+
+func TestNormalizeGraphQLUnparseable(t *testing.T) {
+	tests := map[string]string{
+		"query Q { # comment\n  a(s: \"# kept  {  }\")\n":   `query Q{a(s:"# kept  {  }")`,
+		"query Q {\n  a ( first : 10 ) {\n    b\n  \n":      `query Q{a(first:10){b`,
+		"query Q { a(s: \"\"\"block # kept\"\"\") # gone\n": `query Q{a(s:"""block # kept""")`,
+	}
+	for raw, want := range tests {
+		if got := normalizeGraphQL(raw); got != want {
+			t.Errorf("normalizeGraphQL(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
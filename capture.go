@@ -3,16 +3,27 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/http/cookiejar"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/mafredri/cdp"
@@ -29,11 +40,62 @@ type DevToolsResponse struct {
 
 // GraphQLCapture represents a captured GraphQL request/response pair
 type GraphQLCapture struct {
-	Query     string                 `json:"query"`
-	Variables map[string]interface{} `json:"variables,omitempty"`
-	Response  interface{}            `json:"response,omitempty"`
-	Timestamp time.Time             `json:"timestamp"`
-	URL       string                `json:"url"`
+	Query              string                 `json:"query"`
+	OperationName      string                 `json:"operationName,omitempty"`
+	SelectedOperation  string                 `json:"selectedOperation,omitempty"` // Operation operationName picked from a multi-operation query
+	Variables          map[string]interface{} `json:"variables,omitempty"`
+	Response           interface{}            `json:"response,omitempty"`
+	Timestamp          time.Time              `json:"timestamp"`
+	URL                string                 `json:"url"`
+	PageURL            string                 `json:"pageUrl,omitempty"` // Page the browser had loaded when the request was sent
+	Status             int                    `json:"status,omitempty"`
+	DurationMs         float64                `json:"durationMs,omitempty"`
+	ResponseSize       int64                  `json:"responseSize,omitempty"`
+	ContentType        string                 `json:"contentType,omitempty"`
+	Method             string                 `json:"method,omitempty"`
+	RequestHeaders     map[string]string      `json:"requestHeaders,omitempty"`
+	RequestBody        string                 `json:"requestBody,omitempty"`
+	PersistedQueryHash string                 `json:"persistedQueryHash,omitempty"`
+	UploadVariables    []string               `json:"uploadVariables,omitempty"` // Variable paths carrying files in multipart uploads
+	ResponseHeaders    map[string]string      `json:"responseHeaders,omitempty"`
+	ResponseBody       string                 `json:"-"`
+	StartedAt          time.Time              `json:"startedAt,omitempty"`
+	Timings            *CaptureTimings        `json:"timings,omitempty"`
+	Pending            bool                   `json:"pending,omitempty"`
+	BodyUnavailable    bool                   `json:"bodyUnavailable,omitempty"`
+	ResponseInferred   bool                   `json:"responseInferred,omitempty"`
+	HasErrors          bool                   `json:"hasErrors,omitempty"`
+	Errors             []GraphQLError         `json:"errors,omitempty"`
+	DynamicOnly        bool                   `json:"dynamicOnly,omitempty"` // Matches no operation found in JavaScript
+	SSRState           string                 `json:"ssrState,omitempty"`    // Page global the capture was read from instead of a request, e.g. __APOLLO_STATE__
+	SSRCache           bool                   `json:"ssrCache,omitempty"`    // Query rebuilt from an Apollo cache, which the page never sent
+}
+
+// GraphQLError represents an entry of a response's top-level errors array
+type GraphQLError struct {
+	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
+	Path    string `json:"path,omitempty"` // Response path the error applies to, e.g. viewer.orders.0
+}
+
+// CaptureTimings breaks down where the time of a request went, in milliseconds.
+// Phases that did not apply (e.g. DNS on a reused connection) are -1.
+type CaptureTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+}
+
+// pendingRequest holds a GraphQL request until its response arrives
+type pendingRequest struct {
+	request   *network.Request
+	timestamp network.MonotonicTime
+	wallTime  time.Time
+	seen      time.Time // Local time the request was seen, for --request-ttl eviction
+	page      string    // URL of the page that sent the request
 }
 
 // Progress tracks the progress of the extraction
@@ -41,13 +103,29 @@ type Progress struct {
 	JSFilesFound      int32
 	JSFilesProcessed  int32
 	JSFilesDownloaded int32
+	JSCacheHits       int32 // JS files served from --cache-dir after the server answered 304
+	JSCacheBytes      int64 // Size of the cached bodies reused instead of downloaded
 	TotalBytesDownloaded int64
-	QueriesFound      int32
-	MutationsFound    int32
+	QueriesFound      int32 // Unique queries found in JS, by operation key
+	MutationsFound    int32 // Unique mutations found in JS, by operation key
+	SubscriptionsFound int32 // Unique subscriptions found in JS, by operation key
+	OperationsMatched int32 // Every operation extracted from JS, before deduplication
 	NetworkCaptures   int32
+	WebhookFailures   int32
+	NoiseFiltered     int32 // Captures and operations dropped by --ignore-noise
+	JSFilesSkipped    int32 // Third-party JS files skipped by --same-origin
+	JSFilesTooLarge   int32 // JS files skipped by --max-js-size
+	ParseFailures     int32 // Operation-like text in JS that failed to parse
+	DuplicateJSSkipped int32 // JS files skipped because identical content was already processed
+	DuplicateJSBytes  int64 // Size of the skipped duplicates
+	UnchangedJSSkipped int32 // JS files skipped by --resume because an earlier run processed them
+	LastActivity      int64 // Unix nanoseconds of the last response the browser received, for --finish-after-idle
 	StartTime         time.Time
+	Quiet             bool // Render a single updating line and suppress per-file logs
+	Verbose           bool // Also log every network capture
 	mu                sync.Mutex
 	jsFileList        []string
+	operationKeys     map[string]bool
 }
 
 func (p *Progress) AddJSFile(url string) {
@@ -57,7 +135,84 @@ func (p *Progress) AddJSFile(url string) {
 	atomic.AddInt32(&p.JSFilesFound, 1)
 }
 
+// JSFiles returns the distinct JS file URLs found so far, in the order they were found
+func (p *Progress) JSFiles() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return appendUnique(nil, p.jsFileList...)
+}
+
+// RecordOperation counts an operation extracted from JS, adding it to the per-type
+// counters only the first time its operation key is seen. It reports whether the
+// operation was new.
+func (p *Progress) RecordOperation(op *GraphQLOperation) bool {
+	atomic.AddInt32(&p.OperationsMatched, 1)
+	key := createOperationKey(op)
+
+	p.mu.Lock()
+	if p.operationKeys == nil {
+		p.operationKeys = make(map[string]bool)
+	}
+	seen := p.operationKeys[key]
+	p.operationKeys[key] = true
+	p.mu.Unlock()
+	if seen {
+		return false
+	}
+
+	switch op.Type {
+	case Query:
+		atomic.AddInt32(&p.QueriesFound, 1)
+	case Mutation:
+		atomic.AddInt32(&p.MutationsFound, 1)
+	case Subscription:
+		atomic.AddInt32(&p.SubscriptionsFound, 1)
+	}
+	return true
+}
+
+// Report renders the current progress, as one updating line in quiet mode and as a
+// multi-line log entry otherwise
 func (p *Progress) Report() {
+	if p.Quiet {
+		p.reportLine()
+		return
+	}
+	p.reportLog()
+}
+
+// Finish renders the final progress and ends the updating line in quiet mode
+func (p *Progress) Finish() {
+	p.Report()
+	if p.Quiet {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// Log logs per-file detail unless quiet mode is rendering a progress line instead
+func (p *Progress) Log(msg string, args ...interface{}) {
+	if !p.Quiet {
+		slog.Info(msg, args...)
+	}
+}
+
+// reportLine redraws the single progress line on stderr
+func (p *Progress) reportLine() {
+	found := atomic.LoadInt32(&p.JSFilesFound)
+	processed := atomic.LoadInt32(&p.JSFilesProcessed)
+	bytes := atomic.LoadInt64(&p.TotalBytesDownloaded)
+	queries := atomic.LoadInt32(&p.QueriesFound)
+	mutations := atomic.LoadInt32(&p.MutationsFound)
+	subscriptions := atomic.LoadInt32(&p.SubscriptionsFound)
+	captures := atomic.LoadInt32(&p.NetworkCaptures)
+
+	fmt.Fprintf(os.Stderr, "\r\033[K[%s] JS %d/%d | %d queries, %d mutations, %d subscriptions | %d captures | %.2f MB",
+		time.Since(p.StartTime).Round(time.Second), processed, found, queries, mutations, subscriptions, captures,
+		float64(bytes)/(1024*1024))
+}
+
+// reportLog writes a multi-line progress report through the logger
+func (p *Progress) reportLog() {
 	elapsed := time.Since(p.StartTime)
 	found := atomic.LoadInt32(&p.JSFilesFound)
 	processed := atomic.LoadInt32(&p.JSFilesProcessed)
@@ -67,33 +222,81 @@ func (p *Progress) Report() {
 	mutations := atomic.LoadInt32(&p.MutationsFound)
 	captures := atomic.LoadInt32(&p.NetworkCaptures)
 	
-	log.Printf("Progress Report [%s elapsed]:", elapsed.Round(time.Second))
-	log.Printf("  JS Files: %d found, %d downloaded, %d processed", found, downloaded, processed)
-	log.Printf("  Data: %.2f MB downloaded", float64(bytes)/(1024*1024))
-	log.Printf("  GraphQL: %d queries, %d mutations found", queries, mutations)
-	log.Printf("  Network: %d GraphQL requests captured", captures)
+	attrs := []interface{}{
+		"elapsed", elapsed.Round(time.Second).String(),
+		"jsFound", found,
+		"jsDownloaded", downloaded,
+		"jsProcessed", processed,
+		"bytesDownloaded", bytes,
+		"uniqueQueries", queries,
+		"uniqueMutations", mutations,
+		"uniqueSubscriptions", atomic.LoadInt32(&p.SubscriptionsFound),
+		"operationsMatched", atomic.LoadInt32(&p.OperationsMatched),
+		"captures", captures,
+	}
+	// Counters that are usually zero are only included once they are not
+	for _, counter := range []struct {
+		key   string
+		value int64
+	}{
+		{"jsCacheHits", int64(atomic.LoadInt32(&p.JSCacheHits))},
+		{"jsCacheBytes", atomic.LoadInt64(&p.JSCacheBytes)},
+		{"webhookFailures", int64(atomic.LoadInt32(&p.WebhookFailures))},
+		{"jsThirdPartySkipped", int64(atomic.LoadInt32(&p.JSFilesSkipped))},
+		{"jsTooLarge", int64(atomic.LoadInt32(&p.JSFilesTooLarge))},
+		{"jsDuplicates", int64(atomic.LoadInt32(&p.DuplicateJSSkipped))},
+		{"jsDuplicateBytes", atomic.LoadInt64(&p.DuplicateJSBytes)},
+		{"jsUnchanged", int64(atomic.LoadInt32(&p.UnchangedJSSkipped))},
+		{"noiseIgnored", int64(atomic.LoadInt32(&p.NoiseFiltered))},
+		{"parseFailures", int64(atomic.LoadInt32(&p.ParseFailures))},
+	} {
+		if counter.value > 0 {
+			attrs = append(attrs, counter.key, counter.value)
+		}
+	}
 	
 	// Show current processing files
 	p.mu.Lock()
 	if processed < found && int(processed) < len(p.jsFileList) {
-		log.Printf("  Currently processing: %s", p.jsFileList[processed])
+		attrs = append(attrs, "processing", p.jsFileList[processed])
 	}
 	p.mu.Unlock()
+
+	slog.Info("Progress report", attrs...)
+}
+
+// lineClearingWriter clears the quiet-mode progress line before each log message so
+// the two do not run together
+type lineClearingWriter struct {
+	out io.Writer
+}
+
+func (w lineClearingWriter) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(w.out, "\r\033[K"); err != nil {
+		return 0, err
+	}
+	return w.out.Write(b)
 }
 
-// Setup Selenium WebDriver using the locally running ChromeDriver and DevTools Protocol
-func setupSelenium() (selenium.WebDriver, func(), *cdp.Client, error) {
+// Setup Selenium WebDriver using the locally running ChromeDriver and DevTools Protocol.
+// A non-nil proxyURL sends the browser's traffic through that upstream proxy.
+func setupSelenium(proxyURL *url.URL) (selenium.WebDriver, func(), *cdp.Client, error) {
 	const seleniumPath = "http://localhost:4444"
 
+	args := []string{
+		"--disable-gpu",
+		"--no-sandbox",
+		"--remote-debugging-port=9222",
+	}
+	if proxyURL != nil {
+		args = append(args, chromeProxyArgs(proxyURL)...)
+	}
+
 	// Configure ChromeOptions directly in capabilities
 	caps := selenium.Capabilities{
 		"browserName": "chrome",
 		"goog:chromeOptions": map[string]interface{}{
-			"args": []string{
-				"--disable-gpu",
-				"--no-sandbox",
-				"--remote-debugging-port=9222",
-			},
+			"args": args,
 		},
 	}
 
@@ -102,7 +305,7 @@ func setupSelenium() (selenium.WebDriver, func(), *cdp.Client, error) {
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to open session: %v", err)
 	}
-	log.Println("Selenium session started.")
+	slog.Info("Selenium session started")
 
 	// Create a new Chrome DevTools Protocol client
 	devt := devtool.New("http://localhost:9222")
@@ -122,16 +325,16 @@ func setupSelenium() (selenium.WebDriver, func(), *cdp.Client, error) {
 
 	client := cdp.NewClient(conn)
 	return wd, func() {
-		log.Println("Closing Selenium session and Chrome DevTools connection.")
+		slog.Info("Closing Selenium session and Chrome DevTools connection")
 		wd.Quit()
 		conn.Close()
 	}, client, nil
 }
 
-// Capture all network requests to identify JavaScript files and GraphQL requests
-func captureNetworkTraffic(client *cdp.Client, jsURLs chan string, gqlCaptures chan GraphQLCapture, progress *Progress) error {
-	ctx := context.Background()
-
+// captureNetworkTraffic captures all network requests to identify JavaScript files and
+// GraphQL requests. Events are processed in the background until ctx is done or the
+// browser closes, then both channels are closed.
+func captureNetworkTraffic(ctx context.Context, client *cdp.Client, jsURLs chan string, gqlCaptures chan GraphQLCapture, origins *OriginFilter, scripts *JSContentIndex, tracker *networkTracker, requestTTL time.Duration, handler CaptureHandler, progress *Progress) error {
 	// Enable network events
 	if err := client.Network.Enable(ctx, nil); err != nil {
 		return fmt.Errorf("failed to enable network tracking: %v", err)
@@ -148,92 +351,313 @@ func captureNetworkTraffic(client *cdp.Client, jsURLs chan string, gqlCaptures c
 		return fmt.Errorf("failed to subscribe to network requests: %v", err)
 	}
 
-	log.Println("Started capturing network traffic.")
+	failedStream, err := client.Network.LoadingFailed(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to network failures: %v", err)
+	}
+
+	finishedStream, err := client.Network.LoadingFinished(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to finished requests: %v", err)
+	}
+
+	slog.Info("Started capturing network traffic")
 
 	// Process network events in a separate goroutine
-	go func() {
-		defer close(jsURLs)
-		defer close(gqlCaptures)
+	events := networkEvents{
+		requests:  requestStream,
+		responses: responseStream,
+		failed:    failedStream,
+		finished:  finishedStream,
+		responseBody: func(ctx context.Context, id network.RequestID) (string, error) {
+			reply, err := client.Network.GetResponseBody(ctx, &network.GetResponseBodyArgs{RequestID: id})
+			if err != nil {
+				return "", err
+			}
+			return reply.Body, nil
+		},
+	}
+	go processNetworkEvents(ctx, events, jsURLs, gqlCaptures, origins, scripts, tracker, requestTTL, handler, progress)
 
-		// Map to store request data temporarily
-		requests := make(map[network.RequestID]*network.Request)
+	return nil
+}
 
-		for {
-			select {
-			case <-requestStream.Ready():
-				req, err := requestStream.Recv()
-				if err != nil {
-					return
-				}
-				
-				// Store request data
-				requests[req.RequestID] = &req.Request
-
-				// Check if it's a potential GraphQL request
-				if isGraphQLRequest(&req.Request) {
-					capture := GraphQLCapture{
-						Query:     extractQueryFromRequest(&req.Request),
-						Variables: extractVariablesFromRequest(&req.Request),
-						Timestamp: time.Now(),
-						URL:       req.Request.URL,
-					}
-					
-					if capture.Query != "" {
-						atomic.AddInt32(&progress.NetworkCaptures, 1)
-						gqlCaptures <- capture
-					}
+// networkEvents are the CDP event streams the capture goroutine reads
+type networkEvents struct {
+	requests     network.RequestWillBeSentClient
+	responses    network.ResponseReceivedClient
+	failed       network.LoadingFailedClient
+	finished     network.LoadingFinishedClient
+	responseBody func(ctx context.Context, id network.RequestID) (string, error)
+}
+
+// processNetworkEvents turns network events into JS URLs and GraphQL captures until
+// ctx is done or a stream fails, then closes both channels
+func processNetworkEvents(ctx context.Context, events networkEvents, jsURLs chan string, gqlCaptures chan GraphQLCapture, origins *OriginFilter, scripts *JSContentIndex, tracker *networkTracker, requestTTL time.Duration, handler CaptureHandler, progress *Progress) {
+	defer close(jsURLs)
+	defer close(gqlCaptures)
+
+	// GraphQL requests waiting for their response
+	requests := make(map[network.RequestID]*pendingRequest)
+
+	// Emit a request whose response never arrived instead of losing it
+	emitPending := func(pending *pendingRequest) {
+		capture := newCapture(pending.request)
+		capture.StartedAt = pending.wallTime
+		capture.PageURL = pending.page
+		capture.Pending = true
+		if identifiesOperation(capture) {
+			atomic.AddInt32(&progress.NetworkCaptures, 1)
+			runCaptureHandler(handler, capture)
+			gqlCaptures <- capture
+		}
+	}
+	defer func() {
+		for _, pending := range requests {
+			emitPending(pending)
+		}
+	}()
+
+	// Stop waiting for responses after --request-ttl so aborted requests do not
+	// accumulate over long sessions
+	var evict <-chan time.Time
+	if requestTTL > 0 {
+		ticker := time.NewTicker(min(requestTTL, 10*time.Second))
+		defer ticker.Stop()
+		evict = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case now := <-evict:
+			for id, pending := range requests {
+				if now.Sub(pending.seen) > requestTTL {
+					delete(requests, id)
+					emitPending(pending)
 				}
+			}
 
-			case <-responseStream.Ready():
-				resp, err := responseStream.Recv()
-				if err != nil {
-					return
+		case <-events.requests.Ready():
+			req, err := events.requests.Recv()
+			if err != nil {
+				return
+			}
+			tracker.Started(req.RequestID)
+
+			// Keep GraphQL requests until the response arrives
+			if isGraphQLRequest(&req.Request) {
+				requests[req.RequestID] = &pendingRequest{
+					request:   &req.Request,
+					timestamp: req.Timestamp,
+					wallTime:  req.WallTime.Time(),
+					seen:      time.Now(),
+					page:      req.DocumentURL,
 				}
+			}
 
-				// Handle JavaScript files
-				if strings.HasSuffix(resp.Response.URL, ".js") {
+		case <-events.responses.Ready():
+			resp, err := events.responses.Recv()
+			if err != nil {
+				return
+			}
+			atomic.StoreInt64(&progress.LastActivity, time.Now().UnixNano())
+
+			// Handle JavaScript files and pages with inline scripts, skipping
+			// third-party ones with --same-origin
+			if isScriptResponse(resp.Response.URL, resp.Response.MimeType) ||
+				(resp.Type == network.ResourceTypeDocument && isHTMLResponse(resp.Response.MimeType)) {
+				if origins.Allows(resp.Response.URL) {
+					if headers, err := resp.Response.Headers.Map(); err == nil {
+						scripts.Observe(resp.Response.URL, headers)
+					}
 					progress.AddJSFile(resp.Response.URL)
 					jsURLs <- resp.Response.URL
+				} else {
+					atomic.AddInt32(&progress.JSFilesSkipped, 1)
 				}
+			}
 
-				// Handle GraphQL responses
-				req, exists := requests[resp.RequestID]
-				if exists && isGraphQLRequest(req) {
-					responseBody, err := client.Network.GetResponseBody(ctx, &network.GetResponseBodyArgs{
-						RequestID: resp.RequestID,
-					})
-					if err == nil && responseBody.Body != "" {
-						var responseData interface{}
-						if err := json.Unmarshal([]byte(responseBody.Body), &responseData); err == nil {
-							capture := GraphQLCapture{
-								Query:     extractQueryFromRequest(req),
-								Variables: extractVariablesFromRequest(req),
-								Response:  responseData,
-								Timestamp: time.Now(),
-								URL:       resp.Response.URL,
-							}
-							
-							if capture.Query != "" {
-								atomic.AddInt32(&progress.NetworkCaptures, 1)
-								gqlCaptures <- capture
-							}
-						}
-					}
-				}
+			// Handle GraphQL responses
+			pending, exists := requests[resp.RequestID]
+			if !exists {
+				continue
+			}
+			delete(requests, resp.RequestID)
+
+			body, err := events.responseBody(ctx, resp.RequestID)
+			capture := completeCapture(pending, resp, body, err)
+
+			if identifiesOperation(capture) {
+				atomic.AddInt32(&progress.NetworkCaptures, 1)
+				runCaptureHandler(handler, capture)
+				gqlCaptures <- capture
+			}
+
+		case <-events.failed.Ready():
+			failed, err := events.failed.Recv()
+			if err != nil {
+				return
+			}
+			tracker.Finished(failed.RequestID)
+
+			// The response will never arrive; emit what we know and stop tracking it
+			pending, exists := requests[failed.RequestID]
+			if !exists {
+				continue
+			}
+			delete(requests, failed.RequestID)
 
-				// Cleanup request data
-				delete(requests, resp.RequestID)
+			emitPending(pending)
+
+		case <-events.finished.Ready():
+			finished, err := events.finished.Recv()
+			if err != nil {
+				return
 			}
+			tracker.Finished(finished.RequestID)
 		}
-	}()
+	}
+}
 
-	return nil
+// completeCapture builds the capture for a GraphQL request whose response arrived.
+// bodyErr is the error from fetching the response body; the capture keeps its query
+// and response metadata even when the body is unavailable.
+func completeCapture(pending *pendingRequest, resp *network.ResponseReceivedReply, body string, bodyErr error) GraphQLCapture {
+	capture := newCapture(pending.request)
+	capture.URL = resp.Response.URL
+	capture.Status = resp.Response.Status
+	capture.ResponseSize = int64(resp.Response.EncodedDataLength)
+	capture.ContentType = resp.Response.MimeType
+	if headers, err := resp.Response.Headers.Map(); err == nil {
+		capture.ResponseHeaders = headers
+	}
+	capture.StartedAt = pending.wallTime
+	capture.PageURL = pending.page
+	if pending.timestamp > 0 && resp.Timestamp >= pending.timestamp {
+		capture.DurationMs = float64(resp.Timestamp-pending.timestamp) * 1000
+	}
+	if resp.Response.Timing != nil {
+		capture.Timings = newCaptureTimings(resp.Response.Timing)
+	}
+
+	if bodyErr != nil || body == "" {
+		capture.BodyUnavailable = true
+		return capture
+	}
+
+	setResponseBody(&capture, body)
+	return capture
+}
+
+// setResponseBody stores a response body on a capture along with its parsed errors
+func setResponseBody(capture *GraphQLCapture, body string) {
+	capture.ResponseBody = body
+	if capture.ResponseSize == 0 {
+		capture.ResponseSize = int64(len(body))
+	}
+	var responseData interface{}
+	if err := json.Unmarshal([]byte(body), &responseData); err == nil {
+		capture.Response = responseData
+		capture.Errors = extractErrorsFromResponse(responseData)
+		capture.HasErrors = responseHasErrors(responseData)
+	}
+}
+
+// backfillResponses gives captures whose response body was evicted the response of another
+// capture of the same operation on the same endpoint
+func backfillResponses(captures []GraphQLCapture) {
+	responses := make(map[string]interface{})
+	for _, capture := range captures {
+		if capture.Response != nil && capture.OperationName != "" {
+			responses[capture.OperationName+"|"+endpointURL(capture.URL)] = capture.Response
+		}
+	}
+
+	for i := range captures {
+		capture := &captures[i]
+		if !capture.BodyUnavailable || capture.Response != nil || capture.OperationName == "" {
+			continue
+		}
+		if response, ok := responses[capture.OperationName+"|"+endpointURL(capture.URL)]; ok {
+			capture.Response = response
+			capture.ResponseInferred = true
+		}
+	}
+}
+
+// newCaptureTimings converts CDP resource timing into per-phase durations
+func newCaptureTimings(t *network.ResourceTiming) *CaptureTimings {
+	phase := func(start, end float64) float64 {
+		if start < 0 || end < start {
+			return -1
+		}
+		return end - start
+	}
+
+	timings := &CaptureTimings{
+		Blocked: -1,
+		DNS:     phase(t.DNSStart, t.DNSEnd),
+		Connect: phase(t.ConnectStart, t.ConnectEnd),
+		SSL:     phase(t.SSLStart, t.SSLEnd),
+		Send:    phase(t.SendStart, t.SendEnd),
+		Wait:    phase(t.SendEnd, t.ReceiveHeadersEnd),
+	}
+
+	// Time spent queued before the first network activity
+	for _, start := range []float64{t.DNSStart, t.ConnectStart, t.SendStart} {
+		if start >= 0 {
+			timings.Blocked = start
+			break
+		}
+	}
+
+	return timings
+}
+
+// newCapture builds a capture from the request side of a GraphQL exchange
+func newCapture(req *network.Request) GraphQLCapture {
+	capture := GraphQLCapture{
+		Query:         extractQueryFromRequest(req),
+		OperationName: extractOperationNameFromRequest(req),
+		Variables:     extractVariablesFromRequest(req),
+		Timestamp:     time.Now(),
+		URL:           req.URL,
+		Method:        req.Method,
+	}
+	if headers, err := req.Headers.Map(); err == nil {
+		capture.RequestHeaders = headers
+	}
+	if req.PostData != nil {
+		capture.RequestBody = *req.PostData
+	}
+	capture.PersistedQueryHash = extractPersistedQueryHash(req)
+	capture.UploadVariables = extractUploadVariables(req)
+
+	capture.SelectedOperation = selectOperation(capture.Query, capture.OperationName)
+
+	// Fall back to the name declared in the query document
+	if capture.OperationName == "" && capture.Query != "" {
+		if op, err := ParseGraphQLOperation(capture.Query); err == nil {
+			capture.OperationName = op.Name
+		}
+	}
+
+	return capture
+}
+
+// identifiesOperation reports whether a capture names the operation it ran, by its query
+// text or, for an APQ request that sent only the hash, by its persisted query hash
+func identifiesOperation(capture GraphQLCapture) bool {
+	return capture.Query != "" || capture.PersistedQueryHash != ""
 }
 
 // Helper functions for GraphQL request handling
 func isGraphQLRequest(req *network.Request) bool {
 	// Check URL path
-	if strings.Contains(strings.ToLower(req.URL), "graphql") {
+	if isGraphQLURL(req.URL) {
 		return true
 	}
 
@@ -246,6 +670,11 @@ func isGraphQLRequest(req *network.Request) bool {
 		}
 	}
 
+	// Check for a GraphQL-shaped JSON body, whatever the URL
+	if req.Method == "POST" && hasGraphQLBody(requestPayload(req)) {
+		return true
+	}
+
 	// Check request body for GraphQL keywords
 	if req.PostData != nil {
 		return strings.Contains(*req.PostData, "query") || strings.Contains(*req.PostData, "mutation")
@@ -254,98 +683,693 @@ func isGraphQLRequest(req *network.Request) bool {
 	return false
 }
 
-func extractQueryFromRequest(req *network.Request) string {
+// isGraphQLURL reports whether a URL contains "graphql" or matches an --endpoint-pattern
+func isGraphQLURL(rawURL string) bool {
+	if strings.Contains(strings.ToLower(rawURL), "graphql") {
+		return true
+	}
+	for _, pattern := range endpointPatterns {
+		if pattern.MatchString(rawURL) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasGraphQLBody reports whether a JSON request body (or the first request of a batch)
+// has a query key alongside operationName or variables, the shape GraphQL clients send
+func hasGraphQLBody(payload string) bool {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(firstOperation(payload)), &body); err != nil {
+		return false
+	}
+	if _, ok := body["query"]; !ok {
+		return false
+	}
+	_, hasName := body["operationName"]
+	_, hasVariables := body["variables"]
+	return hasName || hasVariables
+}
+
+// requestPayload returns the JSON body of a GraphQL request. For multipart file uploads
+// (graphql-multipart-request-spec) this is the "operations" form field, and for GET
+// requests it is rebuilt from the query string.
+func requestPayload(req *network.Request) string {
 	if req.PostData == nil {
-		return ""
+		return queryStringPayload(req.URL)
 	}
 
-	var requestData struct {
-		Query string `json:"query"`
+	mediaType, params, err := mime.ParseMediaType(requestHeader(req, "Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return *req.PostData
 	}
 
-	if err := json.Unmarshal([]byte(*req.PostData), &requestData); err != nil {
+	operations, _ := multipartFields(*req.PostData, params["boundary"])
+	return firstOperation(operations)
+}
+
+// queryStringPayload rebuilds the JSON body of a GraphQL GET request from its query,
+// operationName, variables and extensions parameters. Parameters that should hold JSON
+// but don't are left out.
+func queryStringPayload(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	params := parsed.Query()
+	if params.Get("query") == "" {
 		return ""
 	}
+	payload := map[string]interface{}{"query": params.Get("query")}
+	if name := params.Get("operationName"); name != "" {
+		payload["operationName"] = name
+	}
+	for _, key := range []string{"variables", "extensions"} {
+		if value := params.Get(key); value != "" && json.Valid([]byte(value)) {
+			payload[key] = json.RawMessage(value)
+		}
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
 
-	return requestData.Query
+// multipartFields reads the "operations" and "map" fields of a multipart upload body
+func multipartFields(body, boundary string) (operations, fileMap string) {
+	if boundary == "" {
+		return "", ""
+	}
+
+	reader := multipart.NewReader(strings.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		if name := part.FormName(); name == "operations" || name == "map" {
+			value, err := io.ReadAll(part)
+			if err != nil {
+				break
+			}
+			if name == "operations" {
+				operations = string(value)
+			} else {
+				fileMap = string(value)
+			}
+		}
+		part.Close()
+	}
+
+	return operations, fileMap
 }
 
-func extractVariablesFromRequest(req *network.Request) map[string]interface{} {
+// firstOperation unwraps a batched operations array to its first operation
+func firstOperation(operations string) string {
+	trimmed := strings.TrimSpace(operations)
+	if !strings.HasPrefix(trimmed, "[") {
+		return operations
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal([]byte(trimmed), &batch); err != nil || len(batch) == 0 {
+		return ""
+	}
+	return string(batch[0])
+}
+
+// extractUploadVariables lists the variable paths of a multipart request that carry
+// files, e.g. "variables.file" or "variables.files.0"
+func extractUploadVariables(req *network.Request) []string {
 	if req.PostData == nil {
 		return nil
 	}
 
-	var requestData struct {
-		Variables map[string]interface{} `json:"variables"`
+	mediaType, params, err := mime.ParseMediaType(requestHeader(req, "Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil
 	}
 
-	if err := json.Unmarshal([]byte(*req.PostData), &requestData); err != nil {
+	_, fileMap := multipartFields(*req.PostData, params["boundary"])
+	var mapping map[string][]string
+	if err := json.Unmarshal([]byte(fileMap), &mapping); err != nil {
 		return nil
 	}
 
-	return requestData.Variables
+	var paths []string
+	for _, targets := range mapping {
+		for _, target := range targets {
+			// Batched uploads prefix paths with the operation index
+			if i := strings.Index(target, "variables."); i > 0 {
+				target = target[i:]
+			}
+			paths = appendUnique(paths, target)
+		}
+	}
+	sort.Strings(paths)
+	return paths
 }
 
-// Download and save JavaScript content with progress tracking
-func downloadJS(jsURL string, progress *Progress) (string, error) {
-	log.Printf("Downloading: %s", jsURL)
-	
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-	
-	resp, err := client.Get(jsURL)
+// requestHeader looks up a request header case-insensitively
+func requestHeader(req *network.Request, name string) string {
+	headers, err := req.Headers.Map()
 	if err != nil {
-		return "", fmt.Errorf("failed to download JS: %v", err)
+		return ""
 	}
-	defer resp.Body.Close()
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read JS content: %v", err)
+func extractQueryFromRequest(req *network.Request) string {
+	payload := requestPayload(req)
+	if payload == "" {
+		return ""
 	}
 
-	size := int64(len(body))
-	atomic.AddInt64(&progress.TotalBytesDownloaded, size)
-	atomic.AddInt32(&progress.JSFilesDownloaded, 1)
-	
-	log.Printf("Downloaded: %s (%.2f KB)", jsURL, float64(size)/1024)
+	var requestData struct {
+		Query string `json:"query"`
+	}
+
+	if err := json.Unmarshal([]byte(payload), &requestData); err != nil {
+		return ""
+	}
 
-	return string(body), nil
+	return requestData.Query
 }
 
-// Extract GQL queries and mutations from JS content using the parser
-func extractGraphQL(content string, progress *Progress) ([]*GraphQLOperation, error) {
-	log.Println("Extracting GraphQL queries and mutations...")
-	
-	operations, err := ExtractOperationsFromJS(content)
-	if err != nil {
-		return nil, err
+func extractOperationNameFromRequest(req *network.Request) string {
+	payload := requestPayload(req)
+	if payload == "" {
+		return ""
 	}
-	
-	// Count operations by type
-	for _, op := range operations {
-		switch op.Type {
-		case Query:
-			atomic.AddInt32(&progress.QueriesFound, 1)
-		case Mutation:
-			atomic.AddInt32(&progress.MutationsFound, 1)
-		}
+
+	var requestData struct {
+		OperationName string `json:"operationName"`
 	}
 
-	log.Printf("Found %d operations (%d queries, %d mutations)", 
-		len(operations), 
-		atomic.LoadInt32(&progress.QueriesFound),
-		atomic.LoadInt32(&progress.MutationsFound))
+	if err := json.Unmarshal([]byte(payload), &requestData); err != nil {
+		return ""
+	}
 
-	return operations, nil
+	return requestData.OperationName
 }
 
-// Format GraphQL query with proper indentation and spacing
-func formatGraphQLQuery(query string) string {
-	query = strings.TrimSpace(query)
-	indent := 0
+func extractVariablesFromRequest(req *network.Request) map[string]interface{} {
+	payload := requestPayload(req)
+	if payload == "" {
+		return nil
+	}
+
+	var requestData struct {
+		Variables map[string]interface{} `json:"variables"`
+	}
+
+	if err := json.Unmarshal([]byte(payload), &requestData); err != nil {
+		return nil
+	}
+
+	return requestData.Variables
+}
+
+// extractPersistedQueryHash returns the APQ sha256Hash from the request body, or from the
+// extensions query parameter that Apollo uses for GET requests
+func extractPersistedQueryHash(req *network.Request) string {
+	type apqExtensions struct {
+		PersistedQuery struct {
+			Sha256Hash string `json:"sha256Hash"`
+		} `json:"persistedQuery"`
+	}
+
+	if payload := requestPayload(req); payload != "" {
+		var requestData struct {
+			Extensions apqExtensions `json:"extensions"`
+		}
+		if err := json.Unmarshal([]byte(payload), &requestData); err != nil {
+			return ""
+		}
+		return requestData.Extensions.PersistedQuery.Sha256Hash
+	}
+
+	parsed, err := url.Parse(req.URL)
+	if err != nil {
+		return ""
+	}
+	var extensions apqExtensions
+	if err := json.Unmarshal([]byte(parsed.Query().Get("extensions")), &extensions); err != nil {
+		return ""
+	}
+	return extensions.PersistedQuery.Sha256Hash
+}
+
+// responseHasErrors reports whether a response carries a non-empty top-level errors
+// key, whether or not it holds the usual array of error objects
+func responseHasErrors(response interface{}) bool {
+	respMap, ok := response.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	switch errors := respMap["errors"].(type) {
+	case nil:
+		return false
+	case []interface{}:
+		return len(errors) > 0
+	case map[string]interface{}:
+		return len(errors) > 0
+	case string:
+		return errors != ""
+	default:
+		return true
+	}
+}
+
+// extractErrorsFromResponse collects messages and extension codes from a response's errors array
+func extractErrorsFromResponse(response interface{}) []GraphQLError {
+	respMap, ok := response.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	rawErrors, ok := respMap["errors"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var errors []GraphQLError
+	for _, rawError := range rawErrors {
+		errMap, ok := rawError.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		gqlErr := GraphQLError{}
+		gqlErr.Message, _ = errMap["message"].(string)
+		if extensions, ok := errMap["extensions"].(map[string]interface{}); ok {
+			gqlErr.Code, _ = extensions["code"].(string)
+			if gqlErr.Code == "" {
+				// Spring and other Java servers report the kind of error as a classification
+				gqlErr.Code, _ = extensions["classification"].(string)
+			}
+		}
+		if path, ok := errMap["path"].([]interface{}); ok {
+			segments := make([]string, len(path))
+			for i, segment := range path {
+				segments[i] = fmt.Sprint(segment)
+			}
+			gqlErr.Path = strings.Join(segments, ".")
+		}
+		errors = append(errors, gqlErr)
+	}
+
+	return errors
+}
+
+// DownloadOptions configures how JavaScript files are fetched
+type DownloadOptions struct {
+	Client  *http.Client
+	Retries int
+	Cookie  string            // Manually supplied Cookie header value
+	Browser *cdp.Client       // Source of the browser session's cookies, may be nil
+	Cache   *JSCache          // On-disk cache revalidated with conditional requests, may be nil
+	Offline map[string]string // JS content by URL read from a HAR file; nothing is downloaded when set
+	MaxSize int64             // Files larger than this many bytes are skipped; 0 for no limit
+}
+
+// errJSTooLarge reports a JS file skipped because it exceeds --max-js-size
+var errJSTooLarge = errors.New("larger than --max-js-size")
+
+// JS URL deduplication modes for --dedup-js-mode
+const (
+	DedupJSExact = "exact" // Only identical URLs are skipped
+	DedupJSQuery = "query" // Query strings and fragments are ignored
+	DedupJSHash  = "hash"  // Content hashes in the file name are ignored too
+)
+
+// defaultJSHashPattern matches bundler content hashes such as main.3f2a1b9c.js or app-3f2a1b9c4d.chunk.js
+const defaultJSHashPattern = `[.-][0-9a-fA-F]{8,}\b`
+
+// jsDedupKey normalizes a JS URL for the already-processed check, so cache-busted
+// copies of the same bundle are only downloaded once
+func jsDedupKey(jsURL, mode string, hashPattern *regexp.Regexp) string {
+	if mode == DedupJSExact {
+		return jsURL
+	}
+	parsed, err := url.Parse(jsURL)
+	if err != nil {
+		return jsURL
+	}
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+
+	if mode == DedupJSHash && hashPattern != nil {
+		dir, file := path.Split(parsed.Path)
+		parsed.Path = dir + hashPattern.ReplaceAllString(file, "")
+		parsed.RawPath = ""
+	}
+
+	return parsed.String()
+}
+
+// newDownloadOptions creates download options with a shared cookie jar. A non-nil
+// proxyURL routes downloads through that upstream proxy, except for NO_PROXY hosts.
+func newDownloadOptions(retries int, cookie string, browser *cdp.Client, proxyURL *url.URL) *DownloadOptions {
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		Jar:     jar,
+	}
+	if proxyURL != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = upstreamProxyFunc(proxyURL)
+		client.Transport = transport
+	}
+	return &DownloadOptions{
+		Client:  client,
+		Retries: retries,
+		Cookie:  cookie,
+		Browser: browser,
+	}
+}
+
+// syncBrowserCookies copies the browser's cookies for jsURL into the download cookie jar
+func syncBrowserCookies(browser *cdp.Client, jar http.CookieJar, jsURL string) error {
+	parsed, err := url.Parse(jsURL)
+	if err != nil {
+		return err
+	}
+
+	reply, err := browser.Network.GetCookies(context.Background(), network.NewGetCookiesArgs().SetURLs([]string{jsURL}))
+	if err != nil {
+		return fmt.Errorf("failed to get browser cookies: %v", err)
+	}
+
+	cookies := make([]*http.Cookie, 0, len(reply.Cookies))
+	for _, c := range reply.Cookies {
+		cookies = append(cookies, &http.Cookie{Name: c.Name, Value: c.Value})
+	}
+	jar.SetCookies(parsed, cookies)
+
+	return nil
+}
+
+// Download and save JavaScript content with progress tracking. The download and its
+// retries stop as soon as ctx is done.
+func downloadJS(ctx context.Context, jsURL string, opts *DownloadOptions, progress *Progress) (string, error) {
+	if opts.Offline != nil {
+		content, ok := opts.Offline[jsURL]
+		if !ok {
+			return "", fmt.Errorf("failed to load JS: not recorded in the HAR file")
+		}
+		if opts.MaxSize > 0 && int64(len(content)) > opts.MaxSize {
+			atomic.AddInt32(&progress.JSFilesTooLarge, 1)
+			progress.Log("Skipping JS file", "url", jsURL, "reason", errJSTooLarge)
+			return "", errJSTooLarge
+		}
+		progress.Log("Loaded from HAR", "url", jsURL, "size", len(content))
+		return content, nil
+	}
+
+	progress.Log("Downloading", "url", jsURL)
+	
+	// Reuse the browser session's cookies so authenticated bundles are reachable
+	if opts.Browser != nil && opts.Client.Jar != nil {
+		if err := syncBrowserCookies(opts.Browser, opts.Client.Jar, jsURL); err != nil {
+			slog.Warn("Could not sync cookies", "url", jsURL, "error", err)
+		}
+	}
+	
+	// A cached copy is revalidated instead of downloaded again
+	var cached *jsCacheEntry
+	var cachedBody []byte
+	if opts.Cache != nil {
+		cached, cachedBody = opts.Cache.Lookup(jsURL)
+	}
+
+	var resp *jsResponse
+	for attempt := 0; ; attempt++ {
+		var retryAfter time.Duration
+		var retryable bool
+		var err error
+		resp, retryAfter, retryable, err = fetchJS(ctx, opts.Client, jsURL, opts.Cookie, cached, opts.MaxSize)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if errors.Is(err, errJSTooLarge) {
+			atomic.AddInt32(&progress.JSFilesTooLarge, 1)
+			progress.Log("Skipping JS file", "url", jsURL, "reason", err)
+			return "", err
+		}
+		if !retryable || attempt >= opts.Retries {
+			return "", err
+		}
+
+		// Exponential backoff unless the server told us how long to wait
+		delay := time.Duration(1<<attempt) * time.Second
+		if retryAfter > 0 {
+			delay = retryAfter
+		}
+		progress.Log("Retrying download", "url", jsURL, "delay", delay.String(), "attempt", attempt+1, "retries", opts.Retries, "error", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	if resp.NotModified {
+		if err := opts.Cache.Refresh(jsURL, cached); err != nil {
+			slog.Warn("Could not refresh cache entry", "url", jsURL, "error", err)
+		}
+		atomic.AddInt32(&progress.JSCacheHits, 1)
+		atomic.AddInt64(&progress.JSCacheBytes, int64(len(cachedBody)))
+		progress.Log("Not modified, using cached copy", "url", jsURL, "size", len(cachedBody))
+		return string(cachedBody), nil
+	}
+	if opts.Cache != nil {
+		if err := opts.Cache.Store(jsURL, resp.Body, resp.ETag, resp.LastModified); err != nil {
+			slog.Warn("Could not cache JS file", "url", jsURL, "error", err)
+		}
+	}
+
+	size := int64(len(resp.Body))
+	atomic.AddInt64(&progress.TotalBytesDownloaded, size)
+	atomic.AddInt32(&progress.JSFilesDownloaded, 1)
+	
+	progress.Log("Downloaded", "url", jsURL, "size", size)
+
+	return string(resp.Body), nil
+}
+
+// jsResponse is the result of one download attempt
+type jsResponse struct {
+	Body         []byte
+	ETag         string
+	LastModified string
+	NotModified  bool // The cached copy sent validators for is still current
+}
+
+// fetchJS performs a single download attempt and reports whether a failure is worth
+// retrying. With a cache entry the request is conditional on its validators. Bodies
+// over maxSize are rejected from their Content-Length, or once that many bytes were
+// read when the header is missing.
+func fetchJS(ctx context.Context, client *http.Client, jsURL string, cookie string, cached *jsCacheEntry, maxSize int64) (*jsResponse, time.Duration, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jsURL, nil)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("failed to create request: %v", err)
+	}
+	if cookie != "" {
+		req.Header.Set("Cookie", cookie)
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, true, fmt.Errorf("failed to download JS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return &jsResponse{NotModified: true}, 0, false, nil
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, parseRetryAfter(resp.Header.Get("Retry-After")), true,
+			fmt.Errorf("failed to download JS: %s", resp.Status)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, 0, false, fmt.Errorf("failed to download JS: %s", resp.Status)
+	}
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return nil, 0, false, fmt.Errorf("%w: Content-Length %d", errJSTooLarge, resp.ContentLength)
+	}
+
+	reader := io.Reader(resp.Body)
+	if maxSize > 0 {
+		reader = io.LimitReader(resp.Body, maxSize+1)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, 0, true, fmt.Errorf("failed to read JS content: %v", err)
+	}
+	if maxSize > 0 && int64(len(body)) > maxSize {
+		return nil, 0, false, fmt.Errorf("%w: more than %d bytes", errJSTooLarge, maxSize)
+	}
+
+	return &jsResponse{
+		Body:         body,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, 0, false, nil
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(when); delay > 0 {
+			return delay
+		}
+	}
+	return 0
+}
+
+// maxFailureSamples is how many unparseable operations --verbose logs per JS file
+const maxFailureSamples = 3
+
+// Extract GQL queries and mutations from JS content using the parser, recording the
+// counts in the file's stats
+func extractGraphQL(content string, source string, stats *FileStats, progress *Progress) ([]*GraphQLOperation, error) {
+	progress.Log("Extracting GraphQL operations", "url", source)
+	
+	operations, failures := ExtractOperationsFromJSWithFailures(content, source)
+	
+	// Count what was thrown away, showing a few examples when verbose
+	atomic.AddInt32(&progress.ParseFailures, int32(len(failures)))
+	if progress.Verbose {
+		for i, failure := range failures {
+			if i == maxFailureSamples {
+				slog.Info("More unparseable operations", "url", source, "count", len(failures)-i)
+				break
+			}
+			text := strings.Join(strings.Fields(failure.Text), " ")
+			if truncated, ok := truncateBody(text, 120); ok {
+				text = truncated + "..."
+			}
+			slog.Info("Could not parse operation", "url", source, "error", failure.Err, "text", text)
+		}
+	}
+	
+	// Count unique operations by type
+	stats.Matches = len(operations)
+	stats.ParseFailures = len(failures)
+	for _, op := range operations {
+		if progress.RecordOperation(op) {
+			stats.UniqueOperations++
+		}
+	}
+
+	progress.Log("Found operations",
+		"url", source,
+		"count", len(operations),
+		"uniqueQueries", atomic.LoadInt32(&progress.QueriesFound),
+		"uniqueMutations", atomic.LoadInt32(&progress.MutationsFound),
+		"uniqueSubscriptions", atomic.LoadInt32(&progress.SubscriptionsFound))
+
+	return operations, nil
+}
+
+// jsResult is what a worker made of one JS file
+type jsResult struct {
+	URL        string
+	Extracted  bool // False when the file failed or was skipped as already processed
+	Unchanged  bool // Skipped by --resume; Fragments and Endpoints are from the run that scanned it
+	Operations []*GraphQLOperation
+	Fragments  map[string]*Fragment
+	Endpoints  []string
+}
+
+// processJSFile downloads a JS file and extracts its operations, fragments and
+// endpoint URLs, recording what happened in stats. It runs on one of the --workers, so
+// the target's results are left to the caller.
+func processJSFile(ctx context.Context, jsURL string, stats *FileStats, run *targetRun, scripts *JSContentIndex, opts *DownloadOptions, progress *Progress) jsResult {
+	result := jsResult{URL: jsURL}
+	started := time.Now()
+	jsContent, err := downloadJS(ctx, jsURL, opts, progress)
+	stats.DownloadMs = float64(time.Since(started).Microseconds()) / 1000
+	if err != nil {
+		// After a timeout or interrupt the processing loop has already ended
+		if ctx.Err() == nil && !errors.Is(err, errJSTooLarge) {
+			slog.Error("Error downloading JS", "url", jsURL, "error", err)
+		}
+		stats.Error = err.Error()
+		return result
+	}
+	stats.Size = len(jsContent)
+	if run.Archive != nil {
+		if err := run.Archive.Save(jsURL, jsContent); err != nil {
+			slog.Error("Error saving JS", "url", jsURL, "error", err)
+		}
+	}
+	if first, duplicate := scripts.MarkProcessed(jsURL, jsContent); duplicate {
+		progress.Log("Skipping JS file, same content", "url", jsURL, "duplicateOf", first)
+		stats.DuplicateOf = first
+		atomic.AddInt32(&progress.DuplicateJSSkipped, 1)
+		atomic.AddInt64(&progress.DuplicateJSBytes, int64(len(jsContent)))
+		return result
+	}
+	if run.State != nil {
+		unchanged := run.State.SameContent(jsURL, jsContent)
+		run.State.RecordJS(jsURL, jsContent, scripts.Validator(jsURL))
+		if unchanged {
+			progress.Log("Skipping JS file, unchanged since the last run", "url", jsURL)
+			atomic.AddInt32(&progress.UnchangedJSSkipped, 1)
+			result.Unchanged = true
+			result.Fragments, result.Endpoints = run.State.Restore(jsURL, stats)
+			return result
+		}
+	}
+	jsContent = scriptContent(jsContent)
+
+	operations, err := extractGraphQL(jsContent, jsURL, stats, progress)
+	if err != nil {
+		slog.Error("Error extracting GraphQL", "url", jsURL, "error", err)
+		stats.Error = err.Error()
+		return result
+	}
+	result.Extracted = true
+	result.Operations = operations
+	result.Fragments = ExtractFragmentsFromJS(jsContent)
+	result.Endpoints = extractEndpointURLs(jsContent, endpointBase(run.Domain, jsURL))
+	if run.State != nil {
+		run.State.RecordResult(jsURL, stats, result.Fragments, result.Endpoints)
+	}
+	return result
+}
+
+// Format GraphQL query with proper indentation and spacing
+func formatGraphQLQuery(query string) string {
+	query = strings.TrimSpace(query)
+	indent := 0
 	var formatted strings.Builder
 
 	lines := strings.Split(query, "\n")
@@ -375,43 +1399,284 @@ func formatGraphQLQuery(query string) string {
 	return formatted.String()
 }
 
+// SaveOptions controls which output files saveOperations writes
+type SaveOptions struct {
+	Domain          string                       // Target the operations were extracted from
+	Formats         map[string]bool              // Additional output formats, e.g. "har"
+	HARMaxBody      int                          // Truncate HAR bodies to this many bytes, 0 for no limit
+	MergeByName     bool                         // Collapse operations sharing a name into one entry
+	StripDirectives bool                         // Remove client-only directives before exporting
+	KeepDirectives  []string                     // Directives left in place when stripping
+	SessionStart    time.Time                    // When capturing began, for the report's session duration
+	ExampleLimit    int                          // Captured variable payloads attached per operation, 0 for none
+	SampleVars      bool                         // Attach variables generated from the declared types
+	Schema          map[string]IntrospectionType // Introspected types sample variables are built from, may be nil
+	Redact          *Redactor                    // Masks secrets in the captures before anything is written
+	Fragments       []*Fragment                  // Written as a section of the SDL file when set
+	DupReport       bool                         // Write <base>_duplicates.txt with occurrence counts
+	Previous        *previousExport              // Earlier export to write <base>_diff.txt against, nil for none
+	JSEndpoints     []string                     // GraphQL endpoint URLs referenced in JavaScript
+	Files           []*FileStats                 // Per-file results for the JSON files section
+	GroupByRoot     bool                         // List SDL operations under their first root field instead of by type
+	OutputDir       string                       // Directory the files are written to, "output" when empty
+	Sort            bool                         // Order operations by type, name and body hash instead of as found
+	InferredTypes   map[string]interface{}       // Types inferred by earlier exports, merged into the JSON export
+}
+
+// endpointPatterns are extra URL regexes treated as GraphQL endpoints
+var endpointPatterns patternList
+
+// patternList collects the regexes of a repeatable flag
+type patternList []*regexp.Regexp
+
+// String returns the patterns comma-separated
+func (p *patternList) String() string {
+	patterns := make([]string, len(*p))
+	for i, pattern := range *p {
+		patterns[i] = pattern.String()
+	}
+	return strings.Join(patterns, ",")
+}
+
+// Set compiles and adds one pattern
+func (p *patternList) Set(value string) error {
+	pattern, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, pattern)
+	return nil
+}
+
+// parseList splits a comma-separated flag value into trimmed, non-empty items
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 // saveOperations saves GraphQL operations in multiple formats
-func saveOperations(operations []*GraphQLOperation, captures []GraphQLCapture, baseName string) error {
+func saveOperations(operations []*GraphQLOperation, captures []GraphQLCapture, baseName string, opts SaveOptions) error {
 	// Create output directory
 	outputDir := "output"
+	if opts.OutputDir != "" {
+		outputDir = opts.OutputDir
+	}
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create output directory: %v", err)
 	}
 	
+	// Mask secrets before any capture reaches a file
+	captures = opts.Redact.Captures(captures)
+
 	// Deduplicate operations
-	unique := DeduplicateOperations(operations)
-	log.Printf("Deduplicated %d operations to %d unique operations", len(operations), len(unique))
+	unique, counts := DeduplicateOperationsWithCounts(operations)
+	slog.Info("Deduplicated operations", "count", len(operations), "unique", len(unique))
+	
+	// Save how often each operation was found, before merging changes the set
+	if opts.DupReport {
+		dupFile := filepath.Join(outputDir, baseName + "_duplicates.txt")
+		if err := os.WriteFile(dupFile, []byte(ExportDuplicatesReport(operations, unique, counts)), 0644); err != nil {
+			return fmt.Errorf("failed to save duplicates report: %v", err)
+		}
+		slog.Info("Saved duplicates report", "file", dupFile)
+	}
+	
+	if opts.MergeByName {
+		merged := MergeOperationsByName(unique)
+		slog.Info("Merged operations by name", "count", len(unique), "merged", len(merged))
+		unique = merged
+	}
+	
+	// Remove client-only directives so the output is valid against the real server
+	if opts.StripDirectives {
+		for i, op := range unique {
+			stripped := *op
+			stripped.Raw = stripDirectives(op.Raw, opts.KeepDirectives)
+			if selections := parseSelections(stripped.Raw); selections != nil {
+				stripped.Selections = selections
+			}
+			unique[i] = &stripped
+		}
+	}
+	
+	// Join captured variable values and network observations onto the operations
+	attachExampleVariables(unique, captures, opts.ExampleLimit)
+	if opts.SampleVars {
+		for _, op := range unique {
+			op.SampleVariables = GenerateExampleVariables(op, opts.Schema)
+		}
+	}
+	correlateCaptures(unique, captures)
+	
+	// A stable order keeps the files of repeated runs diffable
+	files := opts.Files
+	if opts.Sort {
+		sortOperations(unique)
+		files = append([]*FileStats(nil), files...)
+		sort.SliceStable(files, func(i, j int) bool { return files[i].URL < files[j].URL })
+	}
 	
 	// Save in SDL format
 	sdlFile := filepath.Join(outputDir, baseName + ".graphql")
-	sdlContent := ExportToSDL(unique)
+	sdlContent := ExportToSDL(unique, opts.GroupByRoot) + fragmentsSDL(opts.Fragments)
 	if err := os.WriteFile(sdlFile, []byte(sdlContent), 0644); err != nil {
 		return fmt.Errorf("failed to save SDL file: %v", err)
 	}
-	log.Printf("Saved SDL format to: %s", sdlFile)
+	slog.Info("Saved SDL format", "file", sdlFile)
+	
+	// Save a schema reconstructed from the operations and responses
+	schemaFile := filepath.Join(outputDir, baseName + "_schema.graphql")
+	schemaContent := ExportToSchema(unique, captures)
+	if err := validateSchemaSDL(schemaContent); err != nil {
+		slog.Warn("Reconstructed schema is not valid", "error", err)
+	}
+	if err := os.WriteFile(schemaFile, []byte(schemaContent), 0644); err != nil {
+		return fmt.Errorf("failed to save schema file: %v", err)
+	}
+	slog.Info("Saved reconstructed schema", "file", schemaFile)
 	
 	// Save in JSON format
 	jsonFile := filepath.Join(outputDir, baseName + ".json")
-	jsonContent, err := ExportToJSON(unique, captures)
+	jsonContent, err := ExportToJSON(unique, captures, files, opts.InferredTypes)
 	if err != nil {
 		return fmt.Errorf("failed to generate JSON: %v", err)
 	}
 	if err := os.WriteFile(jsonFile, jsonContent, 0644); err != nil {
 		return fmt.Errorf("failed to save JSON file: %v", err)
 	}
-	log.Printf("Saved JSON format to: %s", jsonFile)
+	slog.Info("Saved JSON format", "file", jsonFile)
+	
+	// Save what changed since the previous export
+	if opts.Previous != nil {
+		diff := diffOperations(opts.Previous.Operations, diffOperationsFrom(unique))
+		diffFile := filepath.Join(outputDir, baseName + "_diff.txt")
+		if err := os.WriteFile(diffFile, []byte(ExportDiff(diff, opts.Previous.Path)), 0644); err != nil {
+			return fmt.Errorf("failed to save diff file: %v", err)
+		}
+		slog.Info("Compared with previous export", "previous", opts.Previous.Path,
+			"added", len(diff.Added), "removed", len(diff.Removed), "changed", len(diff.Changed), "file", diffFile)
+	}
+	
+	// Save network traffic as HAR
+	if opts.Formats["har"] {
+		harFile := filepath.Join(outputDir, baseName + ".har")
+		harContent, err := ExportToHAR(captures, opts.HARMaxBody)
+		if err != nil {
+			return fmt.Errorf("failed to generate HAR: %v", err)
+		}
+		if err := os.WriteFile(harFile, harContent, 0644); err != nil {
+			return fmt.Errorf("failed to save HAR file: %v", err)
+		}
+		slog.Info("Saved HAR format", "file", harFile)
+	}
+	
+	// Save ready-to-run curl commands
+	if opts.Formats["curl"] {
+		defaultEndpoint := strings.TrimRight(opts.Domain, "/") + "/graphql"
+		if endpoints := summarizeEndpoints(captures); len(endpoints) > 0 {
+			defaultEndpoint = endpoints[0].URL
+		}
+		curlFile := filepath.Join(outputDir, baseName + "_curl.sh")
+		if err := os.WriteFile(curlFile, []byte(ExportToCurl(unique, captures, defaultEndpoint)), 0755); err != nil {
+			return fmt.Errorf("failed to save curl script: %v", err)
+		}
+		slog.Info("Saved curl commands", "file", curlFile)
+	}
+	
+	// Save spreadsheet-friendly summaries
+	if opts.Formats["csv"] {
+		csvContent, err := ExportToCSV(unique, captures)
+		if err != nil {
+			return fmt.Errorf("failed to generate CSV: %v", err)
+		}
+		csvFile := filepath.Join(outputDir, baseName + ".csv")
+		if err := os.WriteFile(csvFile, csvContent, 0644); err != nil {
+			return fmt.Errorf("failed to save CSV file: %v", err)
+		}
+		capturesContent, err := ExportCapturesToCSV(captures)
+		if err != nil {
+			return fmt.Errorf("failed to generate captures CSV: %v", err)
+		}
+		capturesFile := filepath.Join(outputDir, baseName + "_captures.csv")
+		if err := os.WriteFile(capturesFile, capturesContent, 0644); err != nil {
+			return fmt.Errorf("failed to save captures CSV file: %v", err)
+		}
+		slog.Info("Saved CSV summaries", "file", csvFile, "capturesFile", capturesFile)
+	}
+	
+	// Save a readable Markdown report
+	if opts.Formats["markdown"] || opts.Formats["md"] {
+		reportFile := filepath.Join(outputDir, baseName + "_report.md")
+		reportContent := ExportToMarkdown(unique, captures, opts.Domain, opts.SessionStart)
+		if err := os.WriteFile(reportFile, []byte(reportContent), 0644); err != nil {
+			return fmt.Errorf("failed to save Markdown report: %v", err)
+		}
+		slog.Info("Saved Markdown report", "file", reportFile)
+	}
+	
+	// Save a SQLite database for querying large extractions
+	if opts.Formats["sqlite"] {
+		dbFile := filepath.Join(outputDir, baseName + ".db")
+		if err := ExportToSQLite(dbFile, unique, captures); err != nil {
+			return fmt.Errorf("failed to save SQLite database: %v", err)
+		}
+		slog.Info("Saved SQLite database", "file", dbFile)
+	}
+	
+	// Save Apollo persisted query manifests in both the legacy and versioned shapes
+	if opts.Formats["persisted"] {
+		legacy, manifest := ExportToPersistedManifest(unique)
+		legacyContent, err := json.MarshalIndent(legacy, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to generate persisted query map: %v", err)
+		}
+		manifestContent, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to generate persisted query manifest: %v", err)
+		}
+		legacyFile := filepath.Join(outputDir, baseName + "_persisted_queries.json")
+		if err := os.WriteFile(legacyFile, legacyContent, 0644); err != nil {
+			return fmt.Errorf("failed to save persisted query map: %v", err)
+		}
+		manifestFile := filepath.Join(outputDir, baseName + "_persisted-query-manifest.json")
+		if err := os.WriteFile(manifestFile, manifestContent, 0644); err != nil {
+			return fmt.Errorf("failed to save persisted query manifest: %v", err)
+		}
+		slog.Info("Saved persisted query manifests", "file", legacyFile, "manifestFile", manifestFile)
+		
+		// A mismatch means our canonical printing differs from the client's
+		if mismatches := checkPersistedHashes(manifest, captures); len(mismatches) > 0 {
+			slog.Warn("Persisted query hashes did not match the captured APQ traffic", "count", len(mismatches))
+		}
+	}
+	
+	// Save the one-page summary
+	summaryFile := filepath.Join(outputDir, baseName + "_summary.md")
+	if err := os.WriteFile(summaryFile, []byte(ExportSummaryMarkdown(unique, captures)), 0644); err != nil {
+		return fmt.Errorf("failed to save summary: %v", err)
+	}
+	slog.Info("Saved summary", "file", summaryFile)
+	
+	// Save the endpoint inventory
+	if endpoints := ExportEndpoints(captures, opts.JSEndpoints); endpoints != "" {
+		endpointsFile := filepath.Join(outputDir, baseName + "_endpoints.txt")
+		if err := os.WriteFile(endpointsFile, []byte(endpoints), 0644); err != nil {
+			return fmt.Errorf("failed to save endpoints: %v", err)
+		}
+		slog.Info("Saved endpoints", "file", endpointsFile)
+	}
 	
 	// Save detailed capture log
 	logFile := filepath.Join(outputDir, baseName + "_detailed.log")
 	if err := saveDetailedLog(unique, captures, logFile); err != nil {
 		return fmt.Errorf("failed to save detailed log: %v", err)
 	}
-	log.Printf("Saved detailed log to: %s", logFile)
+	slog.Info("Saved detailed log", "file", logFile)
 	
 	return nil
 }
@@ -425,7 +1690,7 @@ func saveDetailedLog(operations []*GraphQLOperation, captures []GraphQLCapture,
 	defer f.Close()
 	
 	fmt.Fprintf(f, "# GraphQL Operations Detailed Log\n")
-	fmt.Fprintf(f, "# Generated at: %s\n\n", time.Now().Format(time.RFC3339))
+	fmt.Fprint(f, generatedAtLine("# ") + "\n")
 	
 	// Write static operations
 	if len(operations) > 0 {
@@ -435,64 +1700,607 @@ func saveDetailedLog(operations []*GraphQLOperation, captures []GraphQLCapture,
 			if len(op.Variables) > 0 {
 				fmt.Fprintf(f, "Variables: %v\n", op.Variables)
 			}
+			if op.Source != "" {
+				fmt.Fprintf(f, "Source: %s\n", sourceLocation(op))
+				if op.Line > 0 {
+					fmt.Fprintf(f, "Offset: %d\n", op.Offset)
+				}
+			}
+			for _, example := range op.ExampleVariables {
+				if encoded, err := json.Marshal(example); err == nil {
+					fmt.Fprintf(f, "Example variables: %s\n", encoded)
+				}
+			}
+			if len(op.Sources) > 1 {
+				fmt.Fprintf(f, "Also seen in: %s\n", strings.Join(op.Sources[1:], ", "))
+			}
 			fmt.Fprintf(f, "```graphql\n%s\n```\n\n", op.Raw)
 		}
 	}
-	
-	// Write network captures
-	if len(captures) > 0 {
-		fmt.Fprintf(f, "## Network Captures\n\n")
-		for i, capture := range captures {
-			fmt.Fprintf(f, "### Capture %d\n", i+1)
-			fmt.Fprintf(f, "- Time: %s\n", capture.Timestamp.Format(time.RFC3339))
-			fmt.Fprintf(f, "- URL: %s\n\n", capture.URL)
-			
-			if capture.Query != "" {
-				fmt.Fprintf(f, "#### Query\n```graphql\n%s\n```\n\n", capture.Query)
-			}
-			
-			if len(capture.Variables) > 0 {
-				varsJSON, _ := json.MarshalIndent(capture.Variables, "", "  ")
-				fmt.Fprintf(f, "#### Variables\n```json\n%s\n```\n\n", string(varsJSON))
-			}
-			
-			if capture.Response != nil {
-				respJSON, _ := json.MarshalIndent(capture.Response, "", "  ")
-				// Truncate very long responses
-				if len(respJSON) > 5000 {
-					respJSON = append(respJSON[:5000], []byte("\n... [truncated]")...)
-				}
-				fmt.Fprintf(f, "#### Response\n```json\n%s\n```\n\n", string(respJSON))
+	
+	// Write the operations most worth testing for expensive queries
+	if len(operations) > 0 {
+		ranked := make([]*GraphQLOperation, len(operations))
+		copy(ranked, operations)
+		sort.SliceStable(ranked, func(i, j int) bool {
+			if ranked[i].Depth != ranked[j].Depth {
+				return ranked[i].Depth > ranked[j].Depth
+			}
+			return ranked[i].FieldCount > ranked[j].FieldCount
+		})
+		if len(ranked) > 20 {
+			ranked = ranked[:20]
+		}
+		
+		fmt.Fprintf(f, "## Most Complex Operations\n\n")
+		for _, op := range ranked {
+			fmt.Fprintf(f, "- %s %s: depth %d, %d fields\n", op.Type, op.Name, op.Depth, op.FieldCount)
+		}
+		fmt.Fprintf(f, "\n")
+	}
+	
+	// Write the captures the target took longest to answer
+	if slowest := slowestCaptures(captures, 20); len(slowest) > 0 {
+		fmt.Fprintf(f, "## Slowest Operations\n\n")
+		for _, capture := range slowest {
+			fmt.Fprintf(f, "- %s: %.0fms (%s)\n", captureName(capture), capture.DurationMs, capture.URL)
+		}
+		fmt.Fprintf(f, "\n")
+	}
+	
+	// Write the error codes operations returned, which reveal auth requirements
+	if codes := summarizeErrorCodes(captures); len(codes) > 0 {
+		fmt.Fprint(f, formatErrorCodes(codes))
+	}
+	
+	// Write network captures
+	if len(captures) > 0 {
+		fmt.Fprintf(f, "## Network Captures\n\n")
+		for i, capture := range captures {
+			fmt.Fprintf(f, "### Capture %d\n", i+1)
+			fmt.Fprintf(f, "- Time: %s\n", capture.Timestamp.Format(time.RFC3339))
+			fmt.Fprintf(f, "- URL: %s\n", capture.URL)
+			if !capture.Pending {
+				fmt.Fprintf(f, "- Duration: %.0fms\n", capture.DurationMs)
+			}
+			fmt.Fprintf(f, "\n")
+			
+			if capture.HasErrors {
+				fmt.Fprintf(f, "#### Errors\n")
+				for _, gqlErr := range capture.Errors {
+					line := gqlErr.Message
+					if gqlErr.Path != "" {
+						line += " (at " + gqlErr.Path + ")"
+					}
+					if gqlErr.Code != "" {
+						fmt.Fprintf(f, "- **[%s]** %s\n", gqlErr.Code, line)
+					} else {
+						fmt.Fprintf(f, "- %s\n", line)
+					}
+				}
+				fmt.Fprintf(f, "\n")
+			}
+			
+			if capture.Query != "" {
+				fmt.Fprintf(f, "#### Query\n```graphql\n%s\n```\n\n", capture.Query)
+			}
+			
+			if len(capture.Variables) > 0 {
+				varsJSON, _ := json.MarshalIndent(capture.Variables, "", "  ")
+				fmt.Fprintf(f, "#### Variables\n```json\n%s\n```\n\n", string(varsJSON))
+			}
+			
+			if capture.Pending {
+				fmt.Fprintf(f, "_No response was received for this request._\n\n")
+			} else if capture.BodyUnavailable && capture.Response == nil {
+				fmt.Fprintf(f, "_A response arrived (HTTP %d) but its body was no longer available._\n\n", capture.Status)
+			} else if capture.ResponseInferred {
+				fmt.Fprintf(f, "_Response body was unavailable; showing the response of another %s capture._\n\n", capture.OperationName)
+			}
+			
+			if capture.Response != nil {
+				respJSON, _ := json.MarshalIndent(capture.Response, "", "  ")
+				// Truncate very long responses
+				if len(respJSON) > 5000 {
+					respJSON = append(respJSON[:5000], []byte("\n... [truncated]")...)
+				}
+				fmt.Fprintf(f, "#### Response\n```json\n%s\n```\n\n", string(respJSON))
+			}
+			
+			fmt.Fprintf(f, "---\n\n")
+		}
+	}
+	
+	return nil
+}
+
+// reportEndpoints logs every distinct GraphQL endpoint seen during the session
+func reportEndpoints(captures []GraphQLCapture) {
+	endpoints := summarizeEndpoints(captures)
+	if len(endpoints) == 0 {
+		return
+	}
+
+	slog.Info("GraphQL endpoints seen", "count", len(endpoints))
+	for _, endpoint := range endpoints {
+		slog.Info("GraphQL endpoint", "url", endpoint.URL, "requests", endpoint.RequestCount, "operations", len(endpoint.Operations))
+	}
+}
+
+// reportErrors logs how many operations returned GraphQL errors or an HTTP error status,
+// which points at broken or permission-gated operations, and a count per error code
+func reportErrors(captures []GraphQLCapture) {
+	type errorCounts struct {
+		captures, graphQL, http int
+		statuses                []string
+	}
+	byName := make(map[string]*errorCounts)
+	for _, capture := range captures {
+		if capture.Pending {
+			continue
+		}
+		name := capture.OperationName
+		if name == "" {
+			name = "(anonymous)"
+		}
+		if byName[name] == nil {
+			byName[name] = &errorCounts{}
+		}
+		counts := byName[name]
+		counts.captures++
+		if capture.HasErrors {
+			counts.graphQL++
+		}
+		if capture.Status >= 400 {
+			counts.http++
+			counts.statuses = appendUnique(counts.statuses, strconv.Itoa(capture.Status))
+		}
+	}
+
+	var failing []string
+	for name, counts := range byName {
+		if counts.graphQL > 0 || counts.http > 0 {
+			failing = append(failing, name)
+		}
+	}
+	if len(failing) == 0 {
+		return
+	}
+	sort.Strings(failing)
+
+	slog.Info("Operations returning errors", "count", len(failing), "operations", len(byName))
+	for _, name := range failing {
+		counts := byName[name]
+		attrs := []interface{}{"operation", name, "captures", counts.captures, "graphqlErrors", counts.graphQL}
+		if counts.http > 0 {
+			attrs = append(attrs, "httpErrors", counts.http, "statuses", strings.Join(counts.statuses, "/"))
+		}
+		slog.Info("Operation returning errors", attrs...)
+	}
+
+	for _, summary := range summarizeErrorCodes(captures) {
+		slog.Info("GraphQL error code", "code", summary.Code, "count", summary.Count, "operations", strings.Join(summary.Operations, ", "))
+	}
+}
+
+// reportLatencies logs min/median/max response latency per operation name
+func reportLatencies(captures []GraphQLCapture) {
+	latencies := make(map[string][]float64)
+	pending := 0
+	for _, capture := range captures {
+		if capture.Pending {
+			pending++
+			continue
+		}
+		name := capture.OperationName
+		if name == "" {
+			name = "(anonymous)"
+		}
+		latencies[name] = append(latencies[name], capture.DurationMs)
+	}
+
+	if len(latencies) == 0 && pending == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(latencies))
+	for name := range latencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		values := latencies[name]
+		sort.Float64s(values)
+		slog.Info("Response latency", "operation", name,
+			"minMs", values[0], "medianMs", values[len(values)/2], "maxMs", values[len(values)-1], "captures", len(values))
+	}
+	if pending > 0 {
+		slog.Info("Captures never received a response", "count", pending)
+	}
+
+	for _, capture := range slowestCaptures(captures, 5) {
+		slog.Info("Slow operation", "operation", captureName(capture), "durationMs", capture.DurationMs, "url", capture.URL)
+	}
+}
+
+// slowestCaptures returns up to limit answered captures, longest response time first
+func slowestCaptures(captures []GraphQLCapture, limit int) []GraphQLCapture {
+	var answered []GraphQLCapture
+	for _, capture := range captures {
+		if !capture.Pending && capture.DurationMs > 0 {
+			answered = append(answered, capture)
+		}
+	}
+	sort.SliceStable(answered, func(i, j int) bool {
+		return answered[i].DurationMs > answered[j].DurationMs
+	})
+	if len(answered) > limit {
+		answered = answered[:limit]
+	}
+	return answered
+}
+
+// captureName returns the operation name of a capture, or "(anonymous)"
+func captureName(capture GraphQLCapture) string {
+	if capture.OperationName == "" {
+		return "(anonymous)"
+	}
+	return capture.OperationName
+}
+
+func sanitizeDomain(domain string) string {
+	domain = strings.TrimPrefix(strings.TrimPrefix(domain, "https://"), "http://")
+	return strings.ReplaceAll(strings.ReplaceAll(domain, "/", "_"), ":", "_")
+}
+
+// Exit statuses of a capture run, so scripts and CI jobs can tell outcomes apart
+const (
+	exitOK          = 0 // Operations or captures were found
+	exitSetupFailed = 1 // Bad flags, or the browser, proxy or input could not be set up
+	exitEmpty       = 2 // The run finished but found no operation and no capture
+	exitPartial     = 3 // A timeout or interrupt cut the run short; what was found was saved
+	// exitInterrupted is the exit status of a run stopped by a second SIGINT or SIGTERM
+	// before its results were saved
+	exitInterrupted = 130
+)
+
+// exitMeanings describes each exit status in the final log line
+var exitMeanings = map[int]string{
+	exitOK:      "success, operations or captures found",
+	exitEmpty:   "no operations or captures found",
+	exitPartial: "partial results saved after a timeout or interrupt",
+}
+
+// interruptGrace is how long requests already sent may still complete after an interrupt
+const interruptGrace = 2 * time.Second
+
+// captureShutdownTimeout bounds the wait for the capture goroutine to flush and close
+// its channels at the end of a session, so results are saved even if it is stuck
+const captureShutdownTimeout = 10 * time.Second
+
+// waitForCaptures waits until done is closed or timeout passes, reporting whether the
+// capture goroutine finished in time
+func waitForCaptures(done <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		slog.Warn("Capture did not shut down in time, saving what was collected", "timeout", timeout.String())
+		return false
+	}
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(runReplay(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "merge" {
+		os.Exit(runMerge(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		os.Exit(runDiff(os.Args[2:]))
+	}
+	os.Exit(runExtract())
+}
+
+// runExtract runs a capture session with the command line flags and returns the exit
+// status. Returning instead of exiting lets the deferred cleanup close the browser and
+// flush the streams.
+func runExtract() int {
+	// Parse errors are returned rather than exiting with the flag package's status 2,
+	// which would read as exitEmpty
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+
+	domain := flag.String("domain", "", "Target domain to extract GraphQL queries from")
+	domainsFile := flag.String("domains-file", "", "File of target URLs, one per line, captured one after another in the same browser session")
+	combined := flag.Bool("combined", true, "With --domains-file, also write output files merging every target (deduplicated across targets)")
+	freshSession := flag.Bool("fresh-session", false, "With --domains-file, clear cookies, cache and site storage before each target so no session carries over")
+	autoInteract := flag.Bool("auto-interact", false, "After the page loads, scroll to the bottom, click tabs, expanders and \"load more\" buttons and hover menus to trigger lazy-loaded queries, without leaving the page")
+	interactSelectors := flag.String("interact-selectors", defaultInteractSelectors, "With --auto-interact, CSS selectors of the elements to click besides \"load more\" buttons")
+	interactPause := flag.Duration("interact-pause", time.Second, "With --auto-interact, wait this long after each action for the requests it triggers")
+	interactBudget := flag.Duration("interact-budget", time.Minute, "With --auto-interact, total time spent interacting with a page")
+	crawlSitemap := flag.Bool("crawl-sitemap", false, "After the page loads, visit the target's pages listed in /sitemap.xml (and nested sitemap indexes) while capturing")
+	crawlDepth := flag.Int("crawl-depth", 0, "After the page loads, follow same-host links breadth-first this many clicks deep while capturing (0 to not crawl)")
+	crawlExclude := flag.String("crawl-exclude", `(?i)log-?out|sign-?out`, "Regex of URLs the link crawler never visits")
+	maxPages := flag.Int("max-pages", 50, "With --crawl-sitemap or --crawl-depth, visit at most this many pages per target and crawl (0 for no limit)")
+	pageDwell := flag.Duration("page-dwell", 5*time.Second, "With --crawl-sitemap, how long to stay on each page for its requests; the link crawler moves on earlier once the page's network has settled for --idle-timeout")
+	upstreamProxyFlag := flag.String("upstream-proxy", "", "Send the browser's traffic and all downloads through this HTTP, HTTPS or SOCKS5 proxy (e.g. http://127.0.0.1:8080 for Burp, socks5://127.0.0.1:1080); NO_PROXY hosts and localhost go direct")
+	listJS := flag.Bool("list-js", false, "Dry run: browse and capture as usual, then print every discovered JS file (and HTML page with inline scripts) URL and exit without downloading or extracting")
+	idleTimeout := flag.Duration("idle-timeout", 3*time.Second, "After loading a target, wait until no request started or finished for this long (and none is in flight) before interacting or crawling, at most --timeout")
+	finishAfterIdle := flag.Duration("finish-after-idle", 0, "Stop and save once the page has loaded (and any crawl finished) and the browser received no response for this long, e.g. 30s (0 to wait for the browser to close or --timeout)")
+	failOnEmpty := flag.Bool("fail-on-empty", true, "Exit with status 2 when the run finishes without finding any operation or capture (--fail-on-empty=false exits 0)")
+	timeout := flag.Duration("timeout", 5*time.Minute, "Maximum time to wait for page to load and process (per target with --domains-file; with --proxy only when given, otherwise until Ctrl+C)")
+	requestTTL := flag.Duration("request-ttl", time.Minute, "Stop waiting for a GraphQL response after this long and record the request as pending (0 to wait forever)")
+	progressInterval := flag.Duration("progress", 10*time.Second, "Progress report interval")
+	quiet := flag.Bool("quiet", false, "Show a single updating progress line instead of per-file logs")
+	logFormat := flag.String("log-format", LogFormatText, "Log output format: text or json")
+	logLevel := flag.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	verbose := flag.Bool("verbose", false, "Log every network capture in addition to the default output")
+	downloadRetries := flag.Int("download-retries", 3, "Number of retries for failed JS downloads")
+	workers := flag.Int("workers", 4, "Number of JS files downloaded and parsed at once")
+	outputDir := flag.String("output-dir", "output", "Directory the output files are written to; with several targets each gets a subdirectory")
+	stdoutNDJSON := flag.Bool("stdout-ndjson", false, "Print every capture and extracted operation to stdout as one JSON object per line")
+	stdoutMaxResponse := flag.Int("stdout-max-response", 64*1024, "Truncate responses printed by --stdout-ndjson to this many bytes (0 for no limit)")
+	noFiles := flag.Bool("no-files", false, "Skip writing output files (useful with --stdout-ndjson)")
+	execCommand := flag.String("exec", "", "Run this shell command for every capture, with the capture's JSON on its stdin")
+	webhookURL := flag.String("webhook-url", "", "POST each newly discovered unique operation to this URL as JSON")
+	stream := flag.Bool("stream", false, "Append each capture and static operation to output/<base>.jsonl as it arrives")
+	streamPath := flag.String("stream-file", "", "Append each capture and static operation to this JSON Lines file as it arrives (implies --stream)")
+	aggregate := flag.Bool("aggregate", true, "Write the final aggregate export files (use --aggregate=false with --stream to keep only the stream)")
+	only := flag.String("only", "", "Comma-separated operation types to keep (query,mutation,subscription)")
+	nameFilter := flag.String("name-filter", "", "Only keep operations whose name matches this regex")
+	minDepth := flag.Int("min-depth", 0, "Only keep operations whose selection sets nest at least this deep")
+	format := flag.String("format", "", "Comma-separated additional output formats (har, curl, persisted, csv, markdown, sqlite)")
+	groupByRoot := flag.Bool("group-by-root", false, "Group operations in output/<base>.graphql by the first top-level field they select (e.g. viewer, search) instead of by type")
+	sortOutput := flag.Bool("sort", true, "Order operations in every output file by type, name and body hash so repeated runs produce diffable files (--sort=false keeps the order they were found in)")
+	noTimestamp := flag.Bool("no-timestamp", false, "Leave the generated-at lines, session duration and download times out of the output files so unchanged runs produce identical files")
+	fragmentsSection := flag.Bool("fragments-section", false, "Also list the fragment definitions found in JavaScript at the end of output/<base>.graphql")
+	sampleVars := flag.Bool("sample-vars", false, "Add a sampleVariables payload generated from the declared variable types to each operation in the JSON output")
+	exampleLimit := flag.Int("example-variables", 3, "Distinct captured variable payloads to include per operation (0 to disable)")
+	redactPattern := flag.String("redact-pattern", defaultRedactPattern, "Regex of variable names whose values are redacted wherever captures are written")
+	redactHeaders := flag.String("redact-headers", defaultRedactHeaders, "Comma-separated request and response headers whose values are redacted wherever captures are written")
+	inferScalarsFlag := flag.Bool("infer-scalars", true, "Infer ID (UUID and numeric strings), DateTime (RFC3339) and enum candidates from captured values instead of plain String")
+	resume := flag.Bool("resume", false, "Keep state in output/<base>_state.json: skip JS unchanged since the last run and merge new operations into the existing output")
+	diffPath := flag.String("diff", "", "Compare with a previous JSON export and write added, removed and changed operations to output/<base>_diff.txt")
+	dupReport := flag.Bool("dup-report", false, "Write output/<base>_duplicates.txt with how often each operation was found and duplication per source")
+	mergeByName := flag.Bool("merge-by-name", false, "Merge operations sharing a name, keeping the most complete variant")
+	stripDirs := flag.Bool("strip-directives", false, "Remove client-only directives (e.g. @client, @connection) from exported operations")
+	keepDirs := flag.String("keep-directives", "include,skip", "Comma-separated directives preserved by --strip-directives")
+	har := flag.Bool("har", false, "Write captured GraphQL traffic to output/<base>.har (same as --format=har)")
+	harMaxBody := flag.Int("har-max-body", 1024*1024, "Truncate request/response bodies in the HAR file to this many bytes (0 for no limit)")
+	curl := flag.Bool("curl", false, "Write a ready-to-run curl command per operation to output/<base>_curl.sh")
+	persisted := flag.Bool("persisted-manifest", false, "Write Apollo persisted query manifests to output/<base>_persisted_queries.json and output/<base>_persisted-query-manifest.json")
+	sqliteOut := flag.Bool("sqlite", false, "Write operations, captures and endpoints to output/<base>.db")
+	validate := flag.Bool("validate", false, "Parse every operation with a spec-compliant GraphQL parser and drop those that fail")
+	probe := flag.Bool("probe-introspection", false, "Send an introspection query to each detected GraphQL endpoint (active traffic)")
+	harInput := flag.String("har-input", "", "Extract from a HAR file recorded by DevTools, Burp or a proxy instead of driving a browser (no network access)")
+	proxyAddr := flag.String("proxy", "", "Run as an intercepting HTTP/HTTPS proxy on this address (e.g. :8080) instead of driving a browser")
+	proxyCADir := flag.String("proxy-ca-dir", defaultProxyCADir(), "Directory holding the proxy CA certificate and key, generated on first use")
+	dedupJSMode := flag.String("dedup-js-mode", DedupJSExact, "How JS URLs are compared before downloading: exact, query (ignore query strings, which may select different bundles) or hash (also ignore content hashes in file names)")
+	jsHashPattern := flag.String("js-hash-pattern", defaultJSHashPattern, "Regex matching the content hash removed from JS file names by --dedup-js-mode=hash")
+	sameOrigin := flag.Bool("same-origin", false, "Only download JS files served from the target's host (plus --js-host-allow hosts), skipping third-party scripts")
+	jsHostAllow := flag.String("js-host-allow", "", "Comma-separated extra hosts (and their subdomains) whose JS files --same-origin downloads, e.g. a CDN")
+	flag.Var(&endpointPatterns, "endpoint-pattern", "Regex of request URLs to treat as GraphQL endpoints besides those containing \"graphql\" (repeatable, e.g. /api/gql$)")
+	ignoreNoise := flag.Bool("ignore-noise", true, "Drop introspection and client housekeeping queries such as IntrospectionQuery, __ApolloGetServiceDefinition__, { __typename } and __schema/__type-only documents")
+	noIgnoreNoise := flag.Bool("no-ignore-noise", false, "Keep introspection and housekeeping queries (same as --ignore-noise=false)")
+	noisePatterns := flag.String("noise-names", "", "Comma-separated additional operation name regexes treated as noise by --ignore-noise")
+	saveJS := flag.Bool("save-js", false, "Save every downloaded JS file to output/<base>/js with a manifest.json mapping files to URLs")
+	maxJSSize := flag.Int64("max-js-size", 0, "Skip JS files larger than this many bytes (0 for no limit)")
+	cacheDir := flag.String("cache-dir", "", "Keep downloaded JS files in this directory and revalidate them with conditional requests on later runs")
+	cacheMaxAge := flag.Duration("cache-max-age", 7*24*time.Hour, "Download cached JS files again once they are older than this (0 to keep them forever)")
+	noCache := flag.Bool("no-cache", false, "Bypass --cache-dir entirely for this run")
+	cookie := flag.String("cookie", "", "Cookie header to send when downloading JS files (e.g. \"session=abc; token=xyz\")")
+	configPath := flag.String("config", "", "JSON file of flag values (keys are flag names); command-line flags take precedence")
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		// The flag package has already printed the error and usage
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitSetupFailed
+	}
+
+	if *configPath != "" {
+		config, err := loadConfig(*configPath)
+		if err != nil {
+			fatal("Error loading config", "error", err)
+		}
+		if err := config.apply(flag.CommandLine); err != nil {
+			fatal("Error loading config", "error", err)
+		}
+	}
+
+	if *quiet && *verbose {
+		fatal("--quiet and --verbose cannot be used together")
+	}
+
+	// A proxy session runs until Ctrl+C unless --timeout was given, on the command line
+	// or in the config
+	timeoutSet := false
+	flag.Visit(func(f *flag.Flag) {
+		timeoutSet = timeoutSet || f.Name == "timeout"
+	})
+	proxyUntilInterrupt := *proxyAddr != "" && !timeoutSet
+
+	// Keep stdout free for results; all logging goes to stderr, clearing the quiet
+	// progress line before each message so the two do not run together
+	var logOut io.Writer = os.Stderr
+	if *quiet {
+		logOut = lineClearingWriter{out: os.Stderr}
+	}
+	if err := setupLogging(logOut, *logFormat, *logLevel); err != nil {
+		fatal("Invalid logging flags", "error", err)
+	}
+
+	// A HAR file replaces the live session; its first entry names the target by default
+	var recording *HAR
+	if *harInput != "" {
+		if *proxyAddr != "" || *domainsFile != "" {
+			fatal("--har-input cannot be used with --proxy or --domains-file")
+		}
+		var err error
+		recording, err = readHAR(*harInput)
+		if err != nil {
+			fatal("Error reading HAR input", "error", err)
+		}
+		if *domain == "" {
+			*domain = harTarget(recording)
+		}
+	}
+
+	var upstreamProxy *url.URL
+	if *upstreamProxyFlag != "" {
+		var proxyErr error
+		if upstreamProxy, proxyErr = parseUpstreamProxy(*upstreamProxyFlag); proxyErr != nil {
+			fatal("Invalid --upstream-proxy", "error", proxyErr)
+		}
+		if upstreamProxy.User != nil && *proxyAddr == "" && *harInput == "" {
+			slog.Warn("Chrome cannot authenticate to the upstream proxy from the command line; its credentials are only used for downloads")
+		}
+		slog.Info("Using upstream proxy", "proxy", upstreamProxy.Redacted())
+	}
+	if *listJS && *stdoutNDJSON {
+		fatal("--list-js and --stdout-ndjson both write to stdout and cannot be used together")
+	}
+	if (*crawlSitemap || *crawlDepth > 0 || *autoInteract) && (*proxyAddr != "" || *harInput != "") {
+		fatal("--crawl-sitemap, --crawl-depth and --auto-interact need the browser and cannot be used with --proxy or --har-input")
+	}
+	crawlExcludePattern, crawlExcludeErr := regexp.Compile(*crawlExclude)
+	if crawlExcludeErr != nil {
+		fatal("Invalid --crawl-exclude regex", "error", crawlExcludeErr)
+	}
+	interactor := &Interactor{Selectors: *interactSelectors, Pause: *interactPause, Budget: *interactBudget}
+	linkCrawler := &LinkCrawler{MaxDepth: *crawlDepth, MaxPages: *maxPages, MaxWait: *pageDwell, Quiet: *idleTimeout}
+	if *crawlExclude != "" {
+		linkCrawler.Exclude = crawlExcludePattern
+	}
+
+	if *domain == "" && *proxyAddr == "" && *domainsFile == "" {
+		fatal("No domain provided. Please specify a target domain using --domain")
+	}
+	if *workers < 1 {
+		fatal("--workers must be at least 1")
+	}
+
+	// Each target is captured in turn and gets its own output files
+	targets := []string{*domain}
+	if *domainsFile != "" {
+		if *proxyAddr != "" {
+			fatal("--domains-file cannot be used with --proxy")
+		}
+		fileTargets, err := readTargets(*domainsFile)
+		if err != nil {
+			fatal("Error reading targets", "error", err)
+		}
+		if *domain != "" {
+			targets = appendUnique(targets, fileTargets...)
+		} else {
+			targets = fileTargets
+		}
+	}
+	runs := make([]*targetRun, len(targets))
+	for i, target := range targets {
+		runs[i] = newTargetRun(target, *outputDir)
+	}
+	multiTarget := len(runs) > 1
+	if multiTarget {
+		// Each target writes to its own directory; combined files stay in --output-dir
+		for _, run := range runs {
+			run.OutputDir = filepath.Join(*outputDir, run.BaseName)
+		}
+	}
+	if *resume {
+		for _, run := range runs {
+			run.State = loadRunState(filepath.Join(run.OutputDir, run.BaseName + "_state.json"), run.Domain)
+		}
+	}
+	if *saveJS {
+		for _, run := range runs {
+			archive, err := newJSArchive(*outputDir, run.BaseName)
+			if err != nil {
+				fatal("Error preparing --save-js", "error", err)
 			}
-			
-			fmt.Fprintf(f, "---\n\n")
+			run.Archive = archive
 		}
 	}
-	
-	return nil
-}
 
-func sanitizeDomain(domain string) string {
-	return strings.ReplaceAll(strings.ReplaceAll(domain, "https://", ""), "/", "_")
-}
+	if *dedupJSMode != DedupJSExact && *dedupJSMode != DedupJSQuery && *dedupJSMode != DedupJSHash {
+		fatal("Invalid --dedup-js-mode: expected exact, query or hash", "value", *dedupJSMode)
+	}
+	hashPattern, hashErr := regexp.Compile(*jsHashPattern)
+	if hashErr != nil {
+		fatal("Invalid --js-hash-pattern regex", "error", hashErr)
+	}
+	redact, redactErr := regexp.Compile(*redactPattern)
+	if redactErr != nil {
+		fatal("Invalid --redact-pattern regex", "error", redactErr)
+	}
+	redactor := newRedactor(redact, parseList(*redactHeaders))
 
-func main() {
-	domain := flag.String("domain", "", "Target domain to extract GraphQL queries from")
-	timeout := flag.Duration("timeout", 5*time.Minute, "Maximum time to wait for page to load and process")
-	progressInterval := flag.Duration("progress", 10*time.Second, "Progress report interval")
-	flag.Parse()
+	inferScalars = *inferScalarsFlag
+	omitTimestamps = *noTimestamp
+
+	// Load the previous export now, before this run's files can overwrite it
+	var previous *previousExport
+	if *diffPath != "" {
+		var err error
+		previous, err = loadPreviousExport(*diffPath)
+		if err != nil {
+			fatal("Error loading --diff export", "error", err)
+		}
+	}
+
+	// Only follow JS from the target's own hosts when asked to
+	var origins *OriginFilter
+	if *sameOrigin {
+		if runs[0].Domain == "" && *jsHostAllow == "" {
+			fatal("--same-origin with --proxy needs --domain or --js-host-allow to know which hosts to keep")
+		}
+		origins = newOriginFilter(runs[0].Domain, parseList(*jsHostAllow))
+	}
+
+	// Drop housekeeping traffic unless asked to keep it
+	var noise *NoiseFilter
+	if *ignoreNoise && !*noIgnoreNoise {
+		var err error
+		noise, err = newNoiseFilter(parseList(*noisePatterns))
+		if err != nil {
+			fatal("Invalid --noise-names", "error", err)
+		}
+	}
 
-	if *domain == "" {
-		log.Fatalf("No domain provided. Please specify a target domain using --domain.")
+	filter := OperationFilter{Types: make(map[OperationType]bool)}
+	for _, t := range parseList(*only) {
+		opType := OperationType(strings.ToLower(t))
+		if opType != Query && opType != Mutation && opType != Subscription {
+			fatal("Invalid --only type: expected query, mutation or subscription", "value", t)
+		}
+		filter.Types[opType] = true
+	}
+	if *nameFilter != "" {
+		re, err := regexp.Compile(*nameFilter)
+		if err != nil {
+			fatal("Invalid --name-filter regex", "error", err)
+		}
+		filter.Name = re
 	}
+	filter.MinDepth = *minDepth
 
 	// Initialize progress tracking
 	progress := &Progress{
 		StartTime: time.Now(),
+		Quiet:     *quiet,
+		Verbose:   *verbose,
 	}
 
-	// Start progress reporting
-	progressTicker := time.NewTicker(*progressInterval)
+	// Start progress reporting; the quiet progress line refreshes every second
+	reportInterval := *progressInterval
+	if progress.Quiet {
+		if reportInterval > time.Second {
+			reportInterval = time.Second
+		}
+	}
+	progressTicker := time.NewTicker(reportInterval)
 	defer progressTicker.Stop()
 	
 	go func() {
@@ -501,150 +2309,747 @@ func main() {
 		}
 	}()
 
-	// Setup timeout
-	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	// The run context ends the whole session; each target gets its own timeout below.
+	// Browser capture runs on its own context, which outlives an interrupt by
+	// interruptGrace so responses already on their way are still recorded.
+	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-
-	wd, cleanup, client, err := setupSelenium()
-	if err != nil {
-		log.Fatalf("Error setting up Selenium: %v", err)
-	}
-	defer cleanup()
+	captureCtx, cancelCapture := context.WithCancel(context.Background())
+	defer cancelCapture()
 
 	jsURLs := make(chan string, 100) // Buffer to prevent blocking
+	jsQueue := newURLQueue(jsURLs)    // Holds JS URLs until processed so capture never waits
+	netTracker := newNetworkTracker() // Requests in flight, to tell when a page has settled
+	scripts := newJSContentIndex()   // Content already processed by the current target, across URLs
+	linkCrawler.Network = netTracker
 	gqlCaptures := make(chan GraphQLCapture, 100)
-	var captures []GraphQLCapture
+	var handler CaptureHandler // Custom per-capture processing, set by --exec
+	var hooks *CaptureHooks    // Runs the handler off the capture goroutines
+	if *execCommand != "" {
+		hooks = newCaptureHooks(execCaptureHandler(*execCommand, redactor), captureHookWorkers, captureHookQueue)
+		handler = hooks.Handle
+	}
+	var currentRun int32 // Index of the target captures are attributed to
+
+	// Capture from a HAR file, through an intercepting proxy or by driving Chrome
+	var wd selenium.WebDriver
+	var client *cdp.Client
+	var captureProxy *CaptureProxy
+	var harContents map[string]string
+	var stopBrowser func()
+	var err error
+	if recording != nil {
+		harContents = captureHAR(ctx, recording, jsURLs, gqlCaptures, origins, handler, progress)
+	} else if *proxyAddr != "" {
+		captureProxy, err = newCaptureProxy(*proxyAddr, *proxyCADir, jsURLs, gqlCaptures, origins, scripts, handler, progress)
+		if err != nil {
+			slog.Error("Error setting up proxy", "error", err)
+			return exitSetupFailed
+		}
+		if upstreamProxy != nil {
+			// Chain the intercepted traffic to the upstream proxy, e.g. Burp
+			captureProxy.transport.Proxy = upstreamProxyFunc(upstreamProxy)
+		}
+		if err := captureProxy.Start(); err != nil {
+			slog.Error("Error starting proxy", "error", err)
+			return exitSetupFailed
+		}
+		defer captureProxy.Close()
+	} else {
+		var cleanup func()
+		wd, cleanup, client, err = setupSelenium(upstreamProxy)
+		if err != nil {
+			slog.Error("Error setting up Selenium", "error", err)
+			return exitSetupFailed
+		}
+		var once sync.Once
+		stopBrowser = func() { once.Do(cleanup) }
+		defer stopBrowser()
 
-	err = captureNetworkTraffic(client, jsURLs, gqlCaptures, progress)
-	if err != nil {
-		log.Fatalf("Error capturing network traffic: %v", err)
+		err = captureNetworkTraffic(captureCtx, client, jsURLs, gqlCaptures, origins, scripts, netTracker, *requestTTL, handler, progress)
+		if err != nil {
+			slog.Error("Error capturing network traffic", "error", err)
+			return exitSetupFailed
+		}
 	}
 
-	// Start a goroutine to collect captures
-	capturesDone := make(chan struct{})
+	// Ctrl+C or SIGTERM ends the session early but still saves what was captured; a
+	// second signal exits at once, closing the browser first
+	interrupts := make(chan os.Signal, 2)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		for capture := range gqlCaptures {
-			captures = append(captures, capture)
+		<-interrupts
+		slog.Warn("Interrupted, saving captured results (interrupt again to exit immediately)")
+		cancel()
+		time.AfterFunc(interruptGrace, cancelCapture)
+
+		<-interrupts
+		slog.Warn("Interrupted again, exiting without saving")
+		if stopBrowser != nil {
+			stopBrowser()
 		}
-		close(capturesDone)
+		os.Exit(exitInterrupted)
 	}()
 
-	log.Printf("Navigating to: %s", *domain)
-	err = wd.Get(*domain)
-	if err != nil {
-		log.Fatalf("Error loading the page: %v", err)
+	downloadOpts := newDownloadOptions(*downloadRetries, *cookie, client, upstreamProxy)
+	downloadOpts.MaxSize = *maxJSSize
+	downloadOpts.Offline = harContents
+	if *cacheDir != "" && !*noCache {
+		cache, err := newJSCache(*cacheDir, *cacheMaxAge)
+		if err != nil {
+			slog.Error("Error opening JS cache", "error", err)
+			return exitSetupFailed
+		}
+		downloadOpts.Cache = cache
 	}
 
-	// Wait a bit for the page to load and make requests
-	log.Println("Waiting for page to fully load and make GraphQL requests...")
-	select {
-	case <-time.After(10 * time.Second):
-	case <-ctx.Done():
-		log.Println("Timeout reached while waiting for page load")
+	// Session-wide files such as the stream are named after the only target, or as combined
+	baseFileName := runs[0].BaseName
+	if multiTarget {
+		baseFileName = combinedBaseName
+	}
+
+	// Optionally stream each capture and static operation to disk and/or stdout as it arrives
+	var streams []*CaptureStream
+	streamFile := *streamPath
+	if streamFile == "" && *stream {
+		streamFile = filepath.Join(*outputDir, baseFileName+".jsonl")
+	}
+	if streamFile != "" {
+		captureStream, err := newCaptureStream(streamFile, redactor)
+		if err != nil {
+			slog.Error("Error opening stream file", "error", err)
+			return exitSetupFailed
+		}
+		defer captureStream.Close()
+		streams = append(streams, captureStream)
+		slog.Info("Streaming captures", "file", streamFile)
+	}
+	if *stdoutNDJSON {
+		stdoutStream := newStdoutStream(*stdoutMaxResponse, redactor)
+		defer stdoutStream.Close()
+		streams = append(streams, stdoutStream)
 	}
 
-	sanitizedDomain := sanitizeDomain(*domain)
-	baseFileName := fmt.Sprintf("graphql_operations_%s", sanitizedDomain)
+	// Optionally announce each new unique operation as it is discovered
+	var notifier *WebhookNotifier
+	if *webhookURL != "" {
+		notifier = newWebhookNotifier(*webhookURL, runs[0].Domain, progress)
+	}
 
-	var allOperations []*GraphQLOperation
-	processedURLs := make(map[string]bool)
+	// Start a goroutine to collect captures. Once saving starts, late captures are no
+	// longer added to the results. Server-rendered state read from the page arrives on
+	// its own channel, which is never closed, so sending to it cannot race the capture
+	// goroutine closing gqlCaptures.
+	capturesDone := make(chan struct{})
+	ssrStates := make(chan GraphQLCapture)
+	var collectMu sync.Mutex
+	collecting := true
+	go func() {
+		defer close(capturesDone)
+		for {
+			var capture GraphQLCapture
+			select {
+			case received, ok := <-gqlCaptures:
+				if !ok {
+					return
+				}
+				capture = received
+			case capture = <-ssrStates:
+			}
+			if noise.IsNoise(capture.OperationName, capture.Query) {
+				atomic.AddInt32(&progress.NoiseFiltered, 1)
+				for _, s := range streams {
+					s.WriteFiltered(capture)
+				}
+				continue
+			}
+			if progress.Verbose {
+				slog.Info("Captured", "method", capture.Method, "operation", capture.OperationName, "url", capture.URL, "status", capture.Status)
+			}
+			for _, s := range streams {
+				s.Write(capture)
+			}
+			if notifier != nil && capture.Query != "" {
+				if op, err := ParseGraphQLOperation(captureDocument(capture)); err == nil {
+					notifier.Notify(op, capture.URL)
+				}
+			}
+			collectMu.Lock()
+			if *aggregate && collecting {
+				run := runs[atomic.LoadInt32(&currentRun)]
+				run.Captures = append(run.Captures, capture)
+			}
+			collectMu.Unlock()
+		}
+	}()
 
-	log.Println("Processing JavaScript files...")
-	log.Println("Continue browsing to capture more queries. Close the browser when done.")
+	sessionDone := make(chan struct{})
+	if recording != nil {
+		slog.Info("Extracting from HAR file", "file", *harInput)
+	} else if captureProxy != nil {
+		if proxyUntilInterrupt {
+			slog.Info("Route client traffic through the proxy to capture queries. Press Ctrl+C when done.")
+		} else {
+			slog.Info("Route client traffic through the proxy to capture queries. Press Ctrl+C when done.", "timeout", timeout.String())
+		}
+	} else if multiTarget {
+		slog.Info("Capturing targets. Close the browser to stop early.", "count", len(runs), "timeout", timeout.String())
+	} else {
+		slog.Info("Continue browsing to capture more queries. Close the browser when done.")
+	}
 	
 	// Monitor browser session
-	sessionDone := make(chan struct{})
 	go func() {
+		if wd == nil {
+			return
+		}
 		ticker := time.NewTicker(2 * time.Second)
 		defer ticker.Stop()
 		
-		for range ticker.C {
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				// Shutting down; the browser is about to be closed on purpose
+				return
+			}
+			
 			// Check if browser session is still active
 			_, err := wd.CurrentURL()
 			if err != nil {
-				log.Println("Browser session ended")
+				slog.Info("Browser session ended")
 				close(sessionDone)
 				return
 			}
 		}
 	}()
 	
-	// Process JS files continuously until the browser is closed
-	processing := true
-	for processing {
-		select {
-		case jsURL, ok := <-jsURLs:
-			if !ok {
-				// Channel closed, network monitoring ended
-				processing = false
-				break
+	sessionEnded := false
+	for i, run := range runs {
+		if sessionEnded || ctx.Err() != nil {
+			run.Err = fmt.Errorf("skipped, the session ended first")
+			continue
+		}
+		atomic.StoreInt32(&currentRun, int32(i))
+		if notifier != nil {
+			notifier.SetDomain(run.Domain)
+		}
+		if origins != nil {
+			origins.SetTarget(run.Domain)
+		}
+		scripts.NextTarget()
+		var targetCtx context.Context
+		var targetCancel context.CancelFunc
+		if proxyUntilInterrupt {
+			targetCtx, targetCancel = context.WithCancel(ctx)
+		} else {
+			targetCtx, targetCancel = context.WithTimeout(ctx, *timeout)
+		}
+		started := progressSnapshot(progress)
+		atomic.StoreInt64(&progress.LastActivity, time.Now().UnixNano())
+		
+		if wd != nil {
+			if *freshSession && i > 0 {
+				if err := clearBrowserState(targetCtx, client, runs[i-1].Domain); err != nil {
+					slog.Warn("Could not clear the browser session", "url", run.Domain, "error", err)
+				}
 			}
-			
-			// Skip if already processed
-			if processedURLs[jsURL] {
+			slog.Info("Navigating", "url", run.Domain)
+			if err := wd.Get(run.Domain); err != nil {
+				if !multiTarget {
+					slog.Error("Error loading the page", "error", err)
+					targetCancel()
+					return exitSetupFailed
+				}
+				// One unreachable target should not stop the others
+				slog.Error("Error loading target", "url", run.Domain, "error", err)
+				run.Err = err
+				targetCancel()
 				continue
 			}
-			processedURLs[jsURL] = true
 
-			jsContent, err := downloadJS(jsURL, progress)
-			if err != nil {
-				log.Printf("Error downloading JS from %s: %v", jsURL, err)
-				continue
+			// Wait until the page stops making requests
+			slog.Info("Waiting for page to fully load and make GraphQL requests")
+			loadStart := time.Now()
+			if netTracker.WaitSettled(targetCtx, *idleTimeout) {
+				slog.Info("Page settled", "after", time.Since(loadStart).Round(100*time.Millisecond).String())
+			} else {
+				slog.Warn("Timeout reached while waiting for page load")
 			}
 
-			operations, err := extractGraphQL(jsContent, progress)
-			if err != nil {
-				log.Printf("Error extracting GQL from %s: %v", jsURL, err)
-				continue
+			// Server-rendered pages embed results fetched before any request the
+			// browser makes
+			if source, err := wd.PageSource(); err == nil {
+				page, err := wd.CurrentURL()
+				if err != nil {
+					page = run.Domain
+				}
+				states := ssrCaptures(page, source)
+				for _, capture := range states {
+					select {
+					case ssrStates <- capture:
+					case <-capturesDone:
+					case <-targetCtx.Done():
+					}
+				}
+				if len(states) > 0 {
+					slog.Info("Read server-rendered GraphQL state", "url", page, "captures", len(states))
+				}
 			}
+		}
+
+		// Interact with the page, then walk the sitemap and the links in the background
+		// while JS files keep being processed
+		crawlDone := make(chan struct{})
+		if wd != nil && (*autoInteract || *crawlSitemap || *crawlDepth > 0) {
+			go func(target string) {
+				defer close(crawlDone)
+				if *autoInteract {
+					interactor.Interact(targetCtx, wd)
+				}
+				if *crawlSitemap && targetCtx.Err() == nil {
+					pages, err := fetchSitemapPages(downloadOpts.Client, target, *maxPages)
+					if err != nil {
+						slog.Warn("Could not read sitemap", "url", target, "error", err)
+					} else {
+						slog.Info("Read sitemap", "url", target, "pages", len(pages))
+						crawlPages(targetCtx, wd, target, pages, *pageDwell)
+					}
+				}
+				if *crawlDepth > 0 && targetCtx.Err() == nil {
+					linkCrawler.Crawl(targetCtx, wd, target)
+				}
+			}(run.Domain)
+		} else {
+			close(crawlDone)
+		}
 
-			allOperations = append(allOperations, operations...)
+		processedURLs := make(map[string]bool)
+		slog.Info("Processing JavaScript files")
+		
+		// Up to --workers files are downloaded and parsed at once; their operations are
+		// added here so the target's results are only changed by this goroutine
+		jsResults := make(chan jsResult)
+		jsSlots := make(chan struct{}, *workers)
+		inFlight := 0
+		addJSResult := func(result jsResult) {
+			if result.Unchanged {
+				// Its operations come back with the state; spreads in changed files
+				// still need its fragments
+				addFragments(run.Fragments, result.Fragments, result.URL)
+				run.JSEndpoints = appendUnique(run.JSEndpoints, result.Endpoints...)
+				return
+			}
+			if !result.Extracted {
+				return
+			}
+			addFragments(run.Fragments, result.Fragments, result.URL)
+			run.JSEndpoints = appendUnique(run.JSEndpoints, result.Endpoints...)
+			for _, op := range result.Operations {
+				if noise.IsNoise(op.Name, op.Raw) {
+					atomic.AddInt32(&progress.NoiseFiltered, 1)
+					for _, s := range streams {
+						s.WriteFilteredOperation(op)
+					}
+					continue
+				}
+				for _, s := range streams {
+					s.WriteOperation(op)
+				}
+				if notifier != nil {
+					notifier.Notify(op, result.URL)
+				}
+				run.Operations = append(run.Operations, op)
+			}
 			atomic.AddInt32(&progress.JSFilesProcessed, 1)
-			
-		case <-sessionDone:
-			log.Println("Browser closed by user, finishing up...")
-			processing = false
-			
-		case <-ctx.Done():
-			log.Println("Timeout reached, stopping processing")
-			processing = false
 		}
+		
+		// Check for a quiet network once the page has loaded and the crawl is over
+		var idleCheck <-chan time.Time
+		var idleTicker *time.Ticker
+		if *finishAfterIdle > 0 && wd != nil {
+			idleTicker = time.NewTicker(time.Second)
+			idleCheck = idleTicker.C
+		}
+		
+		// Process JS files continuously until the browser is closed
+		processing := true
+		for processing {
+			select {
+			case jsURL, ok := <-jsQueue.C():
+				if !ok {
+					// Channel closed, network monitoring ended
+					sessionEnded = true
+					processing = false
+					break
+				}
+				
+				// Skip if already processed, comparing URLs per --dedup-js-mode
+				key := jsDedupKey(jsURL, *dedupJSMode, hashPattern)
+				if processedURLs[key] {
+					if key != jsURL {
+						progress.Log("Skipping JS file, already processed", "url", jsURL, "processedAs", key)
+					}
+					continue
+				}
+				processedURLs[key] = true
+				if *listJS {
+					continue
+				}
+
+				// Skip the download when the response matches a processed file's ETag
+				if first, length, duplicate := scripts.Duplicate(jsURL); duplicate {
+					progress.Log("Skipping JS file, same ETag", "url", jsURL, "duplicateOf", first)
+					atomic.AddInt32(&progress.DuplicateJSSkipped, 1)
+					atomic.AddInt64(&progress.DuplicateJSBytes, length)
+					continue
+				}
+				// Its operations were found by an earlier run and are merged back in
+				if run.State != nil && run.State.Unchanged(jsURL, scripts.Validator(jsURL)) {
+					progress.Log("Skipping JS file, unchanged since the last run", "url", jsURL)
+					atomic.AddInt32(&progress.UnchangedJSSkipped, 1)
+					stats := &FileStats{URL: jsURL}
+					run.Files = append(run.Files, stats)
+					result := jsResult{URL: jsURL, Unchanged: true}
+					result.Fragments, result.Endpoints = run.State.Restore(jsURL, stats)
+					addJSResult(result)
+					continue
+				}
+
+				stats := &FileStats{URL: jsURL}
+				run.Files = append(run.Files, stats)
+				inFlight++
+				go func(jsURL string) {
+					jsSlots <- struct{}{}
+					result := processJSFile(targetCtx, jsURL, stats, run, scripts, downloadOpts, progress)
+					<-jsSlots
+					jsResults <- result
+				}(jsURL)
+				
+			case result := <-jsResults:
+				inFlight--
+				addJSResult(result)
+				
+			case <-sessionDone:
+				slog.Info("Capture session ended, finishing up")
+				sessionEnded = true
+				processing = false
+				
+			case <-idleCheck:
+				select {
+				case <-crawlDone:
+				default:
+					continue
+				}
+				idle := time.Since(time.Unix(0, atomic.LoadInt64(&progress.LastActivity)))
+				if idle < *finishAfterIdle || jsQueue.Len() > 0 || inFlight > 0 {
+					continue
+				}
+				if multiTarget {
+					slog.Info("No network activity, moving on", "url", run.Domain, "idle", idle.Round(time.Second).String())
+				} else {
+					slog.Info("No network activity, finishing up", "idle", idle.Round(time.Second).String())
+				}
+				processing = false
+				
+			case <-targetCtx.Done():
+				if ctx.Err() == context.Canceled {
+					slog.Info("Stopped by user, finishing up")
+				} else if multiTarget {
+					slog.Warn("Timeout reached, moving on", "url", run.Domain)
+					run.TimedOut = true
+				} else {
+					slog.Warn("Timeout reached, stopping processing")
+					run.TimedOut = true
+				}
+				processing = false
+			}
+		}
+		if idleTicker != nil {
+			idleTicker.Stop()
+		}
+		// Files already being processed are finished, or fail quickly after a timeout
+		for ; inFlight > 0; inFlight-- {
+			addJSResult(<-jsResults)
+		}
+		run.Progress = progressSnapshot(progress).since(started)
+		targetCancel()
+		// The next target must not navigate while the crawl is still loading a page
+		<-crawlDone
 	}
 
 	// Final progress report
-	progress.Report()
+	progressTicker.Stop()
+	progress.Finish()
 
-	// Wait for captures to finish
-	<-capturesDone
+	// Stop the proxy so the capture channel closes
+	if captureProxy != nil {
+		captureProxy.Close()
+	}
 
-	// Convert network captures to operations
-	for _, capture := range captures {
-		if capture.Query != "" {
-			op, err := ParseGraphQLOperation(capture.Query)
-			if err == nil {
-				// Add variables from capture
-				if len(capture.Variables) > 0 && len(op.Variables) == 0 {
-					op.Variables = make(map[string]string)
-					for k := range capture.Variables {
-						op.Variables[k] = "Any" // Default type
-					}
+	// Stop the capture goroutine, which flushes pending requests and closes its channels.
+	// After an interrupt it gets the grace period and the browser is closed then; after
+	// a timeout or --finish-after-idle the browser is still open and capture stops now.
+	if ctx.Err() == context.Canceled {
+		<-captureCtx.Done()
+		if stopBrowser != nil {
+			stopBrowser()
+		}
+	} else {
+		cancelCapture()
+	}
+
+	// Keep draining JS URLs so the queue does not grow for the rest of the run
+	go func() {
+		for range jsQueue.C() {
+		}
+	}()
+
+	// Wait for captures to finish, but save what was collected even if they do not
+	waitForCaptures(capturesDone, captureShutdownTimeout)
+	collectMu.Lock()
+	collecting = false
+	collectMu.Unlock()
+	if hooks != nil {
+		hooks.Close()
+	}
+	if notifier != nil {
+		notifier.Wait()
+	}
+
+	// Dry run: print what would have been downloaded and stop
+	if *listJS {
+		files := progress.JSFiles()
+		for _, jsURL := range files {
+			fmt.Println(jsURL)
+		}
+		slog.Info("Listed JS files without downloading them", "count", len(files))
+		return exitStatus(ctx, runs, false)
+	}
+
+	for _, run := range runs {
+		if multiTarget {
+			slog.Info("Processing results", "url", run.Domain)
+		}
+
+		// Fill in responses whose bodies the browser no longer had
+		backfillResponses(run.Captures)
+
+		// Complete operations that spread fragments defined elsewhere in the bundles
+		resolveFragments(run.Operations, run.Fragments)
+		if len(run.Fragments) > 0 {
+			slog.Info("Resolved fragment spreads", "fragments", len(run.Fragments))
+		}
+
+		// Convert network captures to operations
+		run.Operations = append(run.Operations, operationsFromCaptures(run.Captures)...)
+		
+		// Attribute statically extracted operations to the endpoint they were seen on
+		assignEndpoints(run.Operations)
+
+		// Drop regex false positives that a real GraphQL parser rejects
+		if *validate {
+			var invalid int
+			run.Operations, invalid = validateOperations(run.Operations)
+			slog.Info("Validation dropped invalid operations", "count", invalid, "remaining", len(run.Operations))
+		}
+
+		// Keep only the operations the user asked for
+		if filter.Active() {
+			run.Operations = filter.FilterOperations(run.Operations)
+			run.Captures = filter.FilterCaptures(run.Captures)
+			slog.Info("Filtered results", "operations", len(run.Operations), "captures", len(run.Captures))
+		}
+		
+		// Optionally ask each endpoint for its schema
+		if *probe {
+			results := probeIntrospection(run.Captures, downloadOpts)
+			annotateWithIntrospection(run.Operations, results)
+			run.Schema = introspectedTypes(results)
+			if !*noFiles {
+				if err := saveIntrospectionResults(results, run.OutputDir, run.BaseName); err != nil {
+					slog.Error("Error saving introspection results", "error", err)
 				}
-				allOperations = append(allOperations, op)
 			}
 		}
 	}
+
+	// Fold in what earlier runs found, so the output covers every run
+	if *resume {
+		for _, run := range runs {
+			if run.State == nil || run.Err != nil {
+				continue
+			}
+			found, captured := len(run.Operations), len(run.Captures)
+			run.Operations = run.State.Merge(run.Operations, progress.StartTime)
+			run.Captures = run.State.MergeCaptures(run.Captures)
+			newCaptures := run.State.RecordCaptures(run.Captures[:captured], redactor)
+			slog.Info("Merged results from earlier runs", "url", run.Domain, "found", found,
+				"fromEarlierRuns", len(run.Operations)-found, "newCaptures", newCaptures,
+				"capturesFromEarlierRuns", len(run.Captures)-captured)
+			if err := run.State.Save(); err != nil {
+				slog.Error("Error saving state", "url", run.Domain, "error", err)
+			}
+		}
+	}
+	
+	// Everything collected across targets, for the combined output and the summary
+	var allOperations []*GraphQLOperation
+	var captures []GraphQLCapture
+	for _, run := range runs {
+		allOperations = append(allOperations, run.Operations...)
+		captures = append(captures, run.Captures...)
+	}
+	
+	if !*aggregate {
+		if streamFile != "" {
+			slog.Info("Skipping aggregate export; captures were streamed", "file", streamFile)
+		} else {
+			slog.Info("Skipping aggregate export")
+		}
+		return exitStatus(ctx, runs, *failOnEmpty)
+	}
 	
-	log.Printf("Saving results...")
-	if err := saveOperations(allOperations, captures, baseFileName); err != nil {
-		log.Printf("Error saving files: %v", err)
+	saveOpts := SaveOptions{
+		Formats:         make(map[string]bool),
+		HARMaxBody:      *harMaxBody,
+		MergeByName:     *mergeByName,
+		StripDirectives: *stripDirs,
+		KeepDirectives:  parseList(*keepDirs),
+		SessionStart:    progress.StartTime,
+		ExampleLimit:    *exampleLimit,
+		SampleVars:      *sampleVars,
+		GroupByRoot:     *groupByRoot,
+		Sort:            *sortOutput,
+		Redact:          redactor,
+		DupReport:       *dupReport,
+		Previous:        previous,
+	}
+	for _, f := range parseList(*format) {
+		saveOpts.Formats[strings.ToLower(f)] = true
+	}
+	if *har {
+		saveOpts.Formats["har"] = true
+	}
+	if *curl {
+		saveOpts.Formats["curl"] = true
+	}
+	if *persisted {
+		saveOpts.Formats["persisted"] = true
+	}
+	if *sqliteOut {
+		saveOpts.Formats["sqlite"] = true
+	}
+	if *noFiles {
+		slog.Info("Skipping output files")
+	} else {
+		slog.Info("Saving results")
+		for _, run := range runs {
+			if run.Err != nil {
+				continue
+			}
+			saveOpts.Domain = run.Domain
+			saveOpts.JSEndpoints = run.JSEndpoints
+			saveOpts.Files = run.Files
+			saveOpts.OutputDir = run.OutputDir
+			saveOpts.Schema = run.Schema
+			if *fragmentsSection {
+				saveOpts.Fragments = sortedFragments(run.Fragments)
+			}
+			if err := saveOperations(run.Operations, run.Captures, run.BaseName, saveOpts); err != nil {
+				slog.Error("Error saving files", "url", run.Domain, "error", err)
+			}
+		}
+		if multiTarget && *combined {
+			saveOpts.Domain = ""
+			saveOpts.JSEndpoints = nil
+			saveOpts.Files = nil
+			saveOpts.OutputDir = *outputDir
+			saveOpts.Schema = nil
+			for _, run := range runs {
+				saveOpts.JSEndpoints = appendUnique(saveOpts.JSEndpoints, run.JSEndpoints...)
+				saveOpts.Files = append(saveOpts.Files, run.Files...)
+				for name, t := range run.Schema {
+					if saveOpts.Schema == nil {
+						saveOpts.Schema = make(map[string]IntrospectionType)
+					}
+					if _, ok := saveOpts.Schema[name]; !ok {
+						saveOpts.Schema[name] = t
+					}
+				}
+			}
+			if *fragmentsSection {
+				allFragments := make(map[string]*Fragment)
+				for _, run := range runs {
+					addFragments(allFragments, run.Fragments, "")
+				}
+				saveOpts.Fragments = sortedFragments(allFragments)
+			}
+			if err := saveOperations(allOperations, captures, combinedBaseName, saveOpts); err != nil {
+				slog.Error("Error saving combined files", "error", err)
+			}
+		}
+	}
+
+	uniqueOperations := DeduplicateOperations(allOperations)
+	totals := []interface{}{
+		"jsProcessed", atomic.LoadInt32(&progress.JSFilesProcessed),
+		"bytesDownloaded", atomic.LoadInt64(&progress.TotalBytesDownloaded),
+	}
+	if hits := atomic.LoadInt32(&progress.JSCacheHits); hits > 0 {
+		totals = append(totals, "jsCacheHits", hits, "jsCacheBytes", atomic.LoadInt64(&progress.JSCacheBytes))
+	}
+	if filter.Active() {
+		totals = append(totals,
+			"queriesKept", countOperationType(allOperations, Query),
+			"mutationsKept", countOperationType(allOperations, Mutation),
+			"subscriptionsKept", countOperationType(allOperations, Subscription),
+			"capturesKept", len(captures))
+	} else {
+		totals = append(totals,
+			"operationsMatched", atomic.LoadInt32(&progress.OperationsMatched),
+			"uniqueQueries", atomic.LoadInt32(&progress.QueriesFound),
+			"uniqueMutations", atomic.LoadInt32(&progress.MutationsFound),
+			"uniqueSubscriptions", atomic.LoadInt32(&progress.SubscriptionsFound),
+			"captures", atomic.LoadInt32(&progress.NetworkCaptures))
+	}
+	totals = append(totals, "uniqueOperations", len(uniqueOperations))
+	slog.Info("Extraction complete", totals...)
+	reportCoverage(correlateCaptures(uniqueOperations, captures))
+	reportEndpoints(captures)
+	reportErrors(captures)
+	reportLatencies(captures)
+	if multiTarget {
+		reportTargets(runs)
+		slog.Info("Results saved, one base name per target", "dir", *outputDir)
+	} else {
+		slog.Info("Results saved", "dir", *outputDir, "baseName", baseFileName)
+	}
+	return exitStatus(ctx, runs, *failOnEmpty)
+}
+
+// exitStatus returns the exit status of a finished run and logs what it means. The run
+// is partial when an interrupt cancelled it or a target timed out, failed or was
+// skipped; otherwise it is empty, with failOnEmpty, when no target found anything.
+func exitStatus(ctx context.Context, runs []*targetRun, failOnEmpty bool) int {
+	partial := ctx.Err() == context.Canceled
+	found := false
+	for _, run := range runs {
+		if run.TimedOut || run.Err != nil {
+			partial = true
+		}
+		if len(run.Operations) > 0 || len(run.Captures) > 0 {
+			found = true
+		}
 	}
 
-	log.Printf("\nExtraction complete!")
-	log.Printf("Total JS files processed: %d", atomic.LoadInt32(&progress.JSFilesProcessed))
-	log.Printf("Total data downloaded: %.2f MB", float64(atomic.LoadInt64(&progress.TotalBytesDownloaded))/(1024*1024))
-	log.Printf("Total queries found: %d", atomic.LoadInt32(&progress.QueriesFound))
-	log.Printf("Total mutations found: %d", atomic.LoadInt32(&progress.MutationsFound))
-	log.Printf("Total network captures: %d", atomic.LoadInt32(&progress.NetworkCaptures))
-	log.Printf("Total unique operations: %d", len(DeduplicateOperations(allOperations)))
-	log.Printf("Results saved to output/ directory with base name: %s", baseFileName)
+	code := exitOK
+	if partial {
+		code = exitPartial
+	} else if !found && failOnEmpty {
+		code = exitEmpty
+	}
+	slog.Info("Exiting", "code", code, "meaning", exitMeanings[code])
+	return code
 }
\ No newline at end of file
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mafredri/cdp/protocol/network"
+)
+
+// graphQLRequest builds a pending POST of a GraphQL body, as the CDP goroutine keeps it
+func graphQLRequest(body string) *pendingRequest {
+	return &pendingRequest{
+		request: &network.Request{
+			URL:      "https://example.com/graphql",
+			Method:   "POST",
+			Headers:  network.Headers(`{"Content-Type":"application/json"}`),
+			PostData: &body,
+		},
+		timestamp: 100,
+		wallTime:  time.Unix(1700000000, 0),
+		page:      "https://example.com/app",
+	}
+}
+
+// graphQLResponse builds the responseReceived event answering a request
+func graphQLResponse(status int, timestamp network.MonotonicTime) *network.ResponseReceivedReply {
+	return &network.ResponseReceivedReply{
+		Timestamp: timestamp,
+		Response: network.Response{
+			URL:               "https://example.com/graphql?v=2",
+			Status:            status,
+			Headers:           network.Headers(`{"Content-Type":"application/json"}`),
+			MimeType:          "application/json",
+			EncodedDataLength: 42,
+		},
+	}
+}
+
+func TestCompleteCapturePairsRequestAndResponse(t *testing.T) {
+	pending := graphQLRequest(`{"query":"query GetUser($id: ID!) { user(id: $id) { name } }","operationName":"GetUser","variables":{"id":"1"}}`)
+	capture := completeCapture(pending, graphQLResponse(200, 100.25), `{"data":{"user":{"name":"Ada"}}}`, nil)
+
+	if capture.Query != "query GetUser($id: ID!) { user(id: $id) { name } }" || capture.OperationName != "GetUser" {
+		t.Errorf("request side = (%q, %q)", capture.Query, capture.OperationName)
+	}
+	if capture.Variables["id"] != "1" {
+		t.Errorf("variables = %v", capture.Variables)
+	}
+	if capture.URL != "https://example.com/graphql?v=2" || capture.Status != 200 || capture.ContentType != "application/json" {
+		t.Errorf("response side = (%s, %d, %s)", capture.URL, capture.Status, capture.ContentType)
+	}
+	if capture.DurationMs != 250 {
+		t.Errorf("DurationMs = %v, want 250", capture.DurationMs)
+	}
+	if capture.ResponseSize != 42 {
+		t.Errorf("ResponseSize = %d, want the encoded length 42", capture.ResponseSize)
+	}
+	if !capture.StartedAt.Equal(pending.wallTime) {
+		t.Errorf("StartedAt = %v, want %v", capture.StartedAt, pending.wallTime)
+	}
+	if capture.PageURL != pending.page {
+		t.Errorf("PageURL = %q, want %q", capture.PageURL, pending.page)
+	}
+	if capture.BodyUnavailable || capture.Response == nil || capture.HasErrors {
+		t.Errorf("body = (unavailable %v, response %v, errors %v)", capture.BodyUnavailable, capture.Response, capture.HasErrors)
+	}
+}
+
+func TestCompleteCaptureBodies(t *testing.T) {
+	const request = `{"query":"query A { a }","operationName":"A"}`
+	tests := []struct {
+		name        string
+		body        string
+		bodyErr     error
+		unavailable bool
+		hasResponse bool
+		errors      int
+	}{
+		{"body fetch failed", "", errors.New("No resource with given identifier found"), true, false, 0},
+		{"empty body", "", nil, true, false, 0},
+		{"not JSON", "<html>502 Bad Gateway</html>", nil, false, false, 0},
+		{"GraphQL errors", `{"errors":[{"message":"Cannot query field \"b\""}],"data":null}`, nil, false, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capture := completeCapture(graphQLRequest(request), graphQLResponse(500, 101), tt.body, tt.bodyErr)
+			if capture.Query != "query A { a }" || capture.Status != 500 {
+				t.Errorf("capture lost its request or status: (%q, %d)", capture.Query, capture.Status)
+			}
+			if capture.BodyUnavailable != tt.unavailable {
+				t.Errorf("BodyUnavailable = %v, want %v", capture.BodyUnavailable, tt.unavailable)
+			}
+			if (capture.Response != nil) != tt.hasResponse {
+				t.Errorf("Response = %v, want present %v", capture.Response, tt.hasResponse)
+			}
+			if len(capture.Errors) != tt.errors || capture.HasErrors != (tt.errors > 0) {
+				t.Errorf("Errors = %v (HasErrors %v), want %d", capture.Errors, capture.HasErrors, tt.errors)
+			}
+		})
+	}
+}
+
+func TestCompleteCaptureClockSkew(t *testing.T) {
+	// A response timestamp before the request's cannot give a duration
+	capture := completeCapture(graphQLRequest(`{"query":"{ a }"}`), graphQLResponse(200, 50), `{"data":{}}`, nil)
+	if capture.DurationMs != 0 {
+		t.Errorf("DurationMs = %v, want 0", capture.DurationMs)
+	}
+}
+
+// multipartRequest builds a graphql-multipart-request-spec upload: the operations and
+// map fields followed by one file part per map entry
+func multipartRequest(t *testing.T, operations, fileMap string, files ...string) *network.Request {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := w.WriteField("operations", operations); err != nil {
+		t.Fatal(err)
+	}
+	if fileMap != "" {
+		if err := w.WriteField("map", fileMap); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, name := range files {
+		part, err := w.CreateFormFile(string(rune('0'+i)), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte("file contents"))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	postData := body.String()
+	return &network.Request{
+		URL:      "https://example.com/upload",
+		Method:   "POST",
+		Headers:  network.Headers(`{"content-type":"` + w.FormDataContentType() + `"}`),
+		PostData: &postData,
+	}
+}
+
+func TestMultipartUploads(t *testing.T) {
+	tests := []struct {
+		name       string
+		operations string
+		fileMap    string
+		files      []string
+		query      string
+		opName     string
+		variables  map[string]interface{}
+		uploads    []string
+	}{
+		{
+			name:       "single file",
+			operations: `{"query":"mutation Upload($file: Upload!) { upload(file: $file) { id } }","operationName":"Upload","variables":{"file":null}}`,
+			fileMap:    `{"0":["variables.file"]}`,
+			files:      []string{"a.png"},
+			query:      "mutation Upload($file: Upload!) { upload(file: $file) { id } }",
+			opName:     "Upload",
+			variables:  map[string]interface{}{"file": nil},
+			uploads:    []string{"variables.file"},
+		},
+		{
+			name:       "file list",
+			operations: `{"query":"mutation Many($files: [Upload!]!) { many(files: $files) }","variables":{"files":[null,null]}}`,
+			fileMap:    `{"0":["variables.files.0"],"1":["variables.files.1"]}`,
+			files:      []string{"a.png", "b.png"},
+			query:      "mutation Many($files: [Upload!]!) { many(files: $files) }",
+			opName:     "Many", // Taken from the query without an operationName field
+			variables:  map[string]interface{}{"files": []interface{}{nil, nil}},
+			uploads:    []string{"variables.files.0", "variables.files.1"},
+		},
+		{
+			name:       "batch",
+			operations: `[{"query":"mutation A($f: Upload) { a(f: $f) }","operationName":"A","variables":{"f":null}},{"query":"mutation B { b }"}]`,
+			fileMap:    `{"0":["0.variables.f"]}`,
+			files:      []string{"a.png"},
+			query:      "mutation A($f: Upload) { a(f: $f) }",
+			opName:     "A",
+			variables:  map[string]interface{}{"f": nil},
+			uploads:    []string{"variables.f"},
+		},
+		{
+			name:       "no map field",
+			operations: `{"query":"mutation C { c }","operationName":"C"}`,
+			query:      "mutation C { c }",
+			opName:     "C",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := multipartRequest(t, tt.operations, tt.fileMap, tt.files...)
+			if !isGraphQLRequest(req) {
+				t.Error("upload not detected as a GraphQL request")
+			}
+			capture := newCapture(req)
+			if capture.Query != tt.query || capture.OperationName != tt.opName {
+				t.Errorf("operation = (%q, %q), want (%q, %q)", capture.Query, capture.OperationName, tt.query, tt.opName)
+			}
+			if !reflect.DeepEqual(capture.Variables, tt.variables) {
+				t.Errorf("variables = %v, want %v", capture.Variables, tt.variables)
+			}
+			if !reflect.DeepEqual(capture.UploadVariables, tt.uploads) {
+				t.Errorf("upload variables = %v, want %v", capture.UploadVariables, tt.uploads)
+			}
+		})
+	}
+}
+
+// fakeStream replays CDP events sent by a test. Once closed, Recv fails like a lost
+// connection after the queued events.
+type fakeStream[T any] struct {
+	mu     sync.Mutex
+	events []*T
+	ready  chan struct{} // Closed while an event is queued or the stream is closed
+	closed bool
+}
+
+func newFakeStream[T any]() *fakeStream[T] {
+	return &fakeStream[T]{ready: make(chan struct{})}
+}
+
+func (s *fakeStream[T]) Send(event *T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.events = append(s.events, event)
+	if len(s.events) == 1 {
+		close(s.ready)
+	}
+}
+
+func (s *fakeStream[T]) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+func (s *fakeStream[T]) Ready() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ready
+}
+
+func (s *fakeStream[T]) Recv() (*T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.events) == 0 {
+		return nil, errors.New("rpcc: the connection is closing")
+	}
+	event := s.events[0]
+	s.events = s.events[1:]
+	if len(s.events) == 0 && !s.closed {
+		s.ready = make(chan struct{})
+	}
+	return event, nil
+}
+
+func (s *fakeStream[T]) RecvMsg(m interface{}) error {
+	return errors.New("fakeStream: RecvMsg not supported")
+}
+
+func (s *fakeStream[T]) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		if len(s.events) == 0 {
+			close(s.ready)
+		}
+	}
+	return nil
+}
+
+// fakeNetwork holds the event streams of a fake browser
+type fakeNetwork struct {
+	requests  *fakeStream[network.RequestWillBeSentReply]
+	responses *fakeStream[network.ResponseReceivedReply]
+	failed    *fakeStream[network.LoadingFailedReply]
+	finished  *fakeStream[network.LoadingFinishedReply]
+}
+
+// startFakeCapture runs the capture goroutine on fake streams, returning its channels
+func startFakeCapture(ctx context.Context) (*fakeNetwork, chan string, chan GraphQLCapture) {
+	fake := &fakeNetwork{
+		requests:  newFakeStream[network.RequestWillBeSentReply](),
+		responses: newFakeStream[network.ResponseReceivedReply](),
+		failed:    newFakeStream[network.LoadingFailedReply](),
+		finished:  newFakeStream[network.LoadingFinishedReply](),
+	}
+	events := networkEvents{
+		requests:  fake.requests,
+		responses: fake.responses,
+		failed:    fake.failed,
+		finished:  fake.finished,
+		responseBody: func(ctx context.Context, id network.RequestID) (string, error) {
+			return `{"data":{"viewer":{"id":"1"}}}`, nil
+		},
+	}
+	jsURLs := make(chan string, 10)
+	gqlCaptures := make(chan GraphQLCapture, 10)
+	go processNetworkEvents(ctx, events, jsURLs, gqlCaptures, nil, newJSContentIndex(), newNetworkTracker(), 0, nil, &Progress{})
+	return fake, jsURLs, gqlCaptures
+}
+
+// sendRequest queues a GraphQL request and waits until the goroutine has taken it, so
+// its response cannot be seen first
+func (f *fakeNetwork) sendRequest(t *testing.T, id network.RequestID) {
+	t.Helper()
+	f.requests.Send(&network.RequestWillBeSentReply{
+		RequestID:   id,
+		Request:     *graphQLRequest(`{"query":"query Viewer { viewer { id } }","operationName":"Viewer"}`).request,
+		DocumentURL: "https://example.com/app",
+	})
+	deadline := time.Now().Add(time.Second)
+	for f.requests.Len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("request event was not read")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waitClosed drains ch and fails if it is not closed within a second
+func waitClosed[T any](t *testing.T, name string, ch <-chan T) []T {
+	t.Helper()
+	var got []T
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case v, ok := <-ch:
+			if !ok {
+				return got
+			}
+			got = append(got, v)
+		case <-timeout:
+			t.Fatalf("%s was not closed", name)
+		}
+	}
+}
+
+func TestNetworkEventsStopOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fake, jsURLs, gqlCaptures := startFakeCapture(ctx)
+
+	fake.sendRequest(t, "1")
+	fake.responses.Send(&network.ResponseReceivedReply{
+		RequestID: "2",
+		Type:      network.ResourceTypeScript,
+		Response: network.Response{
+			URL:      "https://example.com/app.js",
+			Headers:  network.Headers(`{}`),
+			MimeType: "application/javascript",
+		},
+	})
+	resp := graphQLResponse(200, 0)
+	resp.RequestID = "1"
+	fake.responses.Send(resp)
+
+	select {
+	case url := <-jsURLs:
+		if url != "https://example.com/app.js" {
+			t.Errorf("JS URL = %q", url)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("JS URL not captured")
+	}
+	select {
+	case capture := <-gqlCaptures:
+		if capture.OperationName != "Viewer" || capture.Status != 200 || capture.Pending {
+			t.Errorf("capture = %q status %d pending %v", capture.OperationName, capture.Status, capture.Pending)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("GraphQL response not captured")
+	}
+
+	// The streams stay open, as when the browser hangs; cancelling must still end the goroutine
+	cancel()
+	waitClosed(t, "jsURLs", jsURLs)
+	waitClosed(t, "gqlCaptures", gqlCaptures)
+}
+
+func TestNetworkEventsStopOnStreamError(t *testing.T) {
+	fake, jsURLs, gqlCaptures := startFakeCapture(context.Background())
+
+	// A request still waiting for its response is emitted as pending when the connection drops
+	fake.sendRequest(t, "1")
+	fake.requests.Close()
+
+	captures := waitClosed(t, "gqlCaptures", gqlCaptures)
+	waitClosed(t, "jsURLs", jsURLs)
+	if len(captures) != 1 || captures[0].OperationName != "Viewer" || !captures[0].Pending {
+		t.Fatalf("captures = %+v, want one pending Viewer", captures)
+	}
+}
+
+func TestWaitForCaptures(t *testing.T) {
+	done := make(chan struct{})
+	close(done)
+	if !waitForCaptures(done, time.Second) {
+		t.Error("finished capture reported as timed out")
+	}
+
+	// A capture goroutine that never closes its channels must not block saving
+	start := time.Now()
+	if waitForCaptures(make(chan struct{}), 20*time.Millisecond) {
+		t.Error("stuck capture reported as finished")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("wait took %v, want about the timeout", elapsed)
+	}
+}
+
+// foundOperations returns what several workers extracted from three bundles, with the
+// same operations found in more than one file
+func foundOperations() ([]*GraphQLOperation, []*FileStats) {
+	found := func(source string, line int, raw string) *GraphQLOperation {
+		op, err := ParseGraphQLOperation(raw)
+		if err != nil {
+			panic(err)
+		}
+		op.Source, op.Line, op.Sources = source, line, []string{source}
+		return op
+	}
+	operations := []*GraphQLOperation{
+		found("https://example.com/b.js", 7, "query Viewer { viewer { id } }"),
+		found("https://example.com/a.js", 3, "query Viewer {\n  viewer { id }\n}"),
+		found("https://example.com/c.js", 1, "query Viewer { viewer { id } }"),
+		found("https://example.com/c.js", 9, "mutation Save($id: ID!) { save(id: $id) }"),
+		found("https://example.com/b.js", 2, "mutation Save($id: ID!) { save(id: $id) }"),
+		found("https://example.com/a.js", 5, "query Feed { feed { title } }"),
+	}
+	files := []*FileStats{
+		{URL: "https://example.com/c.js", Matches: 2},
+		{URL: "https://example.com/a.js", Matches: 2},
+		{URL: "https://example.com/b.js", Matches: 2},
+	}
+	return operations, files
+}
+
+func TestSaveOperationsIgnoresInputOrder(t *testing.T) {
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer func(saved bool) {
+		slog.SetDefault(logger)
+		omitTimestamps = saved
+	}(omitTimestamps)
+	omitTimestamps = true
+
+	var want map[string]string
+	for seed := int64(0); seed < 5; seed++ {
+		operations, files := foundOperations()
+		shuffle := rand.New(rand.NewSource(seed))
+		shuffle.Shuffle(len(operations), func(i, j int) { operations[i], operations[j] = operations[j], operations[i] })
+		shuffle.Shuffle(len(files), func(i, j int) { files[i], files[j] = files[j], files[i] })
+
+		dir := t.TempDir()
+		opts := SaveOptions{Formats: map[string]bool{"csv": true, "markdown": true}, Files: files, OutputDir: dir, Sort: true}
+		if err := saveOperations(operations, nil, "run", opts); err != nil {
+			t.Fatal(err)
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]string)
+		for _, entry := range entries {
+			data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got[entry.Name()] = string(data)
+		}
+
+		if want == nil {
+			want = got
+			continue
+		}
+		if len(got) != len(want) {
+			t.Fatalf("seed %d wrote %d files, want %d", seed, len(got), len(want))
+		}
+		for name, content := range want {
+			if got[name] != content {
+				t.Errorf("seed %d: %s differs:\n%s\nwant:\n%s", seed, name, got[name], content)
+			}
+		}
+	}
+}
+
+func TestDeduplicateKeepsLowestSource(t *testing.T) {
+	operations, _ := foundOperations()
+	unique, counts := DeduplicateOperationsWithCounts(operations)
+	if len(unique) != 3 {
+		t.Fatalf("got %d unique operations, want 3", len(unique))
+	}
+	for _, op := range unique {
+		switch op.Name {
+		case "Viewer":
+			if sourceLocation(op) != "https://example.com/a.js:3" || counts[canonicalHash(op)] != 3 {
+				t.Errorf("Viewer kept from %s with count %d, want a.js:3 and 3", sourceLocation(op), counts[canonicalHash(op)])
+			}
+			if want := []string{"https://example.com/a.js", "https://example.com/b.js", "https://example.com/c.js"}; !reflect.DeepEqual(op.Sources, want) {
+				t.Errorf("Viewer sources = %v, want %v", op.Sources, want)
+			}
+		case "Save":
+			if sourceLocation(op) != "https://example.com/b.js:2" {
+				t.Errorf("Save kept from %s, want b.js:2", sourceLocation(op))
+			}
+		}
+	}
+}
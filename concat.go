@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+)
+
+const (
+	maxConcatParts = 256     // String literals joined into one chain at most
+	maxConcatSize  = 1 << 16 // Bytes a merged chain may reach before it is abandoned
+)
+
+// mergeConcatenatedStrings returns the joined text of string literal chains that
+// minifiers split queries into: "a"+"b", 'a'.concat('b') and ["a","b"].join(""), with
+// the span each chain covers in content. Only chains of adjacent literals are merged,
+// so a chain never crosses a statement, and only merged text that mentions an
+// operation or fragment keyword is returned.
+func mergeConcatenatedStrings(content string) ([]string, [][2]int) {
+	var merged []string
+	var spans [][2]int
+	for i := 0; i < len(content); i++ {
+		start := i
+		var parts []string
+		end := i
+		switch content[i] {
+		case '"', '\'':
+			parts, end = readConcatChain(content, i)
+		case '[':
+			parts, end = readJoinedArray(content, i)
+		default:
+			continue
+		}
+		if end > i {
+			i = end - 1
+		}
+		if len(parts) < 2 {
+			continue
+		}
+		if text := strings.Join(parts, ""); operationKeywordPattern.MatchString(text) || fragmentDefinitionPattern.MatchString(text) {
+			merged = append(merged, text)
+			spans = append(spans, [2]int{start, end})
+		}
+	}
+	return merged, spans
+}
+
+// readConcatChain reads a literal at start followed by any number of + "..." and
+// .concat("...", ...) continuations. It returns the decoded parts and the index just
+// past the chain; a chain that grows past the limits yields no parts.
+func readConcatChain(content string, start int) ([]string, int) {
+	first, end, ok := readJSLiteral(content, start)
+	if !ok {
+		return nil, start + 1
+	}
+	parts := []string{first}
+	size := len(first)
+
+	for {
+		next := skipJSSpace(content, end)
+		var added []string
+		var after int
+		switch {
+		case strings.HasPrefix(content[next:], "+"):
+			part, partEnd, ok := readJSLiteral(content, skipJSSpace(content, next+1))
+			if !ok {
+				return parts, end
+			}
+			added, after = []string{part}, partEnd
+		case strings.HasPrefix(content[next:], ".concat("):
+			list, listEnd, ok := readLiteralList(content, next+len(".concat("), ')')
+			if !ok {
+				return parts, end
+			}
+			added, after = list, listEnd
+		default:
+			return parts, end
+		}
+
+		for _, part := range added {
+			size += len(part)
+		}
+		parts = append(parts, added...)
+		if len(parts) > maxConcatParts || size > maxConcatSize {
+			return nil, after
+		}
+		end = after
+	}
+}
+
+// readJoinedArray reads ["...", "..."].join("") at start, returning its decoded parts
+// and the index just past the join call
+func readJoinedArray(content string, start int) ([]string, int) {
+	parts, end, ok := readLiteralList(content, start+1, ']')
+	if !ok || len(parts) > maxConcatParts {
+		return nil, start + 1
+	}
+	join := skipJSSpace(content, end)
+	for _, call := range []string{`.join("")`, `.join('')`} {
+		if strings.HasPrefix(content[join:], call) {
+			return parts, join + len(call)
+		}
+	}
+	return nil, start + 1
+}
+
+// readLiteralList reads comma-separated string literals up to the closing bracket,
+// returning them and the index just past the bracket. Anything other than a literal
+// fails the list.
+func readLiteralList(content string, start int, closing byte) ([]string, int, bool) {
+	var parts []string
+	size := 0
+	i := skipJSSpace(content, start)
+	for i < len(content) && content[i] != closing {
+		part, end, ok := readJSLiteral(content, i)
+		if !ok {
+			return nil, 0, false
+		}
+		parts = append(parts, part)
+		size += len(part)
+		if size > maxConcatSize {
+			return nil, 0, false
+		}
+		i = skipJSSpace(content, end)
+		if i < len(content) && content[i] == ',' {
+			i = skipJSSpace(content, i+1)
+		}
+	}
+	if i >= len(content) || len(parts) == 0 {
+		return nil, 0, false
+	}
+	return parts, i + 1, true
+}
+
+// readJSLiteral decodes the single- or double-quoted literal at start and returns the
+// index just past it
+func readJSLiteral(content string, start int) (string, int, bool) {
+	if start >= len(content) || (content[start] != '"' && content[start] != '\'') {
+		return "", start, false
+	}
+	end := skipJSString(content, start)
+	if end >= len(content) || content[end] != content[start] {
+		return "", start, false
+	}
+	text, ok := unquoteJSLiteral(content[start : end+1])
+	return text, end + 1, ok
+}
+
+// skipJSSpace returns the index of the first non-whitespace byte at or after start
+func skipJSSpace(content string, start int) int {
+	for start < len(content) && strings.IndexByte(" \t\r\n", content[start]) >= 0 {
+		start++
+	}
+	return start
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMergeConcatenatedStrings(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"plus chain", `q="query A($id"+":ID!){a(id:$id)"+"{id}}";`, []string{"query A($id:ID!){a(id:$id){id}}"}},
+		{"mixed quotes", `q='query A'+"{a}";`, []string{"query A{a}"}},
+		{"concat call", `q="query A".concat("{a",'}');`, []string{"query A{a}"}},
+		{"concat then plus", `q="query A".concat("{a")+"}";`, []string{"query A{a}"}},
+		{"joined array", `q=["query A","{a}"].join("");`, []string{"query A{a}"}},
+		{"joined array with single quotes", `q=['query A', '{a}'].join('');`, []string{"query A{a}"}},
+		{"escapes decoded", `q="query A"+"{a(s:\"x\")}";`, []string{`query A{a(s:"x")}`}},
+		{"fragment", `f="fragment F on T"+"{id}";`, []string{"fragment F on T{id}"}},
+		{"no operation keyword", `q="hello "+"world";`, nil},
+		{"single literal", `q="query A{a}";`, nil},
+		{"stops at a statement", `a="query A";b="{a}";`, nil},
+		{"stops at a non-literal", `q="query A"+x+"{a}";`, nil},
+		{"array joined with a separator", `q=["query A","{a}"].join(",");`, nil},
+		{"array with a non-literal", `q=["query A",x,"{a}"].join("");`, nil},
+		{"too many parts", `q="query A"` + strings.Repeat(`+"x"`, maxConcatParts) + `;`, nil},
+		{"too large", `q="query A"+"` + strings.Repeat("x", maxConcatSize) + `";`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := mergeConcatenatedStrings(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeConcatenatedStrings = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExtractConcatenatedVueBundle extracts from a minified Vue bundle whose operations
+// are only visible once their concatenated literals are joined
+func TestExtractConcatenatedVueBundle(t *testing.T) {
+	data, err := os.ReadFile("testdata/concat/vue_app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	operations, err := ExtractOperationsFromJS(string(data), "app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, op := range operations {
+		names = append(names, string(op.Type)+" "+op.Name)
+	}
+	sort.Strings(names)
+	want := []string{
+		"mutation UpdateUser",
+		"query GetCart",
+		"query GetUser",
+		"query ListOrders",
+		"query SearchProducts",
+		"subscription OnOrderUpdated",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("operations = %q, want %q", names, want)
+	}
+
+	// Each operation points at the first literal of its chain
+	for _, op := range operations {
+		if c := data[op.Offset]; c != '"' && c != '\'' && c != '[' {
+			t.Errorf("%s found at offset %d (%q), want the start of its chain", op.Name, op.Offset, c)
+		}
+	}
+
+	fragments := ExtractFragmentsFromJS(string(data))
+	if fragments["CartItemFields"] == nil {
+		t.Errorf("fragments = %v, want CartItemFields", fragments)
+	}
+}
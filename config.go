@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"time"
+)
+
+// Config mirrors the command-line flags so a run can be described in a JSON file.
+// Keys are the flag names; durations use Go syntax such as "5m". Unset keys keep the
+// flag defaults, and flags given on the command line override the file.
+type Config struct {
+	Domain             *string   `json:"domain"`
+	DomainsFile        *string   `json:"domains-file"`
+	Combined           *bool     `json:"combined"`
+	FreshSession       *bool     `json:"fresh-session"`
+	UpstreamProxy      *string   `json:"upstream-proxy"`
+	ListJS             *bool     `json:"list-js"`
+	AutoInteract       *bool     `json:"auto-interact"`
+	InteractSelectors  *string   `json:"interact-selectors"`
+	InteractPause      *string   `json:"interact-pause"`
+	InteractBudget     *string   `json:"interact-budget"`
+	CrawlSitemap       *bool     `json:"crawl-sitemap"`
+	CrawlDepth         *int      `json:"crawl-depth"`
+	CrawlExclude       *string   `json:"crawl-exclude"`
+	MaxPages           *int      `json:"max-pages"`
+	PageDwell          *string   `json:"page-dwell"`
+	Timeout            *string   `json:"timeout"`
+	FinishAfterIdle    *string   `json:"finish-after-idle"`
+	IdleTimeout        *string   `json:"idle-timeout"`
+	Progress           *string   `json:"progress"`
+	RequestTTL         *string   `json:"request-ttl"`
+	Quiet              *bool     `json:"quiet"`
+	Verbose            *bool     `json:"verbose"`
+	LogFormat          *string   `json:"log-format"`
+	LogLevel           *string   `json:"log-level"`
+	DownloadRetries    *int      `json:"download-retries"`
+	Workers            *int      `json:"workers"`
+	Cookie             *string   `json:"cookie"`
+	SaveJS             *bool     `json:"save-js"`
+	MaxJSSize          *int64    `json:"max-js-size"`
+	CacheDir           *string   `json:"cache-dir"`
+	CacheMaxAge        *string   `json:"cache-max-age"`
+	NoCache            *bool     `json:"no-cache"`
+	SameOrigin         *bool     `json:"same-origin"`
+	JSHostAllow        *string   `json:"js-host-allow"`
+	IgnoreNoise        *bool     `json:"ignore-noise"`
+	NoiseNames         *string   `json:"noise-names"`
+	EndpointPattern    *[]string `json:"endpoint-pattern"`
+	DedupJSMode        *string   `json:"dedup-js-mode"`
+	JSHashPattern      *string   `json:"js-hash-pattern"`
+	StdoutNDJSON       *bool     `json:"stdout-ndjson"`
+	StdoutMaxResponse  *int      `json:"stdout-max-response"`
+	NoFiles            *bool     `json:"no-files"`
+	Exec               *string   `json:"exec"`
+	WebhookURL         *string   `json:"webhook-url"`
+	Stream             *bool     `json:"stream"`
+	StreamFile         *string   `json:"stream-file"`
+	Aggregate          *bool     `json:"aggregate"`
+	Only               *string   `json:"only"`
+	NameFilter         *string   `json:"name-filter"`
+	MinDepth           *int      `json:"min-depth"`
+	FragmentsSection   *bool     `json:"fragments-section"`
+	GroupByRoot        *bool     `json:"group-by-root"`
+	Sort               *bool     `json:"sort"`
+	NoTimestamp        *bool     `json:"no-timestamp"`
+	FailOnEmpty        *bool     `json:"fail-on-empty"`
+	ExampleVariables   *int      `json:"example-variables"`
+	SampleVars         *bool     `json:"sample-vars"`
+	RedactPattern      *string   `json:"redact-pattern"`
+	RedactHeaders      *string   `json:"redact-headers"`
+	InferScalars       *bool     `json:"infer-scalars"`
+	Format             *string   `json:"format"`
+	HAR                *bool     `json:"har"`
+	HARMaxBody         *int      `json:"har-max-body"`
+	Curl               *bool     `json:"curl"`
+	PersistedManifest  *bool     `json:"persisted-manifest"`
+	SQLite             *bool     `json:"sqlite"`
+	Validate           *bool     `json:"validate"`
+	ProbeIntrospection *bool     `json:"probe-introspection"`
+	MergeByName        *bool     `json:"merge-by-name"`
+	DupReport          *bool     `json:"dup-report"`
+	Diff               *string   `json:"diff"`
+	Resume             *bool     `json:"resume"`
+	StripDirectives    *bool     `json:"strip-directives"`
+	KeepDirectives     *string   `json:"keep-directives"`
+	HARInput           *string   `json:"har-input"`
+	Proxy              *string   `json:"proxy"`
+	ProxyCADir         *string   `json:"proxy-ca-dir"`
+	OutputDir          *string   `json:"output-dir"`
+}
+
+// loadConfig reads and validates a JSON config file, rejecting unknown keys
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var config Config
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	for key, value := range map[string]*string{"timeout": config.Timeout, "progress": config.Progress, "request-ttl": config.RequestTTL, "cache-max-age": config.CacheMaxAge, "page-dwell": config.PageDwell, "finish-after-idle": config.FinishAfterIdle, "idle-timeout": config.IdleTimeout, "interact-pause": config.InteractPause, "interact-budget": config.InteractBudget} {
+		if value == nil {
+			continue
+		}
+		if _, err := time.ParseDuration(*value); err != nil {
+			return nil, fmt.Errorf("invalid %s in config file: %v", key, err)
+		}
+	}
+	if config.LogFormat != nil && *config.LogFormat != LogFormatText && *config.LogFormat != LogFormatJSON {
+		return nil, fmt.Errorf("invalid log-format in config file: expected text or json")
+	}
+	if config.DedupJSMode != nil {
+		switch *config.DedupJSMode {
+		case DedupJSExact, DedupJSQuery, DedupJSHash:
+		default:
+			return nil, fmt.Errorf("invalid dedup-js-mode in config file: expected exact, query or hash")
+		}
+	}
+	for key, value := range map[string]*string{"name-filter": config.NameFilter, "js-hash-pattern": config.JSHashPattern, "redact-pattern": config.RedactPattern, "crawl-exclude": config.CrawlExclude} {
+		if value == nil {
+			continue
+		}
+		if _, err := regexp.Compile(*value); err != nil {
+			return nil, fmt.Errorf("invalid %s in config file: %v", key, err)
+		}
+	}
+	if config.EndpointPattern != nil {
+		for _, pattern := range *config.EndpointPattern {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid endpoint-pattern in config file: %v", err)
+			}
+		}
+	}
+	for key, value := range map[string]*int{"download-retries": config.DownloadRetries, "har-max-body": config.HARMaxBody, "min-depth": config.MinDepth, "example-variables": config.ExampleVariables, "stdout-max-response": config.StdoutMaxResponse, "max-pages": config.MaxPages, "crawl-depth": config.CrawlDepth} {
+		if value != nil && *value < 0 {
+			return nil, fmt.Errorf("invalid %s in config file: must not be negative", key)
+		}
+	}
+	if config.MaxJSSize != nil && *config.MaxJSSize < 0 {
+		return nil, fmt.Errorf("invalid max-js-size in config file: must not be negative")
+	}
+	if config.Workers != nil && *config.Workers < 1 {
+		return nil, fmt.Errorf("invalid workers in config file: must be at least 1")
+	}
+
+	return &config, nil
+}
+
+// apply sets every flag present in the config that was not given on the command line
+func (c *Config) apply(flags *flag.FlagSet) error {
+	explicit := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	value := reflect.ValueOf(c).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		name := value.Type().Field(i).Tag.Get("json")
+		if field.IsNil() || explicit[name] {
+			continue
+		}
+		// Lists set a repeatable flag once per item
+		if field.Elem().Kind() == reflect.Slice {
+			for j := 0; j < field.Elem().Len(); j++ {
+				if err := flags.Set(name, fmt.Sprint(field.Elem().Index(j).Interface())); err != nil {
+					return fmt.Errorf("failed to apply config value %s: %v", name, err)
+				}
+			}
+			continue
+		}
+		if err := flags.Set(name, fmt.Sprint(field.Elem().Interface())); err != nil {
+			return fmt.Errorf("failed to apply config value %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Coverage summarizes how many statically extracted operations were seen at runtime
+type Coverage struct {
+	Static      int // Unique operations found in JavaScript
+	Exercised   int // Static operations with at least one network capture
+	DynamicOnly int // Captures matching no static operation
+}
+
+// correlateCaptures links network captures to operations, matching on operation name
+// first and normalized query second. Each operation is annotated with whether and where
+// it was observed, and captures that match no statically extracted operation are
+// flagged DynamicOnly, except queries rebuilt from an Apollo cache.
+func correlateCaptures(operations []*GraphQLOperation, captures []GraphQLCapture) Coverage {
+	// Endpoints that captures were sent to; any other source is a JS file
+	networkSources := make(map[string]bool)
+	for _, capture := range captures {
+		networkSources[endpointURL(capture.URL)] = true
+	}
+
+	var coverage Coverage
+	staticNames := make(map[string]bool)
+	staticQueries := make(map[string]bool)
+
+	for _, op := range operations {
+		op.ObservedOnNetwork = false
+		op.CaptureCount = 0
+		op.Endpoints = nil
+		op.Pages = nil
+		op.LastSeen = nil
+
+		key := normalizeGraphQL(op.Raw)
+		for i := range captures {
+			capture := &captures[i]
+			byName := op.Name != "" && capture.OperationName == op.Name
+			byQuery := key != "" && capture.Query != "" && normalizeGraphQL(capture.Query) == key
+			if !byName && !byQuery {
+				continue
+			}
+			op.ObservedOnNetwork = true
+			op.CaptureCount++
+			if capture.SSRState == "" {
+				op.Endpoints = appendUnique(op.Endpoints, endpointURL(capture.URL))
+			}
+			if capture.PageURL != "" {
+				op.Pages = appendUnique(op.Pages, capture.PageURL)
+			}
+			if op.LastSeen == nil || capture.Timestamp.After(*op.LastSeen) {
+				seen := capture.Timestamp
+				op.LastSeen = &seen
+			}
+		}
+
+		static := false
+		for _, source := range op.Sources {
+			if !networkSources[source] {
+				static = true
+				break
+			}
+		}
+		if !static {
+			continue
+		}
+		coverage.Static++
+		if op.ObservedOnNetwork {
+			coverage.Exercised++
+		}
+		if op.Name != "" {
+			staticNames[op.Name] = true
+		}
+		if key != "" {
+			staticQueries[key] = true
+		}
+	}
+
+	for i := range captures {
+		capture := &captures[i]
+		capture.DynamicOnly = !capture.SSRCache && !staticNames[capture.OperationName] && !staticQueries[normalizeGraphQL(capture.Query)]
+		if capture.DynamicOnly {
+			coverage.DynamicOnly++
+		}
+	}
+
+	return coverage
+}
+
+// reportCoverage logs how much of the statically extracted surface was exercised
+func reportCoverage(coverage Coverage) {
+	if coverage.Static == 0 {
+		slog.Info("Static operations exercised at runtime: none found in JavaScript")
+	} else {
+		slog.Info("Static operations exercised at runtime", "exercised", coverage.Exercised, "static", coverage.Static,
+			"percent", int(100*float64(coverage.Exercised)/float64(coverage.Static)+0.5))
+	}
+	if coverage.DynamicOnly > 0 {
+		slog.Info("Captures matching no static operation", "count", coverage.DynamicOnly)
+	}
+}
+
+// lastSeenString formats an operation's last capture time for exports
+func lastSeenString(op *GraphQLOperation) string {
+	if op.LastSeen == nil {
+		return ""
+	}
+	return op.LastSeen.Format(time.RFC3339)
+}
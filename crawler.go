@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tebeka/selenium"
+)
+
+// pageLinksScript returns the resolved targets of the page's links
+const pageLinksScript = `return Array.from(document.querySelectorAll("a[href]"), a => a.href);`
+
+// LinkCrawler visits the same-host links of the page the browser has loaded,
+// breadth-first, while the network capture keeps running
+type LinkCrawler struct {
+	MaxDepth int            // Links followed from the start page; 1 visits only its links
+	MaxPages int            // Pages visited at most, 0 for no limit
+	Exclude  *regexp.Regexp // URLs never visited, such as logout links; may be nil
+	MaxWait  time.Duration  // Longest a page is waited on before moving on
+	Quiet    time.Duration  // How long the network must be settled for a page to be left
+	Network  *networkTracker
+}
+
+// crawlItem is a page queued for a visit
+type crawlItem struct {
+	url   string
+	depth int
+}
+
+// Crawl follows links starting from target, which is loaded again unless the browser
+// still shows it. Each page is left once its network has settled for Quiet or after
+// MaxWait. Pages
+// that redirect to another origin are left straight away. It stops early when ctx is
+// done.
+func (c *LinkCrawler) Crawl(ctx context.Context, wd selenium.WebDriver, target string) {
+	origin, err := url.Parse(target)
+	if err != nil {
+		return
+	}
+	if current, err := wd.CurrentURL(); err != nil || normalizeCrawlURL(current) != normalizeCrawlURL(target) {
+		if err := wd.Get(target); err != nil {
+			slog.Warn("Error loading page", "url", target, "error", err)
+			return
+		}
+		c.waitSettled(ctx)
+	}
+	visited := map[string]bool{normalizeCrawlURL(target): true}
+	queue := c.enqueueLinks(wd, origin, nil, visited, 1)
+
+	pages, skipped := 0, 0
+	for len(queue) > 0 && ctx.Err() == nil {
+		if c.MaxPages > 0 && pages >= c.MaxPages {
+			break
+		}
+		item := queue[0]
+		queue = queue[1:]
+
+		slog.Info("Crawling link", "url", item.url, "depth", item.depth, "page", pages+1, "queued", len(queue))
+		if err := wd.Get(item.url); err != nil {
+			slog.Warn("Error loading page", "url", item.url, "error", err)
+			skipped++
+			continue
+		}
+		pages++
+		current, err := wd.CurrentURL()
+		if err == nil && !sameHost(current, origin.Host) {
+			slog.Warn("Leaving page, it redirected off the target", "url", item.url, "redirect", current)
+			continue
+		}
+		if err == nil {
+			visited[normalizeCrawlURL(current)] = true
+		}
+
+		c.waitSettled(ctx)
+		if item.depth < c.MaxDepth {
+			queue = c.enqueueLinks(wd, origin, queue, visited, item.depth+1)
+		}
+	}
+	slog.Info("Finished crawling links", "visited", pages, "skipped", skipped, "unvisited", len(queue))
+}
+
+// enqueueLinks adds the same-host links of the current page not yet queued or visited
+func (c *LinkCrawler) enqueueLinks(wd selenium.WebDriver, origin *url.URL, queue []crawlItem, visited map[string]bool, depth int) []crawlItem {
+	result, err := wd.ExecuteScript(pageLinksScript, nil)
+	if err != nil {
+		slog.Warn("Could not read the page's links", "error", err)
+		return queue
+	}
+	links, _ := result.([]interface{})
+	for _, link := range links {
+		href, ok := link.(string)
+		if !ok || !sameHost(href, origin.Host) {
+			continue
+		}
+		if c.Exclude != nil && c.Exclude.MatchString(href) {
+			continue
+		}
+		key := normalizeCrawlURL(href)
+		if visited[key] {
+			continue
+		}
+		visited[key] = true
+		queue = append(queue, crawlItem{url: href, depth: depth})
+	}
+	return queue
+}
+
+// normalizeCrawlURL reduces a URL to the form pages are compared in: without fragment,
+// with a lowercase host and without a trailing slash
+func normalizeCrawlURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	parsed.Host = strings.ToLower(parsed.Host)
+	parsed.Path = strings.TrimRight(parsed.Path, "/")
+	parsed.RawPath = ""
+	return parsed.String()
+}
+
+// waitSettled waits until the page's network has settled, or at most MaxWait
+func (c *LinkCrawler) waitSettled(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, c.MaxWait)
+	defer cancel()
+	if c.Network == nil {
+		<-ctx.Done()
+		return
+	}
+	c.Network.WaitSettled(ctx, c.Quiet)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportToCSV writes one row per unique operation for triage in a spreadsheet
+func ExportToCSV(operations []*GraphQLOperation, captures []GraphQLCapture) ([]byte, error) {
+	// Endpoints that captures were sent to; any other source is a JS file
+	networkSources := make(map[string]bool)
+	for _, capture := range captures {
+		networkSources[endpointURL(capture.URL)] = true
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{
+		"type", "name", "variable_count", "variables", "field_count",
+		"seen_statically", "seen_on_network", "network_captures", "endpoints", "first_js_source",
+	})
+
+	for _, op := range operations {
+		matched := capturesForOperation(op, captures)
+
+		endpoints := []string{}
+		for _, capture := range matched {
+			endpoints = appendUnique(endpoints, endpointURL(capture.URL))
+		}
+		if len(endpoints) == 0 && op.Endpoint != "" {
+			endpoints = append(endpoints, op.Endpoint)
+		}
+
+		firstJS := ""
+		for _, source := range op.Sources {
+			if !networkSources[source] {
+				firstJS = source
+				break
+			}
+		}
+
+		w.Write([]string{
+			string(op.Type),
+			op.Name,
+			strconv.Itoa(len(op.Variables)),
+			variableSignature(op),
+			strconv.Itoa(len(op.Fields)),
+			strconv.FormatBool(firstJS != ""),
+			strconv.FormatBool(len(matched) > 0),
+			strconv.Itoa(len(matched)),
+			strings.Join(endpoints, " "),
+			firstJS,
+		})
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// ExportCapturesToCSV writes one row per network capture
+func ExportCapturesToCSV(captures []GraphQLCapture) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"timestamp", "operation_name", "url", "page_url", "status", "has_errors"})
+
+	for _, capture := range captures {
+		status := ""
+		if !capture.Pending {
+			status = strconv.Itoa(capture.Status)
+		}
+		w.Write([]string{
+			capture.Timestamp.Format(time.RFC3339),
+			capture.OperationName,
+			capture.URL,
+			capture.PageURL,
+			status,
+			strconv.FormatBool(capture.HasErrors),
+		})
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// capturesForOperation returns the captures of an operation, matched on the normalized
+// query and falling back to the operation name when the query text was rewritten
+func capturesForOperation(op *GraphQLOperation, captures []GraphQLCapture) []GraphQLCapture {
+	key := normalizeGraphQL(op.Raw)
+
+	var matched []GraphQLCapture
+	for _, capture := range captures {
+		if key != "" && normalizeGraphQL(capture.Query) == key {
+			matched = append(matched, capture)
+		}
+	}
+	if len(matched) > 0 || op.Name == "" {
+		return matched
+	}
+
+	for _, capture := range captures {
+		if capture.OperationName == op.Name {
+			matched = append(matched, capture)
+		}
+	}
+	return matched
+}
+
+// variableSignature lists an operation's variables as "$name: Type" sorted by name
+func variableSignature(op *GraphQLOperation) string {
+	names := make([]string, 0, len(op.Variables))
+	for name := range op.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		part := "$" + name + ": " + op.Variables[name]
+		if value, ok := op.VariableDefaults[name]; ok {
+			part += " = " + value
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
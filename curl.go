@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// ExportToCurl renders one curl invocation per operation as a shell script. Operations
+// without a known endpoint are sent to defaultEndpoint.
+func ExportToCurl(operations []*GraphQLOperation, captures []GraphQLCapture, defaultEndpoint string) string {
+	var script strings.Builder
+
+	script.WriteString("#!/bin/sh\n")
+	script.WriteString("# Extracted GraphQL Operations\n")
+	script.WriteString(generatedAtLine("# "))
+	script.WriteString("# Replace the Authorization header with a valid token before running.\n\n")
+
+	// Use the most recently captured variables for each operation name
+	captured := make(map[string]map[string]interface{})
+	for _, capture := range captures {
+		if capture.OperationName != "" && len(capture.Variables) > 0 {
+			captured[capture.OperationName] = capture.Variables
+		}
+	}
+
+	for _, op := range operations {
+		endpoint := op.Endpoint
+		if endpoint == "" {
+			endpoint = defaultEndpoint
+		}
+
+		variables, ok := captured[op.Name]
+		if !ok {
+			variables = op.SampleVariables
+		}
+		if variables == nil {
+			variables = GenerateExampleVariables(op, nil)
+		}
+
+		payload := map[string]interface{}{
+			"query":     op.Raw,
+			"variables": variables,
+		}
+		if op.Name != "" {
+			payload["operationName"] = op.Name
+		}
+
+		script.WriteString("# " + extractOperationSignature(op) + "\n")
+		script.WriteString("curl -s " + shellQuote(endpoint) + " \\\n")
+		script.WriteString("  -H " + shellQuote("Content-Type: application/json") + " \\\n")
+		script.WriteString("  -H " + shellQuote("Authorization: Bearer REPLACE_ME") + " \\\n")
+		script.WriteString("  --data " + shellQuote(encodeJSONPayload(payload)) + "\n\n")
+	}
+
+	return script.String()
+}
+
+// encodeJSONPayload encodes a request body on a single line without HTML escaping
+func encodeJSONPayload(payload interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(payload); err != nil {
+		return "{}"
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// shellQuote wraps s in single quotes for POSIX shells, escaping embedded single quotes
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	gqlast "github.com/vektah/gqlparser/v2/ast"
+)
+
+// previousExport holds the operations of an earlier JSON export for --diff
+type previousExport struct {
+	Path       string
+	Operations []diffOperation
+}
+
+// diffOperation is the part of an exported operation that a diff compares
+type diffOperation struct {
+	Type      string            `json:"type"`
+	Name      string            `json:"name"`
+	Variables map[string]string `json:"variables"`
+	Fields    []string          `json:"fields"`
+	Query     string            `json:"query"`
+}
+
+// operationChange describes how one operation differs between two runs
+type operationChange struct {
+	Key     string   `json:"key"`
+	Details []string `json:"details"`
+}
+
+// OperationDiff lists what changed between a previous export and the current run
+type OperationDiff struct {
+	Added   []string          `json:"added"`
+	Removed []string          `json:"removed"`
+	Changed []operationChange `json:"changed"`
+}
+
+// Empty reports whether the two runs had the same operations
+func (d OperationDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// loadPreviousExport reads the operations of a JSON export written by an earlier run
+func loadPreviousExport(path string) (*previousExport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read previous export: %v", err)
+	}
+	var export struct {
+		Operations []diffOperation `json:"operations"`
+	}
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("failed to parse previous export %s: %v", path, err)
+	}
+	return &previousExport{Path: path, Operations: export.Operations}, nil
+}
+
+// diffOperationsFrom converts the current operations to their comparable form
+func diffOperationsFrom(operations []*GraphQLOperation) []diffOperation {
+	converted := make([]diffOperation, 0, len(operations))
+	for _, op := range operations {
+		converted = append(converted, diffOperation{
+			Type:      string(op.Type),
+			Name:      op.Name,
+			Variables: op.Variables,
+			Fields:    op.Fields,
+			Query:     op.Raw,
+		})
+	}
+	return converted
+}
+
+// diffSide gathers every variant of an operation sharing one semantic key
+type diffSide struct {
+	variables map[string]string
+	fields    map[string]bool // Dotted paths of the selected fields, e.g. user.friends.id
+	queries   map[string]bool
+}
+
+// groupForDiff keys operations by type and name, or by a hash of the normalized query
+// when they are anonymous, merging variants that share a key
+func groupForDiff(operations []diffOperation) map[string]*diffSide {
+	groups := make(map[string]*diffSide)
+	for _, op := range operations {
+		key := op.Type + " " + op.Name
+		if op.Name == "" {
+			sum := sha256.Sum256([]byte(normalizeGraphQL(op.Query)))
+			key = op.Type + " (anonymous " + hex.EncodeToString(sum[:6]) + ")"
+		}
+		side := groups[key]
+		if side == nil {
+			side = &diffSide{variables: make(map[string]string), fields: make(map[string]bool), queries: make(map[string]bool)}
+			groups[key] = side
+		}
+		for name, typ := range op.Variables {
+			side.variables[name] = typ
+		}
+		// Compare the whole selection tree when the query parses, else the top level
+		paths := selectionPaths(op.Query)
+		if paths == nil {
+			paths = op.Fields
+		}
+		for _, path := range paths {
+			side.fields[path] = true
+		}
+		side.queries[normalizeGraphQL(op.Query)] = true
+	}
+	return groups
+}
+
+// selectionPaths returns the dotted path of every field the query's operations select,
+// with fragments defined in the query expanded. It returns nil when the query does not
+// parse.
+func selectionPaths(query string) []string {
+	if strings.TrimSpace(query) == "" {
+		return nil
+	}
+	doc, err := parseGraphQLDocument(query)
+	if err != nil {
+		return nil
+	}
+	fragments := fragmentsByName(doc)
+
+	var paths []string
+	var walk func(selections gqlast.SelectionSet, prefix string, spread map[string]bool)
+	walk = func(selections gqlast.SelectionSet, prefix string, spread map[string]bool) {
+		for _, selection := range selections {
+			switch s := selection.(type) {
+			case *gqlast.Field:
+				path := prefix + s.Name
+				paths = appendUnique(paths, path)
+				walk(s.SelectionSet, path+".", spread)
+			case *gqlast.InlineFragment:
+				walk(s.SelectionSet, prefix, spread)
+			case *gqlast.FragmentSpread:
+				if fragment := fragments[s.Name]; fragment != nil && !spread[s.Name] {
+					spread[s.Name] = true
+					walk(fragment.SelectionSet, prefix, spread)
+					delete(spread, s.Name)
+				}
+			}
+		}
+	}
+	for _, def := range doc.Operations {
+		walk(def.SelectionSet, "", make(map[string]bool))
+	}
+	return paths
+}
+
+// diffOperations compares a previous run's operations with the current ones
+func diffOperations(previous, current []diffOperation) OperationDiff {
+	before := groupForDiff(previous)
+	after := groupForDiff(current)
+
+	diff := OperationDiff{Added: []string{}, Removed: []string{}, Changed: []operationChange{}}
+	for key, now := range after {
+		was, existed := before[key]
+		if !existed {
+			diff.Added = append(diff.Added, key)
+			continue
+		}
+		if details := compareDiffSides(was, now); len(details) > 0 {
+			diff.Changed = append(diff.Changed, operationChange{Key: key, Details: details})
+		}
+	}
+	for key := range before {
+		if after[key] == nil {
+			diff.Removed = append(diff.Removed, key)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].Key < diff.Changed[j].Key
+	})
+	return diff
+}
+
+// compareDiffSides describes variable, field and selection differences
+func compareDiffSides(was, now *diffSide) []string {
+	var details []string
+	for _, name := range sortedNames(now.variables) {
+		if typ, ok := was.variables[name]; !ok {
+			details = append(details, fmt.Sprintf("variable added: $%s: %s", name, now.variables[name]))
+		} else if typ != now.variables[name] {
+			details = append(details, fmt.Sprintf("variable retyped: $%s: %s -> %s", name, typ, now.variables[name]))
+		}
+	}
+	for _, name := range sortedNames(was.variables) {
+		if _, ok := now.variables[name]; !ok {
+			details = append(details, fmt.Sprintf("variable removed: $%s: %s", name, was.variables[name]))
+		}
+	}
+	for _, field := range sortedSet(now.fields) {
+		if !was.fields[field] {
+			details = append(details, "field added: "+field)
+		}
+	}
+	for _, field := range sortedSet(was.fields) {
+		if !now.fields[field] {
+			details = append(details, "field removed: "+field)
+		}
+	}
+	if len(details) == 0 && !sameKeys(was.queries, now.queries) {
+		details = append(details, "selection set changed")
+	}
+	return details
+}
+
+// ExportDiff renders an operation diff as the <base>_diff.txt report
+func ExportDiff(diff OperationDiff, previousPath string) string {
+	var report strings.Builder
+	report.WriteString("# Operation Diff\n")
+	report.WriteString("# Previous: " + previousPath + "\n")
+	report.WriteString(generatedAtLine("# ") + "\n")
+	writeDiff(&report, diff)
+	return report.String()
+}
+
+// writeDiff writes the counts and the added, removed and changed operations of a diff
+func writeDiff(report *strings.Builder, diff OperationDiff) {
+	fmt.Fprintf(report, "%d added, %d removed, %d changed\n", len(diff.Added), len(diff.Removed), len(diff.Changed))
+
+	if len(diff.Added) > 0 {
+		report.WriteString("\n## Added\n")
+		for _, key := range diff.Added {
+			report.WriteString("+ " + key + "\n")
+		}
+	}
+	if len(diff.Removed) > 0 {
+		report.WriteString("\n## Removed\n")
+		for _, key := range diff.Removed {
+			report.WriteString("- " + key + "\n")
+		}
+	}
+	if len(diff.Changed) > 0 {
+		report.WriteString("\n## Changed\n")
+		for _, change := range diff.Changed {
+			report.WriteString("~ " + change.Key + "\n")
+			for _, detail := range change.Details {
+				report.WriteString("    " + detail + "\n")
+			}
+		}
+	}
+}
+
+// sortedNames returns the variable names of a variable map in order
+func sortedNames(variables map[string]string) []string {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedSet returns the members of a set in order
+func sortedSet(set map[string]bool) []string {
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// sameKeys reports whether two sets hold the same members
+func sameKeys(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key := range a {
+		if !b[key] {
+			return false
+		}
+	}
+	return true
+}
+
+// Exit codes of the diff subcommand, following diff(1)
+const (
+	diffSame    = 0
+	diffChanged = 1
+	diffFailed  = 2
+)
+
+// runDiff implements the diff subcommand and returns the process exit code: 0 when the
+// exports have the same operations, 1 when they differ and 2 on errors
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Print the differences as JSON instead of text")
+	logFormat := fs.String("log-format", LogFormatText, "Log output format: text or json")
+	logLevel := fs.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gql-extractor diff [options] <old.json> <new.json>\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return diffFailed
+	}
+	if err := setupLogging(os.Stderr, *logFormat, *logLevel); err != nil {
+		slog.Error("Invalid logging flags", "error", err)
+		return diffFailed
+	}
+
+	old, err := loadPreviousExport(fs.Arg(0))
+	if err != nil {
+		slog.Error("Error loading export", "error", err)
+		return diffFailed
+	}
+	current, err := loadPreviousExport(fs.Arg(1))
+	if err != nil {
+		slog.Error("Error loading export", "error", err)
+		return diffFailed
+	}
+	diff := diffOperations(old.Operations, current.Operations)
+
+	if *jsonOutput {
+		data, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			slog.Error("Error encoding diff", "error", err)
+			return diffFailed
+		}
+		fmt.Println(string(data))
+	} else {
+		var report strings.Builder
+		report.WriteString("# Old: " + old.Path + "\n")
+		report.WriteString("# New: " + current.Path + "\n\n")
+		writeDiff(&report, diff)
+		fmt.Print(report.String())
+	}
+
+	if diff.Empty() {
+		return diffSame
+	}
+	return diffChanged
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// captureStdout returns what fn prints to standard output
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-output
+}
+
+// TestDiffGolden runs the diff subcommand on the exports under testdata/diff and
+// compares its exit code and output against testdata/diff/golden. Run with -update to
+// accept new output.
+func TestDiffGolden(t *testing.T) {
+	logger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(logger) })
+
+	tests := []struct {
+		name   string
+		args   []string
+		code   int
+		golden string // File the output is compared against, empty for none
+	}{
+		{"same", []string{"testdata/diff/old.json", "testdata/diff/old.json"}, diffSame, "same.txt"},
+		{"changed", []string{"testdata/diff/old.json", "testdata/diff/new.json"}, diffChanged, "changed.txt"},
+		{"changed as JSON", []string{"-json", "testdata/diff/old.json", "testdata/diff/new.json"}, diffChanged, "changed.json"},
+		{"same as JSON", []string{"-json", "testdata/diff/new.json", "testdata/diff/new.json"}, diffSame, "same.json"},
+		{"missing export", []string{"testdata/diff/old.json", "testdata/diff/missing.json"}, diffFailed, ""},
+		{"broken export", []string{"testdata/diff/broken.json", "testdata/diff/new.json"}, diffFailed, ""},
+		{"one export", []string{"testdata/diff/old.json"}, diffFailed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var code int
+			got := captureStdout(t, func() {
+				code = runDiff(append([]string{"-log-level", "error"}, tt.args...))
+			})
+			if code != tt.code {
+				t.Errorf("runDiff = %d, want %d", code, tt.code)
+			}
+			if tt.golden == "" {
+				if got != "" {
+					t.Errorf("printed %q on failure", got)
+				}
+				return
+			}
+
+			golden := filepath.Join("testdata", "diff", "golden", tt.golden)
+			if *updateGolden {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("output differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
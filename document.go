@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+
+	gqlast "github.com/vektah/gqlparser/v2/ast"
+	gqlparser "github.com/vektah/gqlparser/v2/parser"
+)
+
+// parseGraphQLDocument parses an executable GraphQL document of operations and fragment
+// definitions
+func parseGraphQLDocument(src string) (*gqlast.QueryDocument, error) {
+	doc, err := gqlparser.ParseQuery(&gqlast.Source{Input: src})
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Operations) == 0 && len(doc.Fragments) == 0 {
+		return nil, fmt.Errorf("empty document")
+	}
+	return doc, nil
+}
+
+// fragmentsByName indexes the fragment definitions of a document by name
+func fragmentsByName(doc *gqlast.QueryDocument) map[string]*gqlast.FragmentDefinition {
+	fragments := make(map[string]*gqlast.FragmentDefinition, len(doc.Fragments))
+	for _, def := range doc.Fragments {
+		fragments[def.Name] = def
+	}
+	return fragments
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ExportDuplicatesReport renders how often each unique operation was found before
+// deduplication, most referenced first, and how much duplication each source had.
+// operations is the full list before deduplication; unique and counts are what
+// DeduplicateOperationsWithCounts returned for it.
+func ExportDuplicatesReport(operations, unique []*GraphQLOperation, counts map[string]int) string {
+	var report strings.Builder
+
+	report.WriteString("# Duplicate Operations Report\n")
+	report.WriteString(generatedAtLine("# ") + "\n")
+
+	fmt.Fprintf(&report, "Operations found: %d\n", len(operations))
+	fmt.Fprintf(&report, "Unique operations: %d\n", len(unique))
+	fmt.Fprintf(&report, "Duplicates removed: %d\n\n", len(operations)-len(unique))
+
+	// Most referenced operations first, ties by signature
+	keys := make(map[*GraphQLOperation]string, len(unique))
+	ranked := make([]*GraphQLOperation, len(unique))
+	copy(ranked, unique)
+	for _, op := range ranked {
+		keys[op] = canonicalHash(op)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if counts[keys[ranked[i]]] != counts[keys[ranked[j]]] {
+			return counts[keys[ranked[i]]] > counts[keys[ranked[j]]]
+		}
+		return extractOperationSignature(ranked[i]) < extractOperationSignature(ranked[j])
+	})
+
+	report.WriteString("## Occurrences per operation\n")
+	for _, op := range ranked {
+		fmt.Fprintf(&report, "%6d  %s", counts[keys[op]], extractOperationSignature(op))
+		if len(op.Sources) > 1 {
+			fmt.Fprintf(&report, " (%d sources)", len(op.Sources))
+		}
+		report.WriteString("\n")
+	}
+
+	// Per source: how many operations it held, how many repeated one found earlier in
+	// the same source, and how many also appear in another source
+	type sourceStats struct {
+		total, repeated int
+		keys            map[string]bool
+	}
+	stats := make(map[string]*sourceStats)
+	keySources := make(map[string]map[string]bool)
+	for _, op := range operations {
+		source := op.Source
+		if source == "" {
+			source = "(unknown)"
+		}
+		key := canonicalHash(op)
+		if stats[source] == nil {
+			stats[source] = &sourceStats{keys: make(map[string]bool)}
+		}
+		if keySources[key] == nil {
+			keySources[key] = make(map[string]bool)
+		}
+		s := stats[source]
+		s.total++
+		if s.keys[key] {
+			s.repeated++
+		}
+		s.keys[key] = true
+		keySources[key][source] = true
+	}
+
+	sources := make([]string, 0, len(stats))
+	for source := range stats {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if stats[sources[i]].total != stats[sources[j]].total {
+			return stats[sources[i]].total > stats[sources[j]].total
+		}
+		return sources[i] < sources[j]
+	})
+
+	report.WriteString("\n## Duplication per source\n")
+	for _, source := range sources {
+		s := stats[source]
+		shared := 0
+		for key := range s.keys {
+			if len(keySources[key]) > 1 {
+				shared++
+			}
+		}
+		fmt.Fprintf(&report, "%s\n  %d operations, %d repeated within the source, %d also found in other sources\n",
+			source, s.total, s.repeated, shared)
+	}
+
+	return report.String()
+}
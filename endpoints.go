@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Quoted absolute, protocol-relative or root-relative URLs in JavaScript
+var jsURLLiteralPattern = regexp.MustCompile("[\"'`]((?:https?:)?//[^\"'`\\s]{1,1000}|/[\\w.~%/-]{1,500})[\"'`]")
+
+// extractEndpointURLs returns the GraphQL endpoint URLs a JS file references, judged
+// the same way network requests are. Relative URLs are resolved against base.
+func extractEndpointURLs(content, base string) []string {
+	baseURL, _ := url.Parse(base)
+	var endpoints []string
+	for _, m := range jsURLLiteralPattern.FindAllStringSubmatch(content, -1) {
+		if !isGraphQLURL(m[1]) {
+			continue
+		}
+		ref, err := url.Parse(m[1])
+		if err != nil {
+			continue
+		}
+		if baseURL != nil {
+			ref = baseURL.ResolveReference(ref)
+		}
+		if ref.Host == "" {
+			continue
+		}
+		endpoints = appendUnique(endpoints, endpointURL(ref.String()))
+	}
+	return endpoints
+}
+
+// endpointBase picks what relative endpoint URLs in a JS file resolve against: the
+// target page, which is where the app sends its requests, or else the file itself
+func endpointBase(domain, jsURL string) string {
+	if domain != "" {
+		return domain
+	}
+	return jsURL
+}
+
+// ExportEndpoints renders the <base>_endpoints.txt inventory: one tab-separated line
+// per distinct endpoint with the operations and requests seen for it and where it was
+// found. The URL comes first so the list can be cut into other tools. Nothing is
+// returned when no endpoint was found.
+func ExportEndpoints(captures []GraphQLCapture, jsEndpoints []string) string {
+	type endpointLine struct {
+		operations, requests int
+		sources              []string
+	}
+	lines := make(map[string]*endpointLine)
+	for _, endpoint := range summarizeEndpoints(captures) {
+		lines[endpoint.URL] = &endpointLine{
+			operations: len(endpoint.Operations),
+			requests:   endpoint.RequestCount,
+			sources:    []string{"network"},
+		}
+	}
+	for _, endpoint := range jsEndpoints {
+		if lines[endpoint] == nil {
+			lines[endpoint] = &endpointLine{}
+		}
+		lines[endpoint].sources = appendUnique(lines[endpoint].sources, "javascript")
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+
+	urls := make([]string, 0, len(lines))
+	for endpoint := range lines {
+		urls = append(urls, endpoint)
+	}
+	sort.Strings(urls)
+
+	var report strings.Builder
+	report.WriteString("# GraphQL Endpoints\n")
+	report.WriteString(generatedAtLine("# "))
+	report.WriteString("# url\toperations\trequests\tfound in\n")
+	for _, endpoint := range urls {
+		line := lines[endpoint]
+		fmt.Fprintf(&report, "%s\t%d\t%d\t%s\n", endpoint, line.operations, line.requests, strings.Join(line.sources, ","))
+	}
+	return report.String()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// noErrorCode groups errors whose response carried no extensions.code
+const noErrorCode = "(no code)"
+
+// errorCodeSummary collects the captures that returned one extensions.code, such as
+// FORBIDDEN or UNAUTHENTICATED, which point at auth requirements and gated operations
+type errorCodeSummary struct {
+	Code       string
+	Count      int      // Errors returned with the code
+	Operations []string // Operation names that returned it, in order of first capture
+	Messages   []string // Distinct messages, in order of first capture
+}
+
+// summarizeErrorCodes groups the GraphQL errors of captures by code, most frequent
+// first. Errors without a code are grouped last.
+func summarizeErrorCodes(captures []GraphQLCapture) []*errorCodeSummary {
+	byCode := make(map[string]*errorCodeSummary)
+	for _, capture := range captures {
+		for _, gqlErr := range capture.Errors {
+			code := gqlErr.Code
+			if code == "" {
+				code = noErrorCode
+			}
+			summary := byCode[code]
+			if summary == nil {
+				summary = &errorCodeSummary{Code: code}
+				byCode[code] = summary
+			}
+			summary.Count++
+			summary.Operations = appendUnique(summary.Operations, captureName(capture))
+			if gqlErr.Message != "" {
+				summary.Messages = appendUnique(summary.Messages, gqlErr.Message)
+			}
+		}
+	}
+
+	summaries := make([]*errorCodeSummary, 0, len(byCode))
+	for _, summary := range byCode {
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if (a.Code == noErrorCode) != (b.Code == noErrorCode) {
+			return b.Code == noErrorCode
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Code < b.Code
+	})
+	return summaries
+}
+
+// formatErrorCodes writes the detailed log section listing, for each error code, the
+// operations that returned it and a few of its messages
+func formatErrorCodes(summaries []*errorCodeSummary) string {
+	var sb strings.Builder
+	sb.WriteString("## Errors by Code\n\n")
+	for _, summary := range summaries {
+		fmt.Fprintf(&sb, "### %s (%d errors)\n", summary.Code, summary.Count)
+		fmt.Fprintf(&sb, "Operations: %s\n", strings.Join(summary.Operations, ", "))
+		messages := summary.Messages
+		if len(messages) > 5 {
+			messages = messages[:5]
+		}
+		for _, message := range messages {
+			fmt.Fprintf(&sb, "- %s\n", message)
+		}
+		if more := len(summary.Messages) - len(messages); more > 0 {
+			fmt.Fprintf(&sb, "- ... and %d more messages\n", more)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
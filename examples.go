@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// defaultRedactPattern matches variable names whose values are never written to exports
+const defaultRedactPattern = `(?i)password|passwd|secret|token|api[_-]?key|credential|authorization|cookie|session`
+
+// redactedValue replaces the value of a sensitive variable
+const redactedValue = "[REDACTED]"
+
+// attachExampleVariables sets each operation's ExampleVariables to up to limit distinct
+// variable payloads seen on the network. Captures are expected to be redacted already.
+func attachExampleVariables(operations []*GraphQLOperation, captures []GraphQLCapture, limit int) {
+	if limit <= 0 {
+		return
+	}
+	for _, op := range operations {
+		op.ExampleVariables = exampleVariables(op, captures, limit)
+	}
+}
+
+// exampleVariables collects distinct variable payloads for op. Captures are joined on
+// the operation name, falling back to the normalized query for anonymous operations or
+// when no capture carries the name.
+func exampleVariables(op *GraphQLOperation, captures []GraphQLCapture, limit int) []map[string]interface{} {
+	var matched []GraphQLCapture
+	if op.Name != "" {
+		for _, capture := range captures {
+			if capture.OperationName == op.Name {
+				matched = append(matched, capture)
+			}
+		}
+	}
+	if len(matched) == 0 {
+		if key := normalizeGraphQL(op.Raw); key != "" {
+			for _, capture := range captures {
+				if normalizeGraphQL(capture.Query) == key {
+					matched = append(matched, capture)
+				}
+			}
+		}
+	}
+
+	var examples []map[string]interface{}
+	seen := make(map[string]bool)
+	for _, capture := range matched {
+		if len(capture.Variables) == 0 {
+			continue
+		}
+		variables := capture.Variables
+
+		// Encoded maps have sorted keys, so equal payloads encode identically
+		encoded, err := json.Marshal(variables)
+		if err != nil || seen[string(encoded)] {
+			continue
+		}
+		seen[string(encoded)] = true
+
+		examples = append(examples, variables)
+		if len(examples) == limit {
+			break
+		}
+	}
+
+	return examples
+}
+
+// redactVariables returns a copy of value with the values of keys matching redact
+// replaced, at any depth
+func redactVariables(value interface{}, redact *regexp.Regexp) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			if redact != nil && redact.MatchString(key) && val != nil {
+				redacted[key] = redactedValue
+			} else {
+				redacted[key] = redactVariables(val, redact)
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactVariables(item, redact)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// scalarExamples holds sample values for the built-in scalars and widely used custom ones
+var scalarExamples = map[string]interface{}{
+	"String":       "test",
+	"ID":           "test",
+	"Int":          1,
+	"Float":        1.5,
+	"Boolean":      true,
+	"DateTime":     "2024-01-01T00:00:00Z",
+	"Date":         "2024-01-01",
+	"Time":         "00:00:00Z",
+	"Timestamp":    "2024-01-01T00:00:00Z",
+	"UUID":         "00000000-0000-0000-0000-000000000000",
+	"URL":          "https://example.com",
+	"URI":          "https://example.com",
+	"Email":        "test@example.com",
+	"EmailAddress": "test@example.com",
+	"BigInt":       "1",
+	"Long":         1,
+	"Decimal":      "1.5",
+	"JSON":         map[string]interface{}{},
+	"JSONObject":   map[string]interface{}{},
+}
+
+// GenerateExampleVariables builds a sample variables object from the declared variable
+// types: "test" for strings, 1 for numbers, true for booleans, a placeholder of the right
+// shape for common custom scalars and a one-element list for list types. With the types
+// of an introspected schema, enums get their first value and other custom scalars
+// "test". Nullable variables of other types are null; non-null ones get an empty object
+// so the payload stays valid.
+func GenerateExampleVariables(op *GraphQLOperation, schema map[string]IntrospectionType) map[string]interface{} {
+	variables := make(map[string]interface{}, len(op.Variables))
+	for name, typ := range op.Variables {
+		variables[name] = exampleValue(typ, schema)
+	}
+	return variables
+}
+
+// exampleValue returns a sample value for a GraphQL type such as "[ID!]!", looking up
+// named types other than the common scalars in schema, which may be nil
+func exampleValue(typ string, schema map[string]IntrospectionType) interface{} {
+	typ = strings.TrimSpace(typ)
+	nonNull := strings.HasSuffix(typ, "!")
+	typ = strings.TrimSuffix(typ, "!")
+	if strings.HasPrefix(typ, "[") && strings.HasSuffix(typ, "]") {
+		return []interface{}{exampleValue(typ[1:len(typ)-1], schema)}
+	}
+
+	if value, ok := scalarExamples[typ]; ok {
+		return value
+	}
+	if t, ok := schema[typ]; ok {
+		switch t.Kind {
+		case "ENUM":
+			if len(t.EnumValues) > 0 {
+				return t.EnumValues[0].Name
+			}
+		case "SCALAR":
+			return "test"
+		}
+	}
+	if nonNull {
+		return map[string]interface{}{}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestExampleVariables(t *testing.T) {
+	const getUser = "query GetUser($id: ID!) { user(id: $id) { id } }"
+	captures := []GraphQLCapture{
+		{OperationName: "GetUser", Query: getUser, Variables: map[string]interface{}{"id": "1"}},
+		{OperationName: "GetUser", Query: getUser, Variables: map[string]interface{}{"id": "1"}},
+		{OperationName: "GetUser", Query: getUser, Variables: map[string]interface{}{"id": "2"}},
+		{OperationName: "GetUser", Query: getUser},
+		{OperationName: "GetUser", Query: getUser, Variables: map[string]interface{}{"id": "3"}},
+		{Query: "query { feed(first: $n) { id } }", Variables: map[string]interface{}{"n": 10.0}},
+		{OperationName: "Other", Query: "query Other($id: ID) { user(id: $id) { id } }", Variables: map[string]interface{}{"id": "9"}},
+	}
+
+	tests := []struct {
+		name  string
+		op    *GraphQLOperation
+		limit int
+		want  []map[string]interface{}
+	}{
+		{"distinct payloads by name", &GraphQLOperation{Name: "GetUser", Raw: getUser}, 3,
+			[]map[string]interface{}{{"id": "1"}, {"id": "2"}, {"id": "3"}}},
+		{"limit", &GraphQLOperation{Name: "GetUser", Raw: getUser}, 1,
+			[]map[string]interface{}{{"id": "1"}}},
+		{"anonymous matched on the normalized query", &GraphQLOperation{Raw: "query {\n  feed(first: $n) {\n    id\n  }\n}"}, 3,
+			[]map[string]interface{}{{"n": 10.0}}},
+		{"name without captures falls back to the query", &GraphQLOperation{Name: "Renamed", Raw: "query Other($id: ID) { user(id: $id) { id } }"}, 3,
+			[]map[string]interface{}{{"id": "9"}}},
+		{"no match", &GraphQLOperation{Name: "Missing", Raw: "query Missing { a }"}, 3, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exampleVariables(tt.op, captures, tt.limit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("exampleVariables = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactVariables(t *testing.T) {
+	redact := regexp.MustCompile(defaultRedactPattern)
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{"sensitive keys", map[string]interface{}{"password": "hunter2", "apiKey": "k", "email": "a@example.com"},
+			map[string]interface{}{"password": redactedValue, "apiKey": redactedValue, "email": "a@example.com"}},
+		{"case insensitive", map[string]interface{}{"AuthToken": "t"}, map[string]interface{}{"AuthToken": redactedValue}},
+		{"nested objects and lists", map[string]interface{}{"input": map[string]interface{}{
+			"credentials": []interface{}{"a"}, "users": []interface{}{map[string]interface{}{"sessionId": "s", "id": 1.0}},
+		}}, map[string]interface{}{"input": map[string]interface{}{
+			"credentials": redactedValue, "users": []interface{}{map[string]interface{}{"sessionId": redactedValue, "id": 1.0}},
+		}}},
+		{"null values stay null", map[string]interface{}{"token": nil}, map[string]interface{}{"token": nil}},
+		{"scalars", "password", "password"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactVariables(tt.value, redact); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redactVariables = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The input is copied, not changed
+	original := map[string]interface{}{"password": "hunter2"}
+	redactVariables(original, redact)
+	if original["password"] != "hunter2" {
+		t.Error("redactVariables changed its input")
+	}
+}
+
+func TestExampleValue(t *testing.T) {
+	schema := map[string]IntrospectionType{
+		"Status":      {Kind: "ENUM", Name: "Status", EnumValues: []IntrospectionNamedType{{Name: "ACTIVE"}, {Name: "DISABLED"}}},
+		"Money":       {Kind: "SCALAR", Name: "Money"},
+		"FilterInput": {Kind: "INPUT_OBJECT", Name: "FilterInput"},
+	}
+	tests := []struct {
+		typ    string
+		schema map[string]IntrospectionType
+		want   interface{}
+	}{
+		{"String!", nil, "test"},
+		{"Int", nil, 1},
+		{"[ID!]!", nil, []interface{}{"test"}},
+		{"DateTime!", nil, "2024-01-01T00:00:00Z"},
+		{"UUID!", nil, "00000000-0000-0000-0000-000000000000"},
+		{"JSON", nil, map[string]interface{}{}},
+		{"Status!", schema, "ACTIVE"},
+		{"[Status!]", schema, []interface{}{"ACTIVE"}},
+		{"Money!", schema, "test"},
+		{"FilterInput!", schema, map[string]interface{}{}},
+		{"FilterInput", schema, nil},
+		{"Unknown!", nil, map[string]interface{}{}},
+		{"Unknown", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typ, func(t *testing.T) {
+			if got := exampleValue(tt.typ, tt.schema); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("exampleValue(%q) = %#v, want %#v", tt.typ, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntrospectedTypes(t *testing.T) {
+	results := []*IntrospectionResult{
+		{Endpoint: "https://a.example.com/graphql", Enabled: false},
+		{Endpoint: "https://b.example.com/graphql", Enabled: true, Schema: &IntrospectionSchema{Types: []IntrospectionType{
+			{Kind: "ENUM", Name: "Status", EnumValues: []IntrospectionNamedType{{Name: "ACTIVE"}}},
+		}}},
+		{Endpoint: "https://c.example.com/graphql", Enabled: true, Schema: &IntrospectionSchema{Types: []IntrospectionType{
+			{Kind: "ENUM", Name: "Status", EnumValues: []IntrospectionNamedType{{Name: "OTHER"}}},
+			{Kind: "SCALAR", Name: "Money"},
+		}}},
+	}
+	types := introspectedTypes(results)
+	if len(types) != 2 || types["Status"].EnumValues[0].Name != "ACTIVE" || types["Money"].Kind != "SCALAR" {
+		t.Errorf("introspectedTypes = %+v", types)
+	}
+	if introspectedTypes(results[:1]) != nil {
+		t.Error("no schema returned types")
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+// FileStats records what processing one JavaScript file produced, for the files
+// section of the JSON export
+type FileStats struct {
+	URL              string  `json:"url"`
+	Size             int     `json:"size"`             // Bytes downloaded
+	DownloadMs       float64 `json:"downloadMs"`       // Time spent downloading, including retries
+	Matches          int     `json:"matches"`          // Operations extracted, before session-wide deduplication
+	UniqueOperations int     `json:"uniqueOperations"` // Operations no earlier file contained
+	ParseFailures    int     `json:"parseFailures,omitempty"`
+	Error            string  `json:"error,omitempty"`       // Why downloading or extracting failed
+	DuplicateOf      string  `json:"duplicateOf,omitempty"` // Earlier file with identical content; this one was not scanned
+	Unchanged        bool    `json:"unchanged,omitempty"`   // Skipped by --resume; the counts are from the run that scanned it
+}
+
+// untimedFileStats leaves the download time out of a file's stats, so --no-timestamp
+// exports of unchanged JavaScript are identical. The zero DownloadMs hides the one of
+// FileStats and is itself omitted.
+type untimedFileStats struct {
+	*FileStats
+	DownloadMs float64 `json:"downloadMs,omitempty"`
+}
+
+// untimedFiles wraps every file's stats in untimedFileStats
+func untimedFiles(files []*FileStats) []untimedFileStats {
+	untimed := make([]untimedFileStats, len(files))
+	for i, file := range files {
+		untimed[i] = untimedFileStats{FileStats: file}
+	}
+	return untimed
+}
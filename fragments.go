@@ -0,0 +1,226 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	gqlast "github.com/vektah/gqlparser/v2/ast"
+)
+
+var (
+	// Start of a fragment definition, in plain text or inside a gql template literal
+	fragmentDefinitionPattern = regexp.MustCompile(`\bfragment\s+([_A-Za-z]\w*)\s+on\s+([_A-Za-z]\w*)[^{}"'` + "`" + `]*\{`)
+	// Fragment spreads, which the AST-less fallback uses to find unresolved names
+	fragmentSpreadPattern = regexp.MustCompile(`\.\.\.\s*([_A-Za-z]\w*)`)
+)
+
+// Fragment is a named fragment definition found in JavaScript
+type Fragment struct {
+	Name          string `json:"name"`
+	TypeCondition string `json:"typeCondition"`
+	Raw           string `json:"raw"`
+	Source        string `json:"source,omitempty"` // JS file the fragment was first found in
+}
+
+// ExtractFragmentsFromJS finds fragment definitions in JavaScript content, including
+// ones hidden in encoded or concatenated string literals or split by template
+// interpolations. The first definition of each name wins.
+func ExtractFragmentsFromJS(content string) map[string]*Fragment {
+	fragments := make(map[string]*Fragment)
+	decoded, _ := decodeEmbeddedStrings(content)
+	texts := append([]string{content}, decoded...)
+	merged, _ := mergeConcatenatedStrings(content)
+	texts = append(texts, merged...)
+	for _, text := range append(texts, templateTexts(content)...) {
+		for _, fragment := range extractFragmentsFromText(text) {
+			if fragments[fragment.Name] == nil {
+				fragments[fragment.Name] = fragment
+			}
+		}
+	}
+	return fragments
+}
+
+// extractFragmentsFromText matches fragment definitions in a block of source text,
+// reading each body up to its balanced closing brace
+func extractFragmentsFromText(content string) []*Fragment {
+	var fragments []*Fragment
+	for _, loc := range fragmentDefinitionPattern.FindAllStringSubmatchIndex(content, -1) {
+		end, ok := scanBalanced(content, loc[1]-1, '{', '}')
+		if !ok {
+			continue
+		}
+		raw := content[loc[0]:end]
+
+		// Clean up escaped characters the same way operations are
+		raw = strings.ReplaceAll(raw, "\\n", "\n")
+		raw = strings.ReplaceAll(raw, "\\t", "  ")
+		raw = strings.ReplaceAll(raw, `\"`, `"`)
+
+		doc, err := parseGraphQLDocument(raw)
+		if err != nil || len(doc.Operations) != 0 || len(doc.Fragments) != 1 {
+			continue
+		}
+		fragments = append(fragments, &Fragment{
+			Name:          content[loc[2]:loc[3]],
+			TypeCondition: content[loc[4]:loc[5]],
+			Raw:           printFragment(doc.Fragments[0]),
+		})
+	}
+	return fragments
+}
+
+// addFragments records fragments from source in the registry, keeping earlier ones
+func addFragments(registry map[string]*Fragment, fragments map[string]*Fragment, source string) {
+	for name, fragment := range fragments {
+		if registry[name] == nil {
+			if fragment.Source == "" {
+				fragment.Source = source
+			}
+			registry[name] = fragment
+		}
+	}
+}
+
+// resolveFragments inlines the registry's fragments into every operation that spreads
+// them, recursively, so each operation is complete on its own. Spreads of unknown
+// fragments are left in place and listed in UnresolvedFragments; a fragment that
+// spreads itself is left as a spread rather than expanded forever.
+func resolveFragments(operations []*GraphQLOperation, registry map[string]*Fragment) {
+	known := make(map[string]*gqlast.FragmentDefinition, len(registry))
+	for name, fragment := range registry {
+		if doc, err := parseGraphQLDocument(fragment.Raw); err == nil && len(doc.Fragments) > 0 {
+			known[name] = doc.Fragments[0]
+		}
+	}
+
+	for _, op := range operations {
+		if !strings.Contains(op.Raw, "...") {
+			continue
+		}
+
+		doc, err := parseGraphQLDocument(op.Raw)
+		if err != nil {
+			// Nothing can be inlined, but missing fragments can still be reported
+			for _, match := range fragmentSpreadPattern.FindAllStringSubmatch(op.Raw, -1) {
+				if match[1] != "on" && registry[match[1]] == nil {
+					op.UnresolvedFragments = appendUnique(op.UnresolvedFragments, match[1])
+				}
+			}
+			sort.Strings(op.UnresolvedFragments)
+			continue
+		}
+
+		// Fragments defined alongside the operation take precedence over the registry
+		fragments := make(map[string]*gqlast.FragmentDefinition, len(known))
+		for name, def := range known {
+			fragments[name] = def
+		}
+		for _, def := range doc.Fragments {
+			fragments[def.Name] = def
+		}
+
+		resolver := &fragmentResolver{fragments: fragments, visiting: make(map[string]bool)}
+		var resolved gqlast.QueryDocument
+		for _, def := range doc.Operations {
+			inlined := *def
+			inlined.SelectionSet = resolver.inline(def.SelectionSet)
+			resolved.Operations = append(resolved.Operations, &inlined)
+		}
+		if len(resolved.Operations) == 0 {
+			continue
+		}
+
+		op.Fragments = resolver.used
+		op.UnresolvedFragments = resolver.unresolved
+		sort.Strings(op.Fragments)
+		sort.Strings(op.UnresolvedFragments)
+		if len(resolver.used) == 0 {
+			continue
+		}
+		op.Raw = printDocument(&resolved)
+		op.Depth, op.FieldCount = operationComplexity(op.Raw)
+		if selections := parseSelections(op.Raw); selections != nil {
+			op.Selections = selections
+		}
+	}
+}
+
+// fragmentResolver replaces fragment spreads with equivalent inline fragments
+type fragmentResolver struct {
+	fragments  map[string]*gqlast.FragmentDefinition
+	visiting   map[string]bool // Fragments being expanded, to stop cycles
+	used       []string
+	unresolved []string
+}
+
+// inline returns a copy of selections with every resolvable spread expanded
+func (r *fragmentResolver) inline(selections gqlast.SelectionSet) gqlast.SelectionSet {
+	inlined := make(gqlast.SelectionSet, 0, len(selections))
+	for _, selection := range selections {
+		switch sel := selection.(type) {
+		case *gqlast.Field:
+			copied := *sel
+			copied.SelectionSet = r.inline(sel.SelectionSet)
+			inlined = append(inlined, &copied)
+		case *gqlast.InlineFragment:
+			copied := *sel
+			copied.SelectionSet = r.inline(sel.SelectionSet)
+			inlined = append(inlined, &copied)
+		case *gqlast.FragmentSpread:
+			inlined = append(inlined, r.spread(sel))
+		}
+	}
+	return inlined
+}
+
+// spread returns the inline fragment a spread expands to, or the spread itself when the
+// fragment is unknown or already being expanded
+func (r *fragmentResolver) spread(sel *gqlast.FragmentSpread) gqlast.Selection {
+	fragment := r.fragments[sel.Name]
+	if fragment == nil {
+		r.unresolved = appendUnique(r.unresolved, sel.Name)
+		return sel
+	}
+	if r.visiting[sel.Name] {
+		return sel
+	}
+
+	r.visiting[sel.Name] = true
+	defer delete(r.visiting, sel.Name)
+	r.used = appendUnique(r.used, sel.Name)
+	return &gqlast.InlineFragment{
+		TypeCondition: fragment.TypeCondition,
+		Directives:    sel.Directives,
+		SelectionSet:  r.inline(fragment.SelectionSet),
+	}
+}
+
+// sortedFragments lists the registry's fragments by name
+func sortedFragments(registry map[string]*Fragment) []*Fragment {
+	fragments := make([]*Fragment, 0, len(registry))
+	for _, fragment := range registry {
+		fragments = append(fragments, fragment)
+	}
+	sort.Slice(fragments, func(i, j int) bool {
+		return fragments[i].Name < fragments[j].Name
+	})
+	return fragments
+}
+
+// fragmentsSDL renders fragment definitions as a section appended to the SDL file
+func fragmentsSDL(fragments []*Fragment) string {
+	if len(fragments) == 0 {
+		return ""
+	}
+	var sdl strings.Builder
+	sdl.WriteString("# Fragments\n")
+	for _, fragment := range fragments {
+		if fragment.Source != "" {
+			sdl.WriteString("# Source: " + fragment.Source + "\n")
+		}
+		sdl.WriteString(fragment.Raw + "\n\n")
+	}
+	return sdl.String()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveFragments(t *testing.T) {
+	registry := map[string]*Fragment{
+		"UserFields":   {Name: "UserFields", TypeCondition: "User", Raw: "fragment UserFields on User { id name ...AvatarFields }"},
+		"AvatarFields": {Name: "AvatarFields", TypeCondition: "User", Raw: "fragment AvatarFields on User { avatar }"},
+		"Loop":         {Name: "Loop", TypeCondition: "Node", Raw: "fragment Loop on Node { id ...Loop }"},
+		"Broken":       {Name: "Broken", TypeCondition: "User", Raw: "fragment Broken on User {"},
+	}
+	tests := []struct {
+		name       string
+		raw        string
+		want       string
+		used       []string
+		unresolved []string
+	}{
+		{"nested spreads", "query A { viewer { ...UserFields } }",
+			"query A {\n  viewer {\n    ... on User {\n      id\n      name\n      ... on User {\n        avatar\n      }\n    }\n  }\n}",
+			[]string{"AvatarFields", "UserFields"}, nil},
+		{"local definition wins", "query B { viewer { ...AvatarFields } } fragment AvatarFields on User { avatarUrl }",
+			"query B {\n  viewer {\n    ... on User {\n      avatarUrl\n    }\n  }\n}",
+			[]string{"AvatarFields"}, nil},
+		{"unknown spread kept", "query C { viewer { ...Missing ...AvatarFields } }",
+			"query C {\n  viewer {\n    ...Missing\n    ... on User {\n      avatar\n    }\n  }\n}",
+			[]string{"AvatarFields"}, []string{"Missing"}},
+		{"only unknown spreads", "query D { viewer { ...Missing } }",
+			"query D { viewer { ...Missing } }", nil, []string{"Missing"}},
+		{"cycle stops", "query E { node { ...Loop } }",
+			"query E {\n  node {\n    ... on Node {\n      id\n      ...Loop\n    }\n  }\n}",
+			[]string{"Loop"}, nil},
+		{"unparseable fragment is unknown", "query F { viewer { ...Broken } }",
+			"query F { viewer { ...Broken } }", nil, []string{"Broken"}},
+		{"unparseable operation reports missing fragments", "query G { viewer { ...Missing ...UserFields ... on User { id }",
+			"query G { viewer { ...Missing ...UserFields ... on User { id }", nil, []string{"Missing"}},
+		{"no spreads", "query H { a }", "query H { a }", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := &GraphQLOperation{Type: Query, Raw: tt.raw}
+			resolveFragments([]*GraphQLOperation{op}, registry)
+			if op.Raw != tt.want {
+				t.Errorf("Raw = %q, want %q", op.Raw, tt.want)
+			}
+			if !reflect.DeepEqual(op.Fragments, tt.used) || !reflect.DeepEqual(op.UnresolvedFragments, tt.unresolved) {
+				t.Errorf("Fragments = %v, UnresolvedFragments = %v; want %v and %v", op.Fragments, op.UnresolvedFragments, tt.used, tt.unresolved)
+			}
+		})
+	}
+}
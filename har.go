@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR is the root of an HTTP Archive 1.2 document
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog holds the archive's creator and entries
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator identifies the tool that produced the archive
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is a single request/response exchange
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+}
+
+// HARRequest describes the request side of an entry
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARResponse describes the response side of an entry
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARNameValue is a header, cookie or query string parameter
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is the body sent with a request
+type HARPostData struct {
+	MimeType string         `json:"mimeType"`
+	Text     string         `json:"text"`
+	Params   []HARNameValue `json:"params,omitempty"` // Form fields, recorded instead of Text by some tools
+}
+
+// HARContent is the body returned with a response
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"` // "base64" when Text is encoded
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings breaks down the time spent on an exchange; -1 marks phases that did not apply
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// ExportToHAR serializes captured GraphQL traffic as a HAR 1.2 document, truncating
+// request and response bodies longer than maxBodySize bytes (0 disables truncation)
+func ExportToHAR(captures []GraphQLCapture, maxBodySize int) ([]byte, error) {
+	har := HAR{
+		Log: HARLog{
+			Version: "1.2",
+			Creator: HARCreator{Name: "gql-extractor", Version: "1.0"},
+			Entries: make([]HAREntry, 0, len(captures)),
+		},
+	}
+
+	for _, capture := range captures {
+		har.Log.Entries = append(har.Log.Entries, captureToHAREntry(capture, maxBodySize))
+	}
+
+	return json.MarshalIndent(har, "", "  ")
+}
+
+// captureToHAREntry converts a single capture into a HAR entry
+func captureToHAREntry(capture GraphQLCapture, maxBodySize int) HAREntry {
+	started := capture.StartedAt
+	if started.IsZero() {
+		started = capture.Timestamp.Add(-time.Duration(capture.DurationMs * float64(time.Millisecond)))
+	}
+
+	method := capture.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	request := HARRequest{
+		Method:      method,
+		URL:         capture.URL,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []HARNameValue{},
+		Headers:     harHeaders(capture.RequestHeaders),
+		QueryString: harQueryString(capture.URL),
+		HeadersSize: -1,
+		BodySize:    len(capture.RequestBody),
+	}
+	if capture.RequestBody != "" {
+		mimeType := "application/json"
+		for name, value := range capture.RequestHeaders {
+			if http.CanonicalHeaderKey(name) == "Content-Type" {
+				mimeType = value
+			}
+		}
+		text, _ := truncateBody(capture.RequestBody, maxBodySize)
+		request.PostData = &HARPostData{MimeType: mimeType, Text: text}
+	}
+
+	body := capture.ResponseBody
+	if body == "" && capture.Response != nil {
+		if encoded, err := json.Marshal(capture.Response); err == nil {
+			body = string(encoded)
+		}
+	}
+
+	response := HARResponse{
+		Status:      capture.Status,
+		StatusText:  http.StatusText(capture.Status),
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []HARNameValue{},
+		Headers:     harHeaders(capture.ResponseHeaders),
+		Content: HARContent{
+			Size:     len(body),
+			MimeType: capture.ContentType,
+		},
+		HeadersSize: -1,
+		BodySize:    int(capture.ResponseSize),
+	}
+	var truncated bool
+	response.Content.Text, truncated = truncateBody(body, maxBodySize)
+	if truncated {
+		response.Content.Comment = "truncated"
+	}
+	if capture.Pending {
+		// No response arrived; HAR uses status 0 for aborted requests
+		response.BodySize = -1
+	}
+
+	timings := HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1, Wait: capture.DurationMs}
+	if capture.Timings != nil {
+		timings = HARTimings{
+			Blocked: capture.Timings.Blocked,
+			DNS:     capture.Timings.DNS,
+			Connect: capture.Timings.Connect,
+			SSL:     capture.Timings.SSL,
+			Send:    capture.Timings.Send,
+			Wait:    capture.Timings.Wait,
+		}
+	}
+
+	return HAREntry{
+		StartedDateTime: started.Format(time.RFC3339Nano),
+		Time:            capture.DurationMs,
+		Request:         request,
+		Response:        response,
+		Timings:         timings,
+	}
+}
+
+// truncateBody shortens body to at most maxSize bytes and reports whether it did. The
+// cut backs up to the start of a rune so a multi-byte character is never split.
+func truncateBody(body string, maxSize int) (string, bool) {
+	if maxSize <= 0 || len(body) <= maxSize {
+		return body, false
+	}
+	end := maxSize
+	for end > 0 && !utf8.RuneStart(body[end]) {
+		end--
+	}
+	return body[:end], true
+}
+
+// harHeaders converts a header map into sorted HAR name/value pairs
+func harHeaders(headers map[string]string) []HARNameValue {
+	pairs := make([]HARNameValue, 0, len(headers))
+	for name, value := range headers {
+		pairs = append(pairs, HARNameValue{Name: name, Value: value})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Name < pairs[j].Name
+	})
+	return pairs
+}
+
+// harQueryString extracts the query string parameters of a URL
+func harQueryString(rawURL string) []HARNameValue {
+	pairs := []HARNameValue{}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return pairs
+	}
+	for name, values := range parsed.Query() {
+		for _, value := range values {
+			pairs = append(pairs, HARNameValue{Name: name, Value: value})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].Name < pairs[j].Name
+	})
+	return pairs
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateBody(t *testing.T) {
+	tests := []struct {
+		body      string
+		maxSize   int
+		want      string
+		truncated bool
+	}{
+		{"abcdef", 0, "abcdef", false},
+		{"abcdef", 6, "abcdef", false},
+		{"abcdef", 4, "abcd", true},
+		{"ab€cd", 3, "ab", true}, // € is 3 bytes starting at index 2
+		{"ab€cd", 4, "ab", true},
+		{"ab€cd", 5, "ab€", true},
+		{"日本語", 2, "", true},
+	}
+	for _, tt := range tests {
+		got, truncated := truncateBody(tt.body, tt.maxSize)
+		if got != tt.want || truncated != tt.truncated {
+			t.Errorf("truncateBody(%q, %d) = (%q, %v), want (%q, %v)", tt.body, tt.maxSize, got, truncated, tt.want, tt.truncated)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncateBody(%q, %d) split a rune: %q", tt.body, tt.maxSize, got)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mafredri/cdp/protocol/network"
+)
+
+// readHAR loads a HAR file recorded by DevTools, Burp or a proxy
+func readHAR(path string) (*HAR, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HAR file: %v", err)
+	}
+	var har HAR
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("failed to parse HAR file %s: %v", path, err)
+	}
+	return &har, nil
+}
+
+// captureHAR replays the entries of a HAR file as if they had just been observed:
+// GraphQL exchanges are sent to gqlCaptures and JavaScript and HTML responses to
+// jsURLs. It returns the bodies of those responses keyed by URL so they are read from
+// the archive instead of downloaded. Entries that cannot be used in full are logged
+// and skipped or kept partially. Both channels are closed once every entry was sent.
+func captureHAR(ctx context.Context, har *HAR, jsURLs chan string, gqlCaptures chan GraphQLCapture, origins *OriginFilter, handler CaptureHandler, progress *Progress) map[string]string {
+	var captures []GraphQLCapture
+	var scriptURLs []string
+	contents := make(map[string]string)
+	for i, entry := range har.Log.Entries {
+		req := harNetworkRequest(entry.Request)
+		if isGraphQLRequest(req) {
+			if capture, ok := harCapture(entry, req); ok {
+				captures = append(captures, capture)
+			}
+			continue
+		}
+
+		mimeType := entry.Response.Content.MimeType
+		if !isScriptResponse(entry.Request.URL, mimeType) && !isHTMLResponse(mimeType) {
+			continue
+		}
+		body, err := harResponseBody(entry.Response)
+		if err != nil || len(body) == 0 {
+			slog.Warn("HAR entry has no usable response body", "entry", i, "url", entry.Request.URL, "error", err)
+			continue
+		}
+		if _, seen := contents[entry.Request.URL]; !seen {
+			scriptURLs = append(scriptURLs, entry.Request.URL)
+		}
+		contents[entry.Request.URL] = string(body)
+	}
+	slog.Info("Loaded HAR file", "entries", len(har.Log.Entries), "captures", len(captures), "scripts", len(scriptURLs))
+
+	go func() {
+		defer close(jsURLs)
+		defer close(gqlCaptures)
+
+		for _, capture := range captures {
+			atomic.AddInt32(&progress.NetworkCaptures, 1)
+			runCaptureHandler(handler, capture)
+			select {
+			case gqlCaptures <- capture:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for _, jsURL := range scriptURLs {
+			if !origins.Allows(jsURL) {
+				atomic.AddInt32(&progress.JSFilesSkipped, 1)
+				continue
+			}
+			progress.AddJSFile(jsURL)
+			select {
+			case jsURLs <- jsURL:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return contents
+}
+
+// harNetworkRequest converts a HAR request to the form the CDP capture helpers expect.
+// A multipart body recorded only as form parameters is rebuilt from its operations field.
+func harNetworkRequest(r HARRequest) *network.Request {
+	req := &network.Request{URL: r.URL, Method: r.Method}
+	headers := make(map[string]string, len(r.Headers))
+	for _, header := range r.Headers {
+		headers[header.Name] = header.Value
+	}
+
+	if r.PostData != nil {
+		postData := r.PostData.Text
+		if postData == "" {
+			for _, param := range r.PostData.Params {
+				if param.Name == "operations" {
+					postData = param.Value
+					for name := range headers {
+						if strings.EqualFold(name, "Content-Type") {
+							delete(headers, name)
+						}
+					}
+					headers["Content-Type"] = "application/json"
+				}
+			}
+		}
+		if postData != "" {
+			req.PostData = &postData
+		}
+	}
+
+	if encoded, err := json.Marshal(headers); err == nil {
+		req.Headers = network.Headers(encoded)
+	}
+	return req
+}
+
+// harCapture builds a capture from a GraphQL HAR entry. A missing or truncated
+// response body marks the capture instead of dropping it.
+func harCapture(entry HAREntry, req *network.Request) (GraphQLCapture, bool) {
+	capture := newCapture(req)
+	if !identifiesOperation(capture) {
+		if req.PostData == nil {
+			slog.Warn("HAR entry has no request body", "url", entry.Request.URL)
+		}
+		return capture, false
+	}
+	if started, err := time.Parse(time.RFC3339Nano, entry.StartedDateTime); err == nil {
+		capture.StartedAt = started
+		capture.Timestamp = started
+	}
+	capture.DurationMs = entry.Time
+	capture.Status = entry.Response.Status
+	capture.ContentType = entry.Response.Content.MimeType
+	capture.ResponseHeaders = make(map[string]string, len(entry.Response.Headers))
+	for _, header := range entry.Response.Headers {
+		capture.ResponseHeaders[header.Name] = header.Value
+	}
+	if entry.Response.Status == 0 {
+		capture.Pending = true
+		return capture, true
+	}
+
+	body, err := harResponseBody(entry.Response)
+	switch {
+	case err != nil:
+		slog.Warn("Could not decode HAR response body", "url", entry.Request.URL, "error", err)
+		capture.BodyUnavailable = true
+	case len(body) == 0:
+		capture.BodyUnavailable = true
+	default:
+		if entry.Response.Content.Size > len(body) {
+			slog.Warn("HAR response body is truncated", "url", entry.Request.URL,
+				"size", entry.Response.Content.Size, "recorded", len(body))
+		}
+		capture.ResponseSize = int64(entry.Response.Content.Size)
+		setResponseBody(&capture, string(body))
+	}
+	return capture, true
+}
+
+// harResponseBody returns a response's content, undoing base64 and gzip encodings
+// that some tools leave in the archive
+func harResponseBody(resp HARResponse) ([]byte, error) {
+	body := []byte(resp.Content.Text)
+	if resp.Content.Encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(resp.Content.Text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64 body: %v", err)
+		}
+		body = decoded
+	}
+	if len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b {
+		decoded, err := decodeBody(body, "gzip")
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress body: %v", err)
+		}
+		body = decoded
+	}
+	return body, nil
+}
+
+// harTarget returns the origin of the first entry, naming the output files of a HAR
+// run without --domain
+func harTarget(har *HAR) string {
+	if len(har.Log.Entries) == 0 {
+		return ""
+	}
+	parsed, err := url.Parse(har.Log.Entries[0].Request.URL)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCaptureHAR(t *testing.T) {
+	har, err := readHAR("testdata/har/input.har")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsURLs := make(chan string, 10)
+	gqlCaptures := make(chan GraphQLCapture, 10)
+	contents := captureHAR(context.Background(), har, jsURLs, gqlCaptures, nil, nil, &Progress{})
+
+	captures := make(map[string]GraphQLCapture)
+	for capture := range gqlCaptures {
+		captures[capture.OperationName] = capture
+	}
+	var scripts []string
+	for jsURL := range jsURLs {
+		scripts = append(scripts, jsURL)
+	}
+	if want := []string{"https://example.com/static/app.js"}; !reflect.DeepEqual(scripts, want) {
+		t.Errorf("scripts = %v, want %v", scripts, want)
+	}
+	if contents["https://example.com/static/app.js"] != "const q=`query FromScript { a }`;" {
+		t.Errorf("script content = %q", contents["https://example.com/static/app.js"])
+	}
+
+	started := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string // Case the entry covers
+		operation string
+		query     string
+		variables map[string]interface{}
+		body      string
+	}{
+		{"JSON POST", "Viewer", "query Viewer { viewer { id name } }", map[string]interface{}{},
+			`{"data":{"viewer":{"id":"1","name":"Ada"}}}`},
+		{"GET with query parameters", "Search", "query Search($term: String!) { search(term: $term) { id } }", map[string]interface{}{"term": "lamp"},
+			`{"data":{"search":[{"id":"p1"}]}}`},
+		{"multipart operations field", "UploadAvatar", "mutation UploadAvatar($file: Upload!) { uploadAvatar(file: $file) { url } }", map[string]interface{}{"file": nil},
+			`{"data":{"uploadAvatar":{"url":"https://cdn.example.com/a.png"}}}`},
+		{"base64 response", "Orders", "query Orders { orders { id total } }", nil,
+			`{"data":{"orders":[{"id":"o1","total":12.5}]}}`},
+		{"gzip response", "OrdersGzip", "query OrdersGzip { orders { id total } }", nil,
+			`{"data":{"orders":[{"id":"o1","total":12.5}]}}`},
+	}
+	if len(captures) != len(tests) {
+		t.Errorf("got %d captures, want %d", len(captures), len(tests))
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capture, ok := captures[tt.operation]
+			if !ok {
+				t.Fatalf("no capture of %s", tt.operation)
+			}
+			if capture.Query != tt.query {
+				t.Errorf("query = %q, want %q", capture.Query, tt.query)
+			}
+			if !reflect.DeepEqual(capture.Variables, tt.variables) {
+				t.Errorf("variables = %v, want %v", capture.Variables, tt.variables)
+			}
+			if capture.ResponseBody != tt.body || capture.Response == nil {
+				t.Errorf("response body = %q, want %q", capture.ResponseBody, tt.body)
+			}
+			if capture.Status != 200 || capture.DurationMs != 42.5 || !capture.StartedAt.Equal(started) {
+				t.Errorf("status %d, duration %v, started %v; want 200, 42.5, %v", capture.Status, capture.DurationMs, capture.StartedAt, started)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CaptureHandler runs custom logic on every GraphQL capture as it is recorded, before
+// it enters the rest of the pipeline. An error is logged and does not stop the capture.
+type CaptureHandler func(GraphQLCapture) error
+
+// execTimeout bounds how long an --exec command may take for one capture
+const execTimeout = 30 * time.Second
+
+// Handlers run on a fixed number of workers, with a bounded number of captures waiting
+const (
+	captureHookWorkers = 4
+	captureHookQueue   = 256
+)
+
+// execCaptureHandler returns a handler that runs command through the shell once per
+// capture, writing the capture's JSON to its stdin with secrets masked by redact. The
+// command's stdout and stderr go to stderr so they never mix with results printed on
+// stdout.
+func execCaptureHandler(command string, redact *Redactor) CaptureHandler {
+	return func(capture GraphQLCapture) error {
+		data, err := json.Marshal(redact.Capture(capture))
+		if err != nil {
+			return fmt.Errorf("failed to encode capture: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Stdin = bytes.NewReader(append(data, '\n'))
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to run --exec command: %v", err)
+		}
+		return nil
+	}
+}
+
+// runCaptureHandler invokes handler on a capture, logging rather than returning its error
+func runCaptureHandler(handler CaptureHandler, capture GraphQLCapture) {
+	if handler == nil {
+		return
+	}
+	if err := handler(capture); err != nil {
+		slog.Warn("Capture handler failed", "operation", capture.OperationName, "url", capture.URL,
+			"error", strings.TrimSpace(err.Error()))
+	}
+}
+
+// CaptureHooks runs a handler off the capture goroutines: captures are queued and
+// handled by a fixed pool of workers, so a slow handler never holds up network events.
+// Captures arriving while the queue is full are dropped and counted.
+type CaptureHooks struct {
+	handler CaptureHandler
+	queue   chan GraphQLCapture
+	mu      sync.Mutex // Guards closed against captures queued while closing
+	closed  bool
+	wg      sync.WaitGroup
+	dropped int32
+}
+
+// newCaptureHooks starts workers running handler on the queued captures
+func newCaptureHooks(handler CaptureHandler, workers, size int) *CaptureHooks {
+	h := &CaptureHooks{handler: handler, queue: make(chan GraphQLCapture, size)}
+	for i := 0; i < workers; i++ {
+		h.wg.Add(1)
+		go func() {
+			defer h.wg.Done()
+			for capture := range h.queue {
+				runCaptureHandler(h.handler, capture)
+			}
+		}()
+	}
+	return h
+}
+
+// Handle queues a capture for the workers without waiting. It has the signature of a
+// CaptureHandler so it can stand in for the handler it runs.
+func (h *CaptureHooks) Handle(capture GraphQLCapture) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	select {
+	case h.queue <- capture:
+	default:
+		if atomic.AddInt32(&h.dropped, 1) == 1 {
+			slog.Warn("Capture handler queue full, dropping captures", "queue", cap(h.queue))
+		}
+	}
+	return nil
+}
+
+// Close stops accepting captures and waits for the queued ones to be handled
+func (h *CaptureHooks) Close() {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.closed = true
+	close(h.queue)
+	h.mu.Unlock()
+	h.wg.Wait()
+	if dropped := atomic.LoadInt32(&h.dropped); dropped > 0 {
+		slog.Warn("Capture handler skipped captures while busy", "dropped", dropped)
+	}
+}
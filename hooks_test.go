@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCaptureHooksDoNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	var handled int32
+	hooks := newCaptureHooks(func(GraphQLCapture) error {
+		<-release
+		atomic.AddInt32(&handled, 1)
+		return nil
+	}, 2, 4)
+
+	// Two captures keep the workers busy, four wait and the rest are dropped
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		runCaptureHandler(hooks.Handle, GraphQLCapture{OperationName: "Op"})
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Handle blocked for %v behind a slow handler", elapsed)
+	}
+
+	close(release)
+	hooks.Close()
+	got := atomic.LoadInt32(&handled)
+	if got < 4 || got > 6 {
+		t.Errorf("handled %d captures, want the 4 queued plus up to 2 taken by workers", got)
+	}
+	if dropped := atomic.LoadInt32(&hooks.dropped); dropped+got != 10 {
+		t.Errorf("dropped %d and handled %d, want 10 in total", dropped, got)
+	}
+
+	// Captures after Close are ignored
+	runCaptureHandler(hooks.Handle, GraphQLCapture{})
+	hooks.Close()
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/tebeka/selenium"
+)
+
+// defaultInteractSelectors are the elements --auto-interact clicks besides the buttons
+// and links labelled "load more", "show more" and the like
+const defaultInteractSelectors = `[role=tab], [aria-expanded=false], details > summary`
+
+// Bounds on a single interaction pass, on top of its time budget
+const (
+	maxScrollSteps    = 50  // Viewport-sized scrolls before giving up on reaching the bottom
+	maxMoreClicks     = 5   // Clicks on the same "load more" button
+	maxInteractClicks = 100 // Clicks on a page
+)
+
+// interactGuardScript makes clicks stay on the page: links to other pages and form
+// submissions are cancelled before the browser acts on them
+const interactGuardScript = `
+if (!window.__gqlExtractorGuard) {
+  window.__gqlExtractorGuard = true;
+  var page = function (u) { return u.origin + u.pathname + u.search; };
+  document.addEventListener("click", function (e) {
+    var a = e.target.closest && e.target.closest("a[href]");
+    if (a && page(a) !== page(location)) { e.preventDefault(); }
+  }, true);
+  document.addEventListener("submit", function (e) { e.preventDefault(); }, true);
+}
+return true;`
+
+// scrollStepScript scrolls one viewport down and returns how far down the page the
+// viewport now ends and how tall the page is
+const scrollStepScript = `
+window.scrollBy(0, window.innerHeight);
+return [Math.ceil(window.scrollY + window.innerHeight), document.documentElement.scrollHeight];`
+
+// clickNextScript clicks the first visible candidate not clicked yet and returns its
+// label, or null when none is left. Submit buttons, links to other pages and labels
+// that sound destructive are skipped. "Load more" buttons may be clicked again.
+const clickNextScript = `
+var selectors = arguments[0], maxMore = arguments[1];
+var skip = /\b(?:delete|remove|log ?out|sign ?out|unsubscribe|cancel|pay|purchase|buy|checkout)\b/i;
+var more = /\b(load|show|see|view) more\b/i;
+var page = function (u) { return u.origin + u.pathname + u.search; };
+var candidates = selectors ? Array.from(document.querySelectorAll(selectors)) : [];
+document.querySelectorAll("button, a, [role=button]").forEach(function (el) {
+  if (more.test(el.textContent || "")) { candidates.push(el); }
+});
+for (var i = 0; i < candidates.length; i++) {
+  var el = candidates[i];
+  var label = (el.textContent || el.getAttribute("aria-label") || "").trim().replace(/\s+/g, " ").slice(0, 60);
+  var clicks = Number(el.getAttribute("data-gql-extractor-clicks") || 0);
+  if (clicks >= (more.test(label) ? maxMore : 1) || el.disabled || skip.test(label)) { continue; }
+  if (el.closest("form") && (el.type === "submit" || (el.tagName === "BUTTON" && !el.getAttribute("type")))) { continue; }
+  if (el.tagName === "A" && el.href && page(el) !== page(location)) { continue; }
+  var rect = el.getBoundingClientRect();
+  if (rect.width === 0 || rect.height === 0) { continue; }
+  el.setAttribute("data-gql-extractor-clicks", clicks + 1);
+  el.scrollIntoView({block: "center"});
+  el.click();
+  return label || el.tagName.toLowerCase();
+}
+return null;`
+
+// hoverMenusScript sends hover events to menu triggers not hovered yet and returns how
+// many it hovered
+const hoverMenusScript = `
+var hovered = 0;
+document.querySelectorAll("[aria-haspopup], nav li, [role=menuitem]").forEach(function (el) {
+  if (el.getAttribute("data-gql-extractor-hovered")) { return; }
+  el.setAttribute("data-gql-extractor-hovered", "1");
+  el.dispatchEvent(new MouseEvent("mouseover", {bubbles: true}));
+  el.dispatchEvent(new MouseEvent("mouseenter"));
+  hovered++;
+});
+return hovered;`
+
+// Interactor scrolls, clicks and hovers the loaded page for --auto-interact, so queries
+// that only fire on interaction (infinite scroll, tabs, "load more") are captured
+type Interactor struct {
+	Selectors string        // CSS selectors of elements to click
+	Pause     time.Duration // Wait after each action for the requests it triggers
+	Budget    time.Duration // Total time spent interacting with a page
+}
+
+// Interact runs the interaction sequence on the page the browser shows: scroll to the
+// bottom, click the candidates, then hover menus. Clicks that still navigate away are
+// undone by going back. It stops when the budget is spent or ctx is done.
+func (in *Interactor) Interact(ctx context.Context, wd selenium.WebDriver) {
+	page, err := wd.CurrentURL()
+	if err != nil {
+		return
+	}
+	deadline := time.Now().Add(in.Budget)
+	active := func() bool {
+		return ctx.Err() == nil && time.Now().Before(deadline)
+	}
+	pause := func() {
+		select {
+		case <-time.After(in.Pause):
+		case <-ctx.Done():
+		}
+	}
+
+	// Scroll until the page stops growing once the bottom is reached
+	scrolls, settled := 0, 0
+	lastHeight := 0.0
+	for scrolls < maxScrollSteps && settled < 2 && active() {
+		result, err := wd.ExecuteScript(scrollStepScript, nil)
+		if err != nil {
+			slog.Warn("Could not scroll the page", "error", err)
+			break
+		}
+		scrolls++
+		pause()
+		position, ok := result.([]interface{})
+		if !ok || len(position) != 2 {
+			break
+		}
+		bottom, _ := position[0].(float64)
+		height, _ := position[1].(float64)
+		if bottom >= height && height == lastHeight {
+			settled++
+		} else {
+			settled = 0
+		}
+		lastHeight = height
+	}
+
+	clicks := 0
+	if _, err := wd.ExecuteScript(interactGuardScript, nil); err != nil {
+		slog.Warn("Could not guard the page against navigation, not clicking", "error", err)
+	} else {
+		for clicks < maxInteractClicks && active() {
+			result, err := wd.ExecuteScript(clickNextScript, []interface{}{in.Selectors, maxMoreClicks})
+			if err != nil {
+				slog.Warn("Could not click on the page", "error", err)
+				break
+			}
+			label, ok := result.(string)
+			if !ok {
+				break
+			}
+			clicks++
+			slog.Debug("Clicked", "element", label)
+			pause()
+
+			if current, err := wd.CurrentURL(); err == nil && normalizeCrawlURL(current) != normalizeCrawlURL(page) {
+				slog.Warn("Click navigated away, going back", "element", label, "url", current)
+				if err := wd.Back(); err != nil {
+					break
+				}
+				wd.ExecuteScript(interactGuardScript, nil)
+			}
+		}
+	}
+
+	hovers := 0
+	if active() {
+		if result, err := wd.ExecuteScript(hoverMenusScript, nil); err == nil {
+			if count, ok := result.(float64); ok && count > 0 {
+				hovers = int(count)
+				pause()
+			}
+		}
+	}
+	slog.Info("Finished interacting with the page", "url", page, "scrolls", scrolls, "clicks", clicks, "hovers", hovers)
+}
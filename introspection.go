@@ -0,0 +1,553 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// introspectionQuery is the standard introspection query sent by GraphiQL and most tooling
+const introspectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types { ...FullType }
+    directives { name description locations args { ...InputValue } }
+  }
+}
+
+fragment FullType on __Type {
+  kind
+  name
+  description
+  fields(includeDeprecated: true) {
+    name
+    description
+    args { ...InputValue }
+    type { ...TypeRef }
+    isDeprecated
+    deprecationReason
+  }
+  inputFields { ...InputValue }
+  interfaces { ...TypeRef }
+  enumValues(includeDeprecated: true) { name description isDeprecated deprecationReason }
+  possibleTypes { ...TypeRef }
+}
+
+fragment InputValue on __InputValue {
+  name
+  description
+  type { ...TypeRef }
+  defaultValue
+}
+
+fragment TypeRef on __Type {
+  kind
+  name
+  ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name } } } } } } }
+}`
+
+// IntrospectionSchema is the __schema object returned by an introspection query
+type IntrospectionSchema struct {
+	QueryType        *IntrospectionNamedType `json:"queryType"`
+	MutationType     *IntrospectionNamedType `json:"mutationType"`
+	SubscriptionType *IntrospectionNamedType `json:"subscriptionType"`
+	Types            []IntrospectionType     `json:"types"`
+}
+
+// IntrospectionNamedType references a type by name
+type IntrospectionNamedType struct {
+	Name string `json:"name"`
+}
+
+// IntrospectionType describes a single type in the introspected schema
+type IntrospectionType struct {
+	Kind          string                    `json:"kind"`
+	Name          string                    `json:"name"`
+	Description   string                    `json:"description"`
+	Fields        []IntrospectionField      `json:"fields"`
+	InputFields   []IntrospectionInputValue `json:"inputFields"`
+	Interfaces    []IntrospectionTypeRef    `json:"interfaces"`
+	EnumValues    []IntrospectionNamedType  `json:"enumValues"`
+	PossibleTypes []IntrospectionTypeRef    `json:"possibleTypes"`
+}
+
+// IntrospectionField describes a field of an object or interface type
+type IntrospectionField struct {
+	Name string                    `json:"name"`
+	Args []IntrospectionInputValue `json:"args"`
+	Type IntrospectionTypeRef      `json:"type"`
+}
+
+// IntrospectionInputValue describes an argument or input object field
+type IntrospectionInputValue struct {
+	Name         string               `json:"name"`
+	Type         IntrospectionTypeRef `json:"type"`
+	DefaultValue *string              `json:"defaultValue"`
+}
+
+// IntrospectionTypeRef is a possibly wrapped (list/non-null) type reference
+type IntrospectionTypeRef struct {
+	Kind   string                `json:"kind"`
+	Name   string                `json:"name"`
+	OfType *IntrospectionTypeRef `json:"ofType"`
+}
+
+// IntrospectionResult records the outcome of probing one endpoint
+type IntrospectionResult struct {
+	Endpoint string
+	Enabled  bool   // The endpoint returned a schema
+	Disabled bool   // The server explicitly refused introspection
+	Error    string // Why the probe failed, if it did
+	Schema   *IntrospectionSchema
+	Raw      []byte
+}
+
+// probeIntrospection sends the introspection query to every endpoint seen in captures
+func probeIntrospection(captures []GraphQLCapture, opts *DownloadOptions) []*IntrospectionResult {
+	var results []*IntrospectionResult
+	for _, endpoint := range summarizeEndpoints(captures) {
+		slog.Info("Probing introspection", "url", endpoint.URL)
+		result := probeEndpoint(endpoint.URL, captureHeadersFor(endpoint.URL, captures), opts)
+		switch {
+		case result.Enabled:
+			slog.Info("Introspection enabled", "url", endpoint.URL, "types", len(result.Schema.Types))
+		case result.Disabled:
+			slog.Info("Introspection disabled", "url", endpoint.URL, "error", result.Error)
+		default:
+			slog.Warn("Introspection probe failed", "url", endpoint.URL, "error", result.Error)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// captureHeadersFor returns the request headers the app last sent to endpoint
+func captureHeadersFor(endpoint string, captures []GraphQLCapture) map[string]string {
+	var headers map[string]string
+	for _, capture := range captures {
+		if endpointURL(capture.URL) == endpoint && len(capture.RequestHeaders) > 0 {
+			headers = capture.RequestHeaders
+		}
+	}
+	return headers
+}
+
+// probeEndpoint tries a plain POST, a POST with CSRF preflight headers, and finally a GET
+func probeEndpoint(endpoint string, headers map[string]string, opts *DownloadOptions) *IntrospectionResult {
+	result := &IntrospectionResult{Endpoint: endpoint}
+
+	if opts.Browser != nil && opts.Client.Jar != nil {
+		if err := syncBrowserCookies(opts.Browser, opts.Client.Jar, endpoint); err != nil {
+			slog.Warn("Could not sync cookies", "url", endpoint, "error", err)
+		}
+	}
+
+	attempts := []struct {
+		method    string
+		preflight bool
+	}{
+		{http.MethodPost, false},
+		{http.MethodPost, true},
+		{http.MethodGet, true},
+	}
+
+	for _, attempt := range attempts {
+		status, body, err := sendIntrospection(opts, endpoint, headers, attempt.method, attempt.preflight)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+
+		var response struct {
+			Data *struct {
+				Schema *IntrospectionSchema `json:"__schema"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(body, &response); err == nil && response.Data != nil && response.Data.Schema != nil {
+			result.Enabled = true
+			result.Disabled = false
+			result.Error = ""
+			result.Schema = response.Data.Schema
+			result.Raw = body
+			return result
+		}
+
+		message := describeIntrospectionFailure(status, body)
+		result.Error = message
+		lower := strings.ToLower(message)
+		switch {
+		case strings.Contains(lower, "introspection"):
+			// The server understood the query and refused it; other variants won't help
+			result.Disabled = true
+			return result
+		case strings.Contains(lower, "csrf") || strings.Contains(lower, "cross-site") || strings.Contains(lower, "preflight"):
+			continue
+		case status == http.StatusMethodNotAllowed || status == http.StatusNotFound || status == http.StatusBadRequest:
+			continue
+		}
+	}
+
+	return result
+}
+
+// sendIntrospection performs a single introspection request
+func sendIntrospection(opts *DownloadOptions, endpoint string, headers map[string]string, method string, preflight bool) (int, []byte, error) {
+	var req *http.Request
+	var err error
+	if method == http.MethodGet {
+		target, parseErr := url.Parse(endpoint)
+		if parseErr != nil {
+			return 0, nil, parseErr
+		}
+		query := target.Query()
+		query.Set("query", introspectionQuery)
+		query.Set("operationName", "IntrospectionQuery")
+		target.RawQuery = query.Encode()
+		req, err = http.NewRequest(method, target.String(), nil)
+	} else {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"query":         introspectionQuery,
+			"operationName": "IntrospectionQuery",
+		})
+		req, err = http.NewRequest(method, endpoint, bytes.NewReader(payload))
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	for name, value := range headers {
+		switch strings.ToLower(name) {
+		case "content-length", "host", "accept-encoding", "connection":
+			continue
+		}
+		req.Header.Set(name, value)
+	}
+	if method != http.MethodGet {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if opts.Cookie != "" {
+		req.Header.Set("Cookie", opts.Cookie)
+	}
+	if preflight {
+		// Satisfies Apollo Server's CSRF prevention and similar checks
+		req.Header.Set("Apollo-Require-Preflight", "true")
+		req.Header.Set("X-Apollo-Operation-Name", "IntrospectionQuery")
+	}
+
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("introspection request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("failed to read introspection response: %v", err)
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+// describeIntrospectionFailure summarizes a failed introspection response
+func describeIntrospectionFailure(status int, body []byte) string {
+	var response interface{}
+	if err := json.Unmarshal(body, &response); err == nil {
+		var messages []string
+		for _, gqlErr := range extractErrorsFromResponse(response) {
+			messages = append(messages, gqlErr.Message)
+		}
+		if len(messages) > 0 {
+			return fmt.Sprintf("HTTP %d: %s", status, strings.Join(messages, "; "))
+		}
+	}
+
+	text := strings.TrimSpace(string(body))
+	if len(text) > 200 {
+		text = text[:200] + "..."
+	}
+	return fmt.Sprintf("HTTP %d: %s", status, text)
+}
+
+// annotateWithIntrospection marks whether each operation's top-level fields exist in the real schema
+func annotateWithIntrospection(operations []*GraphQLOperation, results []*IntrospectionResult) {
+	schemas := make(map[string]*IntrospectionSchema)
+	var only *IntrospectionSchema
+	for _, result := range results {
+		if result.Enabled {
+			schemas[result.Endpoint] = result.Schema
+			only = result.Schema
+		}
+	}
+	if len(schemas) == 0 {
+		return
+	}
+
+	for _, op := range operations {
+		schema := schemas[op.Endpoint]
+		if schema == nil && op.Endpoint == "" && len(schemas) == 1 {
+			schema = only
+		}
+		if schema == nil {
+			continue
+		}
+
+		rootFields := schema.rootFields(op.Type)
+		unknown := []string{}
+		for _, field := range op.Fields {
+			if !rootFields[field] && !strings.HasPrefix(field, "__") {
+				unknown = append(unknown, field)
+			}
+		}
+
+		inSchema := len(unknown) == 0
+		op.InSchema = &inSchema
+		op.UnknownFields = unknown
+	}
+}
+
+// introspectedTypes returns the named types of every schema the probes returned. Types
+// several endpoints define are taken from the first.
+func introspectedTypes(results []*IntrospectionResult) map[string]IntrospectionType {
+	var types map[string]IntrospectionType
+	for _, result := range results {
+		if !result.Enabled || result.Schema == nil {
+			continue
+		}
+		if types == nil {
+			types = make(map[string]IntrospectionType)
+		}
+		for _, t := range result.Schema.Types {
+			if _, ok := types[t.Name]; !ok {
+				types[t.Name] = t
+			}
+		}
+	}
+	return types
+}
+
+// rootFields returns the field names of the root type for an operation type
+func (s *IntrospectionSchema) rootFields(opType OperationType) map[string]bool {
+	var root *IntrospectionNamedType
+	switch opType {
+	case Query:
+		root = s.QueryType
+	case Mutation:
+		root = s.MutationType
+	case Subscription:
+		root = s.SubscriptionType
+	}
+
+	fields := make(map[string]bool)
+	if root == nil {
+		return fields
+	}
+	for _, t := range s.Types {
+		if t.Name == root.Name {
+			for _, field := range t.Fields {
+				fields[field.Name] = true
+			}
+		}
+	}
+	return fields
+}
+
+// IntrospectionToSDL renders an introspected schema as GraphQL SDL
+func IntrospectionToSDL(schema *IntrospectionSchema) string {
+	var sdl strings.Builder
+
+	builtins := map[string]bool{"String": true, "Int": true, "Float": true, "Boolean": true, "ID": true}
+
+	types := make([]IntrospectionType, 0, len(schema.Types))
+	for _, t := range schema.Types {
+		if strings.HasPrefix(t.Name, "__") || builtins[t.Name] {
+			continue
+		}
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Name < types[j].Name
+	})
+
+	// Only emit a schema block when root types use non-default names
+	roots := []struct {
+		keyword string
+		ref     *IntrospectionNamedType
+		def     string
+	}{
+		{"query", schema.QueryType, "Query"},
+		{"mutation", schema.MutationType, "Mutation"},
+		{"subscription", schema.SubscriptionType, "Subscription"},
+	}
+	custom := false
+	for _, root := range roots {
+		if root.ref != nil && root.ref.Name != root.def {
+			custom = true
+		}
+	}
+	if custom {
+		sdl.WriteString("schema {\n")
+		for _, root := range roots {
+			if root.ref != nil {
+				sdl.WriteString("  " + root.keyword + ": " + root.ref.Name + "\n")
+			}
+		}
+		sdl.WriteString("}\n\n")
+	}
+
+	for _, t := range types {
+		switch t.Kind {
+		case "SCALAR":
+			sdl.WriteString("scalar " + t.Name + "\n\n")
+		case "OBJECT", "INTERFACE":
+			keyword := "type"
+			if t.Kind == "INTERFACE" {
+				keyword = "interface"
+			}
+			sdl.WriteString(keyword + " " + t.Name)
+			if len(t.Interfaces) > 0 {
+				names := make([]string, 0, len(t.Interfaces))
+				for _, iface := range t.Interfaces {
+					names = append(names, iface.Name)
+				}
+				sdl.WriteString(" implements " + strings.Join(names, " & "))
+			}
+			sdl.WriteString(" {\n")
+			for _, field := range t.Fields {
+				sdl.WriteString("  " + field.Name + formatIntrospectionArgs(field.Args) + ": " + field.Type.String() + "\n")
+			}
+			sdl.WriteString("}\n\n")
+		case "UNION":
+			names := make([]string, 0, len(t.PossibleTypes))
+			for _, member := range t.PossibleTypes {
+				names = append(names, member.Name)
+			}
+			sdl.WriteString("union " + t.Name + " = " + strings.Join(names, " | ") + "\n\n")
+		case "ENUM":
+			sdl.WriteString("enum " + t.Name + " {\n")
+			for _, value := range t.EnumValues {
+				sdl.WriteString("  " + value.Name + "\n")
+			}
+			sdl.WriteString("}\n\n")
+		case "INPUT_OBJECT":
+			sdl.WriteString("input " + t.Name + " {\n")
+			for _, field := range t.InputFields {
+				sdl.WriteString("  " + formatIntrospectionInputValue(field) + "\n")
+			}
+			sdl.WriteString("}\n\n")
+		}
+	}
+
+	return sdl.String()
+}
+
+// formatIntrospectionArgs formats a field's argument list
+func formatIntrospectionArgs(args []IntrospectionInputValue) string {
+	if len(args) == 0 {
+		return ""
+	}
+	formatted := make([]string, 0, len(args))
+	for _, arg := range args {
+		formatted = append(formatted, formatIntrospectionInputValue(arg))
+	}
+	return "(" + strings.Join(formatted, ", ") + ")"
+}
+
+// formatIntrospectionInputValue formats an argument or input field with its default
+func formatIntrospectionInputValue(value IntrospectionInputValue) string {
+	formatted := value.Name + ": " + value.Type.String()
+	if value.DefaultValue != nil {
+		formatted += " = " + *value.DefaultValue
+	}
+	return formatted
+}
+
+// String renders the type reference in GraphQL notation, e.g. [ID!]!
+func (t IntrospectionTypeRef) String() string {
+	switch t.Kind {
+	case "NON_NULL":
+		if t.OfType != nil {
+			return t.OfType.String() + "!"
+		}
+	case "LIST":
+		if t.OfType != nil {
+			return "[" + t.OfType.String() + "]"
+		}
+	}
+	return t.Name
+}
+
+// saveIntrospectionResults writes the raw introspection JSON and generated SDL per endpoint
+// to outputDir
+func saveIntrospectionResults(results []*IntrospectionResult, outputDir, baseName string) error {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	enabled := 0
+	for _, result := range results {
+		if result.Enabled {
+			enabled++
+		}
+	}
+
+	// Record the outcome for every endpoint, including refusals
+	summary := make([]map[string]interface{}, 0, len(results))
+	for _, result := range results {
+		entry := map[string]interface{}{
+			"endpoint": result.Endpoint,
+			"enabled":  result.Enabled,
+			"disabled": result.Disabled,
+		}
+		if result.Error != "" {
+			entry["error"] = result.Error
+		}
+		summary = append(summary, entry)
+	}
+	summaryJSON, _ := json.MarshalIndent(summary, "", "  ")
+	summaryFile := filepath.Join(outputDir, baseName+"_introspection_summary.json")
+	if err := os.WriteFile(summaryFile, summaryJSON, 0644); err != nil {
+		return fmt.Errorf("failed to save introspection summary: %v", err)
+	}
+	slog.Info("Saved introspection summary", "file", summaryFile)
+
+	for _, result := range results {
+		if !result.Enabled {
+			continue
+		}
+
+		name := baseName + "_introspection"
+		if enabled > 1 {
+			name += "_" + sanitizeDomain(result.Endpoint)
+		}
+
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, result.Raw, "", "  "); err != nil {
+			pretty.Reset()
+			pretty.Write(result.Raw)
+		}
+		jsonFile := filepath.Join(outputDir, name+".json")
+		if err := os.WriteFile(jsonFile, pretty.Bytes(), 0644); err != nil {
+			return fmt.Errorf("failed to save introspection JSON: %v", err)
+		}
+		slog.Info("Saved introspection result", "file", jsonFile)
+
+		sdlFile := filepath.Join(outputDir, name+"_schema.graphql")
+		if err := os.WriteFile(sdlFile, []byte(IntrospectionToSDL(result.Schema)), 0644); err != nil {
+			return fmt.Errorf("failed to save introspection schema: %v", err)
+		}
+		slog.Info("Saved introspection schema", "file", sdlFile)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxArchiveNameLength bounds the URL part of an archived file name; longer URLs are
+// truncated and keep a hash of the full URL so they stay distinct
+const maxArchiveNameLength = 120
+
+// unsafeFileNameChars matches everything replaced when a URL becomes a file name
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// JSArchive saves every downloaded bundle under <output-dir>/<base>/js for --save-js, with a
+// manifest mapping the files back to the URLs they were downloaded from. Earlier runs
+// into the same directory keep their entries.
+type JSArchive struct {
+	Dir     string
+	mu      sync.Mutex
+	entries []ArchivedJS
+	files   map[string]bool // File names already written
+	listed  map[string]bool // File name and URL pairs already in the manifest
+}
+
+// ArchivedJS is one manifest entry
+type ArchivedJS struct {
+	URL        string    `json:"url"`
+	File       string    `json:"file"`
+	SHA256     string    `json:"sha256"`
+	Size       int       `json:"size"`
+	Downloaded time.Time `json:"downloaded"`
+}
+
+// newJSArchive creates the archive directory for a target under outputDir, loading the
+// manifest an earlier run left there
+func newJSArchive(outputDir, baseName string) (*JSArchive, error) {
+	dir := filepath.Join(outputDir, baseName, "js")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create JS archive directory: %v", err)
+	}
+	archive := &JSArchive{Dir: dir, files: make(map[string]bool), listed: make(map[string]bool)}
+
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if os.IsNotExist(err) {
+		return archive, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JS manifest: %v", err)
+	}
+	if err := json.Unmarshal(data, &archive.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse JS manifest %s: %v", filepath.Join(dir, "manifest.json"), err)
+	}
+	for _, entry := range archive.entries {
+		archive.listed[entry.File+" "+entry.URL] = true
+		if _, err := os.Stat(filepath.Join(dir, entry.File)); err == nil {
+			archive.files[entry.File] = true
+		}
+	}
+	return archive, nil
+}
+
+// Save writes a bundle and rewrites the manifest, so an interrupted run still leaves
+// a usable corpus. Content already saved under the same name is not written again,
+// but a different URL it came from is still added to the manifest.
+func (a *JSArchive) Save(jsURL, content string) error {
+	sum := sha256.Sum256([]byte(content))
+	hash := hex.EncodeToString(sum[:])
+	name := archiveFileName(jsURL, hash)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.listed[name+" "+jsURL] {
+		return nil
+	}
+	if !a.files[name] {
+		if err := os.WriteFile(filepath.Join(a.Dir, name), []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to save JS file: %v", err)
+		}
+		a.files[name] = true
+	}
+	a.listed[name+" "+jsURL] = true
+	a.entries = append(a.entries, ArchivedJS{URL: jsURL, File: name, SHA256: hash, Size: len(content), Downloaded: time.Now()})
+
+	data, err := json.MarshalIndent(a.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JS manifest: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(a.Dir, "manifest.json"), data, 0644); err != nil {
+		return fmt.Errorf("failed to write JS manifest: %v", err)
+	}
+	return nil
+}
+
+// archiveFileName turns a URL into <sanitized-url>__<hash>.js. The content hash keeps
+// redeployed bundles served under one URL apart.
+func archiveFileName(jsURL, contentHash string) string {
+	name := jsURL
+	if i := strings.Index(name, "://"); i >= 0 {
+		name = name[i+3:]
+	}
+	name = strings.Trim(unsafeFileNameChars.ReplaceAllString(name, "_"), "._")
+	name = strings.TrimSuffix(name, ".js")
+	if len(name) > maxArchiveNameLength {
+		urlSum := sha256.Sum256([]byte(jsURL))
+		name = name[:maxArchiveNameLength] + "_" + hex.EncodeToString(urlSum[:4])
+	}
+	return name + "__" + contentHash[:12] + ".js"
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJSArchiveKeepsEarlierRuns(t *testing.T) {
+	outputDir := t.TempDir()
+	archive, err := newJSArchive(outputDir, "example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Save("https://example.com/app.js", "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A later run saves a new bundle and the same one under another URL
+	archive, err = newJSArchive(outputDir, "example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, save := range []struct{ url, content string }{
+		{"https://example.com/app.js", "first"},
+		{"https://example.com/vendor.js", "second"},
+		{"https://cdn.example.com/app.js", "first"},
+	} {
+		if err := archive.Save(save.url, save.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(archive.Dir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []ArchivedJS
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for _, entry := range entries {
+		urls = append(urls, entry.URL)
+	}
+	want := []string{"https://example.com/app.js", "https://example.com/vendor.js", "https://cdn.example.com/app.js"}
+	if !reflect.DeepEqual(urls, want) {
+		t.Errorf("manifest URLs = %v, want %v", urls, want)
+	}
+
+	if err := os.WriteFile(filepath.Join(archive.Dir, "manifest.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newJSArchive(outputDir, "example"); err == nil {
+		t.Error("corrupt manifest returned no error")
+	}
+}
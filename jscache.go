@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// JSCache keeps downloaded JavaScript on disk between runs. Each body is stored under
+// a hash of its URL with the ETag and Last-Modified it was served with, so the next
+// run can revalidate it with a conditional request instead of downloading it again.
+type JSCache struct {
+	Dir    string
+	MaxAge time.Duration // Entries stored longer ago are downloaded again; 0 keeps them forever
+}
+
+// jsCacheEntry is the metadata stored next to a cached body
+type jsCacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Stored       time.Time `json:"stored"`
+}
+
+// newJSCache creates the cache directory if needed
+func newJSCache(dir string, maxAge time.Duration) (*JSCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	return &JSCache{Dir: dir, MaxAge: maxAge}, nil
+}
+
+// paths returns the body and metadata file names for a URL
+func (c *JSCache) paths(jsURL string) (string, string) {
+	sum := sha256.Sum256([]byte(jsURL))
+	name := filepath.Join(c.Dir, hex.EncodeToString(sum[:]))
+	return name + ".js", name + ".json"
+}
+
+// Lookup returns the cached entry and body for a URL, or nil when there is none or it
+// is older than MaxAge
+func (c *JSCache) Lookup(jsURL string) (*jsCacheEntry, []byte) {
+	bodyPath, metaPath := c.paths(jsURL)
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, nil
+	}
+	var entry jsCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != jsURL {
+		return nil, nil
+	}
+	if c.MaxAge > 0 && time.Since(entry.Stored) > c.MaxAge {
+		return nil, nil
+	}
+	body, err := os.ReadFile(bodyPath)
+	if err != nil {
+		return nil, nil
+	}
+	return &entry, body
+}
+
+// Store writes a downloaded body and its validators. Responses without an ETag or
+// Last-Modified cannot be revalidated and are not cached.
+func (c *JSCache) Store(jsURL string, body []byte, etag, lastModified string) error {
+	if etag == "" && lastModified == "" {
+		return nil
+	}
+	bodyPath, metaPath := c.paths(jsURL)
+	if err := writeFileAtomic(bodyPath, body); err != nil {
+		return fmt.Errorf("failed to write cached JS: %v", err)
+	}
+	return c.writeEntry(metaPath, &jsCacheEntry{URL: jsURL, ETag: etag, LastModified: lastModified, Stored: time.Now()})
+}
+
+// Refresh restarts the max age of an entry the server confirmed is unchanged
+func (c *JSCache) Refresh(jsURL string, entry *jsCacheEntry) error {
+	_, metaPath := c.paths(jsURL)
+	refreshed := *entry
+	refreshed.Stored = time.Now()
+	return c.writeEntry(metaPath, &refreshed)
+}
+
+// writeEntry saves an entry's metadata
+func (c *JSCache) writeEntry(metaPath string, entry *jsCacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %v", err)
+	}
+	if err := writeFileAtomic(metaPath, data); err != nil {
+		return fmt.Errorf("failed to write cache entry: %v", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes through a temporary file so an interrupted run never leaves a
+// truncated cache file behind
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
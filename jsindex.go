@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JSContentIndex remembers which JavaScript content was already processed, so the same
+// bundle served under several URLs (CDN hosts, locale variants) is only scanned once.
+// Responses are matched before downloading by their ETag and Content-Length, and after
+// downloading by a sha256 of the body.
+type JSContentIndex struct {
+	mu         sync.Mutex
+	validators map[string]string // JS URL -> ETag and length seen on its response
+	processed  map[string]string // ETag and length -> first URL processed with it
+	hashes     map[string]string // Body sha256 -> first URL processed with it
+}
+
+// newJSContentIndex creates an empty index
+func newJSContentIndex() *JSContentIndex {
+	return &JSContentIndex{
+		validators: make(map[string]string),
+		processed:  make(map[string]string),
+		hashes:     make(map[string]string),
+	}
+}
+
+// NextTarget forgets the content processed so far, keeping the validators the browser
+// saw. Each target of a --domains-file run processes its bundles again, so its own
+// outputs hold their operations even when an earlier target shared them.
+func (x *JSContentIndex) NextTarget() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.processed = make(map[string]string)
+	x.hashes = make(map[string]string)
+}
+
+// Observe records the validators of a JS response seen by the browser or proxy.
+// Responses without a strong ETag are not matched before downloading.
+func (x *JSContentIndex) Observe(jsURL string, headers map[string]string) {
+	var etag, length string
+	for name, value := range headers {
+		switch strings.ToLower(name) {
+		case "etag":
+			etag = value
+		case "content-length":
+			length = value
+		}
+	}
+	if etag == "" || strings.HasPrefix(etag, "W/") || length == "" {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.validators[jsURL] = etag + "|" + length
+}
+
+// Validator returns the ETag and length the browser saw on jsURL's response, or ""
+// when it had no strong ETag
+func (x *JSContentIndex) Validator(jsURL string) string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.validators[jsURL]
+}
+
+// Duplicate reports the URL already processed with the same ETag and length as jsURL,
+// and that length, so the download can be skipped
+func (x *JSContentIndex) Duplicate(jsURL string) (string, int64, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	validator, ok := x.validators[jsURL]
+	if !ok {
+		return "", 0, false
+	}
+	first, ok := x.processed[validator]
+	if !ok || first == jsURL {
+		return "", 0, false
+	}
+	length, _ := strconv.ParseInt(validator[strings.LastIndex(validator, "|")+1:], 10, 64)
+	return first, length, true
+}
+
+// MarkProcessed records downloaded content, returning the URL it was already
+// processed under when an identical body was seen before
+func (x *JSContentIndex) MarkProcessed(jsURL, content string) (string, bool) {
+	sum := sha256.Sum256([]byte(content))
+	hash := hex.EncodeToString(sum[:])
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if validator, ok := x.validators[jsURL]; ok {
+		if _, exists := x.processed[validator]; !exists {
+			x.processed[validator] = jsURL
+		}
+	}
+	if first, ok := x.hashes[hash]; ok {
+		return first, true
+	}
+	x.hashes[hash] = jsURL
+	return "", false
+}
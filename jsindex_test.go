@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestJSContentIndexPerTarget(t *testing.T) {
+	x := newJSContentIndex()
+	headers := map[string]string{"ETag": `"abc"`, "Content-Length": "42"}
+	x.Observe("https://a.example/app.js", headers)
+	x.Observe("https://cdn.example/app.js", headers)
+
+	if _, duplicate := x.MarkProcessed("https://a.example/app.js", "bundle"); duplicate {
+		t.Fatal("first body reported as duplicate")
+	}
+	if first, length, duplicate := x.Duplicate("https://cdn.example/app.js"); !duplicate || first != "https://a.example/app.js" || length != 42 {
+		t.Errorf("Duplicate = %q, %d, %v; want the first URL with its length", first, length, duplicate)
+	}
+	if first, duplicate := x.MarkProcessed("https://cdn.example/app.js", "bundle"); !duplicate || first != "https://a.example/app.js" {
+		t.Errorf("MarkProcessed = %q, %v; want duplicate of the first URL", first, duplicate)
+	}
+
+	// The next target processes the same bundle again for its own outputs
+	x.NextTarget()
+	if _, _, duplicate := x.Duplicate("https://cdn.example/app.js"); duplicate {
+		t.Error("bundle from an earlier target skipped by ETag")
+	}
+	if _, duplicate := x.MarkProcessed("https://cdn.example/app.js", "bundle"); duplicate {
+		t.Error("bundle from an earlier target skipped by content")
+	}
+	if x.Validator("https://a.example/app.js") == "" {
+		t.Error("validators observed by the browser were forgotten")
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+// mergedBaseName names the output files of the merge subcommand
+const mergedBaseName = "graphql_operations_merged"
+
+// mergeExport is the part of a JSON export the merge subcommand reads back. Captures
+// are exported with the same keys GraphQLCapture uses, without their responses.
+type mergeExport struct {
+	Operations    []mergeOperation       `json:"operations"`
+	Captures      []GraphQLCapture       `json:"captures"`
+	InferredTypes map[string]interface{} `json:"inferredTypes"`
+}
+
+// mergeOperation is an exported operation
+type mergeOperation struct {
+	Type                OperationType            `json:"type"`
+	Name                string                   `json:"name"`
+	Variables           map[string]string        `json:"variables"`
+	Fields              []string                 `json:"fields"`
+	Query               string                   `json:"query"`
+	Source              string                   `json:"source"`
+	Line                int                      `json:"line"`
+	Offset              int                      `json:"offset"`
+	Sources             []string                 `json:"sources"`
+	Fragments           []string                 `json:"fragments"`
+	UnresolvedFragments []string                 `json:"unresolvedFragments"`
+	ExampleVariables    []map[string]interface{} `json:"exampleVariables"`
+	Inputs              []string                 `json:"inputs"`
+	VariableTypes       map[string]struct {
+		Default *string `json:"default"`
+	} `json:"variableTypes"`
+}
+
+// operation rebuilds the operation from its query, falling back to the exported type,
+// name, variables and fields when the query does not parse. It records input as where
+// the operation came from unless the export was itself a merge.
+func (m *mergeOperation) operation(input string) *GraphQLOperation {
+	op, err := ParseGraphQLOperation(m.Query)
+	if strings.TrimSpace(m.Query) == "" || err != nil {
+		op = &GraphQLOperation{Variables: m.Variables, Fields: m.Fields}
+	}
+	op.Type = m.Type
+	op.Name = m.Name
+	op.Raw = m.Query
+	op.Source = m.Source
+	op.Line = m.Line
+	op.Offset = m.Offset
+	op.Sources = m.Sources
+	op.Fragments = m.Fragments
+	op.UnresolvedFragments = m.UnresolvedFragments
+	op.ExampleVariables = m.ExampleVariables
+	for name, typ := range m.VariableTypes {
+		if typ.Default != nil {
+			if op.VariableDefaults == nil {
+				op.VariableDefaults = make(map[string]string)
+			}
+			op.VariableDefaults[name] = *typ.Default
+		}
+	}
+	op.Inputs = m.Inputs
+	if len(op.Inputs) == 0 {
+		op.Inputs = []string{input}
+	}
+	return op
+}
+
+// loadMergeExport reads a JSON export for the merge subcommand
+func loadMergeExport(path string) (*mergeExport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export: %v", err)
+	}
+	var export mergeExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("failed to parse export %s: %v", path, err)
+	}
+	return &export, nil
+}
+
+// mergeExports combines the operations, captures and inferred types of several
+// exports. Operations are deduplicated across them, keeping the inputs each was found
+// in; operations sharing a name but not a body stay separate and are flagged.
+func mergeExports(paths []string) ([]*GraphQLOperation, []GraphQLCapture, map[string]interface{}, error) {
+	var operations []*GraphQLOperation
+	var captures []GraphQLCapture
+	types := make(map[string]interface{})
+	for _, path := range paths {
+		export, err := loadMergeExport(path)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for i := range export.Operations {
+			operations = append(operations, export.Operations[i].operation(path))
+		}
+		captures = append(captures, export.Captures...)
+		for key, value := range export.InferredTypes {
+			types[key] = mergeInferredType(types[key], value)
+		}
+		slog.Info("Loaded export", "file", path, "operations", len(export.Operations), "captures", len(export.Captures))
+	}
+
+	unique := DeduplicateOperations(operations)
+	for _, name := range flagNameConflicts(unique) {
+		slog.Warn("Operations share a name but differ, keeping each", "name", name)
+	}
+	return unique, captures, types, nil
+}
+
+// flagNameConflicts marks the named operations whose type and name another operation
+// with a different body also has, returning the conflicting names sorted
+func flagNameConflicts(operations []*GraphQLOperation) []string {
+	byName := make(map[string][]*GraphQLOperation)
+	for _, op := range operations {
+		if op.Name != "" {
+			key := string(op.Type) + " " + op.Name
+			byName[key] = append(byName[key], op)
+		}
+	}
+	var conflicts []string
+	for key, group := range byName {
+		if len(group) < 2 {
+			continue
+		}
+		for _, op := range group {
+			op.NameConflict = true
+		}
+		conflicts = append(conflicts, key)
+	}
+	sort.Strings(conflicts)
+	return conflicts
+}
+
+// mergeInferredType combines two models written under inferredTypes: kinds are joined,
+// samples added up, enum candidates and fields merged. Either side may be nil.
+func mergeInferredType(a, b interface{}) interface{} {
+	am, aIsModel := a.(map[string]interface{})
+	bm, bIsModel := b.(map[string]interface{})
+	if !aIsModel || !bIsModel {
+		// Field suggestions and empty lists are exported as "Unknown"
+		if a == nil || (a == "Unknown" && b != nil) {
+			return b
+		}
+		return a
+	}
+
+	merged := make(map[string]interface{}, len(am))
+	for key, value := range am {
+		merged[key] = value
+	}
+	merged["type"] = joinTypeNames(fmt.Sprint(am["type"]), fmt.Sprint(bm["type"]))
+	aNullable, _ := am["nullable"].(bool)
+	bNullable, _ := bm["nullable"].(bool)
+	merged["nullable"] = aNullable || bNullable
+	aSamples, _ := am["samples"].(float64)
+	bSamples, _ := bm["samples"].(float64)
+	merged["samples"] = aSamples + bSamples
+
+	if candidates, ok := bm["enumCandidates"].([]interface{}); ok {
+		existing, _ := am["enumCandidates"].([]interface{})
+		values := make([]string, 0, len(existing)+len(candidates))
+		for _, value := range append(existing, candidates...) {
+			values = appendUnique(values, fmt.Sprint(value))
+		}
+		sort.Strings(values)
+		merged["enumCandidates"] = values
+	}
+	if fields, ok := bm["fields"].(map[string]interface{}); ok {
+		combined := make(map[string]interface{})
+		if existing, ok := am["fields"].(map[string]interface{}); ok {
+			for name, field := range existing {
+				combined[name] = field
+			}
+		}
+		for name, field := range fields {
+			combined[name] = mergeInferredType(combined[name], field)
+		}
+		merged["fields"] = combined
+	}
+	if of, ok := bm["of"]; ok {
+		merged["of"] = mergeInferredType(am["of"], of)
+	}
+	return merged
+}
+
+// joinTypeNames joins two inferred type names the way typeModel.typeName names mixed
+// kinds: Int folds into Float, ID and DateTime into String, and Null into anything
+func joinTypeNames(a, b string) string {
+	kinds := make(map[string]bool)
+	for _, kind := range strings.Split(a+"|"+b, "|") {
+		if kind != "" && kind != "<nil>" {
+			kinds[kind] = true
+		}
+	}
+	if len(kinds) > 1 {
+		delete(kinds, "Null")
+	}
+	if kinds["Float"] {
+		delete(kinds, "Int")
+	}
+	if kinds["String"] {
+		delete(kinds, "ID")
+		delete(kinds, "DateTime")
+	}
+	names := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		names = append(names, kind)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
+}
+
+// runMerge implements the merge subcommand and returns the process exit code
+func runMerge(args []string) int {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	var outputDir string
+	fs.StringVar(&outputDir, "o", "output/merged", "Directory to write the merged output files to")
+	fs.StringVar(&outputDir, "output", "output/merged", "Same as -o")
+	format := fs.String("format", "", "Comma-separated additional output formats, as for a capture run: csv, markdown, sqlite")
+	sortOutput := fs.Bool("sort", true, "Order operations by type, name and body hash")
+	noTimestamp := fs.Bool("no-timestamp", false, "Leave the generated-at lines out of the output files")
+	groupByRoot := fs.Bool("group-by-root", false, "In the SDL file, list operations under their first root field instead of by type")
+	logFormat := fs.String("log-format", LogFormatText, "Log output format: text or json")
+	logLevel := fs.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gql-extractor merge [options] <export.json> <export.json>...\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 1
+	}
+	if err := setupLogging(os.Stderr, *logFormat, *logLevel); err != nil {
+		slog.Error("Invalid logging flags", "error", err)
+		return 1
+	}
+
+	omitTimestamps = *noTimestamp
+
+	operations, captures, types, err := mergeExports(fs.Args())
+	if err != nil {
+		slog.Error("Error merging exports", "error", err)
+		return 1
+	}
+
+	opts := SaveOptions{
+		Formats:       make(map[string]bool),
+		GroupByRoot:   *groupByRoot,
+		Sort:          *sortOutput,
+		OutputDir:     outputDir,
+		InferredTypes: types,
+	}
+	for _, f := range parseList(*format) {
+		opts.Formats[strings.ToLower(f)] = true
+	}
+	if err := saveOperations(operations, captures, mergedBaseName, opts); err != nil {
+		slog.Error("Error saving files", "error", err)
+		return 1
+	}
+	slog.Info("Merged exports", "inputs", fs.NArg(), "operations", len(operations), "captures", len(captures), "dir", outputDir)
+	return 0
+}
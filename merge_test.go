@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "Rewrite the golden files under testdata")
+
+// TestMergeGolden merges two exports and compares every file written against
+// testdata/merge/golden. Run with -update to accept new output.
+func TestMergeGolden(t *testing.T) {
+	logger := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(logger)
+		omitTimestamps = false
+	})
+
+	outputDir := t.TempDir()
+	code := runMerge([]string{"-no-timestamp", "-log-level", "error", "-format", "csv,markdown", "-o", outputDir,
+		"testdata/merge/run1.json", "testdata/merge/run2.json"})
+	if code != 0 {
+		t.Fatalf("runMerge = %d, want 0", code)
+	}
+
+	goldenDir := filepath.Join("testdata", "merge", "golden")
+	written, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *updateGolden {
+		if err := os.RemoveAll(goldenDir); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(goldenDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, entry := range written {
+		names[entry.Name()] = true
+		got, err := os.ReadFile(filepath.Join(outputDir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden := filepath.Join(goldenDir, entry.Name())
+		if *updateGolden {
+			if err := os.WriteFile(golden, got, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Errorf("unexpected output file %s: %v", entry.Name(), err)
+			continue
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s differs from %s:\n%s", entry.Name(), golden, got)
+		}
+	}
+
+	expected, err := os.ReadDir(goldenDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range expected {
+		if !names[entry.Name()] {
+			t.Errorf("merge did not write %s", entry.Name())
+		}
+	}
+}
+
+func TestMergeExportRoundTrip(t *testing.T) {
+	// A merged export read back on its own keeps its operations and where each came from
+	operations, captures, _, err := mergeExports([]string{filepath.Join("testdata", "merge", "golden", mergedBaseName+".json")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(operations) != 4 || len(captures) != 2 {
+		t.Fatalf("read %d operations and %d captures, want 4 and 2", len(operations), len(captures))
+	}
+	first := operations[0]
+	if first.Name != "GetUser" || len(first.Inputs) != 2 || len(first.Sources) != 2 {
+		t.Errorf("GetUser = (inputs %v, sources %v), want both runs kept", first.Inputs, first.Sources)
+	}
+	conflicts := 0
+	for _, op := range operations {
+		if op.NameConflict {
+			conflicts++
+		}
+	}
+	if conflicts != 2 {
+		t.Errorf("%d operations flagged as name conflicts, want the two Logout mutations", conflicts)
+	}
+}
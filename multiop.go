@@ -0,0 +1,108 @@
+package main
+
+import (
+	gqlast "github.com/vektah/gqlparser/v2/ast"
+)
+
+// splitOperations returns one document per operation in a multi-operation document,
+// each carrying the fragment definitions it spreads, directly or through other
+// fragments. Documents holding a single operation, or that do not parse, are returned
+// unchanged.
+func splitOperations(document string) []string {
+	doc, err := parseGraphQLDocument(document)
+	if err != nil || len(doc.Operations) < 2 {
+		return []string{document}
+	}
+
+	split := make([]string, 0, len(doc.Operations))
+	for _, op := range doc.Operations {
+		split = append(split, printDocument(&gqlast.QueryDocument{
+			Operations: gqlast.OperationList{op},
+			Fragments:  usedFragments(op.SelectionSet, doc.Fragments),
+		}))
+	}
+	return split
+}
+
+// usedFragments returns the fragments of the document that selections spread, directly
+// or through other fragments, in the order the document defines them
+func usedFragments(selections gqlast.SelectionSet, fragments gqlast.FragmentDefinitionList) gqlast.FragmentDefinitionList {
+	used := make(map[string]bool)
+	var visit func(gqlast.SelectionSet)
+	visit = func(selections gqlast.SelectionSet) {
+		for _, selection := range selections {
+			switch s := selection.(type) {
+			case *gqlast.Field:
+				visit(s.SelectionSet)
+			case *gqlast.InlineFragment:
+				visit(s.SelectionSet)
+			case *gqlast.FragmentSpread:
+				if used[s.Name] {
+					continue
+				}
+				used[s.Name] = true
+				if fragment := fragments.ForName(s.Name); fragment != nil {
+					visit(fragment.SelectionSet)
+				}
+			}
+		}
+	}
+	visit(selections)
+
+	var kept gqlast.FragmentDefinitionList
+	for _, fragment := range fragments {
+		if used[fragment.Name] {
+			kept = append(kept, fragment)
+		}
+	}
+	return kept
+}
+
+// selectOperation returns the operation operationName picks out of a multi-operation
+// document, with the document's fragments, or "" when the document holds a single
+// operation or none by that name
+func selectOperation(document, operationName string) string {
+	if operationName == "" {
+		return ""
+	}
+	split := splitOperations(document)
+	if len(split) < 2 {
+		return ""
+	}
+	for _, text := range split {
+		if op, err := ParseGraphQLOperation(text); err == nil && op.Name == operationName {
+			return text
+		}
+	}
+	return ""
+}
+
+// ParseGraphQLOperations parses every operation of a document. A single-operation
+// document yields the same result as ParseGraphQLOperation.
+func ParseGraphQLOperations(document string) ([]*GraphQLOperation, error) {
+	var operations []*GraphQLOperation
+	var firstErr error
+	for _, text := range splitOperations(document) {
+		op, err := ParseGraphQLOperation(text)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		operations = append(operations, op)
+	}
+	if len(operations) == 0 {
+		return nil, firstErr
+	}
+	return operations, nil
+}
+
+// captureDocument returns the operation a capture actually ran: the one its
+// operationName selected from a multi-operation document, or the whole query
+func captureDocument(capture GraphQLCapture) string {
+	if capture.SelectedOperation != "" {
+		return capture.SelectedOperation
+	}
+	return capture.Query
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mafredri/cdp/protocol/network"
+)
+
+// longLivedRequest is how long a request may stay open before it is taken for a stream
+// or long poll that never finishes, and stops keeping the page from settling
+const longLivedRequest = 10 * time.Second
+
+// networkTracker follows the browser's requests from the CDP events, to tell when the
+// page has settled
+type networkTracker struct {
+	mu       sync.Mutex
+	inFlight map[network.RequestID]time.Time // Requests without a response body or failure yet, by start
+	last     time.Time                       // Last request started, finished or failed
+}
+
+// newNetworkTracker creates a tracker with no request in flight
+func newNetworkTracker() *networkTracker {
+	return &networkTracker{inFlight: make(map[network.RequestID]time.Time), last: time.Now()}
+}
+
+// Started records a request the browser sent. Redirects reuse the request's ID and
+// keep its start.
+func (t *networkTracker) Started(id network.RequestID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.inFlight[id]; !ok {
+		t.inFlight[id] = time.Now()
+	}
+	t.last = time.Now()
+}
+
+// Finished records a request that completed or failed
+func (t *networkTracker) Finished(id network.RequestID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.inFlight, id)
+	t.last = time.Now()
+}
+
+// Settled reports whether no request started or finished for quiet and none is in
+// flight besides long-lived ones
+func (t *networkTracker) Settled(quiet time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if now.Sub(t.last) < quiet {
+		return false
+	}
+	for _, started := range t.inFlight {
+		if now.Sub(started) < longLivedRequest {
+			return false
+		}
+	}
+	return true
+}
+
+// WaitSettled waits until the network has been settled for quiet, returning false when
+// ctx is done first
+func (t *networkTracker) WaitSettled(ctx context.Context, quiet time.Duration) bool {
+	t.mu.Lock()
+	t.last = time.Now() // Give the page quiet to start its first requests
+	t.mu.Unlock()
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for !t.Settled(quiet) {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
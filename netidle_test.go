@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mafredri/cdp/protocol/network"
+)
+
+func TestNetworkTrackerSettled(t *testing.T) {
+	const quiet = time.Minute
+	past := time.Now().Add(-2 * quiet)
+
+	tests := []struct {
+		name    string
+		setup   func(*networkTracker)
+		settled bool
+	}{
+		{"nothing in flight", func(*networkTracker) {}, true},
+		{"request in flight", func(tr *networkTracker) {
+			tr.Started("1")
+			tr.last = past
+		}, false},
+		{"request finished", func(tr *networkTracker) {
+			tr.Started("1")
+			tr.Finished("1")
+			tr.last = past
+		}, true},
+		{"request finished recently", func(tr *networkTracker) {
+			tr.Started("1")
+			tr.Finished("1")
+		}, false},
+		{"redirect keeps its start", func(tr *networkTracker) {
+			tr.Started("1")
+			tr.inFlight["1"] = time.Now().Add(-longLivedRequest)
+			tr.Started("1")
+			tr.last = past
+		}, true},
+		{"long-lived request", func(tr *networkTracker) {
+			tr.Started("stream")
+			tr.Started("2")
+			tr.Finished("2")
+			tr.inFlight["stream"] = time.Now().Add(-longLivedRequest)
+			tr.last = past
+		}, true},
+		{"long-lived beside a new request", func(tr *networkTracker) {
+			tr.Started("stream")
+			tr.Started("2")
+			tr.inFlight["stream"] = time.Now().Add(-longLivedRequest)
+			tr.last = past
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newNetworkTracker()
+			tracker.last = past
+			tt.setup(tracker)
+			if got := tracker.Settled(quiet); got != tt.settled {
+				t.Errorf("Settled = %v, want %v", got, tt.settled)
+			}
+		})
+	}
+}
+
+func TestNetworkTrackerWaitSettled(t *testing.T) {
+	tracker := newNetworkTracker()
+	tracker.Started(network.RequestID("1"))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		tracker.Finished("1")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !tracker.WaitSettled(ctx, 10*time.Millisecond) {
+		t.Error("WaitSettled gave up after the request finished")
+	}
+
+	tracker.Started("2")
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if tracker.WaitSettled(ctx, 10*time.Millisecond) {
+		t.Error("WaitSettled returned with a request in flight")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	gqlast "github.com/vektah/gqlparser/v2/ast"
+)
+
+// defaultNoisePatterns match the names of introspection and client housekeeping operations
+var defaultNoisePatterns = []string{
+	`^IntrospectionQuery$`,
+	`^__ApolloGetServiceDefinition__$`,
+	`^__\w+__$`,
+}
+
+// NoiseFilter recognizes captures and operations that only add noise, such as schema
+// introspection or { __typename } health checks
+type NoiseFilter struct {
+	names []*regexp.Regexp
+}
+
+// newNoiseFilter builds a filter from the built-in name patterns plus extra ones
+func newNoiseFilter(extra []string) (*NoiseFilter, error) {
+	f := &NoiseFilter{}
+	for _, pattern := range append(append([]string{}, defaultNoisePatterns...), extra...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid noise pattern %q: %v", pattern, err)
+		}
+		f.names = append(f.names, re)
+	}
+	return f, nil
+}
+
+// IsNoise reports whether an operation with this name and query should be ignored.
+// A nil filter ignores nothing.
+func (f *NoiseFilter) IsNoise(name, query string) bool {
+	if f == nil {
+		return false
+	}
+	for _, re := range f.names {
+		if name != "" && re.MatchString(name) {
+			return true
+		}
+	}
+	return selectsOnlyMetaFields(query)
+}
+
+// selectsOnlyMetaFields reports whether every operation in query selects nothing but
+// meta fields such as __typename, __schema or __type at the top level
+func selectsOnlyMetaFields(query string) bool {
+	doc, err := parseGraphQLDocument(query)
+	if err != nil {
+		return false
+	}
+
+	for _, def := range doc.Operations {
+		for _, selection := range def.SelectionSet {
+			field, ok := selection.(*gqlast.Field)
+			if !ok || !strings.HasPrefix(field.Name, "__") {
+				return false
+			}
+		}
+	}
+	return len(doc.Operations) > 0
+}
@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestNoiseFilter(t *testing.T) {
+	const introspection = "query IntrospectionQuery { __schema { queryType { name } } }"
+	tests := []struct {
+		name  string
+		extra []string
+		op    string
+		query string
+		noise bool
+	}{
+		{"introspection dropped", nil, "IntrospectionQuery", introspection, true},
+		{"anonymous introspection dropped", nil, "", "{ __type(name: \"User\") { fields { name } } }", true},
+		{"renamed schema query dropped", nil, "FetchSchema", "query FetchSchema { __schema { types { name } } }", true},
+		{"meta field beside a real one", nil, "", "{ __typename viewer { id } }", false},
+		{"typename health check", nil, "", "{ __typename }", true},
+		{"Apollo service definition", nil, "__ApolloGetServiceDefinition__", "query __ApolloGetServiceDefinition__ { _service { sdl } }", true},
+		{"extra name", []string{`^Heartbeat$`}, "Heartbeat", "query Heartbeat { ping }", true},
+		{"regular query", nil, "GetUser", "query GetUser { user { __typename id } }", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := newNoiseFilter(tt.extra)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.IsNoise(tt.op, tt.query); got != tt.noise {
+				t.Errorf("IsNoise(%q) = %v, want %v", tt.op, got, tt.noise)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// OriginFilter limits which JavaScript files are downloaded to those served from the
+// target's host or an allowed host, skipping third-party analytics and ad SDKs
+type OriginFilter struct {
+	mu     sync.Mutex
+	target string   // Host of the target currently being captured
+	allow  []string // Extra hosts; each also allows its subdomains
+}
+
+// newOriginFilter creates a filter for target plus the allowed hosts
+func newOriginFilter(target string, allow []string) *OriginFilter {
+	f := &OriginFilter{}
+	for _, host := range allow {
+		host = strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(host, "*"), "."))
+		if host != "" {
+			f.allow = append(f.allow, host)
+		}
+	}
+	f.SetTarget(target)
+	return f
+}
+
+// SetTarget switches the same-origin host when a multi-target run moves on
+func (f *OriginFilter) SetTarget(target string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.target = urlHost(target)
+}
+
+// Allows reports whether the JS file at jsURL should be downloaded. A nil filter
+// allows everything.
+func (f *OriginFilter) Allows(jsURL string) bool {
+	if f == nil {
+		return true
+	}
+	host := urlHost(jsURL)
+	if host == "" {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if host == f.target {
+		return true
+	}
+	for _, allowed := range f.allow {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlHost returns the lowercased host name of rawURL without its port, accepting bare
+// domains such as example.com
+func urlHost(rawURL string) string {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
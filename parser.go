@@ -1,11 +1,22 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"net/url"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
+
+	gqlast "github.com/vektah/gqlparser/v2/ast"
+	gqlparser "github.com/vektah/gqlparser/v2/parser"
 )
 
 // OperationType represents the type of GraphQL operation
@@ -19,11 +30,59 @@ const (
 
 // GraphQLOperation represents a parsed GraphQL operation
 type GraphQLOperation struct {
-	Type      OperationType          `json:"type"`
-	Name      string                 `json:"name"`
-	Variables map[string]string      `json:"variables,omitempty"`
-	Fields    []string               `json:"fields"`
-	Raw       string                 `json:"raw"`
+	Type        OperationType     `json:"type"`
+	Name        string            `json:"name"`
+	Variables   map[string]string `json:"variables,omitempty"`
+	Fields      []string          `json:"fields"`
+	Selections  []*Selection      `json:"selections,omitempty"` // Field tree with aliases, arguments and directives
+	Raw         string            `json:"raw"`
+	PersistedID string            `json:"persistedId,omitempty"` // Relay artifact id, the only reference to operations compiled without their text
+	Endpoint    string            `json:"endpoint,omitempty"`
+	Source      string            `json:"source,omitempty"` // JS file or endpoint URL the operation was found at, the lowest of Sources once deduplicated
+	Line        int               `json:"line,omitempty"`   // 1-based line of Source the operation starts on, 0 when unknown
+	Offset      int               `json:"offset,omitempty"` // Byte offset in Source, for minified bundles on a single line
+	Sources     []string          `json:"sources,omitempty"`
+	Valid       bool              `json:"valid,omitempty"` // Set by validateOperations when the operation parses
+	Depth       int               `json:"depth"`           // Deepest level of nested selection sets
+	FieldCount  int               `json:"fieldCount"`      // Fields selected at every level
+	// Set by correlateCaptures from the network captures matching the operation
+	ObservedOnNetwork bool       `json:"observedOnNetwork"`
+	CaptureCount      int        `json:"captureCount,omitempty"`
+	Endpoints         []string   `json:"endpoints,omitempty"`
+	Pages             []string   `json:"pages,omitempty"` // Pages the browser had loaded when the operation was sent
+	LastSeen          *time.Time `json:"lastSeen,omitempty"`
+	// Set by --resume to the first and latest runs that found the operation
+	FirstSeen   *time.Time `json:"firstSeen,omitempty"`
+	LastSeenRun *time.Time `json:"lastSeenRun,omitempty"`
+	// Fragments inlined from definitions found elsewhere, and spreads no definition was found for
+	Fragments           []string `json:"fragments,omitempty"`
+	UnresolvedFragments []string `json:"unresolvedFragments,omitempty"`
+	// UnresolvedInterpolations lists ${...} expressions removed from a gql template, or
+	// replaced by $_interp where they stood for a value
+	UnresolvedInterpolations []string `json:"unresolvedInterpolations,omitempty"`
+	// VariableDefaults holds the printed default value of variables declared with one
+	VariableDefaults map[string]string `json:"variableDefaults,omitempty"`
+	// ExampleVariables holds distinct variable payloads captured on the network, redacted
+	ExampleVariables []map[string]interface{} `json:"exampleVariables,omitempty"`
+	// SampleVariables is a payload generated from the declared types, set by --sample-vars
+	SampleVariables map[string]interface{} `json:"sampleVariables,omitempty"`
+	// Set by the merge subcommand: the exports the operation was found in, and whether
+	// another operation of the same type and name has a different body
+	Inputs       []string `json:"inputs,omitempty"`
+	NameConflict bool     `json:"nameConflict,omitempty"`
+	// InSchema is set when an introspected schema was available to check the operation against
+	InSchema      *bool    `json:"inSchema,omitempty"`
+	UnknownFields []string `json:"unknownFields,omitempty"`
+}
+
+// EndpointSummary describes a GraphQL endpoint observed in network captures
+type EndpointSummary struct {
+	URL           string   `json:"url"`
+	RequestCount  int      `json:"requestCount"`
+	Operations    []string `json:"operations"`
+	Subscriptions int      `json:"subscriptions"` // Distinct subscription operations sent to the endpoint
+	HasErrors     bool     `json:"hasErrors"`
+	ContentType   string   `json:"contentType,omitempty"`
 }
 
 // SchemaExport represents the exported schema structure
@@ -33,13 +92,233 @@ type SchemaExport struct {
 	Timestamp  string                 `json:"timestamp"`
 }
 
-// ParseGraphQLOperation attempts to parse a GraphQL operation string
+// ParseGraphQLOperation attempts to parse a GraphQL operation string. Documents that a
+// spec-compliant parser accepts are read from the AST; anything else falls back to
+// pattern matching.
 func ParseGraphQLOperation(operation string) (*GraphQLOperation, error) {
-	operation = strings.TrimSpace(operation)
+	operation = trimOperationNoise(operation)
+	
+	if op, err := parseOperationAST(operation); err == nil {
+		return op, nil
+	}
+	
+	// Ignore whatever follows the brace closing the operation, such as a semicolon or
+	// the remnant of a template literal
+	if end := operationEnd(operation); end > 0 && end < len(operation) {
+		operation = operation[:end]
+		if op, err := parseOperationAST(operation); err == nil {
+			return op, nil
+		}
+	}
+	
+	op, err := parseOperationRegex(operation)
+	if err != nil && strings.HasPrefix(operation, "{") {
+		// Shorthand query without the keyword
+		if op, err = parseOperationRegex("query " + operation); err == nil {
+			op.Name = anonymousOperationName(op.Raw)
+		}
+	}
+	return op, err
+}
+
+// trimOperationNoise removes a byte order mark and the whitespace, commas and literal
+// \n or \t escapes that JavaScript sources leave before and after an operation
+func trimOperationNoise(operation string) string {
+	operation = strings.TrimPrefix(strings.TrimSpace(operation), "\ufeff")
+	operation = operation[skipOperationSpace(operation, 0):]
+	for {
+		trimmed := strings.TrimRight(operation, " \t\r\n,")
+		for _, escape := range []string{`\n`, `\t`} {
+			trimmed = strings.TrimSuffix(trimmed, escape)
+		}
+		if trimmed == operation {
+			return operation
+		}
+		operation = trimmed
+	}
+}
+
+// operationEnd returns the index just past the brace closing the operation at the start
+// of text, or 0 when it has none
+func operationEnd(text string) int {
+	if strings.HasPrefix(text, "{") {
+		end, _ := scanBalanced(text, 0, '{', '}')
+		return end
+	}
+	m := operationStartPattern.FindStringSubmatchIndex(text)
+	if m == nil || m[2] != 0 {
+		return 0
+	}
+	end, _ := scanOperationSpan(text, m[3])
+	return end
+}
+
+// anonymousOperationName gives a shorthand query a stable name derived from its
+// normalized body, so dedup, reports and file names can tell such queries apart
+func anonymousOperationName(query string) string {
+	sum := sha256.Sum256([]byte(normalizeGraphQL(query)))
+	return "AnonymousQuery_" + hex.EncodeToString(sum[:4])
+}
+
+// parseOperationAST builds the operation from the first operation definition in the
+// document. Raw is the document printed back from its AST, so it is always valid.
+func parseOperationAST(operation string) (*GraphQLOperation, error) {
+	doc, err := gqlparser.ParseQuery(&gqlast.Source{Input: operation})
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Operations) == 0 {
+		return nil, fmt.Errorf("no operation in document")
+	}
+	def := doc.Operations[0]
+	
+	op := &GraphQLOperation{
+		Type:      OperationType(def.Operation),
+		Name:      def.Name,
+		Variables: make(map[string]string),
+		Fields:    []string{},
+		Raw:       operation,
+	}
+	for _, v := range def.VariableDefinitions {
+		op.Variables[v.Variable] = v.Type.String()
+		if v.DefaultValue != nil {
+			if op.VariableDefaults == nil {
+				op.VariableDefaults = make(map[string]string)
+			}
+			op.VariableDefaults[v.Variable] = v.DefaultValue.String()
+		}
+	}
+	op.Fields = topLevelFields(def.SelectionSet, doc.Fragments, make(map[string]bool), op.Fields)
+	op.Selections = buildSelections(def.SelectionSet)
+	
+	// The shorthand form { ... }, alone or after fragments, has no keyword to carry a name
+	shorthand := false
+	if def.Position != nil {
+		if runes := []rune(operation); def.Position.Start < len(runes) && runes[def.Position.Start] == '{' {
+			shorthand = true
+		}
+	}
+	
+	if printed, err := printGraphQL(operation); err == nil {
+		// The printer drops the keyword of anonymous queries; keep it so Raw reads alike
+		if strings.HasPrefix(printed, "{") {
+			printed = string(op.Type) + " " + printed
+		}
+		op.Raw = printed
+	}
+	
+	op.Depth, op.FieldCount = operationComplexity(op.Raw)
+	if shorthand {
+		op.Name = anonymousOperationName(op.Raw)
+	}
+	
+	return op, nil
+}
+
+// topLevelFields appends the names of the fields an operation selects at its root,
+// looking through inline fragments and spreads of fragments in the same document
+func topLevelFields(selections gqlast.SelectionSet, fragments gqlast.FragmentDefinitionList, visiting map[string]bool, fields []string) []string {
+	for _, selection := range selections {
+		switch sel := selection.(type) {
+		case *gqlast.Field:
+			fields = appendUnique(fields, sel.Name)
+		case *gqlast.InlineFragment:
+			fields = topLevelFields(sel.SelectionSet, fragments, visiting, fields)
+		case *gqlast.FragmentSpread:
+			fragment := fragments.ForName(sel.Name)
+			if fragment == nil || visiting[sel.Name] {
+				continue
+			}
+			visiting[sel.Name] = true
+			fields = topLevelFields(fragment.SelectionSet, fragments, visiting, fields)
+		}
+	}
+	return fields
+}
+
+// parseVariableDefinitionText splits a (...) variable definition list into types and
+// default values. Commas, brackets and strings inside defaults such as
+// $ids: [ID!] = ["a","b"] or $filter: In = {tags: ["x", "y"]} do not split a definition.
+func parseVariableDefinitionText(section string) (types, defaults map[string]string) {
+	types = make(map[string]string)
+	section = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(section), "("), ")")
+	
+	// Definitions start at a $ outside brackets and strings
+	var definitions []string
+	depth, start := 0, -1
+	for i := 0; i < len(section); i++ {
+		switch section[i] {
+		case '[', '{', '(':
+			depth++
+		case ']', '}', ')':
+			depth--
+		case '"':
+			i = skipGraphQLString(section, i) - 1
+		case '$':
+			if depth == 0 {
+				if start >= 0 {
+					definitions = append(definitions, section[start:i])
+				}
+				start = i
+			}
+		}
+	}
+	if start >= 0 {
+		definitions = append(definitions, section[start:])
+	}
 	
+	for _, def := range definitions {
+		def = strings.TrimRight(strings.TrimSpace(def), ", \t\n")
+		colon := strings.Index(def, ":")
+		if colon < 0 {
+			continue
+		}
+		name := strings.TrimSpace(def[1:colon])
+		rest := def[colon+1:]
+		
+		// Directives on the definition are not part of its type or default
+		if at := topLevelIndex(rest, '@'); at >= 0 {
+			rest = rest[:at]
+		}
+		typ, value := rest, ""
+		if eq := topLevelIndex(rest, '='); eq >= 0 {
+			typ, value = rest[:eq], rest[eq+1:]
+		}
+		types[name] = strings.Join(strings.Fields(typ), "")
+		if value = strings.TrimSpace(value); value != "" {
+			if defaults == nil {
+				defaults = make(map[string]string)
+			}
+			defaults[name] = value
+		}
+	}
+	return types, defaults
+}
+
+// topLevelIndex returns the index of c outside brackets and strings, or -1
+func topLevelIndex(s string, c byte) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[', '{', '(':
+			depth++
+		case ']', '}', ')':
+			depth--
+		case '"':
+			i = skipGraphQLString(s, i) - 1
+		case c:
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseOperationRegex reads an operation with patterns, for text the parser rejects
+func parseOperationRegex(operation string) (*GraphQLOperation, error) {
 	// More robust regex patterns
-	operationPattern := regexp.MustCompile(`(?s)^(query|mutation|subscription)\s+(\w+)?\s*(\([^)]*\))?\s*\{(.+)\}$`)
-	variablePattern := regexp.MustCompile(`\$(\w+):\s*([^,\)]+)`)
+	operationPattern := regexp.MustCompile(`(?s)^(query|mutation|subscription)\s+(\w+)?\s*(\((?:[^()]|\([^()]*\))*\))?\s*\{(.+)\}$`)
 	fieldPattern := regexp.MustCompile(`(\w+)(?:\s*\([^)]*\))?\s*(?:\{[^}]*\})?`)
 	
 	matches := operationPattern.FindStringSubmatch(operation)
@@ -57,12 +336,7 @@ func ParseGraphQLOperation(operation string) (*GraphQLOperation, error) {
 	
 	// Parse variables
 	if matches[3] != "" {
-		varMatches := variablePattern.FindAllStringSubmatch(matches[3], -1)
-		for _, vm := range varMatches {
-			if len(vm) >= 3 {
-				op.Variables[vm[1]] = strings.TrimSpace(vm[2])
-			}
-		}
+		op.Variables, op.VariableDefaults = parseVariableDefinitionText(matches[3])
 	}
 	
 	// Parse fields (simplified - just top level)
@@ -74,66 +348,479 @@ func ParseGraphQLOperation(operation string) (*GraphQLOperation, error) {
 		}
 	}
 	
+	op.Depth, op.FieldCount = operationComplexity(operation)
+	if op.FieldCount == 0 {
+		op.FieldCount = len(op.Fields)
+	}
+	
 	return op, nil
 }
 
+// operationComplexity returns the deepest nesting of selection sets in a query and the
+// total number of fields it selects, following fragments defined in the same document.
+// Queries that do not parse get a depth from brace nesting and no field count.
+func operationComplexity(query string) (depth, fieldCount int) {
+	doc, err := parseGraphQLDocument(query)
+	if err != nil {
+		return braceDepth(query), 0
+	}
+	
+	fragments := fragmentsByName(doc)
+	for _, def := range doc.Operations {
+		d, n := selectionComplexity(def.SelectionSet, fragments, make(map[string]bool))
+		depth = max(depth, d)
+		fieldCount += n
+	}
+	
+	return depth, fieldCount
+}
+
+// selectionComplexity measures a selection set; fragments add fields at the same level
+func selectionComplexity(selections gqlast.SelectionSet, fragments map[string]*gqlast.FragmentDefinition, visiting map[string]bool) (depth, fieldCount int) {
+	depth = 1
+	for _, selection := range selections {
+		switch s := selection.(type) {
+		case *gqlast.Field:
+			fieldCount++
+			if len(s.SelectionSet) > 0 {
+				d, n := selectionComplexity(s.SelectionSet, fragments, visiting)
+				depth = max(depth, d+1)
+				fieldCount += n
+			}
+		case *gqlast.InlineFragment:
+			d, n := selectionComplexity(s.SelectionSet, fragments, visiting)
+			depth = max(depth, d)
+			fieldCount += n
+		case *gqlast.FragmentSpread:
+			fragment, ok := fragments[s.Name]
+			if !ok || visiting[s.Name] {
+				continue
+			}
+			visiting[s.Name] = true
+			d, n := selectionComplexity(fragment.SelectionSet, fragments, visiting)
+			delete(visiting, s.Name)
+			depth = max(depth, d)
+			fieldCount += n
+		}
+	}
+	return depth, fieldCount
+}
+
+// braceDepth returns the deepest nesting of selection-set braces, ignoring strings and
+// object values inside argument lists
+func braceDepth(query string) int {
+	depth, deepest := 0, 0
+	for i := 0; i < len(query); i++ {
+		switch query[i] {
+		case '"':
+			i = skipGraphQLString(query, i) - 1
+		case '(':
+			i = skipBalanced(query, i, '(', ')') - 1
+		case '{':
+			depth++
+			deepest = max(deepest, depth)
+		case '}':
+			depth--
+		}
+	}
+	return deepest
+}
+
 // ExtractOperationsFromJS extracts GraphQL operations from JavaScript content with better parsing
-func ExtractOperationsFromJS(content string) ([]*GraphQLOperation, error) {
+func ExtractOperationsFromJS(content, source string) ([]*GraphQLOperation, error) {
+	operations, _ := ExtractOperationsFromJSWithFailures(content, source)
+	return operations, nil
+}
+
+// ParseFailure records operation text that was found but could not be parsed
+type ParseFailure struct {
+	Text string
+	Err  error
+}
+
+// ExtractOperationsFromJSWithFailures is ExtractOperationsFromJS that also returns the
+// candidate operations it had to drop because they did not parse
+func ExtractOperationsFromJSWithFailures(content, source string) ([]*GraphQLOperation, []ParseFailure) {
+	operations, failures := extractOperationsFromText(content)
+	
+	// Compiled Relay requests, whose text also holds the fragments the operation spreads.
+	// The plain patterns only find the operation itself in it, so that copy is dropped.
+	if hasRelayArtifacts(content) {
+		relay, spans := extractRelayOperations(content)
+		operations = append(dropOperationsWithin(operations, spans), relay...)
+	}
+	
+	// Tagged templates whose ${...} interpolations defeat the plain patterns
+	templated, spans := extractTemplateOperations(content)
+	operations = append(dropOperationsWithin(operations, spans), templated...)
+	
+	// Queries split across concatenated literals are found at the start of their chain.
+	// The plain patterns can read across the quotes of a chain, so those copies are dropped.
+	merged, spans := mergeConcatenatedStrings(content)
+	operations = dropOperationsWithin(operations, spans)
+	for i, text := range merged {
+		found, failed := extractOperationsFromText(text)
+		for _, op := range found {
+			op.Offset = spans[i][0]
+		}
+		operations = append(operations, found...)
+		failures = append(failures, failed...)
+	}
+	
+	// Also scan queries hidden in encoded string literals. Offsets into the decoded text
+	// say nothing about the file, so they are found at the start of their literal.
+	decoded, offsets := decodeEmbeddedStrings(content)
+	for i, text := range decoded {
+		found, failed := extractOperationsFromText(text)
+		for _, op := range found {
+			op.Offset = offsets[i]
+		}
+		operations = append(operations, found...)
+		failures = append(failures, failed...)
+	}
+	
+	// The passes overlap, e.g. a literal that is both plain and escaped, so keep one copy
+	// of each operation per file and the per-file counts stay meaningful
+	operations = uniqueOperations(operations)
+	
+	// Record where each operation came from
+	for _, op := range operations {
+		op.Source = source
+		op.Sources = []string{source}
+		op.Line = 1 + strings.Count(content[:op.Offset], "\n")
+	}
+	
+	return operations, failures
+}
+
+// uniqueOperations drops operations whose normalized text was already seen, keeping
+// the first copy
+func uniqueOperations(operations []*GraphQLOperation) []*GraphQLOperation {
+	seen := make(map[string]bool, len(operations))
+	unique := operations[:0]
+	for _, op := range operations {
+		key := createOperationKey(op)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, op)
+	}
+	return unique
+}
+
+// extractOperationsFromText finds GraphQL operations in a block of source text. Each
+// operation is read from its keyword to the brace that balances its selection set,
+// which patterns cannot do for selection sets nested more than a couple of levels.
+func extractOperationsFromText(content string) ([]*GraphQLOperation, []ParseFailure) {
 	var operations []*GraphQLOperation
+	var failures []ParseFailure
 	
-	// Improved patterns to handle minified code and template literals
-	patterns := []string{
-		// Standard GraphQL operations
-		`(?s)(query|mutation|subscription)\s+\w+\s*\([^)]*\)\s*\{[^}]+(?:\{[^}]+\})*[^}]+\}`,
-		// Operations without names
-		`(?s)(query|mutation|subscription)\s*\([^)]*\)\s*\{[^}]+(?:\{[^}]+\})*[^}]+\}`,
-		// Operations without variables
-		`(?s)(query|mutation|subscription)\s+\w+\s*\{[^}]+(?:\{[^}]+\})*[^}]+\}`,
-		// Template literal operations
-		`gql\s*` + "`" + `\s*((?:query|mutation|subscription)[^` + "`" + `]+)` + "`",
-		// Escaped in strings
-		`["']\\n\s*((?:query|mutation|subscription)[^"']+)["']`,
-	}
-	
-	for _, pattern := range patterns {
-		re := regexp.MustCompile(pattern)
-		matches := re.FindAllStringSubmatch(content, -1)
+	for _, span := range scanOperations(content) {
+		// Clean up escaped characters
+		opString := strings.ReplaceAll(span.Text, "\\n", "\n")
+		opString = strings.ReplaceAll(opString, "\\t", "  ")
+		opString = strings.ReplaceAll(opString, `\"`, `"`)
 		
-		for _, match := range matches {
-			var opString string
-			if len(match) > 1 {
-				if match[1] == "query" || match[1] == "mutation" || match[1] == "subscription" {
-					opString = match[0]
-				} else {
-					opString = match[1]
-				}
-			} else {
-				opString = match[0]
-			}
-			
-			// Clean up escaped characters
-			opString = strings.ReplaceAll(opString, "\\n", "\n")
-			opString = strings.ReplaceAll(opString, "\\t", "  ")
-			opString = strings.ReplaceAll(opString, `\"`, `"`)
-			
-			// Try to parse
-			op, err := ParseGraphQLOperation(opString)
-			if err == nil && op != nil {
-				operations = append(operations, op)
+		// Try to parse
+		op, err := ParseGraphQLOperation(opString)
+		if err != nil {
+			failures = append(failures, ParseFailure{Text: opString, Err: err})
+			continue
+		}
+		op.Offset = span.Start
+		operations = append(operations, op)
+	}
+	
+	return operations, failures
+}
+
+var (
+	// Quoted string literals using \u or \x escapes, which the plain matching cannot see through
+	escapedLiteralPattern = regexp.MustCompile(`"(?:[^"\\\n]|\\.)*\\[ux](?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*\\[ux](?:[^'\\\n]|\\.)*'`)
+	// Quoted base64 blobs long enough to hold an operation
+	base64LiteralPattern = regexp.MustCompile(`["'\x60]([A-Za-z0-9+/]{40,}={0,2})["'\x60]`)
+	// GraphQL keywords worth decoding a literal for
+	operationKeywordPattern = regexp.MustCompile(`\b(query|mutation|subscription)\b`)
+)
+
+// maxDecodedLiteral skips base64 blobs too large to plausibly be a query
+const maxDecodedLiteral = 1 << 20
+
+// decodeEmbeddedStrings returns the text of string literals that hide GraphQL behind
+// JSON/JS escapes or base64, with the offset of each literal in content. Decoded base64
+// that is not printable text is discarded.
+func decodeEmbeddedStrings(content string) (decoded []string, offsets []int) {
+	for _, loc := range escapedLiteralPattern.FindAllStringIndex(content, -1) {
+		if text, ok := unquoteJSLiteral(content[loc[0]:loc[1]]); ok && operationKeywordPattern.MatchString(text) {
+			decoded = append(decoded, text)
+			offsets = append(offsets, loc[0])
+		}
+	}
+	
+	for _, loc := range base64LiteralPattern.FindAllStringSubmatchIndex(content, -1) {
+		blob := content[loc[2]:loc[3]]
+		if len(blob) > maxDecodedLiteral*4/3 {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(blob)
+		if err != nil {
+			data, err = base64.RawStdEncoding.DecodeString(blob)
+		}
+		if err != nil || !isPrintableText(data) {
+			continue
+		}
+		if text := string(data); operationKeywordPattern.MatchString(text) {
+			decoded = append(decoded, text)
+			offsets = append(offsets, loc[0])
+		}
+	}
+	
+	return decoded, offsets
+}
+
+// unquoteJSLiteral decodes a single- or double-quoted JavaScript string literal
+func unquoteJSLiteral(literal string) (string, bool) {
+	if len(literal) < 2 {
+		return "", false
+	}
+	inner := literal[1 : len(literal)-1]
+	
+	// strconv.Unquote follows Go rules, so normalize the escapes that differ in JavaScript
+	inner = strings.ReplaceAll(inner, `\/`, "/")
+	inner = strings.ReplaceAll(inner, `\'`, "'")
+	if literal[0] == '\'' {
+		inner = strings.ReplaceAll(inner, `"`, `\"`)
+		inner = strings.ReplaceAll(inner, `\\"`, `\"`)
+	}
+	
+	text, err := strconv.Unquote(`"` + inner + `"`)
+	if err != nil {
+		return "", false
+	}
+	return text, true
+}
+
+// isPrintableText reports whether data is UTF-8 text rather than binary
+func isPrintableText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, r := range string(data) {
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// stripDirectives removes directives such as @client or @connection(key: "feed") from a
+// query, leaving the directives named in keep (e.g. "include", "skip") in place
+func stripDirectives(query string, keep []string) string {
+	preserved := make(map[string]bool)
+	for _, name := range keep {
+		preserved[strings.TrimPrefix(name, "@")] = true
+	}
+	
+	var out strings.Builder
+	for i := 0; i < len(query); {
+		c := query[i]
+		
+		// Copy string literals untouched, including block strings
+		if c == '"' {
+			end := skipGraphQLString(query, i)
+			out.WriteString(query[i:end])
+			i = end
+			continue
+		}
+		
+		// Copy comments untouched
+		if c == '#' {
+			end := strings.IndexByte(query[i:], '\n')
+			if end == -1 {
+				end = len(query) - i
 			}
+			out.WriteString(query[i : i+end])
+			i += end
+			continue
+		}
+		
+		if c != '@' {
+			out.WriteByte(c)
+			i++
+			continue
+		}
+		
+		nameEnd := i + 1
+		for nameEnd < len(query) && isNameChar(query[nameEnd]) {
+			nameEnd++
+		}
+		if preserved[query[i+1:nameEnd]] {
+			out.WriteString(query[i:nameEnd])
+			i = nameEnd
+			continue
 		}
+		
+		// Skip the directive's argument list, if any
+		end := nameEnd
+		for end < len(query) && (query[end] == ' ' || query[end] == '\t') {
+			end++
+		}
+		if end < len(query) && query[end] == '(' {
+			end = skipBalanced(query, end, '(', ')')
+		} else {
+			end = nameEnd
+		}
+		
+		// Drop the whitespace that separated the directive from what precedes it
+		trimmed := strings.TrimRight(out.String(), " \t")
+		out.Reset()
+		out.WriteString(trimmed)
+		i = end
 	}
 	
-	return operations, nil
+	return out.String()
+}
+
+// isNameChar reports whether c can appear in a GraphQL name
+func isNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// skipGraphQLString returns the index just past the string literal starting at start
+func skipGraphQLString(query string, start int) int {
+	if strings.HasPrefix(query[start:], `"""`) {
+		end := strings.Index(query[start+3:], `"""`)
+		if end == -1 {
+			return len(query)
+		}
+		return start + 3 + end + 3
+	}
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(query)
+}
+
+// skipBalanced returns the index just past the bracket that closes the one at start,
+// ignoring brackets inside string literals
+func skipBalanced(query string, start int, open, close byte) int {
+	depth := 0
+	for i := start; i < len(query); i++ {
+		switch query[i] {
+		case '"':
+			i = skipGraphQLString(query, i) - 1
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(query)
 }
 
-// ExportToSDL converts operations to GraphQL SDL format
-func ExportToSDL(operations []*GraphQLOperation) string {
+// ExportToSDL converts operations to GraphQL SDL format. With groupByRoot, operations
+// are listed under the first top-level field they select instead of by type.
+func ExportToSDL(operations []*GraphQLOperation, groupByRoot bool) string {
 	var sdl strings.Builder
 	
 	sdl.WriteString("# Extracted GraphQL Operations\n")
-	sdl.WriteString("# Generated at: " + time.Now().Format(time.RFC3339) + "\n\n")
+	sdl.WriteString(generatedAtLine("# ") + "\n")
+	
+	// Group by endpoint when operations were attributed to one
+	byEndpoint := make(map[string][]*GraphQLOperation)
+	for _, op := range operations {
+		byEndpoint[op.Endpoint] = append(byEndpoint[op.Endpoint], op)
+	}
+	if len(byEndpoint) == 1 && byEndpoint[""] != nil {
+		writeOperations(&sdl, operations, groupByRoot)
+		return sdl.String()
+	}
+	
+	endpoints := make([]string, 0, len(byEndpoint))
+	for endpoint := range byEndpoint {
+		if endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	sort.Strings(endpoints)
+	if byEndpoint[""] != nil {
+		endpoints = append(endpoints, "")
+	}
+	
+	for _, endpoint := range endpoints {
+		if endpoint == "" {
+			sdl.WriteString("# Endpoint: unknown (not observed on the network)\n\n")
+		} else {
+			sdl.WriteString("# Endpoint: " + endpoint + "\n\n")
+		}
+		writeOperations(&sdl, byEndpoint[endpoint], groupByRoot)
+	}
+	
+	return sdl.String()
+}
+
+// writeOperations writes operations grouped by root field or by type
+func writeOperations(sdl *strings.Builder, operations []*GraphQLOperation, groupByRoot bool) {
+	if groupByRoot {
+		writeOperationsByRootSDL(sdl, operations)
+	} else {
+		writeOperationsSDL(sdl, operations)
+	}
+}
+
+// writeOperationsByRootSDL writes operations under a header for the first top-level
+// field each selects, queries before mutations and subscriptions within a root
+func writeOperationsByRootSDL(sdl *strings.Builder, operations []*GraphQLOperation) {
+	byRoot := make(map[string][]*GraphQLOperation)
+	for _, op := range operations {
+		root := ""
+		if len(op.Fields) > 0 {
+			root = op.Fields[0]
+		}
+		byRoot[root] = append(byRoot[root], op)
+	}
+	
+	roots := make([]string, 0, len(byRoot))
+	for root := range byRoot {
+		if root != "" {
+			roots = append(roots, root)
+		}
+	}
+	sort.Strings(roots)
+	if byRoot[""] != nil {
+		roots = append(roots, "")
+	}
 	
+	typeOrder := map[OperationType]int{Query: 0, Mutation: 1, Subscription: 2}
+	for _, root := range roots {
+		group := byRoot[root]
+		sort.SliceStable(group, func(i, j int) bool {
+			return typeOrder[group[i].Type] < typeOrder[group[j].Type]
+		})
+		if root == "" {
+			fmt.Fprintf(sdl, "# Root field: unknown (%d operations)\n", len(group))
+		} else {
+			fmt.Fprintf(sdl, "# Root field: %s (%d operations)\n", root, len(group))
+		}
+		for _, op := range group {
+			sdl.WriteString(operationSourceComment(op))
+			sdl.WriteString(formatOperationSDL(op))
+			sdl.WriteString("\n\n")
+		}
+	}
+}
+
+// writeOperationsSDL writes operations grouped by type
+func writeOperationsSDL(sdl *strings.Builder, operations []*GraphQLOperation) {
 	// Group by type
 	queries := []*GraphQLOperation{}
 	mutations := []*GraphQLOperation{}
@@ -154,6 +841,7 @@ func ExportToSDL(operations []*GraphQLOperation) string {
 	if len(queries) > 0 {
 		sdl.WriteString("# Queries\n")
 		for _, op := range queries {
+			sdl.WriteString(operationSourceComment(op))
 			sdl.WriteString(formatOperationSDL(op))
 			sdl.WriteString("\n\n")
 		}
@@ -162,6 +850,7 @@ func ExportToSDL(operations []*GraphQLOperation) string {
 	if len(mutations) > 0 {
 		sdl.WriteString("# Mutations\n")
 		for _, op := range mutations {
+			sdl.WriteString(operationSourceComment(op))
 			sdl.WriteString(formatOperationSDL(op))
 			sdl.WriteString("\n\n")
 		}
@@ -170,127 +859,339 @@ func ExportToSDL(operations []*GraphQLOperation) string {
 	if len(subscriptions) > 0 {
 		sdl.WriteString("# Subscriptions\n")
 		for _, op := range subscriptions {
+			sdl.WriteString(operationSourceComment(op))
 			sdl.WriteString(formatOperationSDL(op))
 			sdl.WriteString("\n\n")
 		}
 	}
-	
-	return sdl.String()
 }
 
-// formatOperationSDL formats a single operation in SDL
+// operationSourceComment returns the comment lines naming where an operation was found
+// (with its line when known), any other files it also appeared in, the merged exports
+// it came from and whether its name conflicts with another operation's
+func operationSourceComment(op *GraphQLOperation) string {
+	var comment string
+	if op.Source != "" {
+		comment = "# Source: " + sourceLocation(op)
+		if len(op.Sources) > 1 {
+			comment += fmt.Sprintf(" (also in %d other files)", len(op.Sources)-1)
+		}
+		comment += "\n"
+	}
+	if len(op.Inputs) > 0 {
+		comment += "# Inputs: " + strings.Join(op.Inputs, ", ") + "\n"
+	}
+	if op.NameConflict {
+		comment += "# Conflict: another " + string(op.Type) + " named " + op.Name + " has a different body\n"
+	}
+	return comment
+}
+
+// sourceLocation returns the operation's source with its line appended when known
+func sourceLocation(op *GraphQLOperation) string {
+	if op.Line > 0 {
+		return fmt.Sprintf("%s:%d", op.Source, op.Line)
+	}
+	return op.Source
+}
+
+// formatOperationSDL formats a single operation in SDL. The raw operation is printed
+// with its nested selections intact; text that does not parse is kept as comments so
+// the file stays valid GraphQL.
 func formatOperationSDL(op *GraphQLOperation) string {
-	// If we have the raw operation with proper formatting, use it
-	if op.Raw != "" && strings.Contains(op.Raw, "\n") {
-		return op.Raw
+	if op.Raw != "" {
+		if printed, err := printGraphQL(op.Raw); err == nil {
+			return printed
+		}
+		
+		var sb strings.Builder
+		sb.WriteString("# Could not be parsed, original text follows:\n")
+		for _, line := range strings.Split(strings.TrimSuffix(formatGraphQLQuery(op.Raw), "\n"), "\n") {
+			sb.WriteString("# " + line + "\n")
+		}
+		return strings.TrimSuffix(sb.String(), "\n")
 	}
 	
-	// Otherwise, reconstruct from parsed components
+	// Otherwise, reconstruct from parsed components. Only top-level field names are
+	// known, so each is written as a leaf selection.
 	var sb strings.Builder
 	
+	if op.PersistedID != "" {
+		sb.WriteString("# Persisted query, only its id is in the bundle: " + op.PersistedID + "\n")
+	}
+	
 	sb.WriteString(string(op.Type))
 	if op.Name != "" {
 		sb.WriteString(" " + op.Name)
 	}
 	
 	if len(op.Variables) > 0 {
-		sb.WriteString("(")
-		first := true
-		for name, typ := range op.Variables {
-			if !first {
-				sb.WriteString(", ")
-			}
-			sb.WriteString("$" + name + ": " + typ)
-			first = false
-		}
-		sb.WriteString(")")
+		sb.WriteString("(" + variableSignature(op) + ")")
 	}
 	
 	sb.WriteString(" {\n")
-	
-	// If we have the raw operation, try to extract the body with proper formatting
-	if op.Raw != "" {
-		// Extract the body from the raw operation
-		if bodyStart := strings.Index(op.Raw, "{"); bodyStart != -1 {
-			if bodyEnd := strings.LastIndex(op.Raw, "}"); bodyEnd != -1 && bodyEnd > bodyStart {
-				body := op.Raw[bodyStart+1 : bodyEnd]
-				lines := strings.Split(body, "\n")
-				for _, line := range lines {
-					line = strings.TrimSpace(line)
-					if line != "" {
-						sb.WriteString("  " + line + "\n")
-					}
-				}
-			}
-		}
-	} else {
-		// Fall back to simple field list
-		for _, field := range op.Fields {
+	fields := 0
+	for _, field := range op.Fields {
+		if field != "" && isGraphQLName(field) {
 			sb.WriteString("  " + field + "\n")
+			fields++
 		}
 	}
-	
+	if fields == 0 {
+		// An empty selection set is not valid GraphQL
+		sb.WriteString("  __typename\n")
+	}
 	sb.WriteString("}")
 	
 	return sb.String()
 }
 
-// ExportToJSON exports operations as JSON with detailed information
-func ExportToJSON(operations []*GraphQLOperation, captures []GraphQLCapture) ([]byte, error) {
+// isGraphQLName reports whether s is a valid GraphQL name
+func isGraphQLName(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isNameChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExportToJSON exports operations as JSON with detailed information. files, when
+// given, lists what each processed JavaScript file yielded, and inferred holds types
+// inferred by earlier exports to merge with those inferred from captures.
+func ExportToJSON(operations []*GraphQLOperation, captures []GraphQLCapture, files []*FileStats, inferred map[string]interface{}) ([]byte, error) {
 	// Convert operations to include more details
 	detailedOps := make([]map[string]interface{}, 0, len(operations))
 	
 	for _, op := range operations {
 		detailedOp := map[string]interface{}{
-			"type":      op.Type,
-			"name":      op.Name,
-			"variables": op.Variables,
-			"fields":    op.Fields,
-			"signature": extractOperationSignature(op),
+			"type":       op.Type,
+			"name":       op.Name,
+			"variables":  op.Variables,
+			"fields":     op.Fields,
+			"signature":  extractOperationSignature(op),
+			"query":      op.Raw,
+			"depth":      op.Depth,
+			"fieldCount": op.FieldCount,
 		}
-		
-		// Add variable types if available
-		if len(op.Variables) > 0 {
-			varTypes := make(map[string]interface{})
-			for name, typ := range op.Variables {
-				varTypes[name] = map[string]interface{}{
-					"type":     typ,
-					"required": strings.HasSuffix(typ, "!"),
-				}
-			}
-			detailedOp["variableTypes"] = varTypes
+		if len(op.Selections) > 0 {
+			detailedOp["selections"] = op.Selections
+		}
+		if op.Source != "" {
+			detailedOp["source"] = op.Source
+		}
+		if op.Line > 0 {
+			detailedOp["line"] = op.Line
+			detailedOp["offset"] = op.Offset
+		}
+		if len(op.Sources) > 0 {
+			detailedOp["sources"] = op.Sources
+		}
+		if len(op.Inputs) > 0 {
+			detailedOp["inputs"] = op.Inputs
+		}
+		if op.NameConflict {
+			detailedOp["nameConflict"] = true
+		}
+		if len(op.Fragments) > 0 {
+			detailedOp["fragments"] = op.Fragments
+		}
+		if len(op.UnresolvedFragments) > 0 {
+			detailedOp["unresolvedFragments"] = op.UnresolvedFragments
+		}
+		if len(op.UnresolvedInterpolations) > 0 {
+			detailedOp["unresolvedInterpolations"] = op.UnresolvedInterpolations
+		}
+		if len(op.ExampleVariables) > 0 {
+			detailedOp["exampleVariables"] = op.ExampleVariables
+		}
+		if op.SampleVariables != nil {
+			detailedOp["sampleVariables"] = op.SampleVariables
+		}
+		// Only set when an introspected schema was available to check against
+		if op.InSchema != nil {
+			detailedOp["inSchema"] = *op.InSchema
+			if len(op.UnknownFields) > 0 {
+				detailedOp["unknownFields"] = op.UnknownFields
+			}
+		}
+		detailedOp["observedOnNetwork"] = op.ObservedOnNetwork
+		if op.ObservedOnNetwork {
+			detailedOp["captureCount"] = op.CaptureCount
+			detailedOp["endpoints"] = op.Endpoints
+			if len(op.Pages) > 0 {
+				detailedOp["pages"] = op.Pages
+			}
+			detailedOp["lastSeen"] = lastSeenString(op)
+		}
+		// Resumed runs report when the operation was found instead, and the capture
+		// time under lastCaptured
+		if op.FirstSeen != nil && op.LastSeenRun != nil {
+			detailedOp["firstSeen"] = op.FirstSeen.Format(time.RFC3339)
+			detailedOp["lastSeen"] = op.LastSeenRun.Format(time.RFC3339)
+			if op.ObservedOnNetwork {
+				detailedOp["lastCaptured"] = lastSeenString(op)
+			}
+		}
+		
+		// Add variable types if available
+		if len(op.Variables) > 0 {
+			varTypes := make(map[string]interface{})
+			for name, typ := range op.Variables {
+				// A variable with a default can be omitted even when its type is non-null
+				defaultValue, hasDefault := op.VariableDefaults[name]
+				varType := map[string]interface{}{
+					"type":     typ,
+					"required": strings.HasSuffix(typ, "!") && !hasDefault,
+				}
+				if hasDefault {
+					varType["default"] = defaultValue
+				}
+				varTypes[name] = varType
+			}
+			detailedOp["variableTypes"] = varTypes
 		}
 		
 		detailedOps = append(detailedOps, detailedOp)
 	}
 	
+	summary := map[string]interface{}{
+		"totalOperations": len(operations),
+		"queries":         countOperationType(operations, Query),
+		"mutations":       countOperationType(operations, Mutation),
+		"subscriptions":   countOperationType(operations, Subscription),
+	}
 	export := map[string]interface{}{
 		"operations": detailedOps,
-		"timestamp":  time.Now().Format(time.RFC3339),
-		"summary": map[string]interface{}{
-			"totalOperations": len(operations),
-			"queries":         countOperationType(operations, Query),
-			"mutations":       countOperationType(operations, Mutation),
-			"subscriptions":   countOperationType(operations, Subscription),
-		},
+		"summary":    summary,
+	}
+	if !omitTimestamps {
+		export["timestamp"] = time.Now().Format(time.RFC3339)
 	}
 	
-	// Try to infer types from responses
-	types := make(map[string]interface{})
+	if endpoints := summarizeEndpoints(captures); len(endpoints) > 0 {
+		export["endpoints"] = endpoints
+		subscriptionsByEndpoint := make(map[string]int)
+		for _, endpoint := range endpoints {
+			if endpoint.Subscriptions > 0 {
+				subscriptionsByEndpoint[endpoint.URL] = endpoint.Subscriptions
+			}
+		}
+		if len(subscriptionsByEndpoint) > 0 {
+			summary["subscriptionsByEndpoint"] = subscriptionsByEndpoint
+		}
+	}
+	
+	if len(files) > 0 {
+		export["files"] = files
+		if omitTimestamps {
+			export["files"] = untimedFiles(files)
+		}
+	}
+	
+	// Surface the operations the target was slowest to answer
+	if slowest := slowestCaptures(captures, 10); len(slowest) > 0 {
+		slowestOps := make([]map[string]interface{}, 0, len(slowest))
+		for _, capture := range slowest {
+			slowestOps = append(slowestOps, map[string]interface{}{
+				"operationName": capture.OperationName,
+				"url":           capture.URL,
+				"durationMs":    capture.DurationMs,
+			})
+		}
+		summary["slowestOperations"] = slowestOps
+	}
+	
+	// Include response metadata for each network capture
+	if len(captures) > 0 {
+		captureInfo := make([]map[string]interface{}, 0, len(captures))
+		for _, capture := range captures {
+			info := map[string]interface{}{
+				"url":           capture.URL,
+				"operationName": capture.OperationName,
+				"timestamp":     capture.Timestamp.Format(time.RFC3339),
+			}
+			if len(capture.Variables) > 0 {
+				info["variables"] = capture.Variables
+			}
+			if len(capture.UploadVariables) > 0 {
+				info["uploadVariables"] = capture.UploadVariables
+			}
+			if capture.DynamicOnly {
+				info["dynamicOnly"] = true
+			}
+			if capture.Pending {
+				info["pending"] = true
+			} else {
+				info["status"] = capture.Status
+				info["durationMs"] = capture.DurationMs
+				info["responseSize"] = capture.ResponseSize
+				if capture.BodyUnavailable {
+					info["bodyUnavailable"] = true
+				}
+				if capture.ResponseInferred {
+					info["responseInferred"] = true
+				}
+			}
+			captureInfo = append(captureInfo, info)
+		}
+		export["captures"] = captureInfo
+	}
+	
+	// Infer types by folding every response into one model per top-level key
+	models := make(map[string]*typeModel)
 	for _, capture := range captures {
-		if capture.Response != nil {
-			// Basic type inference from responses
-			if respMap, ok := capture.Response.(map[string]interface{}); ok {
-				for key, value := range respMap {
-					inferredType := inferTypeStructure(value)
-					if inferred, ok := inferredType.(map[string]interface{}); ok {
-						types[key] = inferred
-					} else {
-						types[key] = inferredType
-					}
+		if respMap, ok := capture.Response.(map[string]interface{}); ok {
+			for key, value := range respMap {
+				if models[key] == nil {
+					models[key] = newTypeModel()
 				}
+				models[key].observe(value)
+			}
+		}
+	}
+	types := make(map[string]interface{})
+	for key, model := range models {
+		types[key] = model.export()
+	}
+	for key, value := range inferred {
+		types[key] = mergeInferredType(types[key], value)
+	}
+	
+	// Group error messages by operation and mine field suggestions for types
+	errorsByOp := make(map[string][]string)
+	for _, capture := range captures {
+		if !capture.HasErrors {
+			continue
+		}
+		name := capture.OperationName
+		if name == "" {
+			name = "(anonymous)"
+		}
+		for _, gqlErr := range capture.Errors {
+			message := gqlErr.Message
+			if gqlErr.Code != "" {
+				message = "[" + gqlErr.Code + "] " + message
 			}
+			if !containsString(errorsByOp[name], message) {
+				errorsByOp[name] = append(errorsByOp[name], message)
+			}
+			addSuggestedFields(types, gqlErr.Message)
+		}
+	}
+	
+	if len(errorsByOp) > 0 {
+		export["errors"] = errorsByOp
+	}
+	if codes := summarizeErrorCodes(captures); len(codes) > 0 {
+		counts := make(map[string]int, len(codes))
+		for _, summary := range codes {
+			counts[summary.Code] = summary.Count
 		}
+		export["errorCodes"] = counts
 	}
 	
 	if len(types) > 0 {
@@ -300,10 +1201,86 @@ func ExportToJSON(operations []*GraphQLOperation, captures []GraphQLCapture) ([]
 	return json.MarshalIndent(export, "", "  ")
 }
 
+// fieldSuggestionPattern matches validation errors that leak field names, e.g.
+// Cannot query field "foo" on type "User". Did you mean "food" or "fool"?
+var fieldSuggestionPattern = regexp.MustCompile(`Cannot query field "(\w+)" on type "(\w+)"\.?(?:\s*Did you mean (.+?)\?)?`)
+
+// suggestionPattern matches each quoted field name in the "Did you mean" part
+var suggestionPattern = regexp.MustCompile(`"(\w+)"`)
+
+// addSuggestedFields records field names revealed by a "Did you mean" error in the inferred types
+func addSuggestedFields(types map[string]interface{}, message string) {
+	matches := fieldSuggestionPattern.FindStringSubmatch(message)
+	if len(matches) < 4 || matches[3] == "" {
+		return
+	}
+	
+	typeName := matches[2]
+	typeInfo, ok := types[typeName].(map[string]interface{})
+	if !ok {
+		typeInfo = map[string]interface{}{"type": "Object"}
+		types[typeName] = typeInfo
+	}
+	fields, ok := typeInfo["fields"].(map[string]interface{})
+	if !ok {
+		fields = make(map[string]interface{})
+		typeInfo["fields"] = fields
+	}
+	
+	for _, suggestion := range suggestionPattern.FindAllStringSubmatch(matches[3], -1) {
+		if _, exists := fields[suggestion[1]]; !exists {
+			fields[suggestion[1]] = "Unknown"
+		}
+	}
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// inferScalars enables the ID and DateTime heuristics in inferType and enum candidates
+// in inferred response types
+var inferScalars = true
+
+// omitTimestamps leaves the generated-at lines out of the output files so runs that
+// find the same operations write identical files, set by --no-timestamp
+var omitTimestamps bool
+
+// generatedAtLine returns the line stating when a file was generated, commented with
+// prefix, or nothing when timestamps are omitted
+func generatedAtLine(prefix string) string {
+	if omitTimestamps {
+		return ""
+	}
+	return prefix + "Generated at: " + time.Now().Format(time.RFC3339) + "\n"
+}
+
+var (
+	// UUIDs, Mongo ObjectIDs and numeric strings, which are almost always IDs
+	idValuePattern = regexp.MustCompile(`^(?:[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{24}|[0-9]+)$`)
+	// Values that could be enum members: GraphQL names such as ACTIVE or PUBLISHED
+	enumValuePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+const (
+	enumMinSamples   = 3  // String samples needed before a field can be an enum candidate
+	enumMaxValues    = 10 // Distinct values above which a field is free text, not an enum
+	enumTrackedLimit = 50 // Distinct values remembered per field while observing
+)
+
 // inferType attempts to infer GraphQL type from response data
 func inferType(value interface{}) string {
 	switch v := value.(type) {
 	case string:
+		if inferScalars {
+			return inferStringType(v)
+		}
 		return "String"
 	case float64:
 		if v == float64(int(v)) {
@@ -326,32 +1303,174 @@ func inferType(value interface{}) string {
 	}
 }
 
-// inferTypeStructure attempts to infer detailed type structure from response data
-func inferTypeStructure(value interface{}) interface{} {
+// inferStringType refines a string value to ID or DateTime when its shape says so
+func inferStringType(value string) string {
+	if idValuePattern.MatchString(value) {
+		return "ID"
+	}
+	if _, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return "DateTime"
+	}
+	return "String"
+}
+
+// inferVariableTypes fills in undeclared variable types from captured variable values
+func inferVariableTypes(op *GraphQLOperation, values map[string]interface{}) {
+	if len(values) == 0 {
+		return
+	}
+	if op.Variables == nil {
+		op.Variables = make(map[string]string)
+	}
+	
+	for name, value := range values {
+		if _, declared := op.Variables[name]; declared {
+			continue
+		}
+		typ := inferType(value)
+		if typ == "Null" || typ == "Unknown" {
+			typ = "Any" // Default type
+		}
+		op.Variables[name] = typ
+	}
+}
+
+// typeModel accumulates what every captured response revealed about one field path
+type typeModel struct {
+	kinds        map[string]bool // Observed kinds: String, ID, DateTime, Int, Float, Boolean, Object or List
+	nullable     bool            // Null was seen at least once
+	samples      int             // Values folded into the model
+	fields       map[string]*typeModel
+	elements     *typeModel     // Every element of every list seen
+	stringCounts map[string]int // How often each string value was seen, up to enumTrackedLimit values
+	untracked    bool           // More distinct strings were seen than are tracked
+}
+
+// newTypeModel creates an empty model
+func newTypeModel() *typeModel {
+	return &typeModel{kinds: make(map[string]bool)}
+}
+
+// observe folds one response value into the model
+func (m *typeModel) observe(value interface{}) {
+	m.samples++
+	
 	switch v := value.(type) {
+	case nil:
+		m.nullable = true
 	case map[string]interface{}:
-		fields := make(map[string]interface{})
-		for key, val := range v {
-			fields[key] = inferTypeStructure(val)
+		m.kinds["Object"] = true
+		if m.fields == nil {
+			m.fields = make(map[string]*typeModel)
 		}
-		return map[string]interface{}{
-			"type":   "Object",
-			"fields": fields,
+		for key, val := range v {
+			if m.fields[key] == nil {
+				m.fields[key] = newTypeModel()
+			}
+			m.fields[key].observe(val)
 		}
 	case []interface{}:
-		if len(v) > 0 {
-			return map[string]interface{}{
-				"type": "List",
-				"of":   inferTypeStructure(v[0]),
-			}
+		m.kinds["List"] = true
+		if m.elements == nil {
+			m.elements = newTypeModel()
 		}
-		return map[string]interface{}{
-			"type": "List",
-			"of":   "Unknown",
+		for _, item := range v {
+			m.elements.observe(item)
 		}
+	case string:
+		m.kinds[inferType(v)] = true
+		m.observeString(v)
 	default:
-		return inferType(value)
+		m.kinds[inferType(v)] = true
+	}
+}
+
+// observeString counts a string value for enum detection
+func (m *typeModel) observeString(value string) {
+	if m.untracked {
+		return
+	}
+	if m.stringCounts == nil {
+		m.stringCounts = make(map[string]int)
+	}
+	if _, seen := m.stringCounts[value]; !seen && len(m.stringCounts) == enumTrackedLimit {
+		m.untracked = true
+		m.stringCounts = nil
+		return
 	}
+	m.stringCounts[value]++
+}
+
+// enumValues returns the candidate enum members of a string field: a few distinct
+// name-like values that repeat across samples. It returns nil for anything else.
+func (m *typeModel) enumValues() []string {
+	if !inferScalars || m.untracked || len(m.stringCounts) == 0 || len(m.stringCounts) > enumMaxValues {
+		return nil
+	}
+	total := 0
+	values := make([]string, 0, len(m.stringCounts))
+	for value, count := range m.stringCounts {
+		if !enumValuePattern.MatchString(value) {
+			return nil
+		}
+		total += count
+		values = append(values, value)
+	}
+	if total < enumMinSamples || len(values) == total {
+		return nil
+	}
+	sort.Strings(values)
+	return values
+}
+
+// typeName names the observed kinds, e.g. "String", "Float" for a mix of Int and
+// Float, or "Int|String" when a field was seen with unrelated types
+func (m *typeModel) typeName() string {
+	if len(m.kinds) == 0 {
+		return "Null"
+	}
+	
+	kinds := make([]string, 0, len(m.kinds))
+	for kind := range m.kinds {
+		if kind == "Int" && m.kinds["Float"] {
+			continue
+		}
+		// ID and DateTime are refinements of String; a field that also held other
+		// strings is just a String
+		if (kind == "ID" || kind == "DateTime") && m.kinds["String"] {
+			continue
+		}
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return strings.Join(kinds, "|")
+}
+
+// export converts the model to the structure written under inferredTypes
+func (m *typeModel) export() map[string]interface{} {
+	exported := map[string]interface{}{
+		"type":     m.typeName(),
+		"nullable": m.nullable,
+		"samples":  m.samples,
+	}
+	if values := m.enumValues(); values != nil {
+		exported["enumCandidates"] = values
+	}
+	if m.fields != nil {
+		fields := make(map[string]interface{}, len(m.fields))
+		for key, field := range m.fields {
+			fields[key] = field.export()
+		}
+		exported["fields"] = fields
+	}
+	if m.elements != nil {
+		if m.elements.samples > 0 {
+			exported["of"] = m.elements.export()
+		} else {
+			exported["of"] = "Unknown"
+		}
+	}
+	return exported
 }
 
 // extractOperationSignature creates a signature string for an operation
@@ -363,20 +1482,205 @@ func extractOperationSignature(op *GraphQLOperation) string {
 		sig.WriteString(" " + op.Name)
 	}
 	
+	// Variables are sorted by name so the same operation always yields the same signature
 	if len(op.Variables) > 0 {
-		sig.WriteString("(")
-		first := true
-		for name, typ := range op.Variables {
-			if !first {
-				sig.WriteString(", ")
+		sig.WriteString("(" + variableSignature(op) + ")")
+	}
+	
+	return sig.String()
+}
+
+// endpointURL reduces a request URL to scheme, host and path
+func endpointURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return rawURL
+	}
+	return parsed.Scheme + "://" + parsed.Host + parsed.Path
+}
+
+// summarizeEndpoints aggregates captures per distinct GraphQL endpoint
+func summarizeEndpoints(captures []GraphQLCapture) []EndpointSummary {
+	byURL := make(map[string]*EndpointSummary)
+	subscriptions := make(map[string]map[string]bool)
+	for _, capture := range captures {
+		if capture.SSRState != "" {
+			// Embedded in a page, not sent to an endpoint
+			continue
+		}
+		endpoint := endpointURL(capture.URL)
+		summary, exists := byURL[endpoint]
+		if !exists {
+			summary = &EndpointSummary{URL: endpoint, Operations: []string{}}
+			byURL[endpoint] = summary
+		}
+		
+		summary.RequestCount++
+		if capture.HasErrors {
+			summary.HasErrors = true
+		}
+		if summary.ContentType == "" {
+			summary.ContentType = capture.ContentType
+		}
+		if capture.OperationName != "" && !containsString(summary.Operations, capture.OperationName) {
+			summary.Operations = append(summary.Operations, capture.OperationName)
+		}
+		if captureOperationType(capture.Query) == Subscription {
+			if subscriptions[endpoint] == nil {
+				subscriptions[endpoint] = make(map[string]bool)
 			}
-			sig.WriteString("$" + name + ": " + typ)
-			first = false
+			subscriptions[endpoint][capture.OperationName+"|"+normalizeGraphQL(capture.Query)] = true
 		}
-		sig.WriteString(")")
 	}
 	
-	return sig.String()
+	endpoints := make([]EndpointSummary, 0, len(byURL))
+	for endpoint, summary := range byURL {
+		summary.Subscriptions = len(subscriptions[endpoint])
+		sort.Strings(summary.Operations)
+		endpoints = append(endpoints, *summary)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].URL < endpoints[j].URL
+	})
+	
+	return endpoints
+}
+
+// captureOperationType returns the type of the first operation in a captured query
+// document, or "" when it has none
+func captureOperationType(query string) OperationType {
+	if m := operationStartPattern.FindStringSubmatch(query); m != nil {
+		return OperationType(m[1])
+	}
+	if strings.Contains(query, "{") {
+		return Query
+	}
+	return ""
+}
+
+// assignEndpoints copies endpoints from network-derived operations onto identical static ones
+func assignEndpoints(operations []*GraphQLOperation) {
+	endpoints := make(map[string]string)
+	for _, op := range operations {
+		if op.Endpoint != "" {
+			key := createOperationKey(op)
+			if _, exists := endpoints[key]; !exists {
+				endpoints[key] = op.Endpoint
+			}
+		}
+	}
+	
+	for _, op := range operations {
+		if op.Endpoint == "" {
+			op.Endpoint = endpoints[createOperationKey(op)]
+		}
+	}
+}
+
+// operationsFromCaptures parses the query of each network capture into an operation
+// attributed to the endpoint it was sent to. Queries rebuilt from an Apollo cache are
+// left out, as the app never sends them.
+func operationsFromCaptures(captures []GraphQLCapture) []*GraphQLOperation {
+	var operations []*GraphQLOperation
+	for _, capture := range captures {
+		if capture.Query != "" && !capture.SSRCache {
+			// Only the selected operation of a multi-operation document ran; without an
+			// operationName every operation in it is kept
+			parsed, err := ParseGraphQLOperations(captureDocument(capture))
+			if err != nil {
+				continue
+			}
+			for _, op := range parsed {
+				// Add variables from capture, typed by their runtime values
+				inferVariableTypes(op, capture.Variables)
+				op.Endpoint = endpointURL(capture.URL)
+				op.Source = op.Endpoint
+				if capture.SSRState != "" {
+					op.Endpoint = ""
+					op.Source = capture.PageURL + "#" + capture.SSRState
+				}
+				op.Sources = []string{op.Source}
+				operations = append(operations, op)
+			}
+		}
+	}
+	return operations
+}
+
+// OperationFilter selects operations by type and name
+type OperationFilter struct {
+	Types    map[OperationType]bool // Empty means every type
+	Name     *regexp.Regexp         // Nil means every name
+	MinDepth int                    // Zero means every depth
+}
+
+// Active reports whether the filter excludes anything
+func (f OperationFilter) Active() bool {
+	return len(f.Types) > 0 || f.Name != nil || f.MinDepth > 0
+}
+
+// Match reports whether an operation with the given type and name passes the filter
+func (f OperationFilter) Match(opType OperationType, name string) bool {
+	if len(f.Types) > 0 && !f.Types[opType] {
+		return false
+	}
+	if f.Name != nil && !f.Name.MatchString(name) {
+		return false
+	}
+	return true
+}
+
+// FilterOperations returns the operations that pass the filter
+func (f OperationFilter) FilterOperations(operations []*GraphQLOperation) []*GraphQLOperation {
+	if !f.Active() {
+		return operations
+	}
+	filtered := make([]*GraphQLOperation, 0, len(operations))
+	for _, op := range operations {
+		if f.Match(op.Type, op.Name) && op.Depth >= f.MinDepth {
+			filtered = append(filtered, op)
+		}
+	}
+	return filtered
+}
+
+// FilterCaptures returns the captures whose operation passes the filter
+func (f OperationFilter) FilterCaptures(captures []GraphQLCapture) []GraphQLCapture {
+	if !f.Active() {
+		return captures
+	}
+	filtered := make([]GraphQLCapture, 0, len(captures))
+	for _, capture := range captures {
+		opType := Query
+		depth := 0
+		if op, err := ParseGraphQLOperation(captureDocument(capture)); err == nil {
+			opType = op.Type
+			depth = op.Depth
+		}
+		if f.Match(opType, capture.OperationName) && depth >= f.MinDepth {
+			filtered = append(filtered, capture)
+		}
+	}
+	return filtered
+}
+
+// validateOperations runs each operation through a spec-compliant GraphQL parser, marking
+// the ones that parse as Valid. It returns the valid operations and the number dropped.
+func validateOperations(operations []*GraphQLOperation) ([]*GraphQLOperation, int) {
+	valid := make([]*GraphQLOperation, 0, len(operations))
+	invalid := 0
+	
+	for _, op := range operations {
+		if _, err := gqlparser.ParseQuery(&gqlast.Source{Input: op.Raw}); err != nil {
+			invalid++
+			slog.Info("Dropping invalid operation", "type", op.Type, "name", op.Name, "error", err)
+			continue
+		}
+		op.Valid = true
+		valid = append(valid, op)
+	}
+	
+	return valid, invalid
 }
 
 // countOperationType counts operations of a specific type
@@ -390,94 +1694,309 @@ func countOperationType(operations []*GraphQLOperation, opType OperationType) in
 	return count
 }
 
+// sortOperations orders operations by type, then name, then the hash of their canonical
+// body, so every run over the same operations writes identical files whatever order
+// they were found in. Operations equal in all three fall back to their normalized text.
+func sortOperations(operations []*GraphQLOperation) {
+	typeOrder := map[OperationType]int{Query: 0, Mutation: 1, Subscription: 2}
+	hashes := make(map[*GraphQLOperation]string, len(operations))
+	for _, op := range operations {
+		hashes[op] = canonicalHash(op)
+	}
+	sort.SliceStable(operations, func(i, j int) bool {
+		a, b := operations[i], operations[j]
+		if typeOrder[a.Type] != typeOrder[b.Type] {
+			return typeOrder[a.Type] < typeOrder[b.Type]
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if hashes[a] != hashes[b] {
+			return hashes[a] < hashes[b]
+		}
+		return createOperationKey(a) < createOperationKey(b)
+	})
+}
+
 // DeduplicateOperations removes duplicate GraphQL operations based on their content
 func DeduplicateOperations(operations []*GraphQLOperation) []*GraphQLOperation {
-	seen := make(map[string]bool)
+	unique, _ := DeduplicateOperationsWithCounts(operations)
+	return unique
+}
+
+// DeduplicateOperationsWithCounts removes duplicates like DeduplicateOperations and also
+// returns how many times each canonical operation key occurred
+func DeduplicateOperationsWithCounts(operations []*GraphQLOperation) ([]*GraphQLOperation, map[string]int) {
+	seen := make(map[string]int) // Canonical hash -> index in unique
 	unique := make([]*GraphQLOperation, 0)
+	counts := make(map[string]int)
 	
 	for _, op := range operations {
-		// Create a unique key based on the operation's content
-		key := createOperationKey(op)
+		// Operations with the same canonical document are duplicates
+		key := canonicalHash(op)
+		counts[key]++
 		
-		if !seen[key] {
-			seen[key] = true
+		if i, exists := seen[key]; exists {
+			// The copy found at the lowest source is kept, so the choice does not
+			// depend on the order the --workers finished files in
+			kept, duplicate := unique[i], op
+			if foundBefore(op, kept) {
+				kept, duplicate = op, kept
+			}
+			kept.Sources = appendUnique(kept.Sources, duplicate.Sources...)
+			kept.Inputs = appendUnique(kept.Inputs, duplicate.Inputs...)
+			kept.Variables = reconcileVariables(kept.Variables, duplicate.Variables)
+			unique[i] = kept
+		} else {
+			seen[key] = len(unique)
 			unique = append(unique, op)
 		}
 	}
+	for _, op := range unique {
+		sort.Strings(op.Sources)
+	}
 	
-	return unique
+	return unique, counts
 }
 
-// createOperationKey creates a unique key for an operation to detect duplicates
-func createOperationKey(op *GraphQLOperation) string {
-	// Normalize the raw operation for comparison
-	normalized := normalizeGraphQL(op.Raw)
+// foundBefore orders copies of an operation by where they were found: by source, then
+// position in it, then text. Copies without a source come last.
+func foundBefore(a, b *GraphQLOperation) bool {
+	if a.Source != b.Source {
+		return b.Source == "" || (a.Source != "" && a.Source < b.Source)
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	if a.Offset != b.Offset {
+		return a.Offset < b.Offset
+	}
+	return a.Raw < b.Raw
+}
+
+// MergeOperationsByName collapses named operations of the same type into a single entry,
+// keeping the most complete selection set and the richest types for its variables
+func MergeOperationsByName(operations []*GraphQLOperation) []*GraphQLOperation {
+	groups := make(map[string][]*GraphQLOperation)
+	var order []string
+	for _, op := range operations {
+		key := string(op.Type) + "|" + op.Name
+		if op.Name == "" {
+			key = createOperationKey(op)
+		}
+		if _, exists := groups[key]; !exists {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], op)
+	}
 	
-	// If raw is empty, create key from components
-	if normalized == "" {
-		var key strings.Builder
-		key.WriteString(string(op.Type))
-		key.WriteString("|")
-		key.WriteString(op.Name)
-		key.WriteString("|")
+	merged := make([]*GraphQLOperation, 0, len(order))
+	for _, key := range order {
+		group := groups[key]
+		if len(group) == 1 {
+			merged = append(merged, group[0])
+			continue
+		}
 		
-		// Sort variables for consistent key
-		if len(op.Variables) > 0 {
-			varKeys := make([]string, 0, len(op.Variables))
-			for k := range op.Variables {
-				varKeys = append(varKeys, k)
-			}
-			// Simple string sort
-			for i := range varKeys {
-				for j := i + 1; j < len(varKeys); j++ {
-					if varKeys[i] > varKeys[j] {
-						varKeys[i], varKeys[j] = varKeys[j], varKeys[i]
-					}
-				}
+		bestSelection, first := group[0], group[0]
+		var sources []string
+		for _, op := range group {
+			size, best := selectionSize(op), selectionSize(bestSelection)
+			if size > best || (size == best && foundBefore(op, bestSelection)) {
+				bestSelection = op
 			}
-			
-			for _, k := range varKeys {
-				key.WriteString(k)
-				key.WriteString(":")
-				key.WriteString(op.Variables[k])
-				key.WriteString(",")
+			if foundBefore(op, first) {
+				first = op
 			}
+			sources = appendUnique(sources, op.Sources...)
 		}
+		sort.Strings(sources)
 		
-		// Sort fields for consistent key
-		fields := make([]string, len(op.Fields))
-		copy(fields, op.Fields)
-		for i := range fields {
-			for j := i + 1; j < len(fields); j++ {
-				if fields[i] > fields[j] {
-					fields[i], fields[j] = fields[j], fields[i]
+		// Only the variables the kept document declares are reconciled, so the exports
+		// never list a variable its text lacks
+		result := *bestSelection
+		for _, op := range group {
+			result.Variables = reconcileVariables(result.Variables, declaredIn(op.Variables, bestSelection.Variables))
+		}
+		result.Source, result.Line, result.Offset = first.Source, first.Line, first.Offset
+		result.Sources = sources
+		if result.Endpoint == "" {
+			for _, op := range group {
+				if op.Endpoint != "" {
+					result.Endpoint = op.Endpoint
+					break
 				}
 			}
 		}
-		
-		for _, field := range fields {
-			key.WriteString("|")
-			key.WriteString(field)
+		merged = append(merged, &result)
+	}
+	
+	return merged
+}
+
+// reconcileVariables combines the variable types two copies of an operation declare or
+// had inferred, keeping the more specific type where they disagree. Ties keep a's type.
+func reconcileVariables(a, b map[string]string) map[string]string {
+	if len(b) == 0 {
+		return a
+	}
+	reconciled := make(map[string]string, len(a)+len(b))
+	for name, typ := range a {
+		reconciled[name] = typ
+	}
+	for name, typ := range b {
+		if current, ok := reconciled[name]; !ok || variableTypeRank(typ) > variableTypeRank(current) {
+			reconciled[name] = typ
+		}
+	}
+	return reconciled
+}
+
+// variableTypeRank scores how specific a variable type is: Any ranks lowest, shapes
+// inferred without a type name next, and non-null types above nullable ones
+func variableTypeRank(typ string) int {
+	if typ == "" || typ == "Any" {
+		return 0
+	}
+	rank := 1
+	switch strings.TrimSuffix(typ, "!") {
+	case "Object", "Unknown", "[Unknown]", "Null":
+	default:
+		rank++
+	}
+	if strings.HasSuffix(typ, "!") {
+		rank++
+	}
+	return rank
+}
+
+// selectionSize estimates how complete an operation's selection set is
+func selectionSize(op *GraphQLOperation) int {
+	return len(normalizeGraphQL(op.Raw)) + len(op.Fields)
+}
+
+// declaredIn returns the variables of vars that declared also has
+func declaredIn(vars, declared map[string]string) map[string]string {
+	kept := make(map[string]string, len(vars))
+	for name, typ := range vars {
+		if _, ok := declared[name]; ok {
+			kept[name] = typ
+		}
+	}
+	return kept
+}
+
+// appendUnique appends values that are not already present in list
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		if !containsString(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// createOperationKey creates a unique key for an operation to detect duplicates
+func createOperationKey(op *GraphQLOperation) string {
+	// Operations with text are compared on their canonical document
+	if strings.TrimSpace(op.Raw) != "" {
+		return canonicalHash(op)
+	}
+	
+	// Otherwise, create key from components
+	var key strings.Builder
+	key.WriteString(string(op.Type))
+	key.WriteString("|")
+	key.WriteString(op.Name)
+	key.WriteString("|")
+	
+	// Sort variables for consistent key
+	if len(op.Variables) > 0 {
+		varKeys := make([]string, 0, len(op.Variables))
+		for k := range op.Variables {
+			varKeys = append(varKeys, k)
+		}
+		// Simple string sort
+		for i := range varKeys {
+			for j := i + 1; j < len(varKeys); j++ {
+				if varKeys[i] > varKeys[j] {
+					varKeys[i], varKeys[j] = varKeys[j], varKeys[i]
+				}
+			}
 		}
 		
-		return key.String()
+		for _, k := range varKeys {
+			key.WriteString(k)
+			key.WriteString(":")
+			key.WriteString(op.Variables[k])
+			key.WriteString(",")
+		}
 	}
 	
-	return normalized
+	// Sort fields for consistent key
+	fields := make([]string, len(op.Fields))
+	copy(fields, op.Fields)
+	for i := range fields {
+		for j := i + 1; j < len(fields); j++ {
+			if fields[i] > fields[j] {
+				fields[i], fields[j] = fields[j], fields[i]
+			}
+		}
+	}
+	
+	for _, field := range fields {
+		key.WriteString("|")
+		key.WriteString(field)
+	}
+	
+	return key.String()
 }
 
 // normalizeGraphQL normalizes a GraphQL operation string for comparison
 func normalizeGraphQL(query string) string {
-	// Remove comments
-	commentPattern := regexp.MustCompile(`#[^\n]*`)
-	query = commentPattern.ReplaceAllString(query, "")
-	
-	// Normalize whitespace
-	query = strings.TrimSpace(query)
-	query = regexp.MustCompile(`\s+`).ReplaceAllString(query, " ")
-	
-	// Remove spaces around punctuation
-	query = regexp.MustCompile(`\s*([\{\}\(\)\[\]:,])\s*`).ReplaceAllString(query, "$1")
-	
-	return query
+	// Print parseable queries canonically so formatting differences do not matter. Text
+	// that does not parse is compacted as it is.
+	if printed, err := printGraphQL(query); err == nil {
+		query = printed
+	}
+	return compactGraphQL(query)
+}
+
+// compactGraphQL drops # comments, collapses whitespace to single spaces and removes the
+// spaces around punctuation. String literals are copied unchanged, so a # or brace
+// inside one is not mistaken for a comment or punctuation.
+func compactGraphQL(query string) string {
+	var out strings.Builder
+	pendingSpace := false
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			pendingSpace = true
+			i++
+			continue
+		case '#':
+			for i < len(query) && query[i] != '\n' && query[i] != '\r' {
+				i++
+			}
+			pendingSpace = true
+			continue
+		}
+		if pendingSpace && out.Len() > 0 && !isCompactPunct(out.String()[out.Len()-1]) && !isCompactPunct(c) {
+			out.WriteByte(' ')
+		}
+		pendingSpace = false
+		end := i + 1
+		if c == '"' {
+			end = skipGraphQLString(query, i)
+		}
+		out.WriteString(query[i:end])
+		i = end
+	}
+	return out.String()
+}
+
+// isCompactPunct reports whether compactGraphQL removes the spaces around c
+func isCompactPunct(c byte) bool {
+	return strings.IndexByte("{}()[]:,", c) >= 0
 }
\ No newline at end of file
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// largeBundle builds a minified-looking bundle of n operations among filler code, about
+// 3 KB per operation. Each is written both as a plain literal and as a gql template.
+func largeBundle(n int) string {
+	var b strings.Builder
+	filler := strings.Repeat(`function r(e,t){return e.query(t)||{a:1,b:[2,3]}}var o=this.query;`, 40)
+	for i := 0; i < n; i++ {
+		op := fmt.Sprintf("query Op%d($id: ID!, $first: Int = 10) { node(id: $id) { ... on User { name friends(first: $first) { edges { node { id name } } } } } }", i)
+		fmt.Fprintf(&b, "var q%d=%q;", i, op)
+		fmt.Fprintf(&b, "var t%d=gql`%s`;", i, op)
+		b.WriteString(filler)
+	}
+	return b.String()
+}
+
+func TestExtractOperationsOncePerFile(t *testing.T) {
+	operations, err := ExtractOperationsFromJS(largeBundle(50), "bundle.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(operations) != 50 {
+		t.Fatalf("found %d operations, want each of the 50 once", len(operations))
+	}
+	for i, op := range operations {
+		if want := fmt.Sprintf("Op%d", i); op.Name != want || op.Source != "bundle.js" {
+			t.Errorf("operation %d = (%s, %s), want (%s, bundle.js)", i, op.Name, op.Source, want)
+		}
+	}
+}
+
+func TestExtractOperationsLines(t *testing.T) {
+	content := "query First { a }\nvar x=1;\nvar q=\"mutation\\u0020Save { save }\";"
+	operations, err := ExtractOperationsFromJS(content, "bundle.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make(map[string]int)
+	for _, op := range operations {
+		lines[op.Name] = op.Line
+	}
+	// The first operation starts at offset 0; the decoded one is placed at its literal
+	if want := map[string]int{"First": 1, "Save": 3}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines = %v, want %v", lines, want)
+	}
+}
+
+// BenchmarkExtractOperationsFromJS scans a bundle of about 1.5 MB
+func BenchmarkExtractOperationsFromJS(b *testing.B) {
+	bundle := largeBundle(500)
+	b.SetBytes(int64(len(bundle)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ExtractOperationsFromJS(bundle, "bundle.js"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestExportToJSONSchemaCheck(t *testing.T) {
+	inSchema, notInSchema := true, false
+	operations := []*GraphQLOperation{
+		{Type: Query, Name: "Known", Raw: "query Known { a }", InSchema: &inSchema},
+		{Type: Query, Name: "Unknown", Raw: "query Unknown { a b }", InSchema: &notInSchema, UnknownFields: []string{"b"}},
+		{Type: Query, Name: "Unchecked", Raw: "query Unchecked { a }"},
+	}
+	data, err := ExportToJSON(operations, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var export struct {
+		Operations []map[string]interface{} `json:"operations"`
+	}
+	if err := json.Unmarshal(data, &export); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		inSchema interface{}
+		unknown  interface{}
+	}{
+		{true, nil},
+		{false, []interface{}{"b"}},
+		{nil, nil},
+	}
+	for i, tt := range tests {
+		op := export.Operations[i]
+		if !reflect.DeepEqual(op["inSchema"], tt.inSchema) || !reflect.DeepEqual(op["unknownFields"], tt.unknown) {
+			t.Errorf("%s: inSchema = %v, unknownFields = %v, want %v and %v", op["name"], op["inSchema"], op["unknownFields"], tt.inSchema, tt.unknown)
+		}
+	}
+}
+
+func TestExportToJSONNoTimestampOmitsTimings(t *testing.T) {
+	defer func(saved bool) { omitTimestamps = saved }(omitTimestamps)
+	files := []*FileStats{{URL: "https://example.com/app.js", Size: 10, DownloadMs: 12.5, Matches: 1}}
+
+	for _, omit := range []bool{false, true} {
+		omitTimestamps = omit
+		data, err := ExportToJSON(nil, nil, files, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var export struct {
+			Files []map[string]interface{} `json:"files"`
+		}
+		if err := json.Unmarshal(data, &export); err != nil {
+			t.Fatal(err)
+		}
+		if len(export.Files) != 1 || export.Files[0]["size"] != 10.0 {
+			t.Fatalf("files = %v, want the app.js stats", export.Files)
+		}
+		if _, timed := export.Files[0]["downloadMs"]; timed == omit {
+			t.Errorf("with omitTimestamps %v, files = %v", omit, export.Files)
+		}
+	}
+
+	// omitTimestamps is still set by the last iteration
+	if report := ExportToMarkdown(nil, nil, "", time.Now().Add(-time.Minute)); strings.Contains(report, "Session duration") {
+		t.Error("--no-timestamp report still has the session duration")
+	}
+}
+
+func TestMergeOperationsByNameKeepsDeclaredVariables(t *testing.T) {
+	operations := []*GraphQLOperation{
+		{Type: Query, Name: "GetUser", Raw: "query GetUser($id: String) { user(id: $id) { id name email avatar createdAt } }",
+			Variables: map[string]string{"id": "String"}, Sources: []string{"app.js"}},
+		{Type: Query, Name: "GetUser", Raw: "query GetUser($id: ID!, $locale: String) { user(id: $id) { id } }",
+			Variables: map[string]string{"id": "ID!", "locale": "String"}, VariableDefaults: map[string]string{"locale": `"en"`}, Sources: []string{"capture"}},
+	}
+	merged := MergeOperationsByName(operations)
+	if len(merged) != 1 {
+		t.Fatalf("got %d operations, want 1", len(merged))
+	}
+	op := merged[0]
+	if op.Raw != operations[0].Raw {
+		t.Errorf("Raw = %q, want the most complete selection", op.Raw)
+	}
+	// $locale is not declared by the kept document; $id takes the more specific type
+	if want := map[string]string{"id": "ID!"}; !reflect.DeepEqual(op.Variables, want) {
+		t.Errorf("Variables = %v, want %v", op.Variables, want)
+	}
+	if len(op.VariableDefaults) != 0 {
+		t.Errorf("VariableDefaults = %v, want none", op.VariableDefaults)
+	}
+	if want := []string{"app.js", "capture"}; !reflect.DeepEqual(op.Sources, want) {
+		t.Errorf("Sources = %v, want %v", op.Sources, want)
+	}
+}
+
+func TestUnquoteJSLiteral(t *testing.T) {
+	tests := []struct {
+		name    string
+		literal string
+		want    string
+		ok      bool
+	}{
+		{"double quoted", `"query A { a }"`, "query A { a }", true},
+		{"unicode escapes", `"query\u0020A\u0020{ a }"`, "query A { a }", true},
+		{"hex escapes", `"query\x20A"`, "query A", true},
+		{"escaped slash", `"a\/b"`, "a/b", true},
+		{"single quoted with double quotes", `'query A { a(s: "x") }'`, `query A { a(s: "x") }`, true},
+		{"single quoted with escaped quote", `'it\'s'`, "it's", true},
+		{"single quoted with escaped double quote", `'say \"hi\"'`, `say "hi"`, true},
+		{"newline escape", `"query A {\n a }"`, "query A {\n a }", true},
+		{"bad escape", `"\q"`, "", false},
+		{"truncated unicode escape", `"\u00"`, "", false},
+		{"too short", `"`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := unquoteJSLiteral(tt.literal)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("unquoteJSLiteral(%s) = %q, %v; want %q, %v", tt.literal, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDecodeEmbeddedStrings(t *testing.T) {
+	const query = "query GetUser($id: ID!) { user(id: $id) { id name } }"
+	encoded := base64.StdEncoding.EncodeToString([]byte(query))
+	binary := base64.StdEncoding.EncodeToString(append([]byte("query \x00\x01"), bytes.Repeat([]byte{0xff}, 40)...))
+
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"unicode escaped literal", `var q="query\u0020GetUser($id:\u0020ID!)\u0020{ user(id: $id) { id } }";`,
+			[]string{"query GetUser($id: ID!) { user(id: $id) { id } }"}},
+		{"single quoted hex escapes", `q='mutation\x20Save { save }'`, []string{"mutation Save { save }"}},
+		{"escaped literal without an operation", `var s="café au lait";`, nil},
+		{"base64 in double quotes", `var d="` + encoded + `";`, []string{query}},
+		{"base64 in a template literal", "var d=`" + encoded + "`;", []string{query}},
+		{"unpadded base64", `var d="` + strings.TrimRight(encoded, "=") + `";`, []string{query}},
+		{"base64 of binary", `var d="` + binary + `";`, nil},
+		{"base64 without an operation", `var d="` + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("plain text ", 8))) + `";`, nil},
+		{"short base64", `var d="cXVlcnkgQSB7IGEgfQ==";`, nil},
+		{"plain literal", `var q="query A { a }";`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := decodeEmbeddedStrings(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeEmbeddedStrings = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTypeModel(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []interface{}
+		want    map[string]interface{}
+	}{
+		{"never seen", nil, map[string]interface{}{"type": "Null", "nullable": false, "samples": 0}},
+		{"null then string", []interface{}{nil, "Ada"},
+			map[string]interface{}{"type": "String", "nullable": true, "samples": 2}},
+		{"always set", []interface{}{1.0, 2.0},
+			map[string]interface{}{"type": "Int", "nullable": false, "samples": 2}},
+		{"int and float widen to float", []interface{}{1.0, 2.5},
+			map[string]interface{}{"type": "Float", "nullable": false, "samples": 2}},
+		{"unrelated kinds", []interface{}{"a b", true},
+			map[string]interface{}{"type": "Boolean|String", "nullable": false, "samples": 2}},
+		{"ID mixed with text is a string", []interface{}{"42", "not an id"},
+			map[string]interface{}{"type": "String", "nullable": false, "samples": 2}},
+		{"every list element counts", []interface{}{[]interface{}{1.0, nil}, []interface{}{2.5}},
+			map[string]interface{}{"type": "List", "nullable": false, "samples": 2,
+				"of": map[string]interface{}{"type": "Float", "nullable": true, "samples": 3}}},
+		{"empty lists", []interface{}{[]interface{}{}},
+			map[string]interface{}{"type": "List", "nullable": false, "samples": 1, "of": "Unknown"}},
+		{"object fields fold across samples", []interface{}{
+			map[string]interface{}{"id": "1", "bio": nil},
+			map[string]interface{}{"id": "2", "bio": "hi there"},
+		}, map[string]interface{}{"type": "Object", "nullable": false, "samples": 2, "fields": map[string]interface{}{
+			"id":  map[string]interface{}{"type": "ID", "nullable": false, "samples": 2},
+			"bio": map[string]interface{}{"type": "String", "nullable": true, "samples": 2},
+		}}},
+		{"repeated names are enum candidates", []interface{}{"ACTIVE", "ACTIVE", "BANNED"},
+			map[string]interface{}{"type": "String", "nullable": false, "samples": 3, "enumCandidates": []string{"ACTIVE", "BANNED"}}},
+		{"distinct names are not enums", []interface{}{"ACTIVE", "BANNED", "PENDING"},
+			map[string]interface{}{"type": "String", "nullable": false, "samples": 3}},
+		{"too few samples for an enum", []interface{}{"ACTIVE", "ACTIVE"},
+			map[string]interface{}{"type": "String", "nullable": false, "samples": 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := newTypeModel()
+			for _, sample := range tt.samples {
+				model.observe(sample)
+			}
+			if got := model.export(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("export = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInferStringType(t *testing.T) {
+	defer func(saved bool) { inferScalars = saved }(inferScalars)
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"3f2504e0-4f89-11d3-9a0c-0305e82c3301", "ID"},
+		{"3F2504E0-4F89-11D3-9A0C-0305E82C3301", "ID"},
+		{"507f1f77bcf86cd799439011", "ID"},
+		{"12345", "ID"},
+		{"2024-01-02T03:04:05Z", "DateTime"},
+		{"2024-01-02T03:04:05.123+02:00", "DateTime"},
+		{"2024-01-02", "String"},
+		{"3f2504e0-4f89-11d3-9a0c", "String"},
+		{"12.5", "String"},
+		{"-1", "String"},
+		{"", "String"},
+		{"Ada Lovelace", "String"},
+	}
+	for _, tt := range tests {
+		if got := inferStringType(tt.value); got != tt.want {
+			t.Errorf("inferStringType(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+
+	// With the heuristics off every string is a String
+	inferScalars = false
+	if got := inferType("12345"); got != "String" {
+		t.Errorf("inferType without heuristics = %s, want String", got)
+	}
+}
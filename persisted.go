@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"sort"
+)
+
+// PersistedQueryManifest is the Apollo "apollo-persisted-query-manifest" document
+type PersistedQueryManifest struct {
+	Format     string           `json:"format"`
+	Version    int              `json:"version"`
+	Operations []PersistedQuery `json:"operations"`
+}
+
+// PersistedQuery is a single manifest entry keyed by the sha256 of its body
+type PersistedQuery struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Body string `json:"body"`
+}
+
+// PersistedHashMismatch records a captured APQ hash that differs from the one we computed
+type PersistedHashMismatch struct {
+	OperationName string `json:"operationName"`
+	Captured      string `json:"captured"`
+	Computed      string `json:"computed"`
+}
+
+// ExportToPersistedManifest builds both Apollo manifest shapes for the given operations:
+// the legacy {sha256: query} map and the versioned operations list
+func ExportToPersistedManifest(operations []*GraphQLOperation) (map[string]string, PersistedQueryManifest) {
+	legacy := make(map[string]string)
+	manifest := PersistedQueryManifest{
+		Format:     "apollo-persisted-query-manifest",
+		Version:    1,
+		Operations: []PersistedQuery{},
+	}
+
+	for _, op := range operations {
+		body := canonicalQuery(op.Raw)
+		id := persistedQueryHash(body)
+		if _, exists := legacy[id]; exists {
+			continue
+		}
+		legacy[id] = body
+		manifest.Operations = append(manifest.Operations, PersistedQuery{
+			ID:   id,
+			Name: op.Name,
+			Type: string(op.Type),
+			Body: body,
+		})
+	}
+
+	sort.Slice(manifest.Operations, func(i, j int) bool {
+		if manifest.Operations[i].Name != manifest.Operations[j].Name {
+			return manifest.Operations[i].Name < manifest.Operations[j].Name
+		}
+		return manifest.Operations[i].ID < manifest.Operations[j].ID
+	})
+
+	return legacy, manifest
+}
+
+// canonicalQuery prints a query the way Apollo clients do before hashing it, falling back
+// to whitespace normalization when the document does not parse
+func canonicalQuery(query string) string {
+	printed, err := printGraphQL(query)
+	if err != nil {
+		return normalizeGraphQL(query)
+	}
+	return printed
+}
+
+// persistedQueryHash returns the hex sha256 Apollo uses as a persisted query ID
+func persistedQueryHash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkPersistedHashes compares APQ hashes seen on the wire with our own. Captures that
+// carried the query text are hashed directly; hash-only captures, which the capture
+// paths keep for this, are matched by operation name.
+func checkPersistedHashes(manifest PersistedQueryManifest, captures []GraphQLCapture) []PersistedHashMismatch {
+	byName := make(map[string]string)
+	for _, entry := range manifest.Operations {
+		if entry.Name != "" {
+			byName[entry.Name] = entry.ID
+		}
+	}
+
+	var mismatches []PersistedHashMismatch
+	seen := make(map[string]bool)
+	for _, capture := range captures {
+		if capture.PersistedQueryHash == "" {
+			continue
+		}
+
+		var computed string
+		if capture.Query != "" {
+			computed = persistedQueryHash(canonicalQuery(capture.Query))
+		} else if id, ok := byName[capture.OperationName]; ok {
+			computed = id
+		} else {
+			continue
+		}
+
+		key := capture.PersistedQueryHash + "|" + computed
+		if computed == capture.PersistedQueryHash || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		mismatches = append(mismatches, PersistedHashMismatch{
+			OperationName: capture.OperationName,
+			Captured:      capture.PersistedQueryHash,
+			Computed:      computed,
+		})
+		slog.Warn("Persisted query hash mismatch", "operation", capture.OperationName,
+			"captured", capture.PersistedQueryHash, "computed", computed)
+	}
+
+	return mismatches
+}
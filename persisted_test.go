@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mafredri/cdp/protocol/network"
+)
+
+func TestCheckPersistedHashes(t *testing.T) {
+	op, err := ParseGraphQLOperation("query GetUser($id: ID!) { user(id: $id) { name } }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, manifest := ExportToPersistedManifest([]*GraphQLOperation{op})
+	id := manifest.Operations[0].ID
+	const other = "0000000000000000000000000000000000000000000000000000000000000000"
+
+	tests := []struct {
+		name     string
+		capture  GraphQLCapture
+		mismatch bool
+	}{
+		{"query and matching hash", GraphQLCapture{Query: op.Raw, OperationName: "GetUser", PersistedQueryHash: id}, false},
+		{"query and other hash", GraphQLCapture{Query: op.Raw, OperationName: "GetUser", PersistedQueryHash: other}, true},
+		{"hash only, matching", GraphQLCapture{OperationName: "GetUser", PersistedQueryHash: id}, false},
+		{"hash only, other", GraphQLCapture{OperationName: "GetUser", PersistedQueryHash: other}, true},
+		{"hash only, unknown name", GraphQLCapture{OperationName: "Unknown", PersistedQueryHash: other}, false},
+		{"no hash", GraphQLCapture{Query: op.Raw, OperationName: "GetUser"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mismatches := checkPersistedHashes(manifest, []GraphQLCapture{tt.capture})
+			if (len(mismatches) > 0) != tt.mismatch {
+				t.Errorf("mismatches = %+v, want mismatch %v", mismatches, tt.mismatch)
+			}
+			if tt.mismatch && mismatches[0].Computed != id {
+				t.Errorf("computed = %s, want %s", mismatches[0].Computed, id)
+			}
+		})
+	}
+}
+
+func TestHashOnlyCaptureKept(t *testing.T) {
+	// Apollo's first APQ attempt sends the hash without the query text
+	body := `{"operationName":"GetUser","variables":{"id":"1"},"extensions":{"persistedQuery":{"version":1,"sha256Hash":"abc123"}}}`
+	capture := newCapture(&network.Request{
+		URL:      "https://example.com/graphql",
+		Method:   "POST",
+		Headers:  network.Headers(`{"Content-Type":"application/json"}`),
+		PostData: &body,
+	})
+	if capture.Query != "" || capture.PersistedQueryHash != "abc123" || capture.OperationName != "GetUser" {
+		t.Fatalf("capture = (%q, %q, %q)", capture.Query, capture.PersistedQueryHash, capture.OperationName)
+	}
+	if !identifiesOperation(capture) {
+		t.Error("hash-only capture would be dropped")
+	}
+	if identifiesOperation(GraphQLCapture{OperationName: "GetUser"}) {
+		t.Error("capture with neither query nor hash would be kept")
+	}
+}
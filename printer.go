@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	gqlast "github.com/vektah/gqlparser/v2/ast"
+)
+
+// maxPrintLineLength matches graphql-js, which wraps field arguments past this width
+const maxPrintLineLength = 80
+
+// printGraphQL renders a query in the canonical form produced by graphql-js print(),
+// which Apollo clients hash for persisted queries
+func printGraphQL(query string) (string, error) {
+	doc, err := parseGraphQLDocument(query)
+	if err != nil {
+		return "", err
+	}
+	return printDocument(doc), nil
+}
+
+// printDocument renders every definition in source order, separated by a blank line.
+// Definitions built rather than parsed have no position and follow the others.
+func printDocument(doc *gqlast.QueryDocument) string {
+	type printed struct {
+		start int
+		text  string
+	}
+	definitions := make([]printed, 0, len(doc.Operations)+len(doc.Fragments))
+	for _, def := range doc.Operations {
+		definitions = append(definitions, printed{positionStart(def.Position), printOperation(def)})
+	}
+	for _, def := range doc.Fragments {
+		definitions = append(definitions, printed{positionStart(def.Position), printFragment(def)})
+	}
+	sort.SliceStable(definitions, func(i, j int) bool {
+		return definitions[i].start < definitions[j].start
+	})
+
+	parts := make([]string, len(definitions))
+	for i, def := range definitions {
+		parts[i] = def.text
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// positionStart returns where a parsed node starts, or past any parsed node when unset
+func positionStart(pos *gqlast.Position) int {
+	if pos == nil {
+		return math.MaxInt
+	}
+	return pos.Start
+}
+
+func printOperation(def *gqlast.OperationDefinition) string {
+	prefix := joinPrint([]string{
+		string(def.Operation),
+		joinPrint([]string{def.Name, wrapPrint("(", printVariableDefinitions(def.VariableDefinitions), ")")}, ""),
+		printDirectives(def.Directives),
+	}, " ")
+	if prefix == "query" {
+		return printSelectionSet(def.SelectionSet)
+	}
+	return prefix + " " + printSelectionSet(def.SelectionSet)
+}
+
+func printFragment(def *gqlast.FragmentDefinition) string {
+	return "fragment " + def.Name + wrapPrint("(", printVariableDefinitions(def.VariableDefinition), ")") +
+		" on " + def.TypeCondition + " " + wrapPrint("", printDirectives(def.Directives), " ") +
+		printSelectionSet(def.SelectionSet)
+}
+
+func printVariableDefinitions(defs gqlast.VariableDefinitionList) string {
+	parts := make([]string, len(defs))
+	for i, v := range defs {
+		parts[i] = "$" + v.Variable + ": " + v.Type.String() + wrapPrint(" = ", printValue(v.DefaultValue), "") +
+			wrapPrint(" ", printDirectives(v.Directives), "")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func printSelectionSet(selections gqlast.SelectionSet) string {
+	if len(selections) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(selections))
+	for _, selection := range selections {
+		parts = append(parts, printSelection(selection))
+	}
+	return "{\n" + indentPrint(strings.Join(parts, "\n")) + "\n}"
+}
+
+func printSelection(selection gqlast.Selection) string {
+	switch s := selection.(type) {
+	case *gqlast.FragmentSpread:
+		return "..." + s.Name + wrapPrint(" ", printDirectives(s.Directives), "")
+	case *gqlast.InlineFragment:
+		return joinPrint([]string{
+			"...",
+			wrapPrint("on ", s.TypeCondition, ""),
+			printDirectives(s.Directives),
+			printSelectionSet(s.SelectionSet),
+		}, " ")
+	case *gqlast.Field:
+		// The parser sets Alias to the field name when there is no alias
+		prefix := s.Name
+		if s.Alias != "" && s.Alias != s.Name {
+			prefix = s.Alias + ": " + s.Name
+		}
+		args := printArguments(s.Arguments)
+		argsLine := prefix + wrapPrint("(", strings.Join(args, ", "), ")")
+		if len(argsLine) > maxPrintLineLength {
+			argsLine = prefix + wrapPrint("(\n", indentPrint(strings.Join(args, "\n")), "\n)")
+		}
+		return joinPrint([]string{argsLine, printDirectives(s.Directives), printSelectionSet(s.SelectionSet)}, " ")
+	}
+	return ""
+}
+
+func printArguments(args gqlast.ArgumentList) []string {
+	parts := make([]string, 0, len(args))
+	for _, arg := range args {
+		parts = append(parts, arg.Name+": "+printValue(arg.Value))
+	}
+	return parts
+}
+
+func printDirectives(directives gqlast.DirectiveList) string {
+	parts := make([]string, 0, len(directives))
+	for _, d := range directives {
+		parts = append(parts, "@"+d.Name+wrapPrint("(", strings.Join(printArguments(d.Arguments), ", "), ")"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// printValue renders a value as graphql-js does, or "" for a missing one
+func printValue(v *gqlast.Value) string {
+	if v == nil {
+		return ""
+	}
+	switch v.Kind {
+	case gqlast.Variable:
+		return "$" + v.Raw
+	case gqlast.StringValue:
+		return printString(v.Raw)
+	case gqlast.BlockValue:
+		return printBlockString(v.Raw)
+	case gqlast.ListValue:
+		values := make([]string, len(v.Children))
+		for i, child := range v.Children {
+			values[i] = printValue(child.Value)
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	case gqlast.ObjectValue:
+		fields := make([]string, len(v.Children))
+		for i, child := range v.Children {
+			fields[i] = child.Name + ": " + printValue(child.Value)
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+	return v.Raw
+}
+
+// printString quotes a string value, escaping quotes, backslashes and control characters
+func printString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || (r >= 0x7f && r <= 0x9f) {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// printBlockString renders a block string value the way graphql-js printBlockString
+// does, on its own lines when it spans several or could not be read back otherwise
+func printBlockString(s string) string {
+	escaped := strings.ReplaceAll(s, `"""`, `\"""`)
+	lines := strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(escaped), "\n")
+	singleLine := len(lines) == 1
+
+	forceLeadingNewLine := len(lines) > 1
+	for _, line := range lines[1:] {
+		if line != "" && line[0] != ' ' && line[0] != '\t' {
+			forceLeadingNewLine = false
+			break
+		}
+	}
+	trailingTripleQuotes := strings.HasSuffix(escaped, `\"""`)
+	trailingQuote := strings.HasSuffix(s, `"`) && !trailingTripleQuotes
+	forceTrailingNewLine := trailingQuote || strings.HasSuffix(s, `\`)
+	multipleLines := !singleLine || len(s) > 70 || forceTrailingNewLine || forceLeadingNewLine || trailingTripleQuotes
+
+	var b strings.Builder
+	b.WriteString(`"""`)
+	skipLeadingNewLine := singleLine && s != "" && (s[0] == ' ' || s[0] == '\t')
+	if (multipleLines && !skipLeadingNewLine) || forceLeadingNewLine {
+		b.WriteByte('\n')
+	}
+	b.WriteString(escaped)
+	if multipleLines || forceTrailingNewLine {
+		b.WriteByte('\n')
+	}
+	b.WriteString(`"""`)
+	return b.String()
+}
+
+// joinPrint joins the non-empty parts with sep
+func joinPrint(parts []string, sep string) string {
+	var kept []string
+	for _, part := range parts {
+		if part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, sep)
+}
+
+// wrapPrint surrounds s with start and end, or returns "" when s is empty
+func wrapPrint(start, s, end string) string {
+	if s == "" {
+		return ""
+	}
+	return start + s + end
+}
+
+// indentPrint indents every line of s by two spaces
+func indentPrint(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "  " + strings.ReplaceAll(s, "\n", "\n  ")
+}
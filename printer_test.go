@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+func TestPrintGraphQL(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "anonymous query",
+			query: `query { a { b } }`,
+			want:  "{\n  a {\n    b\n  }\n}",
+		},
+		{
+			name:  "variables, directives and values",
+			query: `query Q($id: ID! = "x", $n: [Int!] @v) @op(a: 1) { user(id: $id, filter: {a: 1, b: [1,2], c: null}) { ... on User @include(if: true) { name } ...F } }`,
+			want: "query Q($id: ID! = \"x\", $n: [Int!] @v) @op(a: 1) {\n" +
+				"  user(id: $id, filter: {a: 1, b: [1, 2], c: null}) {\n" +
+				"    ... on User @include(if: true) {\n      name\n    }\n" +
+				"    ...F\n  }\n}",
+		},
+		{
+			name:  "alias",
+			query: `{ me: user { id } }`,
+			want:  "{\n  me: user {\n    id\n  }\n}",
+		},
+		{
+			name:  "arguments wrapped past 80 columns",
+			query: `mutation M { veryLongFieldName(argumentNumberOne: "aaaaaaaaaaaaaaa", argumentNumberTwo: "bbbbbbbbbbbbbbbbbbb") { id } }`,
+			want: "mutation M {\n  veryLongFieldName(\n    argumentNumberOne: \"aaaaaaaaaaaaaaa\"\n" +
+				"    argumentNumberTwo: \"bbbbbbbbbbbbbbbbbbb\"\n  ) {\n    id\n  }\n}",
+		},
+		{
+			name:  "string escapes",
+			query: `{ a(s: "quote \" slash \\ tab \t unicode é \u0001") }`,
+			want:  "{\n  a(s: \"quote \\\" slash \\\\ tab \\t unicode é \\u0001\")\n}",
+		},
+		{
+			name:  "block strings",
+			query: "{ a(s: \"\"\"one line\"\"\", m: \"\"\"\n  first\n  second\n\"\"\") }",
+			want:  "{\n  a(s: \"\"\"one line\"\"\", m: \"\"\"\n  first\n  second\n  \"\"\")\n}",
+		},
+		{
+			name:  "definitions in source order",
+			query: `fragment F on User { id } query Q { ...F }`,
+			want:  "fragment F on User {\n  id\n}\n\nquery Q {\n  ...F\n}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := printGraphQL(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("printGraphQL =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintGraphQLErrors(t *testing.T) {
+	for _, query := range []string{"", "   ", "query Q {", "query Q { }", "{ a(b: ) }", "type T { a: Int }"} {
+		if printed, err := printGraphQL(query); err == nil {
+			t.Errorf("printGraphQL(%q) = %q, want an error", query, printed)
+		}
+	}
+}
+
+func TestSplitOperationsKeepsFragments(t *testing.T) {
+	split := splitOperations(`query A { ...F } query B { b { ...G } } query C { c } fragment F on T { f } fragment G on T { ...H } fragment H on T { h }`)
+	want := []string{
+		"query A {\n  ...F\n}\n\nfragment F on T {\n  f\n}",
+		"query B {\n  b {\n    ...G\n  }\n}\n\nfragment G on T {\n  ...H\n}\n\nfragment H on T {\n  h\n}",
+		"query C {\n  c\n}",
+	}
+	if len(split) != len(want) {
+		t.Fatalf("split into %d documents, want %d: %q", len(split), len(want), split)
+	}
+	for i := range want {
+		if split[i] != want[i] {
+			t.Errorf("document %d = %q, want %q", i, split[i], want[i])
+		}
+	}
+}
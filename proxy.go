@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/mafredri/cdp/protocol/network"
+)
+
+// CaptureProxy is an intercepting HTTP/HTTPS proxy that feeds GraphQL traffic into the
+// same capture pipeline as the browser. HTTPS is decrypted with certificates signed by
+// a local CA that clients must trust.
+type CaptureProxy struct {
+	ca          *x509.Certificate
+	caKey       *ecdsa.PrivateKey
+	certs       map[string]*tls.Certificate
+	certsMu     sync.Mutex
+	transport   *http.Transport
+	server      *http.Server
+	jsURLs      chan string
+	gqlCaptures chan GraphQLCapture
+	origins     *OriginFilter
+	scripts     *JSContentIndex
+	handler     CaptureHandler
+	progress    *Progress
+	done        chan struct{}
+	closed      bool
+	closeMu     sync.Mutex
+}
+
+// newCaptureProxy creates a proxy using the CA stored in caDir, generating one if needed
+func newCaptureProxy(addr, caDir string, jsURLs chan string, gqlCaptures chan GraphQLCapture, origins *OriginFilter, scripts *JSContentIndex, handler CaptureHandler, progress *Progress) (*CaptureProxy, error) {
+	ca, caKey, err := loadOrCreateCA(caDir)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &CaptureProxy{
+		ca:    ca,
+		caKey: caKey,
+		certs: make(map[string]*tls.Certificate),
+		transport: &http.Transport{
+			Proxy:                 nil,
+			DisableCompression:    true,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 60 * time.Second,
+		},
+		jsURLs:      jsURLs,
+		gqlCaptures: gqlCaptures,
+		origins:     origins,
+		scripts:     scripts,
+		handler:     handler,
+		progress:    progress,
+		done:        make(chan struct{}),
+	}
+	p.server = &http.Server{Addr: addr, Handler: p}
+
+	return p, nil
+}
+
+// Start begins accepting proxy connections in the background
+func (p *CaptureProxy) Start() error {
+	listener, err := net.Listen("tcp", p.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", p.server.Addr, err)
+	}
+
+	go func() {
+		if err := p.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			slog.Error("Proxy server error", "error", err)
+		}
+	}()
+
+	slog.Info("Proxy listening", "addr", listener.Addr().String())
+	return nil
+}
+
+// Close stops the proxy and closes the capture channel so the collector can finish
+func (p *CaptureProxy) Close() error {
+	err := p.server.Close()
+
+	p.closeMu.Lock()
+	defer p.closeMu.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.done)
+		close(p.gqlCaptures)
+	}
+
+	return err
+}
+
+// ServeHTTP handles plain HTTP proxy requests and CONNECT tunnels
+func (p *CaptureProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.handleConnect(w, r)
+		return
+	}
+
+	if !r.URL.IsAbs() {
+		http.Error(w, "gql-extractor proxy: absolute URL required", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := p.forward(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for name, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// handleConnect terminates TLS for a CONNECT tunnel and proxies the requests inside it
+func (p *CaptureProxy) handleConnect(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "gql-extractor proxy: hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		slog.Error("Proxy failed to hijack connection", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return
+	}
+
+	host := r.URL.Host
+	tlsConn := tls.Server(conn, &tls.Config{
+		NextProtos: []string{"http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hello.ServerName
+			if name == "" {
+				name, _, _ = net.SplitHostPort(host)
+			}
+			return p.certificateFor(name)
+		},
+	})
+	if err := tlsConn.Handshake(); err != nil {
+		slog.Warn("Proxy TLS handshake with client failed (is the CA trusted?)", "host", host, "error", err)
+		return
+	}
+	defer tlsConn.Close()
+
+	reader := bufio.NewReader(tlsConn)
+	for {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		req.URL.Scheme = "https"
+		req.URL.Host = req.Host
+		if req.URL.Host == "" {
+			req.URL.Host = host
+		}
+
+		resp, err := p.forward(req)
+		if err != nil {
+			resp = &http.Response{
+				StatusCode: http.StatusBadGateway,
+				ProtoMajor: 1,
+				ProtoMinor: 1,
+				Header:     make(http.Header),
+				Body:       io.NopCloser(strings.NewReader(err.Error())),
+			}
+		}
+		writeErr := resp.Write(tlsConn)
+		resp.Body.Close()
+		if writeErr != nil || req.Close || resp.Close {
+			return
+		}
+	}
+}
+
+// forward sends a client request upstream, recording it when it is GraphQL traffic
+func (p *CaptureProxy) forward(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %v", err)
+		}
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.ContentLength = int64(len(body))
+	removeHopByHopHeaders(out.Header)
+
+	req := proxyNetworkRequest(r, body)
+	graphQL := isGraphQLRequest(req)
+
+	started := time.Now()
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		if graphQL {
+			capture := newCapture(req)
+			capture.StartedAt = started
+			capture.Pending = true
+			p.emit(capture)
+		}
+		return nil, fmt.Errorf("failed to reach %s: %v", r.URL.Host, err)
+	}
+	removeHopByHopHeaders(resp.Header)
+
+	// Handle JavaScript files and pages with inline scripts, skipping third-party ones
+	// with --same-origin
+	contentType := resp.Header.Get("Content-Type")
+	if isScriptResponse(r.URL.String(), contentType) || isHTMLResponse(contentType) {
+		if p.origins.Allows(r.URL.String()) {
+			p.scripts.Observe(r.URL.String(), flattenHeaders(resp.Header))
+			p.progress.AddJSFile(r.URL.String())
+			select {
+			case p.jsURLs <- r.URL.String():
+			case <-p.done:
+			}
+		} else {
+			atomic.AddInt32(&p.progress.JSFilesSkipped, 1)
+		}
+	}
+
+	if !graphQL {
+		return resp, nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	capture := newCapture(req)
+	capture.StartedAt = started
+	capture.DurationMs = float64(time.Since(started)) / float64(time.Millisecond)
+	capture.Status = resp.StatusCode
+	capture.ResponseSize = int64(len(respBody))
+	capture.ContentType = resp.Header.Get("Content-Type")
+	capture.ResponseHeaders = flattenHeaders(resp.Header)
+
+	decoded, decodeErr := decodeBody(respBody, resp.Header.Get("Content-Encoding"))
+	if err != nil || decodeErr != nil || len(decoded) == 0 {
+		capture.BodyUnavailable = true
+	} else {
+		setResponseBody(&capture, string(decoded))
+	}
+	p.emit(capture)
+
+	return resp, nil
+}
+
+// emit hands a capture to the pipeline unless the proxy has been closed
+func (p *CaptureProxy) emit(capture GraphQLCapture) {
+	if !identifiesOperation(capture) {
+		return
+	}
+	runCaptureHandler(p.handler, capture)
+
+	p.closeMu.Lock()
+	defer p.closeMu.Unlock()
+	if p.closed {
+		return
+	}
+	atomic.AddInt32(&p.progress.NetworkCaptures, 1)
+	p.gqlCaptures <- capture
+}
+
+// certificateFor returns a leaf certificate for host signed by the proxy CA
+func (p *CaptureProxy) certificateFor(host string) (*tls.Certificate, error) {
+	p.certsMu.Lock()
+	defer p.certsMu.Unlock()
+
+	if cert, ok := p.certs[host]; ok {
+		return cert, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(30 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, &key.PublicKey, p.caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign certificate for %s: %v", host, err)
+	}
+
+	cert := &tls.Certificate{Certificate: [][]byte{der, p.ca.Raw}, PrivateKey: key}
+	p.certs[host] = cert
+	return cert, nil
+}
+
+// defaultProxyCADir keeps the proxy CA in the user's config directory, away from output
+// files that get shared, so one CA installed on a device serves every run
+func defaultProxyCADir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ".gql-extractor"
+	}
+	return filepath.Join(dir, "gql-extractor")
+}
+
+// loadOrCreateCA reads the proxy CA from dir, creating and saving a new one on first use
+func loadOrCreateCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certFile := filepath.Join(dir, "gql-extractor-ca.pem")
+	keyFile := filepath.Join(dir, "gql-extractor-ca-key.pem")
+
+	certPEM, certErr := os.ReadFile(certFile)
+	keyPEM, keyErr := os.ReadFile(keyFile)
+	if certErr == nil && keyErr == nil {
+		pair, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load proxy CA: %v", err)
+		}
+		ca, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse proxy CA: %v", err)
+		}
+		key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("proxy CA key in %s is not an ECDSA key", keyFile)
+		}
+		// A key copied in with looser permissions is made private again
+		if info, err := os.Stat(keyFile); err == nil && info.Mode().Perm()&0077 != 0 {
+			if err := os.Chmod(keyFile, 0600); err != nil {
+				slog.Warn("Could not restrict the proxy CA key's permissions", "file", keyFile, "error", err)
+			}
+		}
+		slog.Info("Using proxy CA certificate", "file", certFile)
+		return ca, key, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate CA key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate serial: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "gql-extractor CA", Organization: []string{"gql-extractor"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(2, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA certificate: %v", err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse CA certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode CA key: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA directory: %v", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, nil, fmt.Errorf("failed to save CA certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return nil, nil, fmt.Errorf("failed to save CA key: %v", err)
+	}
+	// WriteFile keeps the mode of a key file left without its certificate
+	if err := os.Chmod(keyFile, 0600); err != nil {
+		return nil, nil, fmt.Errorf("failed to restrict CA key permissions: %v", err)
+	}
+
+	slog.Info("Generated proxy CA certificate", "file", certFile)
+	slog.Info("Install it as a trusted root on the client device to capture HTTPS traffic")
+	return ca, key, nil
+}
+
+// proxyNetworkRequest describes a proxied request in the CDP shape the capture helpers use
+func proxyNetworkRequest(r *http.Request, body []byte) *network.Request {
+	req := &network.Request{
+		URL:    r.URL.String(),
+		Method: r.Method,
+	}
+	if headers, err := json.Marshal(flattenHeaders(r.Header)); err == nil {
+		req.Headers = network.Headers(headers)
+	}
+	if len(body) > 0 {
+		postData := string(body)
+		req.PostData = &postData
+	}
+	return req
+}
+
+// flattenHeaders joins repeated header values the way Chrome reports them
+func flattenHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+// hopByHopHeaders only apply to one connection, so the proxy does not forward them
+var hopByHopHeaders = []string{"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "TE", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// removeHopByHopHeaders deletes the hop-by-hop headers and any the Connection header names
+func removeHopByHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+}
+
+// decodeBody undoes the content encodings of a body, the last one applied first.
+// Unsupported encodings are returned as an error.
+func decodeBody(body []byte, encoding string) ([]byte, error) {
+	codings := strings.Split(encoding, ",")
+	for i := len(codings) - 1; i >= 0; i-- {
+		var err error
+		if body, err = decodeContent(body, strings.ToLower(strings.TrimSpace(codings[i]))); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// decodeContent undoes a single gzip, deflate or br content coding
+func decodeContent(body []byte, coding string) ([]byte, error) {
+	switch coding {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	case "deflate":
+		// Meant to be zlib-wrapped, but some servers send raw deflate data
+		reader, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return io.ReadAll(flate.NewReader(bytes.NewReader(body)))
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	case "br":
+		return io.ReadAll(brotli.NewReader(bytes.NewReader(body)))
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", coding)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compress encodes body with a writer such as gzip.NewWriter
+func compress(t *testing.T, body string, newWriter func(io.Writer) io.WriteCloser) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	if _, err := w.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeBody(t *testing.T) {
+	const body = `{"data":{"viewer":{"id":"1"}}}`
+	gzipWriter := func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+	zlibWriter := func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) }
+	flateWriter := func(w io.Writer) io.WriteCloser {
+		fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+		return fw
+	}
+	brotliWriter := func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) }
+
+	tests := []struct {
+		name     string
+		encoded  []byte
+		encoding string
+	}{
+		{"identity", []byte(body), ""},
+		{"gzip", compress(t, body, gzipWriter), "gzip"},
+		{"deflate", compress(t, body, zlibWriter), "deflate"},
+		{"raw deflate", compress(t, body, flateWriter), "Deflate"},
+		{"br", compress(t, body, brotliWriter), "br"},
+		{"stacked", compress(t, string(compress(t, body, gzipWriter)), brotliWriter), "gzip, br"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := decodeBody(tt.encoded, tt.encoding)
+			if err != nil || string(decoded) != body {
+				t.Errorf("decodeBody = (%q, %v), want %q", decoded, err, body)
+			}
+		})
+	}
+
+	if _, err := decodeBody([]byte(body), "zstd"); err == nil {
+		t.Error("unsupported encoding decoded without an error")
+	}
+}
+
+func TestRemoveHopByHopHeaders(t *testing.T) {
+	header := http.Header{
+		"Connection":          {"keep-alive, X-Trace"},
+		"Keep-Alive":          {"timeout=5"},
+		"Proxy-Authorization": {"Basic Zm9vOmJhcg=="},
+		"Te":                  {"trailers"},
+		"Upgrade":             {"websocket"},
+		"X-Trace":             {"abc"},
+		"Authorization":       {"Bearer token"},
+		"Content-Type":        {"application/json"},
+	}
+	removeHopByHopHeaders(header)
+	if len(header) != 2 || header.Get("Authorization") == "" || header.Get("Content-Type") == "" {
+		t.Errorf("headers = %v, want only Authorization and Content-Type", header)
+	}
+}
+
+func TestLoadOrCreateCAKeyPermissions(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "ca")
+	keyFile := filepath.Join(dir, "gql-extractor-ca-key.pem")
+	if _, _, err := loadOrCreateCA(dir); err != nil {
+		t.Fatal(err)
+	}
+	if mode := keyMode(t, keyFile); mode != 0600 {
+		t.Fatalf("new key mode = %v, want 0600", mode)
+	}
+
+	// Loading the CA again restricts a key whose permissions were loosened
+	if err := os.Chmod(keyFile, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := loadOrCreateCA(dir); err != nil {
+		t.Fatal(err)
+	}
+	if mode := keyMode(t, keyFile); mode != 0600 {
+		t.Errorf("reloaded key mode = %v, want 0600", mode)
+	}
+}
+
+// keyMode returns the permission bits of a file
+func keyMode(t *testing.T, path string) os.FileMode {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Mode().Perm()
+}
@@ -0,0 +1,56 @@
+package main
+
+import "sync/atomic"
+
+// urlQueue reads the JS URLs the capture goroutine sends as soon as they arrive and
+// holds them until they are processed. The capture goroutine never blocks on a full
+// channel, so a page loading hundreds of scripts cannot stall the CDP event loop, and
+// the network tracker with it, while nothing is reading URLs yet, e.g. while waiting
+// for the page to settle.
+type urlQueue struct {
+	out     chan string
+	pending int64 // URLs read from the input and not yet taken from out
+}
+
+// newURLQueue starts queueing the URLs sent on in. The queue's channel is closed once in
+// is closed and every URL was taken.
+func newURLQueue(in <-chan string) *urlQueue {
+	q := &urlQueue{out: make(chan string)}
+	go q.run(in)
+	return q
+}
+
+// run moves URLs from in to the queue's channel, buffering as many as needed
+func (q *urlQueue) run(in <-chan string) {
+	defer close(q.out)
+	var queue []string
+	for in != nil || len(queue) > 0 {
+		var out chan string
+		var next string
+		if len(queue) > 0 {
+			out, next = q.out, queue[0]
+		}
+		select {
+		case url, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			queue = append(queue, url)
+			atomic.AddInt64(&q.pending, 1)
+		case out <- next:
+			queue = queue[1:]
+			atomic.AddInt64(&q.pending, -1)
+		}
+	}
+}
+
+// C returns the channel the queued URLs are read from
+func (q *urlQueue) C() <-chan string {
+	return q.out
+}
+
+// Len returns how many URLs are waiting to be read
+func (q *urlQueue) Len() int {
+	return int(atomic.LoadInt64(&q.pending))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestURLQueueNeverBlocksSender(t *testing.T) {
+	in := make(chan string, 100)
+	q := newURLQueue(in)
+
+	// More URLs than the channel buffers, with nothing reading yet
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for i := 0; i < 500; i++ {
+			in <- fmt.Sprintf("https://example.com/%d.js", i)
+		}
+		close(in)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sender blocked while the queue was not read")
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); q.Len() != 500; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Len = %d, want 500", q.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	i := 0
+	for url := range q.C() {
+		if want := fmt.Sprintf("https://example.com/%d.js", i); url != want {
+			t.Fatalf("URL %d = %s, want %s", i, url, want)
+		}
+		i++
+	}
+	if i != 500 || q.Len() != 0 {
+		t.Errorf("read %d URLs with %d pending, want 500 and 0", i, q.Len())
+	}
+}
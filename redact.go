@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// defaultRedactHeaders lists the request and response headers whose values are never
+// written to outputs
+const defaultRedactHeaders = "authorization,proxy-authorization,cookie,set-cookie,x-api-key,x-auth-token,x-csrf-token,x-xsrf-token"
+
+// Redactor masks secrets in captures before they are written anywhere: the values of
+// variables whose names match the redact pattern, in the parsed variables, the request
+// body and the URL of GET requests, and the values of sensitive headers. A nil Redactor leaves captures
+// unchanged.
+type Redactor struct {
+	variables *regexp.Regexp  // Variable names whose values are replaced
+	headers   map[string]bool // Lower-cased names of headers whose values are replaced
+}
+
+// newRedactor returns a redactor replacing the values of variables matching variables
+// and of the named headers, compared case-insensitively
+func newRedactor(variables *regexp.Regexp, headers []string) *Redactor {
+	r := &Redactor{variables: variables, headers: make(map[string]bool, len(headers))}
+	for _, name := range headers {
+		r.headers[strings.ToLower(name)] = true
+	}
+	return r
+}
+
+// Variables returns a copy of variables with sensitive values replaced, at any depth
+func (r *Redactor) Variables(variables map[string]interface{}) map[string]interface{} {
+	if r == nil || r.variables == nil || variables == nil {
+		return variables
+	}
+	return redactVariables(variables, r.variables).(map[string]interface{})
+}
+
+// Capture returns a copy of capture with its secrets masked
+func (r *Redactor) Capture(capture GraphQLCapture) GraphQLCapture {
+	if r == nil {
+		return capture
+	}
+	capture.Variables = r.Variables(capture.Variables)
+	capture.RequestBody = r.body(capture.RequestBody, capture.Variables)
+	capture.URL = r.url(capture.URL)
+	capture.RequestHeaders = r.Headers(capture.RequestHeaders)
+	capture.ResponseHeaders = r.Headers(capture.ResponseHeaders)
+	return capture
+}
+
+// Headers returns a copy of headers with the values of sensitive ones replaced
+func (r *Redactor) Headers(headers map[string]string) map[string]string {
+	if r == nil || len(r.headers) == 0 || headers == nil {
+		return headers
+	}
+	redacted := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if r.headers[strings.ToLower(name)] {
+			value = redactedValue
+		}
+		redacted[name] = value
+	}
+	return redacted
+}
+
+// Captures returns copies of captures with their secrets masked
+func (r *Redactor) Captures(captures []GraphQLCapture) []GraphQLCapture {
+	if r == nil {
+		return captures
+	}
+	redacted := make([]GraphQLCapture, len(captures))
+	for i, capture := range captures {
+		redacted[i] = r.Capture(capture)
+	}
+	return redacted
+}
+
+// body masks sensitive variables in a request body. JSON bodies, single or batched, are
+// redacted like variables and re-encoded only when something was masked. Other bodies,
+// such as multipart uploads whose operations part holds the variables, are replaced
+// whole when the redacted variables show they carried a secret.
+func (r *Redactor) body(body string, redactedVars map[string]interface{}) string {
+	if body == "" || r.variables == nil {
+		return body
+	}
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(body), &parsed); err == nil {
+		if !r.sensitive(parsed) {
+			return body
+		}
+		encoded, err := json.Marshal(redactVariables(parsed, r.variables))
+		if err != nil {
+			return redactedValue
+		}
+		return string(encoded)
+	}
+	if r.sensitive(redactedVars) {
+		return redactedValue
+	}
+	return body
+}
+
+// url masks sensitive variables in the variables parameter of a GET request URL. The
+// query string is rebuilt only when something was masked.
+func (r *Redactor) url(rawURL string) string {
+	if r.variables == nil || !strings.Contains(rawURL, "?") {
+		return rawURL
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	params := parsed.Query()
+	var variables interface{}
+	if err := json.Unmarshal([]byte(params.Get("variables")), &variables); err != nil || !r.sensitive(variables) {
+		return rawURL
+	}
+	encoded, err := json.Marshal(redactVariables(variables, r.variables))
+	if err != nil {
+		encoded = []byte(redactedValue)
+	}
+	params.Set("variables", string(encoded))
+	parsed.RawQuery = params.Encode()
+	return parsed.String()
+}
+
+// sensitive reports whether value holds a key matching the redact pattern at any depth
+func (r *Redactor) sensitive(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			if r.variables.MatchString(key) || r.sensitive(val) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if r.sensitive(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRedactorCapture(t *testing.T) {
+	r := newRedactor(regexp.MustCompile(defaultRedactPattern), parseList(defaultRedactHeaders))
+	capture := GraphQLCapture{
+		RequestHeaders:  map[string]string{"Authorization": "Bearer abc", "Content-Type": "application/json"},
+		ResponseHeaders: map[string]string{"set-cookie": "session=abc"},
+		Variables:       map[string]interface{}{"id": "42", "input": map[string]interface{}{"password": "hunter2"}},
+		RequestBody:     `{"query":"mutation Login($id: ID!, $input: LoginInput!) { login(id: $id, input: $input) }","variables":{"id":"42","input":{"password":"hunter2"}}}`,
+	}
+
+	redacted := r.Capture(capture)
+	if got := redacted.Variables["input"].(map[string]interface{})["password"]; got != redactedValue {
+		t.Errorf("nested variable = %v, want %s", got, redactedValue)
+	}
+	if redacted.Variables["id"] != "42" {
+		t.Errorf("id = %v, want it kept", redacted.Variables["id"])
+	}
+	if strings.Contains(redacted.RequestBody, "hunter2") || !strings.Contains(redacted.RequestBody, redactedValue) {
+		t.Errorf("request body not redacted: %s", redacted.RequestBody)
+	}
+	if redacted.RequestHeaders["Authorization"] != redactedValue || redacted.ResponseHeaders["set-cookie"] != redactedValue {
+		t.Errorf("sensitive headers not redacted: %v %v", redacted.RequestHeaders, redacted.ResponseHeaders)
+	}
+	if redacted.RequestHeaders["Content-Type"] != "application/json" {
+		t.Errorf("Content-Type = %q, want it kept", redacted.RequestHeaders["Content-Type"])
+	}
+	if capture.Variables["input"].(map[string]interface{})["password"] != "hunter2" {
+		t.Error("redacting modified the original capture")
+	}
+}
+
+func TestRedactorBody(t *testing.T) {
+	r := newRedactor(regexp.MustCompile(defaultRedactPattern), nil)
+	tests := []struct {
+		name      string
+		body      string
+		variables map[string]interface{}
+		want      string
+	}{
+		{"nothing sensitive", `{"variables": {"id": 1}}`, map[string]interface{}{"id": 1.0}, `{"variables": {"id": 1}}`},
+		{"batch", `[{"variables":{"token":"abc"}}]`, nil, `[{"variables":{"token":"[REDACTED]"}}]`},
+		{"multipart with secret", "--b\r\n\r\n{\"variables\":{\"token\":\"abc\"}}", map[string]interface{}{"token": redactedValue}, redactedValue},
+		{"multipart without secret", "--b\r\n\r\n{}", map[string]interface{}{"file": nil}, "--b\r\n\r\n{}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.body(tt.body, tt.variables); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactorCaptureURL(t *testing.T) {
+	r := newRedactor(regexp.MustCompile(defaultRedactPattern), nil)
+	rawURL := "https://example.com/graphql?query=" + url.QueryEscape("query Me($password: String) { me(password: $password) { id } }") +
+		"&variables=" + url.QueryEscape(`{"password":"hunter2","id":"42"}`)
+	capture := GraphQLCapture{Method: "GET", URL: rawURL, RequestBody: queryStringPayload(rawURL)}
+
+	redacted := r.Capture(capture)
+	if strings.Contains(redacted.URL, "hunter2") {
+		t.Errorf("URL not redacted: %s", redacted.URL)
+	}
+	parsed, err := url.Parse(redacted.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := parsed.Query().Get("variables"), `{"id":"42","password":"[REDACTED]"}`; got != want {
+		t.Errorf("variables = %s, want %s", got, want)
+	}
+	if strings.Contains(redacted.RequestBody, "hunter2") {
+		t.Errorf("request body not redacted: %s", redacted.RequestBody)
+	}
+	for _, entry := range harQueryString(redacted.URL) {
+		if strings.Contains(entry.Value, "hunter2") {
+			t.Errorf("HAR query string holds %s=%s", entry.Name, entry.Value)
+		}
+	}
+
+	safe := "https://example.com/graphql?query=%7B+me+%7B+id+%7D+%7D&variables=%7B%22id%22%3A1%7D"
+	if got := r.url(safe); got != safe {
+		t.Errorf("URL without secrets = %s, want it kept", got)
+	}
+}
+
+func TestNilRedactor(t *testing.T) {
+	var r *Redactor
+	capture := GraphQLCapture{Variables: map[string]interface{}{"password": "x"}}
+	if got := r.Capture(capture); got.Variables["password"] != "x" {
+		t.Errorf("nil redactor changed the capture: %v", got.Variables)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// relayParamsPattern finds the params object of a compiled Relay ConcreteRequest, in
+// minified (params:{) and JSON ("params":{) form
+var relayParamsPattern = regexp.MustCompile(`(?:\bparams|"params")\s*:\s*\{`)
+
+// extractRelayOperations recovers operations from Relay's compiled artifacts, whose
+// params object carries the operation text, name and kind:
+//
+//	params:{cacheID:"...",id:null,metadata:{},name:"AppQuery",operationKind:"query",text:"query AppQuery {...}"}
+//
+// Artifacts compiled for persisted queries have a null text and only an id; those are
+// recorded with their id, type and name. The spans of the params objects are returned
+// too, so the copies of the text the plain patterns find can be dropped.
+func extractRelayOperations(content string) ([]*GraphQLOperation, [][2]int) {
+	var operations []*GraphQLOperation
+	var spans [][2]int
+	for _, loc := range relayParamsPattern.FindAllStringIndex(content, -1) {
+		fields, end, ok := readRelayParams(content, loc[1]-1)
+		if !ok {
+			continue
+		}
+		kind := OperationType(fields["operationKind"])
+		if kind != Query && kind != Mutation && kind != Subscription {
+			continue
+		}
+
+		if text := fields["text"]; text != "" {
+			op, err := ParseGraphQLOperation(text)
+			if err != nil {
+				continue
+			}
+			if op.Name == "" {
+				op.Name = fields["name"]
+			}
+			op.PersistedID = fields["id"]
+			op.Offset = loc[0]
+			operations = append(operations, op)
+			spans = append(spans, [2]int{loc[0], end})
+			continue
+		}
+
+		id := fields["id"]
+		if id == "" {
+			id = fields["cacheID"]
+		}
+		if id == "" {
+			continue
+		}
+		operations = append(operations, &GraphQLOperation{
+			Type:        kind,
+			Name:        fields["name"],
+			PersistedID: id,
+			Variables:   make(map[string]string),
+			Offset:      loc[0],
+		})
+		spans = append(spans, [2]int{loc[0], end})
+	}
+	return operations, spans
+}
+
+// dropOperationsWithin removes the operations found inside one of spans
+func dropOperationsWithin(operations []*GraphQLOperation, spans [][2]int) []*GraphQLOperation {
+	kept := operations[:0]
+	for _, op := range operations {
+		inside := false
+		for _, span := range spans {
+			if op.Offset >= span[0] && op.Offset < span[1] {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			kept = append(kept, op)
+		}
+	}
+	return kept
+}
+
+// readRelayParams reads the string-valued top-level keys of the object literal whose
+// opening brace is at start and returns the index just past it. Null values are read
+// as empty strings, nested objects and other values are skipped.
+func readRelayParams(content string, start int) (map[string]string, int, bool) {
+	fields := make(map[string]string)
+	limit := min(len(content), start+maxOperationSpan)
+	i := start + 1
+	for i < limit {
+		i = skipJSSpace(content, i)
+		if i >= limit {
+			return nil, 0, false
+		}
+		if content[i] == '}' {
+			return fields, i + 1, true
+		}
+
+		// Key, bare or quoted
+		var key string
+		if content[i] == '"' || content[i] == '\'' {
+			literal, end, ok := readJSLiteral(content, i)
+			if !ok {
+				return nil, 0, false
+			}
+			key, i = literal, end
+		} else {
+			keyStart := i
+			for i < limit && (isNameChar(content[i]) || content[i] == '$') {
+				i++
+			}
+			if i == keyStart {
+				return nil, 0, false
+			}
+			key = content[keyStart:i]
+		}
+		i = skipJSSpace(content, i)
+		if i >= limit || content[i] != ':' {
+			return nil, 0, false
+		}
+		i = skipJSSpace(content, i+1)
+		if i >= limit {
+			return nil, 0, false
+		}
+
+		// Value
+		switch {
+		case content[i] == '"' || content[i] == '\'':
+			value, end, ok := readJSLiteral(content, i)
+			if !ok {
+				return nil, 0, false
+			}
+			fields[key] = value
+			i = end
+		case content[i] == '{' || content[i] == '[':
+			end, ok := skipJSValue(content, i, limit)
+			if !ok {
+				return nil, 0, false
+			}
+			i = end
+		default:
+			// null, numbers, booleans and identifiers run to the next comma or brace
+			end := i
+			for end < limit && content[end] != ',' && content[end] != '}' {
+				end++
+			}
+			i = end
+		}
+
+		i = skipJSSpace(content, i)
+		if i < limit && content[i] == ',' {
+			i++
+		}
+	}
+	return nil, 0, false
+}
+
+// skipJSValue returns the index just past the object or array literal at start,
+// skipping nested literals and strings
+func skipJSValue(content string, start, limit int) (int, bool) {
+	depth := 0
+	for i := start; i < limit; i++ {
+		switch content[i] {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return i + 1, true
+			}
+		case '"', '\'':
+			i = skipJSString(content, i)
+		case '`':
+			_, _, end, ok := scanTemplateLiteral(content, i+1)
+			if !ok {
+				return 0, false
+			}
+			i = end - 1
+		}
+	}
+	return 0, false
+}
+
+// hasRelayArtifacts reports whether content may hold compiled Relay requests, so the
+// extractor only runs on bundles that mention an operation kind
+func hasRelayArtifacts(content string) bool {
+	return strings.Contains(content, "operationKind")
+}
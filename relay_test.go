@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestExtractRelayArtifacts(t *testing.T) {
+	type relayOp struct {
+		Type        OperationType
+		Name        string
+		PersistedID string
+	}
+	tests := []struct {
+		file     string
+		want     []relayOp
+		contains map[string]string // Text an operation's Raw must contain, by name
+	}{
+		{
+			file: "app_bundle.js",
+			want: []relayOp{
+				{Query, "FriendsListPaginationQuery", ""},
+				{Query, "UserProfileQuery", ""},
+			},
+			contains: map[string]string{
+				"UserProfileQuery":           "fragment UserProfile_user on User",
+				"FriendsListPaginationQuery": `orderBy: "name}"`,
+			},
+		},
+		{
+			file: "CreateCommentMutation.graphql.js",
+			want: []relayOp{
+				{Mutation, "CreateCommentMutation", ""},
+			},
+			contains: map[string]string{
+				"CreateCommentMutation": "createComment(input: $input)",
+			},
+		},
+		{
+			file: "persisted_bundle.js",
+			want: []relayOp{
+				{Query, "FeedQuery", "3a5f7c9e1b2d4f6a8c0e2a4c6e8a0c2e"},
+				{Subscription, "OnMessageSubscription", "e9c1b7a5"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", "relay", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			operations, err := ExtractOperationsFromJS(string(data), tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []relayOp
+			for _, op := range operations {
+				got = append(got, relayOp{op.Type, op.Name, op.PersistedID})
+				if want, ok := tt.contains[op.Name]; ok && !strings.Contains(op.Raw, want) {
+					t.Errorf("%s raw = %q, want it to contain %q", op.Name, op.Raw, want)
+				}
+			}
+			sort.Slice(got, func(i, j int) bool { return got[i].Name < got[j].Name })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("operations = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
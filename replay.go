@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// headerFlags collects repeatable "Name: value" header flags
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("header must be in \"Name: value\" form: %q", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// apply sets the collected headers on a request
+func (h headerFlags) apply(req *http.Request) {
+	for _, header := range h {
+		name, value, _ := strings.Cut(header, ":")
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+}
+
+// ReplayExport is the subset of the JSON export needed to replay operations
+type ReplayExport struct {
+	Operations []struct {
+		Type     OperationType `json:"type"`
+		Name     string        `json:"name"`
+		Query    string        `json:"query"`
+		Endpoint string        `json:"endpoint"`
+	} `json:"operations"`
+	Captures []struct {
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	} `json:"captures"`
+}
+
+// replayRequest is a single operation scheduled for replay
+type replayRequest struct {
+	Endpoint      string
+	OperationName string
+	Query         string
+	Variables     map[string]interface{}
+}
+
+// runReplay implements the replay subcommand and returns the process exit code
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	endpoint := fs.String("endpoint", "", "GraphQL endpoint to send operations to (defaults to the endpoint recorded in the export)")
+	filter := fs.String("filter", "", "Only replay operations whose name matches this regex")
+	concurrency := fs.Int("concurrency", 4, "Maximum number of requests in flight")
+	dryRun := fs.Bool("dry-run", false, "Print the requests without sending them")
+	includeMutations := fs.Bool("include-mutations", false, "Also replay mutations (dangerous: may change server state)")
+	output := fs.String("output", "", "File to write the fresh captures to (default: output/<input>_replay.json)")
+	logFormat := fs.String("log-format", LogFormatText, "Log output format: text or json")
+	logLevel := fs.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	var headers headerFlags
+	fs.Var(&headers, "header", "Header to send with each request, e.g. \"Authorization: Bearer ...\" (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: gql-extractor replay [options] <export.json>\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+	if err := setupLogging(os.Stderr, *logFormat, *logLevel); err != nil {
+		slog.Error("Invalid logging flags", "error", err)
+		return 1
+	}
+	inputFile := fs.Arg(0)
+
+	var nameFilter *regexp.Regexp
+	if *filter != "" {
+		var err error
+		nameFilter, err = regexp.Compile(*filter)
+		if err != nil {
+			slog.Error("Invalid --filter regex", "error", err)
+			return 1
+		}
+	}
+
+	data, err := os.ReadFile(inputFile)
+	if err != nil {
+		slog.Error("Error reading export", "file", inputFile, "error", err)
+		return 1
+	}
+	var export ReplayExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		slog.Error("Error parsing export", "file", inputFile, "error", err)
+		return 1
+	}
+
+	// Use the most recently captured variables for each operation name
+	variables := make(map[string]map[string]interface{})
+	for _, capture := range export.Captures {
+		if capture.OperationName != "" && len(capture.Variables) > 0 {
+			variables[capture.OperationName] = capture.Variables
+		}
+	}
+
+	var requests []replayRequest
+	for _, op := range export.Operations {
+		if op.Query == "" {
+			continue
+		}
+		if op.Type == Mutation && !*includeMutations {
+			slog.Info("Skipping mutation (use --include-mutations to replay it)", "name", op.Name)
+			continue
+		}
+		if nameFilter != nil && !nameFilter.MatchString(op.Name) {
+			continue
+		}
+
+		target := *endpoint
+		if target == "" {
+			target = op.Endpoint
+		}
+		if target == "" {
+			slog.Warn("Skipping operation: no endpoint known, pass --endpoint", "type", op.Type, "name", op.Name)
+			continue
+		}
+
+		vars := variables[op.Name]
+		if vars == nil {
+			vars = map[string]interface{}{}
+		}
+		requests = append(requests, replayRequest{
+			Endpoint:      target,
+			OperationName: op.Name,
+			Query:         op.Query,
+			Variables:     vars,
+		})
+	}
+
+	slog.Info("Replaying operations", "count", len(requests), "file", inputFile)
+
+	if *dryRun {
+		for _, req := range requests {
+			payload, _ := json.Marshal(replayPayload(req))
+			fmt.Printf("POST %s\n", req.Endpoint)
+			for _, header := range headers {
+				fmt.Printf("%s\n", header)
+			}
+			fmt.Printf("\n%s\n\n", payload)
+		}
+		return 0
+	}
+
+	captures := replayOperations(requests, headers, *concurrency)
+
+	outputFile := *output
+	if outputFile == "" {
+		base := strings.TrimSuffix(filepath.Base(inputFile), filepath.Ext(inputFile))
+		outputFile = filepath.Join("output", base+"_replay.json")
+	}
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+		slog.Error("Error creating output directory", "error", err)
+		return 1
+	}
+	result, err := json.MarshalIndent(captures, "", "  ")
+	if err != nil {
+		slog.Error("Error encoding replay results", "error", err)
+		return 1
+	}
+	if err := os.WriteFile(outputFile, result, 0644); err != nil {
+		slog.Error("Error saving replay results", "error", err)
+		return 1
+	}
+	slog.Info("Saved replayed captures", "count", len(captures), "file", outputFile)
+
+	return 0
+}
+
+// replayPayload builds the JSON request body for an operation
+func replayPayload(req replayRequest) map[string]interface{} {
+	payload := map[string]interface{}{
+		"query":     req.Query,
+		"variables": req.Variables,
+	}
+	if req.OperationName != "" {
+		payload["operationName"] = req.OperationName
+	}
+	return payload
+}
+
+// replayOperations sends every request with bounded concurrency, preserving order in the result
+func replayOperations(requests []replayRequest, headers headerFlags, concurrency int) []GraphQLCapture {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	captures := make([]GraphQLCapture, len(requests))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, req := range requests {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, req replayRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			captures[i] = replayOperation(client, req, headers)
+		}(i, req)
+	}
+	wg.Wait()
+
+	return captures
+}
+
+// replayOperation sends a single operation and records the response as a capture
+func replayOperation(client *http.Client, req replayRequest, headers headerFlags) GraphQLCapture {
+	capture := GraphQLCapture{
+		Query:         req.Query,
+		OperationName: req.OperationName,
+		Variables:     req.Variables,
+		Timestamp:     time.Now(),
+		URL:           req.Endpoint,
+	}
+
+	payload, _ := json.Marshal(replayPayload(req))
+	httpReq, err := http.NewRequest(http.MethodPost, req.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		slog.Error("Error building request", "operation", req.OperationName, "error", err)
+		return capture
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	headers.apply(httpReq)
+
+	start := time.Now()
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		slog.Error("Error replaying", "operation", req.OperationName, "error", err)
+		capture.Pending = true
+		return capture
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	capture.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+	capture.Status = resp.StatusCode
+	capture.ContentType = resp.Header.Get("Content-Type")
+	capture.ResponseSize = int64(len(body))
+	if err != nil {
+		slog.Error("Error reading response", "operation", req.OperationName, "error", err)
+		return capture
+	}
+
+	var responseData interface{}
+	if err := json.Unmarshal(body, &responseData); err == nil {
+		capture.Response = responseData
+		capture.Errors = extractErrorsFromResponse(responseData)
+		capture.HasErrors = responseHasErrors(responseData)
+	}
+
+	slog.Info("Replayed", "operation", req.OperationName, "status", capture.Status, "durationMs", capture.DurationMs)
+
+	return capture
+}
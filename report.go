@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// reportMaxResponse caps the sample response shown per operation in the Markdown report
+const reportMaxResponse = 2000
+
+// ExportToMarkdown renders a readable report: a summary, a table of contents and one
+// section per unique operation with its query, example variables, a sample response
+// and where it was seen. Repeated captures of an operation share its section.
+func ExportToMarkdown(operations []*GraphQLOperation, captures []GraphQLCapture, domain string, sessionStart time.Time) string {
+	var md strings.Builder
+
+	md.WriteString("# GraphQL Operations Report\n\n")
+	if domain != "" {
+		md.WriteString("Target: " + domain + "  \n")
+	}
+	if line := generatedAtLine(""); line != "" {
+		md.WriteString(line + "\n")
+	}
+
+	// Summary
+	md.WriteString("## Summary\n\n")
+	md.WriteString("| Metric | Value |\n|---|---|\n")
+	fmt.Fprintf(&md, "| Queries | %d |\n", countOperationType(operations, Query))
+	fmt.Fprintf(&md, "| Mutations | %d |\n", countOperationType(operations, Mutation))
+	fmt.Fprintf(&md, "| Subscriptions | %d |\n", countOperationType(operations, Subscription))
+	fmt.Fprintf(&md, "| Network captures | %d |\n", len(captures))
+	endpoints := summarizeEndpoints(captures)
+	fmt.Fprintf(&md, "| Endpoints | %d |\n", len(endpoints))
+	if !sessionStart.IsZero() && !omitTimestamps {
+		fmt.Fprintf(&md, "| Session duration | %s |\n", time.Since(sessionStart).Round(time.Second))
+	}
+	md.WriteString("\n")
+
+	if len(endpoints) > 0 {
+		md.WriteString("### Endpoints\n\n")
+		md.WriteString("| URL | Requests | Operations |\n|---|---|---|\n")
+		for _, endpoint := range endpoints {
+			fmt.Fprintf(&md, "| %s | %d | %s |\n", markdownCell(endpoint.URL), endpoint.RequestCount,
+				markdownCell(strings.Join(endpoint.Operations, ", ")))
+		}
+		md.WriteString("\n")
+	}
+
+	// Table of contents
+	md.WriteString("## Operations\n\n")
+	for i, op := range operations {
+		fmt.Fprintf(&md, "%d. [%s](#op-%d)\n", i+1, markdownCell(operationTitle(op)), i+1)
+	}
+	md.WriteString("\n")
+
+	for i, op := range operations {
+		writeOperationSection(&md, i+1, op, capturesForOperation(op, captures))
+	}
+
+	return md.String()
+}
+
+// ExportSummaryMarkdown renders a one-page overview: top-line counts and a table of the
+// operations with their variable count, source and endpoint. It carries no timestamp
+// and sorts the operations, so the same results always produce the same file.
+func ExportSummaryMarkdown(operations []*GraphQLOperation, captures []GraphQLCapture) string {
+	var md strings.Builder
+	md.WriteString("# GraphQL Operations Summary\n\n")
+
+	observed := 0
+	for _, op := range operations {
+		if op.ObservedOnNetwork {
+			observed++
+		}
+	}
+	errors := 0
+	for _, summary := range summarizeErrorCodes(captures) {
+		errors += summary.Count
+	}
+	md.WriteString("| Metric | Value |\n|---|---|\n")
+	fmt.Fprintf(&md, "| Operations | %d |\n", len(operations))
+	fmt.Fprintf(&md, "| Queries | %d |\n", countOperationType(operations, Query))
+	fmt.Fprintf(&md, "| Mutations | %d |\n", countOperationType(operations, Mutation))
+	fmt.Fprintf(&md, "| Subscriptions | %d |\n", countOperationType(operations, Subscription))
+	fmt.Fprintf(&md, "| Observed on the network | %d |\n", observed)
+	fmt.Fprintf(&md, "| Network captures | %d |\n", len(captures))
+	fmt.Fprintf(&md, "| Endpoints | %d |\n", len(summarizeEndpoints(captures)))
+	fmt.Fprintf(&md, "| GraphQL errors | %d |\n", errors)
+	md.WriteString("\n")
+
+	if len(operations) == 0 {
+		return md.String()
+	}
+	sorted := make([]*GraphQLOperation, len(operations))
+	copy(sorted, operations)
+	sortOperations(sorted)
+
+	md.WriteString("## Operations\n\n")
+	md.WriteString("| Name | Type | Variables | Source | Endpoint |\n|---|---|---|---|---|\n")
+	for _, op := range sorted {
+		name := op.Name
+		if name == "" {
+			name = "(anonymous)"
+		}
+		endpoint := op.Endpoint
+		if endpoint == "" && len(op.Endpoints) > 0 {
+			endpoint = op.Endpoints[0]
+		}
+		fmt.Fprintf(&md, "| %s | %s | %d | %s | %s |\n", markdownCell(name), op.Type, len(op.Variables),
+			markdownCell(sourceLocation(op)), markdownCell(endpoint))
+	}
+	md.WriteString("\n")
+	return md.String()
+}
+
+// writeOperationSection writes the report section for a single operation
+func writeOperationSection(md *strings.Builder, index int, op *GraphQLOperation, captures []GraphQLCapture) {
+	fmt.Fprintf(md, "<a id=\"op-%d\"></a>\n\n", index)
+	fmt.Fprintf(md, "### %d. %s\n\n", index, operationTitle(op))
+
+	// Provenance
+	var provenance strings.Builder
+	networkSources := make(map[string]bool)
+	for _, capture := range captures {
+		networkSources[endpointURL(capture.URL)] = true
+	}
+	for _, source := range op.Sources {
+		if !networkSources[source] && source != op.Endpoint {
+			provenance.WriteString("- JavaScript: " + source + "\n")
+		}
+	}
+	if len(captures) > 0 {
+		first, last := captures[0].Timestamp, captures[0].Timestamp
+		for _, capture := range captures {
+			if capture.Timestamp.Before(first) {
+				first = capture.Timestamp
+			}
+			if capture.Timestamp.After(last) {
+				last = capture.Timestamp
+			}
+		}
+		fmt.Fprintf(&provenance, "- Network: %d capture(s), first %s, last %s\n", len(captures),
+			first.Format(time.RFC3339), last.Format(time.RFC3339))
+	}
+	if op.Endpoint != "" {
+		provenance.WriteString("- Endpoint: " + op.Endpoint + "\n")
+	}
+	if provenance.Len() > 0 {
+		md.WriteString(provenance.String() + "\n")
+	}
+
+	query, err := printGraphQL(op.Raw)
+	if err != nil {
+		query = formatGraphQLQuery(op.Raw)
+	}
+	md.WriteString("```graphql\n" + query + "\n```\n\n")
+
+	// Example variables seen on the network, or placeholders from the declared types
+	examples := op.ExampleVariables
+	if len(examples) == 0 && op.SampleVariables != nil {
+		examples = []map[string]interface{}{op.SampleVariables}
+	}
+	if len(examples) == 0 && len(op.Variables) > 0 {
+		examples = []map[string]interface{}{GenerateExampleVariables(op, nil)}
+	}
+	for _, variables := range examples {
+		if encoded, err := json.MarshalIndent(variables, "", "  "); err == nil {
+			md.WriteString("Variables:\n\n```json\n" + string(encoded) + "\n```\n\n")
+		}
+	}
+
+	for _, capture := range captures {
+		if capture.Response == nil {
+			continue
+		}
+		encoded, err := json.MarshalIndent(capture.Response, "", "  ")
+		if err != nil {
+			break
+		}
+		sample, truncated := truncateBody(string(encoded), reportMaxResponse)
+		if truncated {
+			sample += "\n... (truncated)"
+		}
+		md.WriteString("Sample response:\n\n```json\n" + sample + "\n```\n\n")
+		break
+	}
+}
+
+// operationTitle names an operation for headings, e.g. "query GetUser"
+func operationTitle(op *GraphQLOperation) string {
+	if op.Name == "" {
+		return string(op.Type) + " (anonymous)"
+	}
+	return string(op.Type) + " " + op.Name
+}
+
+// markdownCell escapes text for use inside a Markdown table cell
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", " ")
+}
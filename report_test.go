@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestExportSummaryMarkdown(t *testing.T) {
+	operations := []*GraphQLOperation{
+		{Type: Mutation, Name: "Save", Raw: "mutation Save($id: ID!) { save(id: $id) }", Variables: map[string]string{"id": "ID!"},
+			Source: "https://example.com/b.js", Line: 2, Endpoint: "https://example.com/graphql"},
+		{Type: Query, Name: "Viewer", Raw: "query Viewer { viewer { id } }", Source: "https://example.com/a.js", Line: 3,
+			ObservedOnNetwork: true, Endpoints: []string{"https://api.example.com/graphql"}},
+		{Type: Query, Raw: "{ feed { title } }", Source: "https://example.com/a.js"},
+	}
+	captures := []GraphQLCapture{
+		{URL: "https://api.example.com/graphql", OperationName: "Viewer", Method: "POST"},
+		{URL: "https://api.example.com/graphql", OperationName: "Viewer", Method: "POST",
+			HasErrors: true, Errors: []GraphQLError{{Message: "denied", Code: "FORBIDDEN"}}},
+	}
+
+	want := "# GraphQL Operations Summary\n\n" +
+		"| Metric | Value |\n|---|---|\n" +
+		"| Operations | 3 |\n" +
+		"| Queries | 2 |\n" +
+		"| Mutations | 1 |\n" +
+		"| Subscriptions | 0 |\n" +
+		"| Observed on the network | 1 |\n" +
+		"| Network captures | 2 |\n" +
+		"| Endpoints | 1 |\n" +
+		"| GraphQL errors | 1 |\n\n" +
+		"## Operations\n\n" +
+		"| Name | Type | Variables | Source | Endpoint |\n|---|---|---|---|---|\n" +
+		"| (anonymous) | query | 0 | https://example.com/a.js |  |\n" +
+		"| Viewer | query | 0 | https://example.com/a.js:3 | https://api.example.com/graphql |\n" +
+		"| Save | mutation | 1 | https://example.com/b.js:2 | https://example.com/graphql |\n\n"
+
+	got := ExportSummaryMarkdown(operations, captures)
+	if got != want {
+		t.Errorf("summary:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The input order does not matter
+	reversed := []*GraphQLOperation{operations[2], operations[1], operations[0]}
+	if again := ExportSummaryMarkdown(reversed, captures); again != got {
+		t.Errorf("summary depends on the operation order:\n%s", again)
+	}
+
+	if got := ExportSummaryMarkdown(nil, nil); got != "# GraphQL Operations Summary\n\n| Metric | Value |\n|---|---|\n| Operations | 0 |\n| Queries | 0 |\n| Mutations | 0 |\n| Subscriptions | 0 |\n| Observed on the network | 0 |\n| Network captures | 0 |\n| Endpoints | 0 |\n| GraphQL errors | 0 |\n\n" {
+		t.Errorf("empty summary:\n%s", got)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// maxOperationSpan stops a scan that never finds the closing brace from swallowing
+// the rest of a bundle
+const maxOperationSpan = 1 << 17
+
+// operationStartPattern finds operation keywords that are not part of a longer
+// identifier or a property access such as this.query
+var operationStartPattern = regexp.MustCompile(`(?:^|[^\w$.])(query|mutation|subscription)\b`)
+
+// operationSpan is the text of an operation and the byte offset it starts at
+type operationSpan struct {
+	Text  string
+	Start int
+}
+
+// scanOperations returns every operation in content, from its keyword to the brace
+// closing its selection set. Braces inside string arguments and comments do not count,
+// so deeply nested selection sets are captured whole.
+func scanOperations(content string) []operationSpan {
+	var spans []operationSpan
+	next := 0
+	for _, loc := range operationStartPattern.FindAllStringSubmatchIndex(content, -1) {
+		start := loc[2]
+		if start < next {
+			// A field named query or mutation inside an operation already captured
+			continue
+		}
+		end, ok := scanOperationSpan(content, loc[3])
+		if !ok {
+			continue
+		}
+		spans = append(spans, operationSpan{Text: content[start:end], Start: start})
+		next = end
+	}
+	return spans
+}
+
+// scanOperationSpan reads an operation header (name, variable definitions and
+// directives) from just past its keyword, then the balanced selection set. It returns
+// the index just past the closing brace.
+func scanOperationSpan(content string, start int) (int, bool) {
+	i := skipOperationSpace(content, start)
+
+	// Optional name
+	for i < len(content) && isNameChar(content[i]) {
+		i++
+	}
+	i = skipOperationSpace(content, i)
+
+	// Variable definitions always start with $, which tells them apart from a JS call
+	// such as query(e){...}
+	if i < len(content) && content[i] == '(' {
+		if !strings.HasPrefix(strings.TrimLeft(content[i+1:min(i+64, len(content))], " \t\r\n\\n"), "$") {
+			return 0, false
+		}
+		end, ok := scanBalanced(content, i, '(', ')')
+		if !ok {
+			return 0, false
+		}
+		i = skipOperationSpace(content, end)
+	}
+
+	// Directives
+	for i < len(content) && content[i] == '@' {
+		i++
+		for i < len(content) && isNameChar(content[i]) {
+			i++
+		}
+		i = skipOperationSpace(content, i)
+		if i < len(content) && content[i] == '(' {
+			end, ok := scanBalanced(content, i, '(', ')')
+			if !ok {
+				return 0, false
+			}
+			i = skipOperationSpace(content, end)
+		}
+	}
+
+	if i >= len(content) || content[i] != '{' {
+		return 0, false
+	}
+	return scanBalanced(content, i, '{', '}')
+}
+
+// scanBalanced returns the index just past the bracket closing the one at start. It
+// skips GraphQL strings, including ones whose quotes are escaped inside a JavaScript
+// string literal, and # comments. It gives up at the end of a template literal or
+// after maxOperationSpan bytes.
+func scanBalanced(content string, start int, open, close byte) (int, bool) {
+	depth := 0
+	limit := min(len(content), start+maxOperationSpan)
+	for i := start; i < limit; i++ {
+		switch content[i] {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return i + 1, true
+			}
+		case '"':
+			i = skipGraphQLString(content, i) - 1
+		case '\\':
+			if i+1 < len(content) && content[i+1] == '"' {
+				// \"...\" is a GraphQL string inside a double-quoted JS literal
+				end := strings.Index(content[i+2:], `\"`)
+				if end == -1 {
+					return 0, false
+				}
+				i += 2 + end + 1
+			} else {
+				i++
+			}
+		case '#':
+			// Comments run to a newline, or to a \n escape inside a JS literal
+			end := strings.IndexAny(content[i:], "\n\\")
+			if end == -1 {
+				return 0, false
+			}
+			i += end - 1
+		case '`':
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// skipOperationSpace skips whitespace, commas and \n or \t escapes left in JS literals
+func skipOperationSpace(content string, i int) int {
+	for i < len(content) {
+		switch {
+		case strings.IndexByte(" \t\r\n,", content[i]) >= 0:
+			i++
+		case content[i] == '\\' && i+1 < len(content) && (content[i+1] == 'n' || content[i+1] == 't'):
+			i += 2
+		default:
+			return i
+		}
+	}
+	return i
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScanOperationsNesting(t *testing.T) {
+	deep := "query Deep { a { b { c { d { e { f { g } } } } } } }"
+	content := `const q = "` + deep + `"; function query(e) { return e }`
+
+	spans := scanOperations(content)
+	if len(spans) != 1 || spans[0].Text != deep {
+		t.Fatalf("spans = %+v, want only the six-level operation", spans)
+	}
+	if spans[0].Start != strings.Index(content, "query Deep") {
+		t.Errorf("Start = %d, want the offset of the keyword", spans[0].Start)
+	}
+
+	operations, failures := extractOperationsFromText(content)
+	if len(operations) != 1 || len(failures) != 0 {
+		t.Fatalf("extracted %d operations and %d failures, want 1 and 0", len(operations), len(failures))
+	}
+	if operations[0].Name != "Deep" || operations[0].Depth != 7 {
+		t.Errorf("operation = (%s, depth %d), want Deep at depth 7", operations[0].Name, operations[0].Depth)
+	}
+}
+
+func TestScanOperationsBracesInStrings(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "GraphQL string argument",
+			content: "gql`query Search { search(text: \"}{ }}\") { id } }`",
+			want:    `query Search { search(text: "}{ }}") { id } }`,
+		},
+		{
+			name:    "escaped quotes in a JS literal",
+			content: `var q = "query Search { search(text: \"a } b\") { id nodes { name } } }";`,
+			want:    `query Search { search(text: \"a } b\") { id nodes { name } } }`,
+		},
+		{
+			name:    "block string",
+			content: "`mutation Note { add(body: \"\"\"{ not } a brace\"\"\") { id } }`",
+			want:    `mutation Note { add(body: """{ not } a brace""") { id } }`,
+		},
+		{
+			name:    "comment",
+			content: "`query Commented {\n  a # closes early }\n  b { c }\n}`",
+			want:    "query Commented {\n  a # closes early }\n  b { c }\n}",
+		},
+		{
+			name:    "variables and directives",
+			content: `"query V($f: String = \"{\") @cached(ttl: 5) { a(f: $f) { b } }"`,
+			want:    `query V($f: String = \"{\") @cached(ttl: 5) { a(f: $f) { b } }`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spans := scanOperations(tt.content)
+			if len(spans) != 1 || spans[0].Text != tt.want {
+				t.Errorf("spans = %+v, want %q", spans, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanOperationsUnbalanced(t *testing.T) {
+	for _, content := range []string{
+		"query Broken { a { b }",
+		"`query Cut { a { b ` + x + ` } }`",
+		"this.query { a }",
+		"query(e) { return e }",
+	} {
+		if spans := scanOperations(content); len(spans) != 0 {
+			t.Errorf("scanOperations(%q) = %+v, want none", content, spans)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	gqlast "github.com/vektah/gqlparser/v2/ast"
+	gqlvalidator "github.com/vektah/gqlparser/v2/validator"
+)
+
+// schemaRootTypes are the root operation types, in the order they are printed
+var schemaRootTypes = []string{"Query", "Mutation", "Subscription"}
+
+// schemaBuiltinScalars are the scalars every GraphQL schema defines
+var schemaBuiltinScalars = map[string]bool{"String": true, "Int": true, "Float": true, "Boolean": true, "ID": true}
+
+// schemaType is an object type reconstructed from operations and responses
+type schemaType struct {
+	Name   string
+	Fields []*schemaField
+}
+
+// schemaField is a field with the argument types seen in operations
+type schemaField struct {
+	Name        string
+	Type        string
+	Observed    bool // Type was read from a captured response
+	Synthesized bool // Object type name was made up rather than read from __typename
+	Arguments   []schemaArgument
+}
+
+// schemaArgument is a field argument and its type
+type schemaArgument struct {
+	Name string
+	Type string
+}
+
+// schemaBuilder accumulates object types while walking operations
+type schemaBuilder struct {
+	types     map[string]*schemaType
+	fragments map[string]*gqlast.FragmentDefinition
+}
+
+// ExportToSchema reconstructs a best-effort schema: root types built from the top-level
+// fields of every operation, with argument types taken from variable definitions, and
+// object types inferred from selections and captured responses. Object types are named
+// from __typename when a response included it and synthesized otherwise. Anything that
+// cannot be determined uses the JSON scalar so the schema always loads.
+func ExportToSchema(operations []*GraphQLOperation, captures []GraphQLCapture) string {
+	b := &schemaBuilder{
+		types:     make(map[string]*schemaType),
+		fragments: make(map[string]*gqlast.FragmentDefinition),
+	}
+
+	// Fragments are collected first so spreads resolve across operations
+	docs := make([]*gqlast.QueryDocument, len(operations))
+	for i, op := range operations {
+		doc, err := parseGraphQLDocument(op.Raw)
+		if err != nil {
+			continue
+		}
+		docs[i] = doc
+		for _, def := range doc.Fragments {
+			b.fragments[def.Name] = def
+		}
+	}
+
+	for i, op := range operations {
+		if docs[i] == nil {
+			// Only the top-level field names are known
+			for _, name := range op.Fields {
+				if isGraphQLName(name) && !strings.HasPrefix(name, "__") {
+					b.field(b.object(rootTypeName(op.Type)), name)
+				}
+			}
+			continue
+		}
+
+		// Walk once per captured response so each can contribute types
+		samples := []interface{}{}
+		for _, capture := range capturesForOperation(op, captures) {
+			if response, ok := capture.Response.(map[string]interface{}); ok && response["data"] != nil {
+				samples = append(samples, response["data"])
+			}
+		}
+		if len(samples) == 0 {
+			samples = append(samples, nil)
+		}
+
+		for _, def := range docs[i].Operations {
+			variables := make(map[string]string)
+			for _, variable := range def.VariableDefinitions {
+				variables[variable.Variable] = variable.Type.String()
+			}
+			for _, data := range samples {
+				b.walk(rootTypeName(OperationType(def.Operation)), def.SelectionSet, variables, data, make(map[string]bool))
+			}
+		}
+	}
+
+	return b.print()
+}
+
+// rootTypeName returns the schema root type for an operation type
+func rootTypeName(opType OperationType) string {
+	switch opType {
+	case Mutation:
+		return "Mutation"
+	case Subscription:
+		return "Subscription"
+	default:
+		return "Query"
+	}
+}
+
+// object returns the named object type, creating it if needed
+func (b *schemaBuilder) object(name string) *schemaType {
+	t, ok := b.types[name]
+	if !ok {
+		t = &schemaType{Name: name}
+		b.types[name] = t
+	}
+	return t
+}
+
+// field returns the named field of t, or nil if it has none
+func (t *schemaType) field(name string) *schemaField {
+	for _, f := range t.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// field returns the named field of t, creating it if needed
+func (b *schemaBuilder) field(t *schemaType, name string) *schemaField {
+	if f := t.field(name); f != nil {
+		return f
+	}
+	f := &schemaField{Name: name}
+	t.Fields = append(t.Fields, f)
+	return f
+}
+
+// walk adds the fields of a selection set to the parent type. data is the matching
+// part of a captured response, or nil when there is none.
+func (b *schemaBuilder) walk(parent string, selections gqlast.SelectionSet, variables map[string]string, data interface{}, visiting map[string]bool) {
+	object, _ := data.(map[string]interface{})
+
+	for _, selection := range selections {
+		switch sel := selection.(type) {
+		case *gqlast.FragmentSpread:
+			fragment := b.fragments[sel.Name]
+			if fragment == nil || visiting[sel.Name] {
+				continue
+			}
+			visiting[sel.Name] = true
+			b.walk(parent, fragment.SelectionSet, variables, fragmentData(data, fragment.TypeCondition), visiting)
+			delete(visiting, sel.Name)
+		case *gqlast.InlineFragment:
+			b.walk(parent, sel.SelectionSet, variables, fragmentData(data, sel.TypeCondition), visiting)
+		case *gqlast.Field:
+			if strings.HasPrefix(sel.Name, "__") {
+				continue
+			}
+			field := b.field(b.object(parent), sel.Name)
+			for _, arg := range sel.Arguments {
+				addSchemaArgument(field, arg.Name, argumentType(printValue(arg.Value), variables), arg.Value.Kind == gqlast.Variable)
+			}
+
+			key := sel.Name
+			if sel.Alias != "" {
+				key = sel.Alias
+			}
+			var value interface{}
+			if object != nil {
+				value = object[key]
+			}
+			b.setFieldType(field, parent, sel, value, variables, visiting)
+		}
+	}
+}
+
+// setFieldType infers the type of a field from its selection set and response value.
+// Types read from a response replace ones guessed without one.
+func (b *schemaBuilder) setFieldType(field *schemaField, parent string, sel *gqlast.Field, value interface{}, variables map[string]string, visiting map[string]bool) {
+	element, list := value, false
+	if items, ok := value.([]interface{}); ok {
+		list = true
+		element = nil
+		for _, item := range items {
+			if item != nil {
+				element = item
+				break
+			}
+		}
+	}
+
+	named, synthesized := "JSON", false
+	if len(sel.SelectionSet) > 0 {
+		named, synthesized = responseTypename(element), false
+		if named == "" {
+			// Keep adding to the type this field already has rather than making a new one
+			named, synthesized = synthesizedTypeName(parent, sel.Name), true
+			if existing := strings.Trim(field.Type, "[]!"); b.types[existing] != nil {
+				named, synthesized = existing, field.Synthesized
+			}
+		}
+		b.object(named)
+		b.walk(named, sel.SelectionSet, variables, element, visiting)
+	} else if scalar := inferType(element); schemaBuiltinScalars[scalar] || scalar == "DateTime" {
+		named = scalar
+	}
+
+	typ := named
+	if list {
+		typ = "[" + named + "]"
+	}
+
+	observed := value != nil
+	replace := field.Type == "" ||
+		(observed && !field.Observed) ||
+		(observed && field.Synthesized && !synthesized)
+	if replace {
+		// Fields gathered under a made-up name move to the real type
+		if previous := strings.Trim(field.Type, "[]!"); field.Synthesized && previous != named && b.types[previous] != nil {
+			for _, f := range b.types[previous].Fields {
+				if b.types[named].field(f.Name) == nil {
+					b.types[named].Fields = append(b.types[named].Fields, f)
+				}
+			}
+		}
+		field.Type, field.Observed, field.Synthesized = typ, observed, synthesized
+	}
+}
+
+// fragmentData returns data if it may be of the fragment's type condition, judged by
+// its __typename
+func fragmentData(data interface{}, typeCondition string) interface{} {
+	typename := responseTypename(data)
+	if typeCondition != "" && typename != "" && typename != typeCondition {
+		return nil
+	}
+	return data
+}
+
+// responseTypename returns the __typename of a response object, if it has a usable one
+func responseTypename(value interface{}) string {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	typename, _ := object["__typename"].(string)
+	if !isGraphQLName(typename) || strings.HasPrefix(typename, "__") || schemaBuiltinScalars[typename] {
+		return ""
+	}
+	return typename
+}
+
+// synthesizedTypeName names an object type after the field path leading to it,
+// e.g. the user field of Query becomes UserResult and its profile UserProfileResult
+func synthesizedTypeName(parent, field string) string {
+	prefix := strings.TrimSuffix(parent, "Result")
+	for _, root := range schemaRootTypes {
+		if parent == root {
+			prefix = ""
+		}
+	}
+	return prefix + strings.ToUpper(field[:1]) + field[1:] + "Result"
+}
+
+// addSchemaArgument records an argument type. A declared variable type wins over one
+// guessed from a literal, and any type wins over JSON.
+func addSchemaArgument(field *schemaField, name, typ string, declared bool) {
+	for i, arg := range field.Arguments {
+		if arg.Name == name {
+			if typ != "JSON" && (arg.Type == "JSON" || (declared && schemaBuiltinScalars[arg.Type])) {
+				field.Arguments[i].Type = typ
+			}
+			return
+		}
+	}
+	field.Arguments = append(field.Arguments, schemaArgument{Name: name, Type: typ})
+}
+
+// argumentType infers the type of a printed argument value: a variable takes its
+// declared type, simple literals their scalar type, and anything else JSON
+func argumentType(value string, variables map[string]string) string {
+	switch {
+	case strings.HasPrefix(value, "$"):
+		if typ, ok := variables[value[1:]]; ok {
+			return typ
+		}
+	case strings.HasPrefix(value, `"`):
+		return "String"
+	case value == "true" || value == "false":
+		return "Boolean"
+	case value != "" && (value[0] == '-' || (value[0] >= '0' && value[0] <= '9')):
+		if strings.ContainsAny(value, ".eE") {
+			return "Float"
+		}
+		return "Int"
+	}
+	return "JSON"
+}
+
+// print renders the reachable types as SDL. Argument types that name an unknown type
+// are declared as custom scalars, and ones that clash with an object type become JSON.
+func (b *schemaBuilder) print() string {
+	var sdl strings.Builder
+
+	sdl.WriteString("# Reconstructed GraphQL Schema\n")
+	sdl.WriteString(generatedAtLine("# "))
+	sdl.WriteString("# Best effort: built from extracted operations and captured responses.\n")
+	sdl.WriteString("# Types that could not be determined use the JSON scalar.\n\n")
+
+	// Only types reachable from a root are printed
+	reachable := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		t, ok := b.types[name]
+		if !ok || reachable[name] {
+			return
+		}
+		reachable[name] = true
+		for _, f := range t.Fields {
+			visit(strings.Trim(f.Type, "[]!"))
+		}
+	}
+	for _, root := range schemaRootTypes {
+		visit(root)
+	}
+
+	names := make([]string, 0, len(reachable))
+	for name := range reachable {
+		if !containsString(schemaRootTypes, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for i := len(schemaRootTypes) - 1; i >= 0; i-- {
+		if reachable[schemaRootTypes[i]] {
+			names = append([]string{schemaRootTypes[i]}, names...)
+		}
+	}
+
+	scalars := map[string]bool{"JSON": true}
+	for _, name := range names {
+		for _, f := range b.types[name].Fields {
+			if f.Type == "" {
+				// Only the name is known, from an operation that did not parse
+				f.Type = "JSON"
+			}
+			if named := strings.Trim(f.Type, "[]!"); b.types[named] == nil && !schemaBuiltinScalars[named] {
+				scalars[named] = true
+			}
+			for i, arg := range f.Arguments {
+				named := strings.Trim(arg.Type, "[]!")
+				if b.types[named] != nil {
+					f.Arguments[i].Type = "JSON"
+				} else if !schemaBuiltinScalars[named] {
+					scalars[named] = true
+				}
+			}
+		}
+	}
+	scalarNames := make([]string, 0, len(scalars))
+	for name := range scalars {
+		scalarNames = append(scalarNames, name)
+	}
+	sort.Strings(scalarNames)
+	for _, name := range scalarNames {
+		sdl.WriteString("scalar " + name + "\n")
+	}
+
+	for _, name := range names {
+		sdl.WriteString("\ntype " + name + " {\n")
+		fields := b.types[name].Fields
+		if len(fields) == 0 {
+			// Only __typename was selected; object types need at least one field
+			sdl.WriteString("  _empty: JSON\n")
+		}
+		for _, f := range fields {
+			sdl.WriteString("  " + f.Name)
+			if len(f.Arguments) > 0 {
+				args := make([]string, len(f.Arguments))
+				for i, arg := range f.Arguments {
+					args[i] = arg.Name + ": " + arg.Type
+				}
+				sdl.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			sdl.WriteString(": " + f.Type + "\n")
+		}
+		sdl.WriteString("}\n")
+	}
+
+	return sdl.String()
+}
+
+// validateSchemaSDL checks that a reconstructed schema loads
+func validateSchemaSDL(sdl string) error {
+	if _, err := gqlvalidator.LoadSchema(gqlvalidator.Prelude, &gqlast.Source{Name: "schema.graphql", Input: sdl}); err != nil {
+		return fmt.Errorf("reconstructed schema is invalid: %v", err)
+	}
+	return nil
+}
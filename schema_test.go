@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExportToSchema(t *testing.T) {
+	defer func(saved bool) { omitTimestamps = saved }(omitTimestamps)
+	omitTimestamps = true
+
+	parsed := func(raw string) *GraphQLOperation {
+		op, err := ParseGraphQLOperation(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return op
+	}
+	const getUser = `query GetUser($id: ID!) { user(id: $id) { id name createdAt tags } }`
+	userResponse := map[string]interface{}{"data": map[string]interface{}{"user": map[string]interface{}{
+		"__typename": "User", "id": "1", "name": "Ada", "createdAt": "2024-01-02T03:04:05Z", "tags": []interface{}{nil, "admin"},
+	}}}
+
+	tests := []struct {
+		name       string
+		operations []*GraphQLOperation
+		captures   []GraphQLCapture
+		want       string
+	}{
+		{
+			name:       "synthesized names without responses",
+			operations: []*GraphQLOperation{parsed(`query GetUser($id: ID!) { user(id: $id) { id profile { bio } } }`)},
+			want: "scalar JSON\n\n" +
+				"type Query {\n  user(id: ID!): UserResult\n}\n\n" +
+				"type UserProfileResult {\n  bio: JSON\n}\n\n" +
+				"type UserResult {\n  id: JSON\n  profile: UserProfileResult\n}\n",
+		},
+		{
+			name:       "types from a captured response",
+			operations: []*GraphQLOperation{parsed(getUser)},
+			captures:   []GraphQLCapture{{OperationName: "GetUser", Query: getUser, Response: userResponse}},
+			want: "scalar DateTime\nscalar JSON\n\n" +
+				"type Query {\n  user(id: ID!): User\n}\n\n" +
+				"type User {\n  id: ID\n  name: String\n  createdAt: DateTime\n  tags: [String]\n}\n",
+		},
+		{
+			name:       "literal arguments, custom input scalars and fragments",
+			operations: []*GraphQLOperation{parsed(`mutation Save($input: SaveInput!) { save(input: $input, dryRun: true, limit: 5, ratio: 0.5, note: "x") { ...Result } } fragment Result on SaveResult { ok }`)},
+			want: "scalar JSON\nscalar SaveInput\n\n" +
+				"type Mutation {\n  save(input: SaveInput!, dryRun: Boolean, limit: Int, ratio: Float, note: String): SaveResult\n}\n\n" +
+				"type SaveResult {\n  ok: JSON\n}\n",
+		},
+		{
+			name:       "unparseable operation keeps its top-level fields",
+			operations: []*GraphQLOperation{{Type: Query, Name: "Broken", Raw: "query Broken { feed(", Fields: []string{"feed", "__typename"}}},
+			want:       "scalar JSON\n\ntype Query {\n  feed: JSON\n}\n",
+		},
+		{
+			name:       "typename only",
+			operations: []*GraphQLOperation{parsed(`query Ping { node { __typename } }`)},
+			want:       "scalar JSON\n\ntype Query {\n  node: NodeResult\n}\n\ntype NodeResult {\n  _empty: JSON\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sdl := ExportToSchema(tt.operations, tt.captures)
+			if err := validateSchemaSDL(sdl); err != nil {
+				t.Errorf("schema does not load: %v\n%s", err, sdl)
+			}
+			// Skip the comment header
+			body := sdl[strings.Index(sdl, "scalar "):]
+			if body != tt.want {
+				t.Errorf("schema:\n%s\nwant:\n%s", body, tt.want)
+			}
+		})
+	}
+}
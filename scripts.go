@@ -0,0 +1,62 @@
+package main
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// javaScriptMimeTypes are the Content-Types servers send JavaScript with
+var javaScriptMimeTypes = map[string]bool{
+	"application/javascript":   true,
+	"application/x-javascript": true,
+	"application/ecmascript":   true,
+	"text/javascript":          true,
+	"text/ecmascript":          true,
+	"text/jsx":                 true,
+}
+
+// Inline script blocks of an HTML page
+var scriptTagPattern = regexp.MustCompile(`(?is)<script\b[^>]*>(.*?)</script>`)
+
+// isScriptResponse reports whether a response is JavaScript worth scanning, by its
+// Content-Type or, when that is missing or generic, a .js, .mjs or .jsx path
+func isScriptResponse(rawURL, contentType string) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && javaScriptMimeTypes[mediaType] {
+		return true
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(path.Ext(parsed.Path)) {
+	case ".js", ".mjs", ".jsx":
+		return true
+	}
+	return false
+}
+
+// isHTMLResponse reports whether a response is an HTML page whose inline scripts can be
+// scanned
+func isHTMLResponse(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "text/html"
+}
+
+// scriptContent returns the text to scan for operations: the inline scripts of an HTML
+// page, or the content itself for JavaScript
+func scriptContent(content string) string {
+	head := strings.ToLower(strings.TrimSpace(content[:min(len(content), 1024)]))
+	if !strings.HasPrefix(head, "<!doctype html") && !strings.HasPrefix(head, "<html") {
+		return content
+	}
+	var scripts []string
+	for _, m := range scriptTagPattern.FindAllStringSubmatch(content, -1) {
+		if script := strings.TrimSpace(m[1]); script != "" {
+			scripts = append(scripts, script)
+		}
+	}
+	return strings.Join(scripts, "\n;\n")
+}
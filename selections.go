@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+
+	gqlast "github.com/vektah/gqlparser/v2/ast"
+	gqlparser "github.com/vektah/gqlparser/v2/parser"
+)
+
+// Selection is one entry of an operation's selection set: a field, an inline fragment
+// or a fragment spread. Argument values keep their source text, so hardcoded literals
+// such as role: "ADMIN" survive into the export.
+type Selection struct {
+	Kind          string            `json:"kind"`                    // field, inlineFragment or fragmentSpread
+	Name          string            `json:"name,omitempty"`          // Field name, or the fragment a spread names
+	Alias         string            `json:"alias,omitempty"`         // Set when the field is selected under another name
+	TypeCondition string            `json:"typeCondition,omitempty"` // Type an inline fragment applies to
+	Arguments     map[string]string `json:"arguments,omitempty"`     // Printed values, e.g. "ADMIN", 10 or $id
+	Directives    []string          `json:"directives,omitempty"`    // Printed directives, e.g. @include(if: $full)
+	Selections    []*Selection      `json:"selections,omitempty"`
+}
+
+// parseSelections returns the selection tree of the first operation in query, or nil
+// when the query does not parse
+func parseSelections(query string) []*Selection {
+	doc, err := gqlparser.ParseQuery(&gqlast.Source{Input: query})
+	if err != nil || len(doc.Operations) == 0 {
+		return nil
+	}
+	return buildSelections(doc.Operations[0].SelectionSet)
+}
+
+// buildSelections converts a parsed selection set to its exported form
+func buildSelections(set gqlast.SelectionSet) []*Selection {
+	var selections []*Selection
+	for _, selection := range set {
+		switch sel := selection.(type) {
+		case *gqlast.Field:
+			converted := &Selection{
+				Kind:       "field",
+				Name:       sel.Name,
+				Directives: selectionDirectives(sel.Directives),
+				Selections: buildSelections(sel.SelectionSet),
+			}
+			if sel.Alias != "" && sel.Alias != sel.Name {
+				converted.Alias = sel.Alias
+			}
+			for _, arg := range sel.Arguments {
+				if converted.Arguments == nil {
+					converted.Arguments = make(map[string]string)
+				}
+				converted.Arguments[arg.Name] = arg.Value.String()
+			}
+			selections = append(selections, converted)
+		case *gqlast.InlineFragment:
+			selections = append(selections, &Selection{
+				Kind:          "inlineFragment",
+				TypeCondition: sel.TypeCondition,
+				Directives:    selectionDirectives(sel.Directives),
+				Selections:    buildSelections(sel.SelectionSet),
+			})
+		case *gqlast.FragmentSpread:
+			selections = append(selections, &Selection{
+				Kind:       "fragmentSpread",
+				Name:       sel.Name,
+				Directives: selectionDirectives(sel.Directives),
+			})
+		}
+	}
+	return selections
+}
+
+// selectionDirectives prints each directive with its arguments
+func selectionDirectives(directives gqlast.DirectiveList) []string {
+	var printed []string
+	for _, directive := range directives {
+		text := "@" + directive.Name
+		if len(directive.Arguments) > 0 {
+			args := make([]string, len(directive.Arguments))
+			for i, arg := range directive.Arguments {
+				args[i] = arg.Name + ": " + arg.Value.String()
+			}
+			text += "(" + strings.Join(args, ", ") + ")"
+		}
+		printed = append(printed, text)
+	}
+	return printed
+}
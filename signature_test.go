@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestOperationSignatureStable(t *testing.T) {
+	const want = "query Search($after: String, $first: Int = 10, $text: String!)"
+	variants := []string{
+		`query Search($text: String!, $first: Int = 10, $after: String) { search(text: $text, first: $first, after: $after) { id } }`,
+		`query Search($after: String, $text: String!, $first: Int = 10) { search(text: $text, first: $first, after: $after) { id } }`,
+		"query Search(\n  $first: Int = 10\n  $text: String!\n  $after: String\n) {\n  search(text: $text, first: $first, after: $after) {\n    id\n  }\n}",
+		`query   Search ( $text :String! , $after:String,$first : Int=10 ){search(text:$text,first:$first,after:$after){id}}`,
+	}
+	for _, variant := range variants {
+		op, err := ParseGraphQLOperation(variant)
+		if err != nil {
+			t.Fatalf("ParseGraphQLOperation(%q): %v", variant, err)
+		}
+		// Map iteration order changes between calls, so sign each operation several times
+		for i := 0; i < 20; i++ {
+			if got := extractOperationSignature(op); got != want {
+				t.Fatalf("signature of %q = %q, want %q", variant, got, want)
+			}
+		}
+	}
+}
+
+func TestOperationSignatureWithoutVariables(t *testing.T) {
+	tests := map[string]string{
+		"query Viewer { viewer { id } }":             "query Viewer",
+		"query Viewer {\n  viewer {\n    id\n  }\n}": "query Viewer",
+		"mutation Logout { logout }":                 "mutation Logout",
+	}
+	for raw, want := range tests {
+		op, err := ParseGraphQLOperation(raw)
+		if err != nil {
+			t.Fatalf("ParseGraphQLOperation(%q): %v", raw, err)
+		}
+		if got := extractOperationSignature(op); got != want {
+			t.Errorf("signature of %q = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestAnonymousOperationSignatureStable(t *testing.T) {
+	// Shorthand queries are named from their normalized body, so reformatting one must
+	// not change its signature while a different body must
+	sign := func(raw string) string {
+		op, err := ParseGraphQLOperation(raw)
+		if err != nil {
+			t.Fatalf("ParseGraphQLOperation(%q): %v", raw, err)
+		}
+		return extractOperationSignature(op)
+	}
+	compact := sign("{viewer{id name}}")
+	if spaced := sign("{\n  viewer {\n    id\n    name\n  }\n}"); spaced != compact {
+		t.Errorf("reformatted signature = %q, want %q", spaced, compact)
+	}
+	if other := sign("{ viewer { id } }"); other == compact {
+		t.Errorf("different bodies share the signature %q", other)
+	}
+}
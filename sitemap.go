@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tebeka/selenium"
+)
+
+// maxSitemapSize is the largest sitemap read, the limit the sitemap protocol sets
+const maxSitemapSize = 50 << 20
+
+// maxSitemapDepth bounds how deep sitemap indexes are followed
+const maxSitemapDepth = 3
+
+// sitemapDocument reads both a urlset and a sitemapindex; only one list is filled
+type sitemapDocument struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// fetchSitemapPages reads /sitemap.xml of target, following nested sitemap indexes, and
+// returns up to limit page URLs on the target's host. Sitemaps that fail to load are
+// logged and skipped; an error is returned only when the root sitemap cannot be read.
+func fetchSitemapPages(client *http.Client, target string, limit int) ([]string, error) {
+	base, err := url.Parse(target)
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("invalid target URL %q", target)
+	}
+	root := base.ResolveReference(&url.URL{Path: "/sitemap.xml"}).String()
+
+	var pages []string
+	seen := make(map[string]bool)
+	visited := make(map[string]bool)
+	var walk func(sitemapURL string, depth int) error
+	walk = func(sitemapURL string, depth int) error {
+		if visited[sitemapURL] || depth > maxSitemapDepth {
+			return nil
+		}
+		visited[sitemapURL] = true
+
+		doc, err := fetchSitemap(client, sitemapURL)
+		if err != nil {
+			return err
+		}
+		for _, entry := range doc.URLs {
+			if limit > 0 && len(pages) >= limit {
+				return nil
+			}
+			page := strings.TrimSpace(entry.Loc)
+			if page == "" || seen[page] || !sameHost(page, base.Host) {
+				continue
+			}
+			seen[page] = true
+			pages = append(pages, page)
+		}
+		for _, entry := range doc.Sitemaps {
+			if limit > 0 && len(pages) >= limit {
+				return nil
+			}
+			nested := strings.TrimSpace(entry.Loc)
+			if nested == "" || !sameHost(nested, base.Host) {
+				continue
+			}
+			if err := walk(nested, depth+1); err != nil {
+				slog.Warn("Could not read nested sitemap", "url", nested, "error", err)
+			}
+		}
+		return nil
+	}
+	if err := walk(root, 0); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// fetchSitemap downloads and parses one sitemap, gzip-compressed or not
+func fetchSitemap(client *http.Client, sitemapURL string) (*sitemapDocument, error) {
+	resp, err := client.Get(sitemapURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sitemap: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch sitemap: HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSitemapSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sitemap: %v", err)
+	}
+	if len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b {
+		if body, err = decodeBody(body, "gzip"); err != nil {
+			return nil, fmt.Errorf("failed to decompress sitemap: %v", err)
+		}
+	}
+
+	var doc sitemapDocument
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse sitemap: %v", err)
+	}
+	return &doc, nil
+}
+
+// sameHost reports whether rawURL is an http(s) URL on host, ignoring case
+func sameHost(rawURL, host string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return false
+	}
+	return strings.EqualFold(parsed.Host, host)
+}
+
+// crawlPages navigates the browser through pages, staying on each for dwell so the
+// network capture sees the requests it makes. Pages that redirect to another host are
+// left straight away. It stops early when ctx is done.
+func crawlPages(ctx context.Context, wd selenium.WebDriver, target string, pages []string, dwell time.Duration) {
+	base, err := url.Parse(target)
+	if err != nil {
+		return
+	}
+	visited, skipped := 0, 0
+	for _, page := range pages {
+		if ctx.Err() != nil {
+			break
+		}
+		slog.Info("Crawling page", "url", page, "page", visited+skipped+1, "pages", len(pages))
+		if err := wd.Get(page); err != nil {
+			slog.Warn("Error loading page", "url", page, "error", err)
+			skipped++
+			continue
+		}
+		if current, err := wd.CurrentURL(); err == nil && !sameHost(current, base.Host) {
+			slog.Warn("Skipping page, it redirected off the target", "url", page, "redirect", current)
+			skipped++
+			continue
+		}
+		visited++
+
+		select {
+		case <-time.After(dwell):
+		case <-ctx.Done():
+		}
+	}
+	slog.Info("Finished crawling sitemap", "visited", visited, "skipped", skipped, "pages", len(pages))
+}
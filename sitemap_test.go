@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sitemapServer serves sitemaps by path, with {{base}} replaced by the server's URL
+func sitemapServer(t *testing.T, sitemaps map[string]string) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := sitemaps[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		body = strings.ReplaceAll(body, "{{base}}", server.URL)
+		if strings.HasSuffix(r.URL.Path, ".gz") {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			gz.Write([]byte(body))
+			gz.Close()
+			body = buf.String()
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchSitemapPages(t *testing.T) {
+	server := sitemapServer(t, map[string]string{
+		"/sitemap.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>{{base}}/pages.xml</loc></sitemap>
+  <sitemap><loc> {{base}}/blog.xml.gz </loc></sitemap>
+  <sitemap><loc>{{base}}/missing.xml</loc></sitemap>
+  <sitemap><loc>https://cdn.example.com/sitemap.xml</loc></sitemap>
+  <sitemap><loc>{{base}}/sitemap.xml</loc></sitemap>
+  <sitemap><loc>{{base}}/level1.xml</loc></sitemap>
+</sitemapindex>`,
+		"/pages.xml": `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>{{base}}/</loc></url>
+  <url><loc>
+    {{base}}/about
+  </loc></url>
+  <url><loc>https://other.example.com/about</loc></url>
+  <url><loc>{{base}}/</loc></url>
+  <url><loc></loc></url>
+</urlset>`,
+		"/blog.xml.gz": `<urlset><url><loc>{{base}}/blog/first</loc></url></urlset>`,
+		"/level1.xml":  `<sitemapindex><sitemap><loc>{{base}}/level2.xml</loc></sitemap></sitemapindex>`,
+		"/level2.xml": `<sitemapindex><sitemap><loc>{{base}}/level3.xml</loc></sitemap>
+  <sitemap><loc>{{base}}/deep.xml</loc></sitemap></sitemapindex>`,
+		"/level3.xml":   `<sitemapindex><sitemap><loc>{{base}}/too-deep.xml</loc></sitemap></sitemapindex>`,
+		"/deep.xml":     `<urlset><url><loc>{{base}}/deep</loc></url></urlset>`,
+		"/too-deep.xml": `<urlset><url><loc>{{base}}/too-deep</loc></url></urlset>`,
+	})
+	all := []string{server.URL + "/", server.URL + "/about", server.URL + "/blog/first", server.URL + "/deep"}
+
+	tests := []struct {
+		name  string
+		limit int
+		want  []string
+	}{
+		{"no limit", 0, all},
+		{"limit", 2, all[:2]},
+		{"limit across sitemaps", 3, all[:3]},
+		{"limit above the pages", 10, all},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages, err := fetchSitemapPages(server.Client(), server.URL+"/app?tab=1", tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(pages, tt.want) {
+				t.Errorf("pages = %q, want %q", pages, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchSitemapPagesErrors(t *testing.T) {
+	server := sitemapServer(t, map[string]string{})
+	if _, err := fetchSitemapPages(server.Client(), server.URL, 0); err == nil {
+		t.Error("missing root sitemap returned no error")
+	}
+	if _, err := fetchSitemapPages(server.Client(), "not a url", 0); err == nil {
+		t.Error("invalid target returned no error")
+	}
+
+	broken := sitemapServer(t, map[string]string{"/sitemap.xml": "<urlset><url>"})
+	if _, err := fetchSitemapPages(broken.Client(), broken.URL, 0); err == nil {
+		t.Error("unparseable root sitemap returned no error")
+	}
+}
+
+func TestSameHost(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want bool
+	}{
+		{"same host", "https://example.com/page", true},
+		{"other scheme", "http://example.com/page", true},
+		{"host case", "https://EXAMPLE.com/page", true},
+		{"subdomain", "https://www.example.com/page", false},
+		{"other port", "https://example.com:8443/page", false},
+		{"other host", "https://evil.com/?u=https://example.com", false},
+		{"relative", "/page", false},
+		{"mailto", "mailto:admin@example.com", false},
+		{"javascript", "javascript:void(0)", false},
+		{"unparseable", "https://example.com/%zz", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameHost(tt.url, "example.com"); got != tt.want {
+				t.Errorf("sameHost(%q) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	_ "modernc.org/sqlite" // Pure-Go driver, registered as "sqlite"
+)
+
+// sqliteSchema creates the tables of the SQLite export
+const sqliteSchema = `PRAGMA foreign_keys = ON;
+CREATE TABLE operations (
+  id INTEGER PRIMARY KEY,
+  type TEXT NOT NULL,
+  name TEXT,
+  raw TEXT NOT NULL,
+  normalized_hash TEXT,
+  source_url TEXT
+);
+CREATE TABLE captures (
+  id INTEGER PRIMARY KEY,
+  operation_id INTEGER REFERENCES operations(id),
+  url TEXT NOT NULL,
+  operation_name TEXT,
+  variables_json TEXT,
+  response_json TEXT,
+  status INTEGER,
+  timestamp TEXT NOT NULL
+);
+CREATE TABLE endpoints (
+  url TEXT PRIMARY KEY,
+  capture_count INTEGER NOT NULL
+);
+CREATE INDEX captures_operation_id ON captures(operation_id);
+CREATE INDEX operations_name ON operations(name);
+`
+
+// ExportToSQLite writes operations, captures and endpoints to a new SQLite database at
+// dbFile, replacing any from a previous run. All inserts run in one transaction so
+// loading thousands of rows stays fast.
+func ExportToSQLite(dbFile string, operations []*GraphQLOperation, captures []GraphQLCapture) error {
+	if err := os.Remove(dbFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to replace database: %v", err)
+	}
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return fmt.Errorf("failed to create tables: %v", err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	if err := insertSQLiteRows(tx, operations, captures); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit database: %v", err)
+	}
+	return nil
+}
+
+// insertSQLiteRows inserts the rows of every table. Captures link to the operation with
+// the same normalized query, or failing that the same name.
+func insertSQLiteRows(tx *sql.Tx, operations []*GraphQLOperation, captures []GraphQLCapture) error {
+	byQuery := make(map[string]int)
+	byName := make(map[string]int)
+	for i, op := range operations {
+		id := i + 1
+		normalized := normalizeGraphQL(op.Raw)
+		var hash interface{}
+		if normalized != "" {
+			sum := sha256.Sum256([]byte(normalized))
+			hash = hex.EncodeToString(sum[:])
+			if _, exists := byQuery[normalized]; !exists {
+				byQuery[normalized] = id
+			}
+		}
+		if op.Name != "" {
+			if _, exists := byName[op.Name]; !exists {
+				byName[op.Name] = id
+			}
+		}
+
+		var source interface{}
+		if len(op.Sources) > 0 {
+			source = op.Sources[0]
+		}
+
+		if _, err := tx.Exec("INSERT INTO operations VALUES (?, ?, ?, ?, ?, ?)",
+			id, string(op.Type), sqlNullable(op.Name), op.Raw, hash, source); err != nil {
+			return fmt.Errorf("failed to insert operation: %v", err)
+		}
+	}
+
+	for i, capture := range captures {
+		var operationID interface{}
+		if id, ok := byQuery[normalizeGraphQL(capture.Query)]; ok && capture.Query != "" {
+			operationID = id
+		} else if id, ok := byName[capture.OperationName]; ok {
+			operationID = id
+		}
+
+		var status interface{}
+		if !capture.Pending {
+			status = capture.Status
+		}
+
+		if _, err := tx.Exec("INSERT INTO captures VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			i+1, operationID, capture.URL, sqlNullable(capture.OperationName),
+			sqlJSON(capture.Variables), sqlJSON(capture.Response), status,
+			capture.Timestamp.Format(time.RFC3339Nano)); err != nil {
+			return fmt.Errorf("failed to insert capture: %v", err)
+		}
+	}
+
+	for _, endpoint := range summarizeEndpoints(captures) {
+		if _, err := tx.Exec("INSERT INTO endpoints VALUES (?, ?)", endpoint.URL, endpoint.RequestCount); err != nil {
+			return fmt.Errorf("failed to insert endpoint: %v", err)
+		}
+	}
+	return nil
+}
+
+// sqlNullable stores an optional string, NULL when empty
+func sqlNullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// sqlJSON encodes a value as JSON text, NULL for missing values
+func sqlJSON(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	if m, ok := value.(map[string]interface{}); ok && m == nil {
+		return nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	return string(encoded)
+}
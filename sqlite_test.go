@@ -0,0 +1,69 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportToSQLite(t *testing.T) {
+	operations := []*GraphQLOperation{
+		{Type: Query, Name: "GetUser", Raw: "query GetUser($id: ID!) { user(id: $id) { name } }", Sources: []string{"https://example.com/app.js"}},
+		{Type: Query, Raw: "{ viewer { id } }"},
+	}
+	captures := []GraphQLCapture{
+		{Query: "query GetUser($id: ID!) { user(id: $id) { name } }", OperationName: "GetUser", URL: "https://example.com/graphql",
+			Variables: map[string]interface{}{"id": "1"}, Response: map[string]interface{}{"data": nil}, Status: 200, Timestamp: time.Now()},
+		{Query: "query Other { other }", URL: "https://example.com/graphql", Pending: true, Timestamp: time.Now()},
+	}
+
+	dbFile := filepath.Join(t.TempDir(), "out.db")
+	// Writing twice replaces the first database
+	for i := 0; i < 2; i++ {
+		if err := ExportToSQLite(dbFile, operations, captures); err != nil {
+			t.Fatalf("ExportToSQLite: %v", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM operations").Scan(&count); err != nil || count != 2 {
+		t.Fatalf("operations = %d (%v), want 2", count, err)
+	}
+
+	// The anonymous operation has no name but keeps its text
+	var name sql.NullString
+	var raw string
+	if err := db.QueryRow("SELECT name, raw FROM operations WHERE id = 2").Scan(&name, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if name.Valid || raw != "{ viewer { id } }" {
+		t.Errorf("anonymous operation = (%v, %q)", name, raw)
+	}
+
+	var operationID sql.NullInt64
+	var variables string
+	var status sql.NullInt64
+	if err := db.QueryRow("SELECT operation_id, variables_json, status FROM captures WHERE id = 1").Scan(&operationID, &variables, &status); err != nil {
+		t.Fatal(err)
+	}
+	if operationID.Int64 != 1 || variables != `{"id":"1"}` || status.Int64 != 200 {
+		t.Errorf("capture = (%v, %s, %v), want linked to operation 1 with status 200", operationID, variables, status)
+	}
+	if err := db.QueryRow("SELECT operation_id, status FROM captures WHERE id = 2").Scan(&operationID, &status); err != nil {
+		t.Fatal(err)
+	}
+	if operationID.Valid || status.Valid {
+		t.Errorf("pending capture = (%v, %v), want no operation and no status", operationID, status)
+	}
+
+	if err := db.QueryRow("SELECT capture_count FROM endpoints WHERE url = ?", "https://example.com/graphql").Scan(&count); err != nil || count != 2 {
+		t.Errorf("endpoint capture_count = %d (%v), want 2", count, err)
+	}
+}
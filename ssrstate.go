@@ -0,0 +1,317 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Globals server-rendered pages embed their GraphQL state in
+const (
+	apolloStateGlobal = "__APOLLO_STATE__"
+	nextDataGlobal    = "__NEXT_DATA__"
+)
+
+// maxCacheDepth bounds how deep references in an Apollo cache are followed
+const maxCacheDepth = 10
+
+var (
+	// window.__APOLLO_STATE__ = {...}, up to the start of the JSON value
+	apolloStatePattern = regexp.MustCompile(`(?:window\.)?__APOLLO_STATE__\s*=\s*`)
+	// <script id="__NEXT_DATA__" type="application/json">...</script>
+	nextDataPattern = regexp.MustCompile(`(?is)<script[^>]*\bid=["']?__NEXT_DATA__["']?[^>]*>(.*?)</script>`)
+	// Keys under which Next.js apps pass the Apollo cache to the page
+	apolloCacheKeyPattern = regexp.MustCompile(`(?i)^(?:__)?(?:initial)?apollo_?state(?:__)?$`)
+	// Strings in the state that start like an operation
+	operationTextPattern = regexp.MustCompile(`^\s*(?:query|mutation|subscription)\b`)
+)
+
+// ssrCaptures reads the GraphQL state a server-rendered page embeds in its HTML: the
+// Apollo cache in window.__APOLLO_STATE__ or in the __NEXT_DATA__ page props, and any
+// operation text stored there. Each operation text becomes a capture, and each cache a
+// capture whose query is rebuilt from the cached fields and whose response is the
+// cached data, so they go through the same pipeline as the requests the page makes.
+// Rebuilt queries are marked SSRCache, as no operation of the app has that text.
+func ssrCaptures(pageURL, html string) []GraphQLCapture {
+	var captures []GraphQLCapture
+	add := func(global, query string, response interface{}, cache bool) {
+		captures = append(captures, GraphQLCapture{
+			Query:     query,
+			Response:  response,
+			Timestamp: time.Now(),
+			URL:       pageURL,
+			PageURL:   pageURL,
+			Method:    "GET",
+			SSRState:  global,
+			SSRCache:  cache,
+		})
+	}
+
+	states := findSSRStates(html)
+	for _, global := range sortedKeys(states) {
+		value := states[global]
+		for _, text := range operationTexts(value) {
+			add(global, text, nil, false)
+		}
+		caches := findApolloCaches(value)
+		if global == apolloStateGlobal {
+			if cache, ok := value.(map[string]interface{}); ok {
+				caches = append(caches, cache)
+			}
+		}
+		for _, cache := range caches {
+			if query, data := denormalizeApolloCache(cache); query != "" {
+				add(global, query, map[string]interface{}{"data": data}, true)
+			}
+		}
+	}
+	return captures
+}
+
+// findSSRStates returns the parsed state globals of the page, skipping those that are
+// not plain JSON
+func findSSRStates(html string) map[string]interface{} {
+	states := make(map[string]interface{})
+	for _, loc := range apolloStatePattern.FindAllStringIndex(html, -1) {
+		var value interface{}
+		if err := json.NewDecoder(strings.NewReader(html[loc[1]:])).Decode(&value); err == nil {
+			states[apolloStateGlobal] = value
+			break
+		}
+	}
+	if m := nextDataPattern.FindStringSubmatch(html); m != nil {
+		var value interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(m[1])), &value); err == nil {
+			states[nextDataGlobal] = value
+		}
+	}
+	return states
+}
+
+// operationTexts returns the strings anywhere in value that parse as operations
+func operationTexts(value interface{}) []string {
+	var texts []string
+	var walk func(interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			if operationTextPattern.MatchString(v) {
+				if _, err := ParseGraphQLOperation(v); err == nil {
+					texts = appendUnique(texts, v)
+				}
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case map[string]interface{}:
+			for _, key := range sortedKeys(v) {
+				walk(v[key])
+			}
+		}
+	}
+	walk(value)
+	return texts
+}
+
+// findApolloCaches returns the Apollo caches nested in value under a key such as
+// apolloState or initialApolloState
+func findApolloCaches(value interface{}) []map[string]interface{} {
+	var caches []map[string]interface{}
+	var walk func(interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case map[string]interface{}:
+			for _, key := range sortedKeys(v) {
+				if cache, ok := v[key].(map[string]interface{}); ok && apolloCacheKeyPattern.MatchString(key) {
+					caches = append(caches, cache)
+					continue
+				}
+				walk(v[key])
+			}
+		}
+	}
+	walk(value)
+	return caches
+}
+
+// denormalizeApolloCache rebuilds the query results of a normalized Apollo cache from
+// its ROOT_QUERY, following references to the cached entities. It returns a query
+// selecting the cached fields, with their arguments, and the data it would return.
+func denormalizeApolloCache(cache map[string]interface{}) (string, map[string]interface{}) {
+	root, ok := cache["ROOT_QUERY"].(map[string]interface{})
+	if !ok {
+		return "", nil
+	}
+	d := &cacheDenormalizer{cache: cache, visiting: make(map[string]bool)}
+	selections, data := d.object(root, 0)
+	if len(selections) == 0 {
+		return "", nil
+	}
+	return "query {\n  " + strings.Join(selections, "\n  ") + "\n}", data
+}
+
+// cacheDenormalizer follows references through one Apollo cache
+type cacheDenormalizer struct {
+	cache    map[string]interface{}
+	visiting map[string]bool // Entities on the current path, to stop at cycles
+}
+
+// object returns the selections and data of a cached object. Fields cached with
+// different arguments are aliased name_2, name_3 and so on.
+func (d *cacheDenormalizer) object(obj map[string]interface{}, depth int) ([]string, map[string]interface{}) {
+	var selections []string
+	data := make(map[string]interface{})
+	for _, key := range sortedKeys(obj) {
+		name, args := splitCacheKey(key)
+		if !isGraphQLName(name) || (strings.HasPrefix(name, "__") && name != "__typename") {
+			continue
+		}
+		sub, value, ok := d.value(obj[key], depth+1)
+		if !ok {
+			continue
+		}
+
+		alias := name
+		for n := 2; ; n++ {
+			if _, taken := data[alias]; !taken {
+				break
+			}
+			alias = fmt.Sprintf("%s_%d", name, n)
+		}
+		selection := name + args
+		if alias != name {
+			selection = alias + ": " + selection
+		}
+		if sub != "" {
+			selection += " " + sub
+		}
+		selections = append(selections, selection)
+		data[alias] = value
+	}
+	return selections, data
+}
+
+// value resolves a cached field value, returning the selection set it needs (empty for
+// leaves) and its data. References to entities missing from the cache, cycles and
+// values nested too deeply are dropped.
+func (d *cacheDenormalizer) value(v interface{}, depth int) (string, interface{}, bool) {
+	if depth > maxCacheDepth {
+		return "", nil, false
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		// Apollo Client 3 references, and the { type: "id" } ones of version 2
+		ref, _ := v["__ref"].(string)
+		if id, _ := v["id"].(string); ref == "" && v["type"] == "id" {
+			ref = id
+		}
+		if ref != "" {
+			entity, ok := d.cache[ref].(map[string]interface{})
+			if !ok || d.visiting[ref] {
+				return "", nil, false
+			}
+			d.visiting[ref] = true
+			defer delete(d.visiting, ref)
+			v = entity
+		} else if v["type"] == "json" {
+			return "", v["json"], true
+		}
+		selections, data := d.object(v, depth)
+		if len(selections) == 0 {
+			// An object without fields is a JSON scalar
+			return "", v, true
+		}
+		return "{ " + strings.Join(selections, " ") + " }", data, true
+	case []interface{}:
+		var selections []string
+		items := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			sub, value, ok := d.value(item, depth)
+			if !ok {
+				continue
+			}
+			if sub != "" {
+				selections = appendUnique(selections, strings.TrimSuffix(strings.TrimPrefix(sub, "{ "), " }"))
+			}
+			items = append(items, value)
+		}
+		if len(selections) == 0 {
+			return "", items, true
+		}
+		return "{ " + strings.Join(selections, " ") + " }", items, true
+	default:
+		return "", v, true
+	}
+}
+
+// splitCacheKey splits a cache field key such as user({"id":"1"}) or user:{"id":"1"}
+// into the field name and its arguments written as GraphQL, e.g. (id: "1")
+func splitCacheKey(key string) (string, string) {
+	name, rawArgs := key, ""
+	if i := strings.Index(key, "("); i > 0 && strings.HasSuffix(key, ")") {
+		name, rawArgs = key[:i], key[i+1:len(key)-1]
+	} else if i := strings.Index(key, ":"); i > 0 {
+		name, rawArgs = key[:i], key[i+1:]
+	}
+	var args map[string]interface{}
+	if rawArgs == "" || json.Unmarshal([]byte(rawArgs), &args) != nil || len(args) == 0 {
+		return name, ""
+	}
+	parts := make([]string, 0, len(args))
+	for _, arg := range sortedKeys(args) {
+		if isGraphQLName(arg) {
+			parts = append(parts, arg+": "+graphQLLiteral(args[arg]))
+		}
+	}
+	if len(parts) == 0 {
+		return name, ""
+	}
+	return name, "(" + strings.Join(parts, ", ") + ")"
+}
+
+// graphQLLiteral writes a JSON value as a GraphQL input value
+func graphQLLiteral(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		quoted, _ := json.Marshal(v)
+		return string(quoted)
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, graphQLLiteral(item))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		fields := make([]string, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			fields = append(fields, key+": "+graphQLLiteral(v[key]))
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+	return "null"
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindSSRStates(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want map[string]interface{}
+	}{
+		{"apollo global", `<script>window.__APOLLO_STATE__ = {"ROOT_QUERY":{"a":1}};</script>`,
+			map[string]interface{}{apolloStateGlobal: map[string]interface{}{"ROOT_QUERY": map[string]interface{}{"a": 1.0}}}},
+		{"bare apollo global", `<script>__APOLLO_STATE__={"x":true}</script>`,
+			map[string]interface{}{apolloStateGlobal: map[string]interface{}{"x": true}}},
+		{"first parseable apollo state", `<script>window.__APOLLO_STATE__ = JSON.parse("{}"); window.__APOLLO_STATE__ = {"y":2};</script>`,
+			map[string]interface{}{apolloStateGlobal: map[string]interface{}{"y": 2.0}}},
+		{"next data", `<script id="__NEXT_DATA__" type="application/json">
+			{"props":{"pageProps":{}}}
+		</script>`,
+			map[string]interface{}{nextDataGlobal: map[string]interface{}{"props": map[string]interface{}{"pageProps": map[string]interface{}{}}}}},
+		{"unquoted id", `<SCRIPT type="application/json" id=__NEXT_DATA__>{"page":"/"}</SCRIPT>`,
+			map[string]interface{}{nextDataGlobal: map[string]interface{}{"page": "/"}}},
+		{"both", `<script id="__NEXT_DATA__">{"n":1}</script><script>window.__APOLLO_STATE__={"a":1}</script>`,
+			map[string]interface{}{nextDataGlobal: map[string]interface{}{"n": 1.0}, apolloStateGlobal: map[string]interface{}{"a": 1.0}}},
+		{"not JSON", `<script>window.__APOLLO_STATE__ = initState();</script><script id="__NEXT_DATA__">{props: 1}</script>`,
+			map[string]interface{}{}},
+		{"no state", `<html><body>hello</body></html>`, map[string]interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findSSRStates(tt.html); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findSSRStates = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitCacheKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		name string
+		args string
+	}{
+		{"viewer", "viewer", ""},
+		{`user({"id":"1"})`, "user", `(id: "1")`},
+		{`user:{"id":"1"}`, "user", `(id: "1")`},
+		{`search({"first":10,"term":"lamp"})`, "search", `(first: 10, term: "lamp")`},
+		{`feed({})`, "feed", ""},
+		{`feed({"filter":{"tags":["a","b"],"open":true}})`, "feed", `(filter: {open: true, tags: ["a", "b"]})`},
+		{`node({"bad key":1,"id":"2"})`, "node", `(id: "2")`},
+		{`node({"bad key":1})`, "node", ""},
+		{`items(not json)`, "items", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			name, args := splitCacheKey(tt.key)
+			if name != tt.name || args != tt.args {
+				t.Errorf("splitCacheKey(%q) = %q, %q; want %q, %q", tt.key, name, args, tt.name, tt.args)
+			}
+		})
+	}
+}
+
+func TestGraphQLLiteral(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"null", nil, "null"},
+		{"bool", true, "true"},
+		{"integer", 10.0, "10"},
+		{"float", 2.5, "2.5"},
+		{"large number", 1e21, "1000000000000000000000"},
+		{"string", `say "hi"`, `"say \"hi\""`},
+		{"list", []interface{}{"a", 1.0, nil}, `["a", 1, null]`},
+		{"object", map[string]interface{}{"b": false, "a": []interface{}{}}, "{a: [], b: false}"},
+		{"unknown", struct{}{}, "null"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := graphQLLiteral(tt.value); got != tt.want {
+				t.Errorf("graphQLLiteral(%v) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSRCapturesKeepCacheOutOfOperations(t *testing.T) {
+	html := `<script>window.__APOLLO_STATE__ = {
+		"ROOT_QUERY": {"viewer": {"__ref": "User:1"}},
+		"User:1": {"__typename": "User", "id": "1", "name": "Ada"},
+		"saved": "query SavedSearch { saved { id } }"
+	};</script>`
+	captures := ssrCaptures("https://example.com/", html)
+	if len(captures) != 2 {
+		t.Fatalf("got %d captures, want 2", len(captures))
+	}
+	var cache, text GraphQLCapture
+	for _, capture := range captures {
+		if capture.SSRCache {
+			cache = capture
+		} else {
+			text = capture
+		}
+	}
+	if want := "query {\n  viewer { __typename id name }\n}"; cache.Query != want {
+		t.Errorf("cache query = %q, want %q", cache.Query, want)
+	}
+	if text.Query != "query SavedSearch { saved { id } }" {
+		t.Errorf("operation text = %q", text.Query)
+	}
+
+	operations := operationsFromCaptures(captures)
+	if len(operations) != 1 || operations[0].Name != "SavedSearch" {
+		t.Fatalf("operations = %v, want only SavedSearch", operations)
+	}
+	if want := "https://example.com/#" + apolloStateGlobal; operations[0].Source != want {
+		t.Errorf("source = %q, want %q", operations[0].Source, want)
+	}
+}
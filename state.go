@@ -0,0 +1,315 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// stateVersion is bumped whenever the state file layout changes; files of another
+// version are ignored
+const stateVersion = 2
+
+// runState is what --resume keeps between runs against a target in
+// <base>_state.json: the JavaScript already processed, the operations found so far and
+// the captures already seen
+type runState struct {
+	Version    int                        `json:"version"`
+	Keys       string                     `json:"keys"` // stateKeys of the run that wrote it
+	Target     string                     `json:"target"`
+	Updated    time.Time                  `json:"updated"`
+	JSFiles    map[string]stateJSFile     `json:"jsFiles"`    // JS URL -> what it was processed with
+	Operations map[string]*stateOperation `json:"operations"` // createOperationKey -> operation
+	Captures   []stateCapture             `json:"captures"`   // Every capture seen, sorted by hash
+
+	path     string
+	captures map[string]bool
+	jsMu     sync.Mutex // Guards JSFiles against the --workers processing files
+}
+
+// stateCapture is a capture seen by an earlier run. The hash is taken before redaction
+// so the same request is recognized again.
+type stateCapture struct {
+	Hash    string         `json:"hash"` // captureHash of the capture as it was sent
+	Capture GraphQLCapture `json:"capture"`
+}
+
+// stateJSFile identifies the content a JS URL was processed with and what scanning it
+// yielded besides operations, so a later run skipping it still has its fragments,
+// endpoints and statistics
+type stateJSFile struct {
+	Hash      string               `json:"hash"`                // sha256 of the body
+	Validator string               `json:"validator,omitempty"` // ETag and length the browser saw, if any
+	Stats     *FileStats           `json:"stats,omitempty"`
+	Fragments map[string]*Fragment `json:"fragments,omitempty"`
+	Endpoints []string             `json:"endpoints,omitempty"`
+}
+
+// stateKeys fingerprints how operation, capture and content keys are computed. The
+// state is indexed by them, so a change to any of those algorithms invalidates older
+// state files just like a version bump.
+func stateKeys() string {
+	op := &GraphQLOperation{Type: Query, Name: "Probe", Raw: `query Probe($id: ID!, $n: Int = 1) { node(id: $id) { ...F id } } fragment F on Node { __typename }`}
+	capture := GraphQLCapture{Method: "POST", URL: "https://example.com/graphql", OperationName: "Probe",
+		Query: op.Raw, Variables: map[string]interface{}{"id": "1", "n": 2}}
+	return contentHash(createOperationKey(op) + "\n" + captureHash(capture) + "\n" + contentHash(op.Raw))[:16]
+}
+
+// stateOperation is an operation found by an earlier run, with the first and latest
+// runs that found it
+type stateOperation struct {
+	FirstSeen time.Time         `json:"firstSeen"`
+	LastSeen  time.Time         `json:"lastSeen"`
+	Operation *GraphQLOperation `json:"operation"`
+}
+
+// loadRunState reads the state file at path. A missing file starts an empty state; an
+// unreadable, corrupted or version-mismatched one is ignored with a warning, so the run
+// starts over instead of failing.
+func loadRunState(path, target string) *runState {
+	state := &runState{
+		Version:    stateVersion,
+		Keys:       stateKeys(),
+		Target:     target,
+		JSFiles:    make(map[string]stateJSFile),
+		Operations: make(map[string]*stateOperation),
+		path:       path,
+		captures:   make(map[string]bool),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state
+	}
+	if err != nil {
+		slog.Warn("Could not read state file, starting over", "file", path, "error", err)
+		return state
+	}
+
+	var saved runState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		slog.Warn("State file is corrupted, starting over", "file", path, "error", err)
+		return state
+	}
+	if saved.Version != stateVersion || saved.Keys != state.Keys {
+		slog.Warn("State file was written by another version, starting over", "file", path, "version", saved.Version, "expected", stateVersion)
+		return state
+	}
+	if saved.JSFiles != nil {
+		state.JSFiles = saved.JSFiles
+	}
+	for key, entry := range saved.Operations {
+		if entry != nil && entry.Operation != nil {
+			state.Operations[key] = entry
+		}
+	}
+	for _, capture := range saved.Captures {
+		if !state.captures[capture.Hash] {
+			state.captures[capture.Hash] = true
+			state.Captures = append(state.Captures, capture)
+		}
+	}
+	state.Updated = saved.Updated
+	slog.Info("Resuming from state file", "file", path, "jsFiles", len(state.JSFiles),
+		"operations", len(state.Operations), "captures", len(state.captures), "updated", saved.Updated.Format(time.RFC3339))
+	return state
+}
+
+// Unchanged reports whether jsURL was processed before with the ETag and length the
+// browser saw for it now, so it need not be downloaded again
+func (s *runState) Unchanged(jsURL, validator string) bool {
+	s.jsMu.Lock()
+	defer s.jsMu.Unlock()
+	file, ok := s.JSFiles[jsURL]
+	return ok && validator != "" && file.Validator == validator
+}
+
+// SameContent reports whether jsURL was processed before with this exact content
+func (s *runState) SameContent(jsURL, content string) bool {
+	hash := contentHash(content)
+	s.jsMu.Lock()
+	defer s.jsMu.Unlock()
+	file, ok := s.JSFiles[jsURL]
+	return ok && file.Hash == hash
+}
+
+// RecordJS remembers the content jsURL was processed with. What an earlier run
+// recorded for the same content is kept.
+func (s *runState) RecordJS(jsURL, content, validator string) {
+	file := stateJSFile{Hash: contentHash(content), Validator: validator}
+	s.jsMu.Lock()
+	defer s.jsMu.Unlock()
+	if earlier, ok := s.JSFiles[jsURL]; ok && earlier.Hash == file.Hash {
+		file.Stats, file.Fragments, file.Endpoints = earlier.Stats, earlier.Fragments, earlier.Endpoints
+	}
+	s.JSFiles[jsURL] = file
+}
+
+// RecordResult remembers what scanning jsURL yielded. The stats are saved as they are
+// when the state is written.
+func (s *runState) RecordResult(jsURL string, stats *FileStats, fragments map[string]*Fragment, endpoints []string) {
+	s.jsMu.Lock()
+	defer s.jsMu.Unlock()
+	file, ok := s.JSFiles[jsURL]
+	if !ok {
+		return
+	}
+	file.Stats, file.Fragments, file.Endpoints = stats, fragments, endpoints
+	s.JSFiles[jsURL] = file
+}
+
+// Restore fills stats with what the run that scanned jsURL found and returns its
+// fragments and endpoint URLs, for a file skipped as unchanged
+func (s *runState) Restore(jsURL string, stats *FileStats) (map[string]*Fragment, []string) {
+	s.jsMu.Lock()
+	defer s.jsMu.Unlock()
+	file := s.JSFiles[jsURL]
+	if file.Stats != nil {
+		stats.Matches = file.Stats.Matches
+		stats.UniqueOperations = file.Stats.UniqueOperations
+		stats.ParseFailures = file.Stats.ParseFailures
+		if stats.Size == 0 {
+			stats.Size = file.Stats.Size
+		}
+	}
+	stats.Unchanged = true
+
+	fragments := make(map[string]*Fragment, len(file.Fragments))
+	for name, fragment := range file.Fragments {
+		copied := *fragment
+		fragments[name] = &copied
+	}
+	return fragments, append([]string(nil), file.Endpoints...)
+}
+
+// Merge records this run's operations and returns them followed by the operations of
+// earlier runs not found again. Every operation is stamped with the first and latest
+// runs that found it.
+func (s *runState) Merge(operations []*GraphQLOperation, runTime time.Time) []*GraphQLOperation {
+	found := make(map[string]bool)
+	for _, op := range operations {
+		key := createOperationKey(op)
+		entry := s.Operations[key]
+		if entry == nil {
+			entry = &stateOperation{FirstSeen: runTime}
+			s.Operations[key] = entry
+		}
+		if !found[key] {
+			found[key] = true
+			entry.LastSeen = runTime
+			entry.Operation = stateCopy(op)
+		}
+		stampRuns(op, entry)
+	}
+
+	merged := operations
+	keys := make([]string, 0, len(s.Operations))
+	for key := range s.Operations {
+		if !found[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		entry := s.Operations[key]
+		op := stateCopy(entry.Operation)
+		stampRuns(op, entry)
+		merged = append(merged, op)
+	}
+	return merged
+}
+
+// stateCopy returns op without what correlating this run's captures sets, which an
+// earlier run's copy must not carry over
+func stateCopy(op *GraphQLOperation) *GraphQLOperation {
+	stored := *op
+	stored.ObservedOnNetwork = false
+	stored.CaptureCount = 0
+	stored.Endpoints = nil
+	stored.Pages = nil
+	stored.LastSeen = nil
+	stored.ExampleVariables = nil
+	stored.SampleVariables = nil
+	stored.FirstSeen = nil
+	stored.LastSeenRun = nil
+	return &stored
+}
+
+// stampRuns sets an operation's run timestamps from its state entry
+func stampRuns(op *GraphQLOperation, entry *stateOperation) {
+	first, last := entry.FirstSeen, entry.LastSeen
+	op.FirstSeen = &first
+	op.LastSeenRun = &last
+}
+
+// MergeCaptures returns this run's captures followed by those of earlier runs that
+// this run did not repeat
+func (s *runState) MergeCaptures(captures []GraphQLCapture) []GraphQLCapture {
+	seen := make(map[string]bool, len(captures))
+	for _, capture := range captures {
+		seen[captureHash(capture)] = true
+	}
+	merged := captures
+	for _, capture := range s.Captures {
+		if !seen[capture.Hash] {
+			merged = append(merged, capture.Capture)
+		}
+	}
+	return merged
+}
+
+// RecordCaptures remembers the captures, masked by redactor since the state file is
+// written like any output, and returns how many were not seen before
+func (s *runState) RecordCaptures(captures []GraphQLCapture, redactor *Redactor) int {
+	added := 0
+	for _, capture := range captures {
+		hash := captureHash(capture)
+		if !s.captures[hash] {
+			s.captures[hash] = true
+			s.Captures = append(s.Captures, stateCapture{Hash: hash, Capture: redactor.Capture(capture)})
+			added++
+		}
+	}
+	return added
+}
+
+// Save writes the state file
+func (s *runState) Save() error {
+	s.Updated = time.Now()
+	sort.Slice(s.Captures, func(i, j int) bool {
+		return s.Captures[i].Hash < s.Captures[j].Hash
+	})
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	return nil
+}
+
+// captureHash identifies a request by its method, URL, operation and variables, which
+// encoding/json writes with sorted keys
+func captureHash(capture GraphQLCapture) string {
+	variables, _ := json.Marshal(capture.Variables)
+	return contentHash(capture.Method + "\n" + capture.URL + "\n" + capture.OperationName + "\n" +
+		capture.PersistedQueryHash + "\n" + capture.Query + "\n" + string(variables))
+}
+
+// contentHash returns the hex sha256 of content
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
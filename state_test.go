@@ -0,0 +1,216 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// savedState writes a state with one JS file, operation and capture, returning its path
+func savedState(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "state.json")
+	state := loadRunState(path, "https://example.com")
+	state.RecordJS("https://example.com/app.js", "bundle", `"abc"|6`)
+	state.Merge([]*GraphQLOperation{{Type: Query, Name: "A", Raw: "query A { a }"}}, time.Unix(100, 0))
+	state.RecordCaptures([]GraphQLCapture{{Method: "POST", URL: "https://example.com/graphql", OperationName: "A", Query: "query A { a }"}}, nil)
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadRunState(t *testing.T) {
+	tests := []struct {
+		name    string
+		rewrite func(string) string // Changes the saved file; nil removes it
+		resumed bool
+	}{
+		{"saved state", func(data string) string { return data }, true},
+		{"missing file", nil, false},
+		{"corrupt file", func(data string) string { return data[:len(data)/2] }, false},
+		{"not JSON", func(string) string { return "not json" }, false},
+		{"version mismatch", func(data string) string {
+			return strings.Replace(data, `"version": 2`, `"version": 1`, 1)
+		}, false},
+		{"key mismatch", func(data string) string {
+			return regexp.MustCompile(`"keys": "\w+"`).ReplaceAllString(data, `"keys": "0000000000000000"`)
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := savedState(t)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.rewrite == nil {
+				os.Remove(path)
+			} else if err := os.WriteFile(path, []byte(tt.rewrite(string(data))), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			state := loadRunState(path, "https://example.com")
+			if state == nil {
+				t.Fatal("loadRunState returned nil")
+			}
+			resumed := len(state.JSFiles) == 1 && len(state.Operations) == 1 && len(state.Captures) == 1
+			empty := len(state.JSFiles) == 0 && len(state.Operations) == 0 && len(state.Captures) == 0
+			if tt.resumed && !resumed {
+				t.Errorf("state not resumed: %d JS files, %d operations, %d captures", len(state.JSFiles), len(state.Operations), len(state.Captures))
+			}
+			if !tt.resumed && !empty {
+				t.Errorf("state not started over: %d JS files, %d operations, %d captures", len(state.JSFiles), len(state.Operations), len(state.Captures))
+			}
+			if state.Version != stateVersion || state.Keys != stateKeys() {
+				t.Errorf("state version %d keys %q, want %d %q", state.Version, state.Keys, stateVersion, stateKeys())
+			}
+		})
+	}
+}
+
+func TestRunStateUnchanged(t *testing.T) {
+	state := loadRunState(filepath.Join(t.TempDir(), "state.json"), "")
+	state.RecordJS("https://example.com/app.js", "bundle", `"abc"|6`)
+	state.RecordJS("https://example.com/noetag.js", "bundle", "")
+
+	tests := []struct {
+		name      string
+		url       string
+		validator string
+		unchanged bool
+	}{
+		{"same ETag and length", "https://example.com/app.js", `"abc"|6`, true},
+		{"new ETag", "https://example.com/app.js", `"def"|6`, false},
+		{"no ETag now", "https://example.com/app.js", "", false},
+		{"no ETag before", "https://example.com/noetag.js", "", false},
+		{"never processed", "https://example.com/other.js", `"abc"|6`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := state.Unchanged(tt.url, tt.validator); got != tt.unchanged {
+				t.Errorf("Unchanged = %v, want %v", got, tt.unchanged)
+			}
+		})
+	}
+	if !state.SameContent("https://example.com/noetag.js", "bundle") || state.SameContent("https://example.com/noetag.js", "changed") {
+		t.Error("SameContent does not compare the body hash")
+	}
+}
+
+func TestRunStateMerge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	first, second := time.Unix(100, 0).UTC(), time.Unix(200, 0).UTC()
+
+	state := loadRunState(path, "")
+	state.Merge([]*GraphQLOperation{
+		{Type: Query, Name: "A", Raw: "query A { a }"},
+		{Type: Query, Name: "B", Raw: "query B { b }", CaptureCount: 3},
+	}, first)
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next run finds A again and C for the first time; B only comes from the state
+	state = loadRunState(path, "")
+	merged := state.Merge([]*GraphQLOperation{
+		{Type: Query, Name: "C", Raw: "query C { c }"},
+		{Type: Query, Name: "A", Raw: "query A { a }"},
+	}, second)
+
+	type runs struct {
+		first, last time.Time
+	}
+	got := make(map[string]runs)
+	var names []string
+	for _, op := range merged {
+		names = append(names, op.Name)
+		got[op.Name] = runs{*op.FirstSeen, *op.LastSeenRun}
+		if op.Name == "B" && op.CaptureCount != 0 {
+			t.Errorf("B carried over its capture count %d", op.CaptureCount)
+		}
+	}
+	if want := []string{"C", "A", "B"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("merged %v, want %v", names, want)
+	}
+	want := map[string]runs{"A": {first, second}, "B": {first, first}, "C": {second, second}}
+	for name, w := range want {
+		if g := got[name]; !g.first.Equal(w.first) || !g.last.Equal(w.last) {
+			t.Errorf("%s seen %v to %v, want %v to %v", name, g.first, g.last, w.first, w.last)
+		}
+	}
+}
+
+func TestRunStateRestoresSkippedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	const jsURL = "https://example.com/fragments.js"
+
+	state := loadRunState(path, "")
+	state.RecordJS(jsURL, "bundle", `"abc"|6`)
+	state.RecordResult(jsURL, &FileStats{URL: jsURL, Size: 6, DownloadMs: 12, Matches: 2, UniqueOperations: 1},
+		map[string]*Fragment{"UserFields": {Name: "UserFields", TypeCondition: "User", Raw: "fragment UserFields on User { id }", Source: jsURL}},
+		[]string{"https://api.example.com/graphql"})
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	state = loadRunState(path, "")
+	stats := &FileStats{URL: jsURL}
+	fragments, endpoints := state.Restore(jsURL, stats)
+	if want := (FileStats{URL: jsURL, Size: 6, Matches: 2, UniqueOperations: 1, Unchanged: true}); *stats != want {
+		t.Errorf("stats = %+v, want %+v", *stats, want)
+	}
+	if fragments["UserFields"] == nil || fragments["UserFields"].Raw != "fragment UserFields on User { id }" {
+		t.Errorf("fragments = %v, want UserFields", fragments)
+	}
+	if want := []string{"https://api.example.com/graphql"}; !reflect.DeepEqual(endpoints, want) {
+		t.Errorf("endpoints = %v, want %v", endpoints, want)
+	}
+
+	// Downloading the same content again keeps what the earlier run found
+	state.RecordJS(jsURL, "bundle", "")
+	if fragments, _ := state.Restore(jsURL, &FileStats{}); len(fragments) != 1 {
+		t.Error("recording unchanged content dropped its fragments")
+	}
+}
+
+func TestRunStateMergeCaptures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	redactor := newRedactor(regexp.MustCompile(`(?i)password`), []string{"authorization"})
+	login := GraphQLCapture{Method: "POST", URL: "https://example.com/graphql", OperationName: "Login",
+		Variables: map[string]interface{}{"password": "hunter2"}, RequestHeaders: map[string]string{"Authorization": "Bearer secret"}}
+	viewer := GraphQLCapture{Method: "POST", URL: "https://example.com/graphql", OperationName: "Viewer"}
+
+	state := loadRunState(path, "")
+	if added := state.RecordCaptures([]GraphQLCapture{login, viewer}, redactor); added != 2 {
+		t.Fatalf("recorded %d new captures, want 2", added)
+	}
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "hunter2") || strings.Contains(string(data), "Bearer secret") {
+		t.Error("state file holds unredacted secrets")
+	}
+
+	// The next run repeats the login, which is recognized despite the redaction
+	state = loadRunState(path, "")
+	merged := state.MergeCaptures([]GraphQLCapture{login})
+	var names []string
+	for _, capture := range merged {
+		names = append(names, capture.OperationName)
+	}
+	if want := []string{"Login", "Viewer"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("merged captures %v, want %v", names, want)
+	}
+	if added := state.RecordCaptures([]GraphQLCapture{login}, redactor); added != 0 {
+		t.Errorf("recorded %d new captures, want 0", added)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// streamFlushInterval bounds how long a record can sit in the stream's buffer
+const streamFlushInterval = time.Second
+
+// CaptureStream writes captures and static operations as JSON Lines as they are found.
+// Records are encoded by a single goroutine through a buffered writer so the capture
+// path never waits on I/O.
+type CaptureStream struct {
+	out         io.Writer
+	closer      io.Closer // Nil for streams the process does not own, e.g. stdout
+	flushEach   bool      // Flush after every record instead of periodically
+	maxResponse int       // Cap on a record's encoded response, 0 for no limit
+	redact      *Redactor // Masks secrets in captures before they are queued
+	records     chan interface{}
+	done        chan struct{}
+	mu          sync.Mutex // Guards closed against records sent while closing
+	closed      bool
+}
+
+// captureRecord is a streamed network capture
+type captureRecord struct {
+	Kind string `json:"kind"`
+	GraphQLCapture
+	ResponseTruncated bool `json:"responseTruncated,omitempty"` // Response holds truncated JSON text
+	Filtered          bool `json:"filtered,omitempty"`          // Dropped from the results as noise
+}
+
+// operationRecord is a streamed operation found in a JavaScript file
+type operationRecord struct {
+	Kind string `json:"kind"`
+	GraphQLOperation
+	Filtered bool `json:"filtered,omitempty"` // Dropped from the results as noise
+}
+
+// newCaptureStream opens (or creates) a JSON Lines file for appending
+func newCaptureStream(path string, redact *Redactor) (*CaptureStream, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %v", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream file: %v", err)
+	}
+
+	return newStream(file, file, false, 0, redact), nil
+}
+
+// newStdoutStream writes records to stdout, flushing each one so the output can be
+// piped into tools like jq while the session is still running
+func newStdoutStream(maxResponse int, redact *Redactor) *CaptureStream {
+	return newStream(os.Stdout, nil, true, maxResponse, redact)
+}
+
+// newStream starts the encoding goroutine for a stream writing to out
+func newStream(out io.Writer, closer io.Closer, flushEach bool, maxResponse int, redact *Redactor) *CaptureStream {
+	s := &CaptureStream{
+		out:         out,
+		closer:      closer,
+		flushEach:   flushEach,
+		maxResponse: maxResponse,
+		redact:      redact,
+		records:     make(chan interface{}, 1024),
+		done:        make(chan struct{}),
+	}
+	go s.run()
+
+	return s
+}
+
+// run encodes records until the stream is closed, flushing at least once per interval
+func (s *CaptureStream) run() {
+	defer close(s.done)
+
+	w := bufio.NewWriter(s.out)
+	enc := json.NewEncoder(w)
+	ticker := time.NewTicker(streamFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case record, ok := <-s.records:
+			if !ok {
+				if err := w.Flush(); err != nil {
+					slog.Error("Error flushing stream", "error", err)
+				}
+				return
+			}
+			if err := enc.Encode(record); err != nil {
+				slog.Error("Error streaming record", "error", err)
+			}
+			if s.flushEach {
+				if err := w.Flush(); err != nil {
+					slog.Error("Error flushing stream", "error", err)
+				}
+			}
+		case <-ticker.C:
+			if err := w.Flush(); err != nil {
+				slog.Error("Error flushing stream", "error", err)
+			}
+		}
+	}
+}
+
+// Write queues a capture as one line of JSON
+func (s *CaptureStream) Write(capture GraphQLCapture) {
+	s.writeCapture(capture, false)
+}
+
+// WriteFiltered queues a capture dropped as noise, marked so the stream stays auditable
+func (s *CaptureStream) WriteFiltered(capture GraphQLCapture) {
+	s.writeCapture(capture, true)
+}
+
+// writeCapture queues a capture record with its secrets masked, capping the encoded
+// response
+func (s *CaptureStream) writeCapture(capture GraphQLCapture, filtered bool) {
+	capture = s.redact.Capture(capture)
+	record := captureRecord{Kind: "capture", GraphQLCapture: capture, Filtered: filtered}
+	if s.maxResponse > 0 && capture.Response != nil {
+		if encoded, err := json.Marshal(capture.Response); err == nil && len(encoded) > s.maxResponse {
+			record.Response, record.ResponseTruncated = truncateBody(string(encoded), s.maxResponse)
+		}
+	}
+	s.send(record)
+}
+
+// WriteOperation queues a statically extracted operation as one line of JSON
+func (s *CaptureStream) WriteOperation(op *GraphQLOperation) {
+	s.send(operationRecord{Kind: "operation", GraphQLOperation: *op})
+}
+
+// WriteFilteredOperation queues an operation dropped as noise, marked as filtered
+func (s *CaptureStream) WriteFilteredOperation(op *GraphQLOperation) {
+	s.send(operationRecord{Kind: "operation", GraphQLOperation: *op, Filtered: true})
+}
+
+// send queues a record unless the stream is closed. Captures can still arrive after
+// the session ended and the stream was closed; they are dropped.
+func (s *CaptureStream) send(record interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.records <- record
+}
+
+// Close flushes queued records and closes the underlying file. Later writes are
+// ignored, and closing again does nothing.
+func (s *CaptureStream) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.records)
+	s.mu.Unlock()
+	<-s.done
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
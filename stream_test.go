@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeEvents delivers n captures the way the CDP goroutine does, on an unbuffered
+// channel that stays open after the consumer stopped caring
+func fakeEvents(n int) <-chan GraphQLCapture {
+	events := make(chan GraphQLCapture)
+	go func() {
+		defer close(events)
+		for i := 0; i < n; i++ {
+			events <- GraphQLCapture{Query: fmt.Sprintf("query Op%d { a }", i), OperationName: fmt.Sprintf("Op%d", i)}
+		}
+	}()
+	return events
+}
+
+func TestCaptureStreamLateWritesAfterClose(t *testing.T) {
+	var out bytes.Buffer
+	s := newStream(&out, nil, false, 0, nil)
+
+	events := fakeEvents(200)
+	for i := 0; i < 10; i++ {
+		s.Write(<-events)
+	}
+
+	// The session is saved while the collector is still draining events
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for capture := range events {
+			s.Write(capture)
+			s.WriteFiltered(capture)
+		}
+	}()
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	<-done
+
+	// Late captures must not panic, and closing twice is harmless
+	s.Write(GraphQLCapture{Query: "query Late { a }"})
+	s.WriteOperation(&GraphQLOperation{Type: Query, Name: "Late"})
+	if err := s.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+
+	lines := 0
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid record %q: %v", scanner.Text(), err)
+		}
+		if record["operationName"] == "Late" || record["name"] == "Late" {
+			t.Errorf("record written after Close: %s", scanner.Text())
+		}
+		lines++
+	}
+	if lines < 10 {
+		t.Errorf("got %d records, want at least the 10 written before Close", lines)
+	}
+}
+
+func TestStdoutStreamTruncatesOnRuneBoundary(t *testing.T) {
+	var out bytes.Buffer
+	s := newStream(&out, nil, true, 11, nil)
+	// The cap falls inside the two bytes of "é"
+	s.Write(GraphQLCapture{OperationName: "Greeting", Response: map[string]interface{}{"name": "héllo"}})
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	var record struct {
+		Response          string `json:"response"`
+		ResponseTruncated bool   `json:"responseTruncated"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("invalid record %q: %v", out.String(), err)
+	}
+	if want := `{"name":"h`; record.Response != want || !record.ResponseTruncated {
+		t.Errorf("response = %q truncated %v, want %q truncated", record.Response, record.ResponseTruncated, want)
+	}
+}
+
+func TestWebhookNotifyAfterWait(t *testing.T) {
+	var received int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+	}))
+	defer server.Close()
+
+	notifier := newWebhookNotifier(server.URL, "https://example.com", &Progress{})
+	events := fakeEvents(50)
+	for i := 0; i < 3; i++ {
+		capture := <-events
+		op, err := ParseGraphQLOperation(capture.Query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		notifier.Notify(op, capture.URL)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for capture := range events {
+			if op, err := ParseGraphQLOperation(capture.Query); err == nil {
+				notifier.Notify(op, capture.URL)
+			}
+		}
+	}()
+	notifier.Wait()
+	sent := atomic.LoadInt32(&received)
+	<-done
+
+	// Nothing is sent once Wait returned
+	op, _ := ParseGraphQLOperation("query Late { a }")
+	notifier.Notify(op, "")
+	notifier.Wait()
+	if got := atomic.LoadInt32(&received); got != sent {
+		t.Errorf("webhook received %d notifications after Wait, want none", got-sent)
+	}
+	if sent < 3 {
+		t.Errorf("webhook received %d notifications, want at least the 3 sent before Wait", sent)
+	}
+}
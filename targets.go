@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mafredri/cdp"
+	"github.com/mafredri/cdp/protocol/storage"
+)
+
+// combinedBaseName names the output files that merge every target of a multi-target run
+const combinedBaseName = "graphql_operations_combined"
+
+// targetRun holds what was collected for one target URL
+type targetRun struct {
+	Domain      string
+	BaseName    string
+	Operations  []*GraphQLOperation
+	Captures    []GraphQLCapture
+	Fragments   map[string]*Fragment         // Fragment definitions found in the target's JavaScript
+	JSEndpoints []string                     // GraphQL endpoint URLs referenced in the target's JavaScript
+	Files       []*FileStats                 // What each JavaScript file of the target yielded
+	Archive     *JSArchive                   // Where --save-js keeps the target's bundles, nil when disabled
+	State       *runState                    // What earlier runs found, nil without --resume
+	Schema      map[string]IntrospectionType // Types introspected from the target's endpoints, nil without --probe-introspection
+	OutputDir   string                       // Directory the target's output files are written to
+	Progress    targetProgress               // The target's share of the session's progress counters
+	TimedOut    bool                         // Whether --timeout cut the target's capture short
+	Err         error                        // Why the target could not be captured, if it failed
+}
+
+// newTargetRun prepares the run for a target writing to outputDir, naming its output
+// files after the domain
+func newTargetRun(domain, outputDir string) *targetRun {
+	sanitized := sanitizeDomain(domain)
+	if sanitized == "" {
+		sanitized = "proxy"
+	}
+	return &targetRun{
+		Domain:    domain,
+		BaseName:  fmt.Sprintf("graphql_operations_%s", sanitized),
+		OutputDir: outputDir,
+		Fragments: make(map[string]*Fragment),
+	}
+}
+
+// readTargets reads one target URL per line, skipping blank lines and # comments
+func readTargets(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open domains file: %v", err)
+	}
+	defer file.Close()
+
+	var targets []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		targets = appendUnique(targets, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read domains file: %v", err)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets found in %s", path)
+	}
+
+	return targets, nil
+}
+
+// targetProgress is the part of the session's progress made while one target was
+// being captured
+type targetProgress struct {
+	JSFilesProcessed  int32
+	BytesDownloaded   int64
+	OperationsMatched int32
+	ParseFailures     int32
+}
+
+// progressSnapshot reads the counters a target's progress is measured with
+func progressSnapshot(p *Progress) targetProgress {
+	return targetProgress{
+		JSFilesProcessed:  atomic.LoadInt32(&p.JSFilesProcessed),
+		BytesDownloaded:   atomic.LoadInt64(&p.TotalBytesDownloaded),
+		OperationsMatched: atomic.LoadInt32(&p.OperationsMatched),
+		ParseFailures:     atomic.LoadInt32(&p.ParseFailures),
+	}
+}
+
+// since returns the progress made after an earlier snapshot
+func (t targetProgress) since(before targetProgress) targetProgress {
+	return targetProgress{
+		JSFilesProcessed:  t.JSFilesProcessed - before.JSFilesProcessed,
+		BytesDownloaded:   t.BytesDownloaded - before.BytesDownloaded,
+		OperationsMatched: t.OperationsMatched - before.OperationsMatched,
+		ParseFailures:     t.ParseFailures - before.ParseFailures,
+	}
+}
+
+// clearBrowserState removes cookies, the HTTP cache and the previous target's site
+// storage so the next target starts without a session, for --fresh-session
+func clearBrowserState(ctx context.Context, client *cdp.Client, previous string) error {
+	if err := client.Network.ClearBrowserCookies(ctx); err != nil {
+		return fmt.Errorf("failed to clear cookies: %v", err)
+	}
+	if err := client.Network.ClearBrowserCache(ctx); err != nil {
+		return fmt.Errorf("failed to clear cache: %v", err)
+	}
+	if parsed, err := url.Parse(previous); err == nil && parsed.Host != "" {
+		origin := parsed.Scheme + "://" + parsed.Host
+		if err := client.Storage.ClearDataForOrigin(ctx, storage.NewClearDataForOriginArgs(origin, "all")); err != nil {
+			return fmt.Errorf("failed to clear storage for %s: %v", origin, err)
+		}
+	}
+	return nil
+}
+
+// reportTargets logs a per-target summary of a multi-target run, then the targets
+// that yielded no operations at all
+func reportTargets(runs []*targetRun) {
+	var empty []string
+	for _, run := range runs {
+		if run.Err != nil {
+			slog.Error("Target failed", "url", run.Domain, "error", run.Err)
+			continue
+		}
+		unique := len(DeduplicateOperations(run.Operations))
+		slog.Info("Target results", "url", run.Domain,
+			"uniqueOperations", unique, "captures", len(run.Captures),
+			"jsProcessed", run.Progress.JSFilesProcessed, "bytesDownloaded", run.Progress.BytesDownloaded,
+			"operationsMatched", run.Progress.OperationsMatched, "parseFailures", run.Progress.ParseFailures,
+			"dir", run.OutputDir)
+		if unique == 0 {
+			empty = append(empty, run.Domain)
+		}
+	}
+	if len(empty) > 0 {
+		slog.Warn("Targets without operations", "count", len(empty), "targets", strings.Join(empty, ", "))
+	}
+}
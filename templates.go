@@ -0,0 +1,259 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	gqlast "github.com/vektah/gqlparser/v2/ast"
+)
+
+var (
+	// gql and graphql template tags, including bundler forms such as (0,r.gql)`...`
+	templateTagPattern = regexp.MustCompile(`(?:\b(?:gql|graphql)|\(0,\s*[\w$]+\.(?:gql|graphql)\))\s*` + "`")
+	// Identifier a template is assigned to, read from the text just before the tag
+	templateAssignPattern = regexp.MustCompile(`([A-Za-z_$][\w$]*)\s*=\s*$`)
+	// Interpolations that name a variable, the only kind that can be substituted
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_$][\w$]*$`)
+	// References to interpolationPlaceholder in printed GraphQL
+	placeholderPattern = regexp.MustCompile(`\$_interp\b`)
+)
+
+// interpolationPlaceholder stands in for an interpolation in value position, such as
+// user(id: ${id}), so the query still parses. Being a variable reference, it reads the
+// same for every interpolated value and operations differing only there deduplicate.
+// Operations using it declare it with the JSON type, as the value's type is unknown.
+const (
+	interpolationPlaceholder     = "$_interp"
+	interpolationPlaceholderType = "JSON"
+)
+
+// gqlTemplate is a tagged template literal split around its ${...} interpolations
+type gqlTemplate struct {
+	Variable    string   // Identifier the template was assigned to, if any
+	Offset      int      // Byte offset of the tag in the scanned content
+	End         int      // Byte offset just past the closing backtick
+	Parts       []string // Literal text, one more than there are expressions
+	Expressions []string
+}
+
+// scanGQLTemplates finds every gql/graphql tagged template literal in content
+func scanGQLTemplates(content string) []gqlTemplate {
+	var templates []gqlTemplate
+	for _, loc := range templateTagPattern.FindAllStringIndex(content, -1) {
+		parts, expressions, end, ok := scanTemplateLiteral(content, loc[1])
+		if !ok {
+			continue
+		}
+		template := gqlTemplate{Parts: parts, Expressions: expressions, Offset: loc[0], End: end}
+		before := content[max(0, loc[0]-100):loc[0]]
+		if m := templateAssignPattern.FindStringSubmatch(before); m != nil {
+			template.Variable = m[1]
+		}
+		templates = append(templates, template)
+	}
+	return templates
+}
+
+// scanTemplateLiteral reads a template literal whose text starts at start, just past
+// the opening backtick. It tracks brace nesting inside ${...}, skipping strings and
+// nested template literals, and returns the index just past the closing backtick.
+func scanTemplateLiteral(content string, start int) (parts, expressions []string, end int, ok bool) {
+	var text strings.Builder
+	for i := start; i < len(content); i++ {
+		switch c := content[i]; {
+		case c == '\\' && i+1 < len(content):
+			// Decode escapes the way JavaScript would for the cooked string
+			switch next := content[i+1]; next {
+			case 'n':
+				text.WriteByte('\n')
+			case 't':
+				text.WriteByte('\t')
+			case 'r':
+				text.WriteByte('\r')
+			default:
+				text.WriteByte(next)
+			}
+			i++
+		case c == '`':
+			return append(parts, text.String()), expressions, i + 1, true
+		case c == '$' && i+1 < len(content) && content[i+1] == '{':
+			exprEnd, ok := scanInterpolation(content, i+2)
+			if !ok {
+				return nil, nil, 0, false
+			}
+			parts = append(parts, text.String())
+			text.Reset()
+			expressions = append(expressions, strings.TrimSpace(content[i+2:exprEnd]))
+			i = exprEnd
+		default:
+			text.WriteByte(c)
+		}
+	}
+	return nil, nil, 0, false
+}
+
+// scanInterpolation returns the index of the brace closing a ${ expression that starts
+// at start
+func scanInterpolation(content string, start int) (int, bool) {
+	depth := 1
+	for i := start; i < len(content); i++ {
+		switch content[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i, true
+			}
+		case '"', '\'':
+			i = skipJSString(content, i)
+		case '`':
+			_, _, end, ok := scanTemplateLiteral(content, i+1)
+			if !ok {
+				return 0, false
+			}
+			i = end - 1
+		}
+	}
+	return 0, false
+}
+
+// skipJSString returns the index of the quote closing the string literal at start
+func skipJSString(content string, start int) int {
+	quote := content[start]
+	for i := start + 1; i < len(content); i++ {
+		switch content[i] {
+		case '\\':
+			i++
+		case quote, '\n':
+			return i
+		}
+	}
+	return len(content)
+}
+
+// resolveTemplates joins each template's text, substituting interpolations that name
+// an earlier template defining fragments in the same file. Other interpolations are
+// replaced by interpolationPlaceholder where a value is expected and removed elsewhere,
+// and returned as the template's unresolved dependencies.
+func resolveTemplates(templates []gqlTemplate) (texts []string, unresolved [][]string) {
+	fragmentTexts := make(map[string]string)
+	for _, template := range templates {
+		var text strings.Builder
+		var missing []string
+		for i, part := range template.Parts {
+			text.WriteString(part)
+			if i == len(template.Expressions) {
+				break
+			}
+			expr := template.Expressions[i]
+			if substitute, ok := fragmentTexts[expr]; ok && identifierPattern.MatchString(expr) {
+				text.WriteString("\n" + substitute + "\n")
+			} else {
+				if inValuePosition(text.String()) {
+					text.WriteString(interpolationPlaceholder)
+				}
+				missing = appendUnique(missing, expr)
+			}
+		}
+
+		resolved := text.String()
+		if template.Variable != "" && fragmentDefinitionPattern.MatchString(resolved) {
+			fragmentTexts[template.Variable] = resolved
+		}
+		texts = append(texts, resolved)
+		unresolved = append(unresolved, missing)
+	}
+	return texts, unresolved
+}
+
+// inValuePosition reports whether GraphQL text ending in text expects a value next: an
+// argument or object field value or a list item. Variable defaults must be constant, so
+// they get no placeholder.
+func inValuePosition(text string) bool {
+	text = strings.TrimRight(text, " \t\r\n")
+	if text == "" {
+		return false
+	}
+	switch text[len(text)-1] {
+	case ':', '[':
+		return true
+	case ',':
+		// A comma separates list items only inside brackets
+		return strings.LastIndex(text, "[") > strings.LastIndexAny(text, "]{}(")
+	}
+	return false
+}
+
+// extractTemplateOperations extracts the operations in gql tagged templates, which the
+// plain patterns miss or keep unparsed when interpolations sit inside the literal. Each
+// operation keeps the fragments defined in its template so resolveFragments can inline
+// them later. The spans of the templates it extracted from are returned so the plain
+// copies can be dropped.
+func extractTemplateOperations(content string) ([]*GraphQLOperation, [][2]int) {
+	templates := scanGQLTemplates(content)
+	texts, unresolved := resolveTemplates(templates)
+
+	var operations []*GraphQLOperation
+	var spans [][2]int
+	for i, text := range texts {
+		if len(templates[i].Expressions) == 0 {
+			// Uninterpolated templates are already matched by the plain patterns
+			continue
+		}
+		doc, err := parseGraphQLDocument(text)
+		if err != nil {
+			continue
+		}
+		spans = append(spans, [2]int{templates[i].Offset, templates[i].End})
+
+		for _, def := range doc.Operations {
+			declarePlaceholder(def, doc.Fragments)
+			printed := printOperation(def)
+			if !strings.HasPrefix(printed, string(def.Operation)) {
+				printed = string(def.Operation) + " " + printed
+			}
+			op, err := ParseGraphQLOperation(printed)
+			if err != nil {
+				continue
+			}
+			if len(doc.Fragments) > 0 && strings.Contains(printed, "...") {
+				op.Raw = printDocument(&gqlast.QueryDocument{
+					Operations: gqlast.OperationList{def},
+					Fragments:  doc.Fragments,
+				})
+			}
+			op.UnresolvedInterpolations = unresolved[i]
+			op.Offset = templates[i].Offset
+			operations = append(operations, op)
+		}
+	}
+	return operations, spans
+}
+
+// declarePlaceholder adds interpolationPlaceholder to the variables of an operation that
+// uses it, directly or in a fragment it spreads, so the operation validates
+func declarePlaceholder(def *gqlast.OperationDefinition, fragments gqlast.FragmentDefinitionList) {
+	name := strings.TrimPrefix(interpolationPlaceholder, "$")
+	if def.VariableDefinitions.ForName(name) != nil {
+		return
+	}
+	text := printSelectionSet(def.SelectionSet)
+	for _, fragment := range usedFragments(def.SelectionSet, fragments) {
+		text += printFragment(fragment)
+	}
+	if !placeholderPattern.MatchString(text) {
+		return
+	}
+	def.VariableDefinitions = append(def.VariableDefinitions, &gqlast.VariableDefinition{
+		Variable: name,
+		Type:     gqlast.NamedType(interpolationPlaceholderType, nil),
+	})
+}
+
+// templateTexts returns the resolved text of every gql template in content, for
+// fragment extraction
+func templateTexts(content string) []string {
+	texts, _ := resolveTemplates(scanGQLTemplates(content))
+	return texts
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScanTemplateLiteral(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string // Starts just past the opening backtick
+		parts       []string
+		expressions []string
+		rest        string // What follows the closing backtick
+		ok          bool
+	}{
+		{"plain", "query A { a }`;x", []string{"query A { a }"}, nil, ";x", true},
+		{"escapes", "a\\n\\tb\\`c`", []string{"a\n\tb`c"}, nil, "", true},
+		{"interpolations", "${F} query A { ...F user(id: ${ id }) }`", []string{"", " query A { ...F user(id: ", ") }"}, []string{"F", "id"}, "", true},
+		{"braces in an interpolation", "a ${fn({x: 1})} b`", []string{"a ", " b"}, []string{"fn({x: 1})"}, "", true},
+		{"strings in an interpolation", "a ${\"}\" + '`'} b`", []string{"a ", " b"}, []string{"\"}\" + '`'"}, "", true},
+		{"nested template", "a ${cond ? `x ${y}` : ''} b`;", []string{"a ", " b"}, []string{"cond ? `x ${y}` : ''"}, ";", true},
+		{"unterminated", "query A { a }", nil, nil, "", false},
+		{"unterminated interpolation", "a ${b`", nil, nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, expressions, end, ok := scanTemplateLiteral(tt.content, 0)
+			if ok != tt.ok || !reflect.DeepEqual(parts, tt.parts) || !reflect.DeepEqual(expressions, tt.expressions) {
+				t.Fatalf("scanTemplateLiteral = %q, %q, %v; want %q, %q, %v", parts, expressions, ok, tt.parts, tt.expressions, tt.ok)
+			}
+			if ok && tt.content[end:] != tt.rest {
+				t.Errorf("rest = %q, want %q", tt.content[end:], tt.rest)
+			}
+		})
+	}
+}
+
+func TestResolveTemplates(t *testing.T) {
+	content := "const UserFields = gql`fragment UserFields on User { id name }`;\n" +
+		"const GetUser = gql`${UserFields} query GetUser { user { ...UserFields } }`;\n" +
+		"const Feed = gql`query Feed { feed(first: ${pageSize}) { ...ItemFields } } ${ItemFields}`;\n" +
+		"const Later = gql`${Defined.later} query Later { a }`;\n"
+	templates := scanGQLTemplates(content)
+	if len(templates) != 4 {
+		t.Fatalf("found %d templates, want 4", len(templates))
+	}
+	if templates[0].Variable != "UserFields" || templates[1].Variable != "GetUser" {
+		t.Errorf("variables = %q, %q; want UserFields, GetUser", templates[0].Variable, templates[1].Variable)
+	}
+
+	texts, unresolved := resolveTemplates(templates)
+	want := []string{
+		"fragment UserFields on User { id name }",
+		"\nfragment UserFields on User { id name }\n query GetUser { user { ...UserFields } }",
+		"query Feed { feed(first: $_interp) { ...ItemFields } } ",
+		" query Later { a }",
+	}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("texts = %q, want %q", texts, want)
+	}
+	wantUnresolved := [][]string{nil, nil, {"pageSize", "ItemFields"}, {"Defined.later"}}
+	if !reflect.DeepEqual(unresolved, wantUnresolved) {
+		t.Errorf("unresolved = %q, want %q", unresolved, wantUnresolved)
+	}
+}
+
+func TestInValuePosition(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want bool
+	}{
+		{"argument value", "query A { user(id: ", true},
+		{"object field value", "query A { search(filter: { name: ", true},
+		{"first list item", "query A { users(ids: [", true},
+		{"later list item", "query A { users(ids: [1, ", true},
+		{"argument after a list", "query A { users(ids: [1], ", false},
+		{"argument after a comma", "query A { user(id: 1, ", false},
+		{"selection-set field", "query A { user { ", false},
+		{"field after a field", "query A { id\n", false},
+		{"fragment spread", "query A { user { ...", false},
+		{"variable default", "query A($id: ID = ", false},
+		{"empty", "  ", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inValuePosition(tt.text); got != tt.want {
+				t.Errorf("inValuePosition(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractTemplateOperationsDeclaresPlaceholder(t *testing.T) {
+	content := "const ItemFields = gql`fragment ItemFields on Item { id owner(id: ${ownerId}) { id } }`;\n" +
+		"const A = gql`query User { user(id: ${id}) { name } }`;\n" +
+		"const B = gql`query Items { items { ...ItemFields } } ${ItemFields}`;\n" +
+		"const C = gql`query Named($first: Int) { feed(first: $first) { id } ${extra} }`;\n"
+	operations, _ := extractTemplateOperations(content)
+
+	declares := make(map[string]bool)
+	for _, op := range operations {
+		doc, err := parseGraphQLDocument(op.Raw)
+		if err != nil {
+			t.Fatalf("%s: %v", op.Name, err)
+		}
+		declares[op.Name] = doc.Operations[0].VariableDefinitions.ForName("_interp") != nil
+	}
+	want := map[string]bool{"User": true, "Items": true, "Named": false}
+	if !reflect.DeepEqual(declares, want) {
+		t.Errorf("declares $_interp = %v, want %v", declares, want)
+	}
+}
@@ -0,0 +1,8 @@
+(window.webpackJsonp=window.webpackJsonp||[]).push([["app"],{"0a1b":function(e,t,n){"use strict";n.r(t);var r=n("2b0e"),o=n("8c4f");r.a.use(o.a);var a={name:"UserProfile",props:{id:{type:String,required:!0}},data:function(){return{user:null,loading:!1}},apollo:{user:{query:"query GetUser($id"+":ID!){user(id:$id){"+"id name email avatarUrl}}",variables:function(){return{id:this.id}}}},methods:{save:function(){return this.$apollo.mutate({mutation:'mutation UpdateUser($id:ID!,$input:UserInput!)'.concat('{updateUser(id:$id,input:$input)','{id name}}'),variables:{id:this.id,input:this.form}})}}};
+var i=["query ListOrders($first:Int=20,$after:String)","{orders(first:$first,after:$after){edges{node{id total status}}pageInfo{endCursor hasNextPage}}}"].join(""),s="subscription OnOrderUpdated($id"+':ID!){orderUpdated(id:$id){id status}}';
+var c={render:function(){var e=this,t=e.$createElement,n=e._self._c||t;return n("div",{staticClass:"orders"},[e._v("Orders")])},staticRenderFns:[]};
+t.default={components:{UserProfile:a},data:function(){return{q:"query SearchProducts($term:String!)"+"{search(term:$term){"+"... on Product{id title price}}}"}},computed:{label:function(){return"Showing "+this.count+" results"}}};
+var l="fragment CartItemFields on CartItem"+"{id quantity product{id title}}",u="query GetCart"+"{cart{items{...CartItemFields}}}";
+var d="mutation AddToCart($productId:ID!)";d+="{addToCart(productId:$productId){id}}";
+var f="query NotJoined($a:ID!)",p=["{b}","c"].join(",");
+}}]);
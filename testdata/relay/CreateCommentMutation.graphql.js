@@ -0,0 +1,50 @@
+/**
+ * @generated SignedSource<<3b6f1e0c2a9d8e7f6a5b4c3d2e1f0a9b>>
+ * @flow
+ * @lightSyntaxTransform
+ * @nogrep
+ */
+
+/* eslint-disable */
+
+'use strict';
+
+var node = (function(){
+var v0 = [
+  {
+    "defaultValue": null,
+    "kind": "LocalArgument",
+    "name": "input"
+  }
+];
+return {
+  "fragment": {
+    "argumentDefinitions": (v0/*: any*/),
+    "kind": "Fragment",
+    "metadata": null,
+    "name": "CreateCommentMutation",
+    "selections": [],
+    "type": "Mutation",
+    "abstractKey": null
+  },
+  "kind": "Request",
+  "operation": {
+    "argumentDefinitions": (v0/*: any*/),
+    "kind": "Operation",
+    "name": "CreateCommentMutation",
+    "selections": []
+  },
+  "params": {
+    "cacheID": "8d4c2b1a0f9e8d7c6b5a4f3e2d1c0b9a",
+    "id": null,
+    "metadata": {},
+    "name": "CreateCommentMutation",
+    "operationKind": "mutation",
+    "text": "mutation CreateCommentMutation(\n  $input: CreateCommentInput!\n) {\n  createComment(input: $input) {\n    comment {\n      id\n      body\n    }\n  }\n}\n"
+  }
+};
+})();
+
+node.hash = "d41d8cd98f00b204e9800998ecf8427e";
+
+module.exports = node;
@@ -0,0 +1 @@
+(self.webpackChunkapp=self.webpackChunkapp||[]).push([[179],{4821:function(e,n,a){"use strict";a.r(n);var l=function(){var e=[{defaultValue:null,kind:"LocalArgument",name:"id"}],n=[{kind:"Variable",name:"id",variableName:"id"}],a={alias:null,args:null,kind:"ScalarField",name:"id",storageKey:null};return{fragment:{argumentDefinitions:e,kind:"Fragment",metadata:null,name:"UserProfileQuery",selections:[{alias:null,args:n,concreteType:"User",kind:"LinkedField",name:"user",plural:!1,selections:[{args:null,kind:"FragmentSpread",name:"UserProfile_user"}],storageKey:null}],type:"Query",abstractKey:null},kind:"Request",operation:{argumentDefinitions:e,kind:"Operation",name:"UserProfileQuery",selections:[{alias:null,args:n,concreteType:"User",kind:"LinkedField",name:"user",plural:!1,selections:[a],storageKey:null}]},params:{cacheID:"5c0e2f5a1d0b8f2f2b3c4d5e6f708192",id:null,metadata:{},name:"UserProfileQuery",operationKind:"query",text:"query UserProfileQuery(\n  $id: ID!\n) {\n  user(id: $id) {\n    ...UserProfile_user\n    id\n  }\n}\n\nfragment UserProfile_user on User {\n  name\n  avatar(size: 64) {\n    uri\n  }\n}\n"}}}();l.hash="0f4b2c1ad3e5";var o=function(){return{fragment:{kind:"Fragment",name:"FriendsListPaginationQuery"},kind:"Request",operation:{kind:"Operation",name:"FriendsListPaginationQuery"},params:{cacheID:"a1b2c3d4e5f60718293a4b5c6d7e8f90",id:null,metadata:{connection:[{count:"first",cursor:"after",direction:"forward",path:["viewer","friends"]}],derivedFrom:"FriendsList_viewer",refetch:{connection:{forward:{count:"first",cursor:"after"},backward:null,path:["viewer","friends"]},fragmentPathInResult:["viewer"],operation:{}}},name:"FriendsListPaginationQuery",operationKind:"query",text:"query FriendsListPaginationQuery(\n  $after: String\n  $first: Int = 10\n) {\n  viewer {\n    friends(first: $first, after: $after, orderBy: \"name}\") {\n      edges {\n        node {\n          id\n          name\n        }\n      }\n    }\n    id\n  }\n}\n"}}}();o.hash="77aa9c";var t={kind:"Fragment",name:"UserProfile_user",selections:[{kind:"ScalarField",name:"name"}],type:"User"}}}]);
@@ -0,0 +1 @@
+"use strict";(self.webpackChunkapp=self.webpackChunkapp||[]).push([[412],{9930:function(e){e.exports={fragment:{kind:"Fragment",name:"FeedQuery"},kind:"Request",operation:{kind:"Operation",name:"FeedQuery"},params:{id:"3a5f7c9e1b2d4f6a8c0e2a4c6e8a0c2e",metadata:{},name:"FeedQuery",operationKind:"query",text:null}}},9931:function(e){e.exports={kind:"Request",params:{cacheID:"e9c1b7a5",id:null,metadata:{},name:"OnMessageSubscription",operationKind:"subscription",text:null}}},9932:function(e){e.exports={kind:"Request",params:{id:"",metadata:{},name:"NoReferenceQuery",operationKind:"query",text:null}}},9933:function(e){e.exports={kind:"Fragment",params:{name:"NotAnOperation",operationKind:"fragment",text:null}}}}]);
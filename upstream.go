@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// parseUpstreamProxy reads --upstream-proxy: an http, https, socks5 or socks5h URL, or a
+// bare host:port taken as an HTTP proxy
+func parseUpstreamProxy(raw string) (*url.URL, error) {
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	proxyURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream proxy: %v", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid upstream proxy %q: expected an http, https, socks5 or socks5h URL", raw)
+	}
+	if proxyURL.Hostname() == "" || proxyURL.Port() == "" {
+		return nil, fmt.Errorf("invalid upstream proxy %q: expected host:port", raw)
+	}
+	return proxyURL, nil
+}
+
+// noProxyHosts returns the entries of NO_PROXY (or no_proxy), always including the
+// loopback hosts, which the local Selenium and DevTools endpoints live on. Wildcard
+// domains such as *.example.com are reduced to the .example.com form.
+func noProxyHosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	value := os.Getenv("NO_PROXY")
+	if value == "" {
+		value = os.Getenv("no_proxy")
+	}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if strings.HasPrefix(entry, "*.") {
+			entry = entry[1:]
+		}
+		if entry != "" {
+			hosts = append(hosts, entry)
+		}
+	}
+	return hosts
+}
+
+// bypassesProxy reports whether host matches a NO_PROXY entry: "*" matches everything,
+// a domain matches itself and its subdomains, and an IP or CIDR range matches addresses
+func bypassesProxy(host string, noProxy []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	ip := net.ParseIP(host)
+	for _, entry := range noProxy {
+		if entry == "*" {
+			return true
+		}
+		if ip != nil {
+			if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(ip) {
+				return true
+			}
+		}
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		domain := strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// upstreamProxyFunc routes requests through proxyURL unless their host is in NO_PROXY,
+// for use as http.Transport.Proxy
+func upstreamProxyFunc(proxyURL *url.URL) func(*http.Request) (*url.URL, error) {
+	noProxy := noProxyHosts()
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassesProxy(req.URL.Hostname(), noProxy) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}
+}
+
+// chromeProxyArgs returns the Chrome flags sending the browser's traffic through
+// proxyURL. Chrome resolves names through SOCKS proxies itself and takes no credentials
+// on the command line, so the URL is reduced to scheme, host and port.
+func chromeProxyArgs(proxyURL *url.URL) []string {
+	scheme := proxyURL.Scheme
+	if scheme == "socks5h" {
+		scheme = "socks5"
+	}
+	var bypass []string
+	for _, host := range noProxyHosts() {
+		if host == "*" {
+			return nil
+		}
+		if strings.HasPrefix(host, ".") {
+			bypass = append(bypass, "*"+host)
+			continue
+		}
+		switch ip := net.ParseIP(host); {
+		case ip != nil && ip.To4() == nil:
+			bypass = append(bypass, "["+host+"]")
+		case ip != nil || strings.Contains(host, "/"):
+			bypass = append(bypass, host)
+		default:
+			bypass = append(bypass, host, "*."+host)
+		}
+	}
+	return []string{
+		"--proxy-server=" + scheme + "://" + proxyURL.Host,
+		"--proxy-bypass-list=" + strings.Join(bypass, ";"),
+	}
+}
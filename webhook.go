@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	webhookTimeout     = 5 * time.Second
+	webhookRetries     = 3
+	webhookMaxInFlight = 8
+)
+
+// WebhookPayload is the JSON body posted for each newly discovered operation
+type WebhookPayload struct {
+	Domain    string        `json:"domain"`
+	Type      OperationType `json:"type"`
+	Name      string        `json:"name"`
+	Query     string        `json:"query"`
+	Source    string        `json:"source"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// WebhookNotifier posts operations to a webhook the first time they are seen. Delivery
+// happens in the background with a bounded number of requests in flight, so a slow
+// webhook drops notifications rather than stalling capture.
+type WebhookNotifier struct {
+	url      string
+	domain   string
+	client   *http.Client
+	progress *Progress
+	seen     map[string]bool
+	mu       sync.Mutex
+	closed   bool // Set by Wait; later notifications are dropped
+	slots    chan struct{}
+	wg       sync.WaitGroup
+}
+
+// newWebhookNotifier creates a notifier posting to url
+func newWebhookNotifier(url, domain string, progress *Progress) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:      url,
+		domain:   domain,
+		client:   &http.Client{Timeout: webhookTimeout},
+		progress: progress,
+		seen:     make(map[string]bool),
+		slots:    make(chan struct{}, webhookMaxInFlight),
+	}
+}
+
+// Notify sends op to the webhook if its normalized key has not been seen before
+func (w *WebhookNotifier) Notify(op *GraphQLOperation, source string) {
+	key := createOperationKey(op)
+	w.mu.Lock()
+	if w.closed || w.seen[key] {
+		w.mu.Unlock()
+		return
+	}
+	domain := w.domain
+	select {
+	case w.slots <- struct{}{}:
+	default:
+		// Not marked seen, so the operation is sent if it is found again
+		w.mu.Unlock()
+		atomic.AddInt32(&w.progress.WebhookFailures, 1)
+		slog.Warn("Webhook busy, dropped notification", "type", op.Type, "name", op.Name)
+		return
+	}
+	w.seen[key] = true
+	// Added under the lock so Wait never races a notification it does not wait for
+	w.wg.Add(1)
+	w.mu.Unlock()
+
+	payload := WebhookPayload{
+		Domain:    domain,
+		Type:      op.Type,
+		Name:      op.Name,
+		Query:     op.Raw,
+		Source:    source,
+		Timestamp: time.Now(),
+	}
+	go func() {
+		defer w.wg.Done()
+		defer func() { <-w.slots }()
+
+		if err := w.send(payload); err != nil {
+			atomic.AddInt32(&w.progress.WebhookFailures, 1)
+			slog.Warn("Webhook notification failed", "type", payload.Type, "name", payload.Name, "error", err)
+		}
+	}()
+}
+
+// SetDomain changes the domain reported for later notifications, e.g. when moving on
+// to the next target
+func (w *WebhookNotifier) SetDomain(domain string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.domain = domain
+}
+
+// Wait stops accepting notifications and blocks until in-flight ones finish
+func (w *WebhookNotifier) Wait() {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	w.wg.Wait()
+}
+
+// send posts a payload, retrying with exponential backoff on network errors and
+// server-side failures
+func (w *WebhookNotifier) send(payload WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %v", err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= webhookRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(1<<(attempt-1)) * time.Second)
+		}
+
+		resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("webhook returned HTTP %d", resp.StatusCode)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return lastErr
+		}
+	}
+
+	return lastErr
+}
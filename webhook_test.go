@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestWebhookNotifierRetriesDroppedOperations(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload WebhookPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		received = append(received, payload.Name)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	progress := &Progress{}
+	notifier := newWebhookNotifier(server.URL, "https://example.com", progress)
+	op := &GraphQLOperation{Type: Query, Name: "GetUser", Raw: "query GetUser { user { id } }"}
+
+	// Every slot is taken, so the notification is dropped
+	for i := 0; i < webhookMaxInFlight; i++ {
+		notifier.slots <- struct{}{}
+	}
+	notifier.Notify(op, "app.js")
+	if progress.WebhookFailures != 1 {
+		t.Errorf("WebhookFailures = %d, want 1", progress.WebhookFailures)
+	}
+
+	// Found again once the webhook has room, it is sent, and only once
+	for i := 0; i < webhookMaxInFlight; i++ {
+		<-notifier.slots
+	}
+	notifier.Notify(op, "app.js")
+	notifier.Notify(op, "other.js")
+	notifier.Wait()
+	if want := []string{"GetUser"}; !reflect.DeepEqual(received, want) {
+		t.Errorf("received %v, want %v", received, want)
+	}
+}